@@ -0,0 +1,140 @@
+package batch
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Output is a file or text produced by an output node of a variant
+type Output struct {
+	NodeID    string `json:"node_id"`
+	Kind      string `json:"kind"` // the output's key, e.g. "images"
+	Filename  string `json:"filename,omitempty"`
+	Subfolder string `json:"subfolder,omitempty"`
+	Type      string `json:"type,omitempty"`
+	Text      string `json:"text,omitempty"`
+	// Path is where the output was saved, when the runner has an OutputDir
+	Path string `json:"path,omitempty"`
+}
+
+// Result is the outcome of running a variant
+type Result struct {
+	Variant  int                    `json:"variant"`
+	Params   map[string]interface{} `json:"params"`
+	PromptID string                 `json:"prompt_id,omitempty"`
+	Server   string                 `json:"server,omitempty"`
+	Attempts int                    `json:"attempts"`
+	Outputs  []Output               `json:"outputs"`
+	Started  time.Time              `json:"started"`
+	Finished time.Time              `json:"finished"`
+	// Seconds is the time taken by the last attempt
+	Seconds float64 `json:"seconds"`
+	Error   string  `json:"error,omitempty"`
+}
+
+// Manifest records results as the variants finish
+type Manifest interface {
+	Write(r *Result) error
+	Flush() error
+}
+
+// JSONLManifest writes each result as a line of JSON
+type JSONLManifest struct {
+	enc *json.Encoder
+}
+
+// NewJSONLManifest creates a manifest that writes JSON lines to w
+func NewJSONLManifest(w io.Writer) *JSONLManifest {
+	return &JSONLManifest{enc: json.NewEncoder(w)}
+}
+
+func (m *JSONLManifest) Write(r *Result) error {
+	return m.enc.Encode(r)
+}
+
+func (m *JSONLManifest) Flush() error {
+	return nil
+}
+
+// CSVManifest writes each result as a row, with a column for each parameter.  Output
+// files are joined with ';'.
+type CSVManifest struct {
+	w           *csv.Writer
+	paths       []string
+	wroteHeader bool
+}
+
+// NewCSVManifest creates a manifest that writes CSV to w, with a column for each of
+// the sweep's parameter paths
+func NewCSVManifest(w io.Writer, s *Sweep) *CSVManifest {
+	retv := &CSVManifest{w: csv.NewWriter(w), paths: make([]string, len(s.Params))}
+	for i, p := range s.Params {
+		retv.paths[i] = p.Path
+	}
+	return retv
+}
+
+func (m *CSVManifest) Write(r *Result) error {
+	if !m.wroteHeader {
+		header := append([]string{"variant"}, m.paths...)
+		header = append(header, "prompt_id", "server", "attempts", "outputs", "started", "finished", "seconds", "error")
+		if err := m.w.Write(header); err != nil {
+			return err
+		}
+		m.wroteHeader = true
+	}
+
+	row := []string{strconv.Itoa(r.Variant)}
+	for _, p := range m.paths {
+		row = append(row, csvValue(r.Params[p]))
+	}
+	outputs := make([]string, 0, len(r.Outputs))
+	for _, o := range r.Outputs {
+		switch {
+		case o.Path != "":
+			outputs = append(outputs, o.Path)
+		case o.Filename != "":
+			outputs = append(outputs, o.Filename)
+		default:
+			outputs = append(outputs, o.Text)
+		}
+	}
+	row = append(row,
+		r.PromptID,
+		r.Server,
+		strconv.Itoa(r.Attempts),
+		strings.Join(outputs, ";"),
+		r.Started.Format(time.RFC3339Nano),
+		r.Finished.Format(time.RFC3339Nano),
+		strconv.FormatFloat(r.Seconds, 'f', 3, 64),
+		r.Error,
+	)
+	if err := m.w.Write(row); err != nil {
+		return err
+	}
+	// flush each row so the manifest is usable while the batch runs
+	m.w.Flush()
+	return m.w.Error()
+}
+
+func (m *CSVManifest) Flush() error {
+	m.w.Flush()
+	return m.w.Error()
+}
+
+func csvValue(v interface{}) string {
+	switch value := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,248 @@
+package batch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/richinsley/comfy2go/client"
+	"github.com/richinsley/comfy2go/graphapi"
+)
+
+// Runner queues the variants of a sweep across a pool of clients.  A ComfyClient does
+// not separate the messages of prompts queued concurrently, so each client runs one
+// variant at a time.
+type Runner struct {
+	Clients []*client.ComfyClient
+	// Concurrency limits the number of variants running at once.  It defaults to, and
+	// cannot exceed, the number of clients.
+	Concurrency int
+	// Retries is how many more times a failed variant is run.  Variants whose values
+	// are invalid, or whose prompt the server rejects, are not retried.
+	Retries int
+	// RetryDelay is the wait before a failed variant is run again
+	RetryDelay time.Duration
+	// OutputDir is where output files are saved when set, named after their variant
+	OutputDir string
+	// Manifest records each result as its variant finishes
+	Manifest Manifest
+	// OnResult is called as each variant finishes
+	OnResult func(r *Result)
+
+	mu sync.Mutex
+}
+
+// Run runs every variant on a graph created from the base graph, blocking until they
+// have all finished.  The results are in the order of the variants.  Failed variants
+// are recorded in their results, the error is only for failures of the manifest.
+// Cancelling the context stops variants from being started.
+func (r *Runner) Run(ctx context.Context, base *graphapi.Graph, variants []Variant) ([]*Result, error) {
+	if len(r.Clients) == 0 {
+		return nil, errors.New("runner has no clients")
+	}
+	// each variant runs on a fresh graph
+	workflow, err := base.GraphToJSON()
+	if err != nil {
+		return nil, err
+	}
+	if r.OutputDir != "" {
+		if err := os.MkdirAll(r.OutputDir, 0755); err != nil {
+			return nil, err
+		}
+	}
+
+	workers := r.Concurrency
+	if workers <= 0 || workers > len(r.Clients) {
+		workers = len(r.Clients)
+	}
+
+	results := make([]*Result, len(variants))
+	queue := make(chan int)
+	var manifestErr error
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(c *client.ComfyClient) {
+			defer wg.Done()
+			for index := range queue {
+				res := r.runVariant(ctx, c, workflow, &variants[index])
+				results[index] = res
+				if err := r.record(res); err != nil {
+					r.mu.Lock()
+					if manifestErr == nil {
+						manifestErr = err
+					}
+					r.mu.Unlock()
+				}
+			}
+		}(r.Clients[i])
+	}
+
+loop:
+	for i := range variants {
+		if ctx.Err() != nil {
+			break
+		}
+		select {
+		case queue <- i:
+		case <-ctx.Done():
+			break loop
+		}
+	}
+	close(queue)
+	wg.Wait()
+
+	// variants that were never started
+	for i, res := range results {
+		if res == nil {
+			results[i] = &Result{
+				Variant: variants[i].Index,
+				Params:  variants[i].Params(),
+				Outputs: make([]Output, 0),
+				Error:   ctx.Err().Error(),
+			}
+		}
+	}
+
+	if r.Manifest != nil {
+		if err := r.Manifest.Flush(); err != nil && manifestErr == nil {
+			manifestErr = err
+		}
+	}
+	return results, manifestErr
+}
+
+// record writes a result to the manifest
+func (r *Runner) record(res *Result) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.OnResult != nil {
+		r.OnResult(res)
+	}
+	if r.Manifest != nil {
+		return r.Manifest.Write(res)
+	}
+	return nil
+}
+
+// runVariant runs a variant until it succeeds or runs out of retries
+func (r *Runner) runVariant(ctx context.Context, c *client.ComfyClient, workflow string, v *Variant) *Result {
+	res := &Result{
+		Variant: v.Index,
+		Params:  v.Params(),
+		Server:  c.ServerAddress(),
+	}
+	for {
+		res.Attempts++
+		res.PromptID = ""
+		res.Outputs = make([]Output, 0)
+		res.Started = time.Now()
+		err := r.attempt(c, workflow, v, res)
+		res.Finished = time.Now()
+		res.Seconds = res.Finished.Sub(res.Started).Seconds()
+		if err == nil {
+			res.Error = ""
+			return res
+		}
+		res.Error = err.Error()
+
+		var permanent *permanentError
+		if errors.As(err, &permanent) || res.Attempts > r.Retries || ctx.Err() != nil {
+			return res
+		}
+		slog.Warn("variant failed, retrying", "variant", v.Index, "attempt", res.Attempts, "error", err)
+		select {
+		case <-time.After(r.RetryDelay):
+		case <-ctx.Done():
+			return res
+		}
+	}
+}
+
+// permanentError is a failure that would happen again if the variant was retried
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// attempt runs a variant once
+func (r *Runner) attempt(c *client.ComfyClient, workflow string, v *Variant, res *Result) error {
+	graph, missing, err := c.NewGraphFromJsonString(workflow)
+	if err != nil {
+		if missing != nil && len(*missing) != 0 {
+			return &permanentError{fmt.Errorf("%w: %v", err, *missing)}
+		}
+		return err
+	}
+	if err := v.Apply(graph); err != nil {
+		return &permanentError{err}
+	}
+
+	item, err := c.QueuePromptStrict(graph)
+	if err != nil {
+		var qerr *client.QueuePromptError
+		if errors.As(err, &qerr) {
+			return &permanentError{err}
+		}
+		return err
+	}
+	defer item.Close()
+	res.PromptID = item.PromptID
+
+	var saveErr error
+	var nodeErr error
+	err = item.ProcessMessages(&client.MessageHandlers{
+		OnData: func(msg *client.PromptMessageData) {
+			for kind, outputs := range msg.Data {
+				for _, o := range outputs {
+					out := Output{
+						NodeID:    msg.NodeID,
+						Kind:      kind,
+						Filename:  o.Filename,
+						Subfolder: o.Subfolder,
+						Type:      o.Type,
+						Text:      o.Text,
+					}
+					if r.OutputDir != "" && o.Filename != "" {
+						path, err := r.save(c, v, o)
+						if err != nil {
+							saveErr = err
+						}
+						out.Path = path
+					}
+					res.Outputs = append(res.Outputs, out)
+				}
+			}
+		},
+		OnError: func(e *client.PromptMessageStoppedException) {
+			nodeErr = fmt.Errorf("node %s (%s): %s: %s", e.NodeID, e.NodeType, e.ExceptionType, e.ExceptionMessage)
+		},
+	})
+	if nodeErr != nil {
+		return nodeErr
+	}
+	if err != nil {
+		return err
+	}
+	return saveErr
+}
+
+// save downloads an output file into the output directory
+func (r *Runner) save(c *client.ComfyClient, v *Variant, o client.DataOutput) (string, error) {
+	data, err := c.GetImage(o)
+	if err != nil {
+		return "", fmt.Errorf("downloading %s: %w", o.Filename, err)
+	}
+	path := filepath.Join(r.OutputDir, fmt.Sprintf("variant-%04d_%s", v.Index, filepath.Base(o.Filename)))
+	if err := os.WriteFile(path, *data, 0644); err != nil {
+		return "", err
+	}
+	return path, nil
+}
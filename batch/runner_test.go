@@ -0,0 +1,196 @@
+package batch
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/richinsley/comfy2go/client"
+)
+
+const testObjectInfo = `{
+	"EmptyLatentImage": {
+		"input": {"required": {
+			"width": ["INT", {"default": 512, "min": 16, "max": 4096, "step": 8}],
+			"height": ["INT", {"default": 512, "min": 16, "max": 4096, "step": 8}]
+		}},
+		"output": ["LATENT"], "name": "EmptyLatentImage", "display_name": "Empty Latent Image"
+	},
+	"SaveLatent": {
+		"input": {"required": {"samples": ["LATENT"], "filename_prefix": ["STRING", {"default": "ComfyUI"}]}},
+		"output": [], "name": "SaveLatent", "display_name": "Save Latent", "output_node": true
+	}
+}`
+
+const testWorkflow = `{
+	"nodes": [
+		{"id": 1, "type": "EmptyLatentImage", "title": "Size", "pos": [0, 0], "size": [300, 100], "order": 0, "mode": 0,
+		 "outputs": [{"name": "LATENT", "type": "LATENT", "links": [1]}], "properties": {}, "widgets_values": [512, 512]},
+		{"id": 2, "type": "SaveLatent", "pos": [400, 0], "size": [300, 100], "order": 1, "mode": 0,
+		 "inputs": [{"name": "samples", "type": "LATENT", "link": 1}], "properties": {}, "widgets_values": ["ComfyUI"]}
+	],
+	"links": [[1, 1, 0, 2, 0, "LATENT"]],
+	"groups": [],
+	"last_node_id": 2,
+	"last_link_id": 1,
+	"version": 0.4
+}`
+
+// fakeComfy is a ComfyUI server that fails the prompts whose number is in fail
+type fakeComfy struct {
+	*httptest.Server
+	fail     map[int]bool
+	mu       sync.Mutex
+	prompts  []map[string]interface{}
+	promptCh chan string
+}
+
+func newFakeComfy(t *testing.T, fail ...int) *fakeComfy {
+	f := &fakeComfy{fail: make(map[int]bool), promptCh: make(chan string, 1)}
+	for _, n := range fail {
+		f.fail[n] = true
+	}
+	upgrader := websocket.Upgrader{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/object_info", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, testObjectInfo)
+	})
+	mux.HandleFunc("/prompt", func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		f.mu.Lock()
+		f.prompts = append(f.prompts, body)
+		id := strconv.Itoa(len(f.prompts))
+		f.mu.Unlock()
+		fmt.Fprintf(w, `{"prompt_id": %q, "number": 1, "node_errors": {}}`, id)
+		f.promptCh <- id
+	})
+	mux.HandleFunc("/view", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "latent:"+r.URL.Query().Get("filename"))
+	})
+	mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		id := <-f.promptCh
+		n, _ := strconv.Atoi(id)
+		send := func(msg string) { conn.WriteMessage(websocket.TextMessage, []byte(msg)) }
+		send(fmt.Sprintf(`{"type": "execution_start", "data": {"prompt_id": %q}}`, id))
+		if f.fail[n] {
+			send(fmt.Sprintf(`{"type": "execution_error", "data": {"prompt_id": %q, "node_id": "2", "node_type": "SaveLatent", "exception_message": "out of memory", "exception_type": "RuntimeError", "traceback": []}}`, id))
+		} else {
+			send(fmt.Sprintf(`{"type": "executed", "data": {"node": "2", "output": {"latents": [{"filename": "out_%s.latent", "subfolder": "", "type": "output"}]}, "prompt_id": %q}}`, id, id))
+			send(fmt.Sprintf(`{"type": "executing", "data": {"node": null, "prompt_id": %q}}`, id))
+		}
+		// wait for the client to hang up
+		conn.ReadMessage()
+	})
+	f.Server = httptest.NewServer(mux)
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeComfy) client(t *testing.T) *client.ComfyClient {
+	host, portStr, _ := strings.Cut(strings.TrimPrefix(f.URL, "http://"), ":")
+	port, _ := strconv.Atoi(portStr)
+	c := client.NewComfyClient(host, port, nil)
+	if err := c.Init(); err != nil {
+		t.Fatalf("Failed to initialize client: %v", err)
+	}
+	return c
+}
+
+// TestRunnerRetriesAndManifest tests running a sweep with a failure that is retried, and
+// a variant that is invalid
+func TestRunnerRetriesAndManifest(t *testing.T) {
+	fake := newFakeComfy(t, 1)
+	c := fake.client(t)
+	base, _, err := c.NewGraphFromJsonString(testWorkflow)
+	if err != nil {
+		t.Fatalf("Failed to create graph: %v", err)
+	}
+
+	sweep := &Sweep{Mode: Cartesian, Params: []Param{{Path: "Size.width", Values: []interface{}{768, 1}}}}
+	variants, err := Generate(base, sweep)
+	if err != nil {
+		t.Fatalf("Failed to generate variants: %v", err)
+	}
+
+	var jsonl bytes.Buffer
+	runner := &Runner{
+		Clients:   []*client.ComfyClient{c},
+		Retries:   2,
+		OutputDir: t.TempDir(),
+		Manifest:  NewJSONLManifest(&jsonl),
+	}
+	results, err := runner.Run(context.Background(), base, variants)
+	if err != nil {
+		t.Fatalf("Failed to run: %v", err)
+	}
+
+	ok := results[0]
+	if ok.Error != "" || ok.Attempts != 2 || ok.PromptID != "2" {
+		t.Fatalf("Expected variant 0 to succeed on its second attempt, got %+v", ok)
+	}
+	if len(ok.Outputs) != 1 || !strings.HasSuffix(ok.Outputs[0].Path, "variant-0000_out_2.latent") {
+		t.Errorf("Expected a saved output, got %+v", ok.Outputs)
+	}
+	if width := fake.prompts[1]["prompt"].(map[string]interface{})["1"].(map[string]interface{})["inputs"].(map[string]interface{})["width"]; width != float64(768) {
+		t.Errorf("Expected the variant's width to be queued, got %v", width)
+	}
+
+	bad := results[1]
+	if bad.Attempts != 1 || !strings.Contains(bad.Error, "out of range") {
+		t.Errorf("Expected the invalid variant to fail without retrying, got %+v", bad)
+	}
+
+	lines := strings.Split(strings.TrimSpace(jsonl.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 manifest lines, got %d", len(lines))
+	}
+	var first Result
+	if err := json.Unmarshal([]byte(lines[0]), &first); err != nil || first.Params["Size.width"] != float64(768) {
+		t.Errorf("Expected the manifest to record the parameters, got %s", lines[0])
+	}
+
+	var csvData bytes.Buffer
+	m := NewCSVManifest(&csvData, sweep)
+	for _, r := range results {
+		m.Write(r)
+	}
+	rows, err := csv.NewReader(&csvData).ReadAll()
+	if err != nil {
+		t.Fatalf("Failed to read CSV: %v", err)
+	}
+	if len(rows) != 3 || rows[0][1] != "Size.width" || rows[1][1] != "768" || rows[1][2] != "2" {
+		t.Errorf("Unexpected CSV manifest: %v", rows)
+	}
+}
+
+// TestRunnerCancel tests that cancelled variants are recorded
+func TestRunnerCancel(t *testing.T) {
+	fake := newFakeComfy(t)
+	c := fake.client(t)
+	base, _, _ := c.NewGraphFromJsonString(testWorkflow)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	runner := &Runner{Clients: []*client.ComfyClient{c}}
+	variants, _ := (&Sweep{Params: []Param{{Path: "Size.width", Values: []interface{}{512}}}}).Variants()
+	results, _ := runner.Run(ctx, base, variants)
+	if len(results) != 1 || !strings.Contains(results[0].Error, context.Canceled.Error()) {
+		t.Errorf("Expected a cancelled result, got %+v", results[0])
+	}
+}
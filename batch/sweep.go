@@ -0,0 +1,234 @@
+// Package batch runs parameter sweeps over a workflow.  A Sweep describes the values
+// of property paths to try, its variants are queued across a pool of ComfyClients,
+// and a manifest links the parameters of each variant to its prompt ID, outputs,
+// timings and errors.
+package batch
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"math/rand"
+
+	"github.com/richinsley/comfy2go/graphapi"
+)
+
+// Mode is how the values of a sweep's parameters are combined into variants
+type Mode string
+
+const (
+	// Cartesian tries every combination of the parameters' values
+	Cartesian Mode = "cartesian"
+	// Zip pairs the n-th values of every parameter, the parameters must have the same number of values
+	Zip Mode = "zip"
+	// Random draws Samples distinct combinations from the cartesian product
+	Random Mode = "random"
+)
+
+// Param is a property path and the values it is swept over.  The path is resolved
+// with Graph.Get.
+type Param struct {
+	Path   string        `json:"path"`
+	Values []interface{} `json:"values"`
+}
+
+// Sweep describes the variants of a workflow
+type Sweep struct {
+	Mode   Mode    `json:"mode"`
+	Params []Param `json:"params"`
+	// Samples is the number of variants drawn by Random
+	Samples int `json:"samples,omitempty"`
+	// Seed seeds the random source of Random, so a sweep draws the same variants each time
+	Seed int64 `json:"seed,omitempty"`
+}
+
+// Value is the value of a property path in a variant
+type Value struct {
+	Path  string      `json:"path"`
+	Value interface{} `json:"value"`
+}
+
+// Variant is one combination of a sweep's values
+type Variant struct {
+	Index  int     `json:"index"`
+	Values []Value `json:"values"`
+}
+
+// IntRange returns the integers from start to stop inclusive, counting by step
+func IntRange(start int64, stop int64, step int64) []interface{} {
+	retv := make([]interface{}, 0)
+	if step <= 0 {
+		return retv
+	}
+	for v := start; v <= stop; v += step {
+		retv = append(retv, v)
+	}
+	return retv
+}
+
+// FloatRange returns the numbers from start to stop inclusive, counting by step
+func FloatRange(start float64, stop float64, step float64) []interface{} {
+	retv := make([]interface{}, 0)
+	if step <= 0 {
+		return retv
+	}
+	// count steps rather than accumulating, so the error does not grow
+	for i := 0; ; i++ {
+		v := start + float64(i)*step
+		if v > stop+step/1e6 {
+			break
+		}
+		retv = append(retv, v)
+	}
+	return retv
+}
+
+// Generate checks that every path of the sweep addresses a property of the base graph,
+// and returns the sweep's variants
+func Generate(base *graphapi.Graph, s *Sweep) ([]Variant, error) {
+	if err := s.Validate(base); err != nil {
+		return nil, err
+	}
+	return s.Variants()
+}
+
+// Validate checks that every path of the sweep addresses a property of a graph
+func (s *Sweep) Validate(g *graphapi.Graph) error {
+	errs := make([]error, 0)
+	for _, p := range s.Params {
+		if _, err := g.Get(p.Path); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Variants returns the combinations of the sweep's values
+func (s *Sweep) Variants() ([]Variant, error) {
+	if len(s.Params) == 0 {
+		return nil, errors.New("sweep has no parameters")
+	}
+	for _, p := range s.Params {
+		if len(p.Values) == 0 {
+			return nil, fmt.Errorf("parameter %s has no values", p.Path)
+		}
+	}
+
+	switch s.Mode {
+	case Cartesian, "":
+		count := s.combinations()
+		if !count.IsInt64() || count.Int64() > maxVariants {
+			return nil, fmt.Errorf("sweep has %s variants, more than %d", count, maxVariants)
+		}
+		retv := make([]Variant, count.Int64())
+		for i := range retv {
+			retv[i] = s.combination(i, big.NewInt(int64(i)))
+		}
+		return retv, nil
+	case Zip:
+		n := len(s.Params[0].Values)
+		for _, p := range s.Params[1:] {
+			if len(p.Values) != n {
+				return nil, fmt.Errorf("zip sweep parameters must have the same number of values, %s has %d and %s has %d", s.Params[0].Path, n, p.Path, len(p.Values))
+			}
+		}
+		retv := make([]Variant, n)
+		for i := range retv {
+			retv[i] = Variant{Index: i, Values: make([]Value, len(s.Params))}
+			for j, p := range s.Params {
+				retv[i].Values[j] = Value{Path: p.Path, Value: p.Values[i]}
+			}
+		}
+		return retv, nil
+	case Random:
+		return s.sample()
+	}
+	return nil, fmt.Errorf("unknown sweep mode %q", s.Mode)
+}
+
+// maxVariants limits the number of variants of a cartesian sweep
+const maxVariants = 1 << 20
+
+// combinations returns the size of the cartesian product of the sweep's values
+func (s *Sweep) combinations() *big.Int {
+	retv := big.NewInt(1)
+	for _, p := range s.Params {
+		retv.Mul(retv, big.NewInt(int64(len(p.Values))))
+	}
+	return retv
+}
+
+// combination returns the n-th combination of the cartesian product, the last
+// parameter varying fastest
+func (s *Sweep) combination(index int, n *big.Int) Variant {
+	retv := Variant{Index: index, Values: make([]Value, len(s.Params))}
+	rem := new(big.Int).Set(n)
+	digit := new(big.Int)
+	for i := len(s.Params) - 1; i >= 0; i-- {
+		p := s.Params[i]
+		rem.DivMod(rem, big.NewInt(int64(len(p.Values))), digit)
+		retv.Values[i] = Value{Path: p.Path, Value: p.Values[digit.Int64()]}
+	}
+	return retv
+}
+
+// sample draws distinct combinations from the cartesian product
+func (s *Sweep) sample() ([]Variant, error) {
+	if s.Samples <= 0 {
+		return nil, errors.New("random sweep needs a positive number of samples")
+	}
+	count := s.combinations()
+	samples := big.NewInt(int64(s.Samples))
+	if count.Cmp(samples) <= 0 {
+		// every combination, in a random order
+		s2 := *s
+		s2.Mode = Cartesian
+		all, err := s2.Variants()
+		if err != nil {
+			return nil, err
+		}
+		r := rand.New(rand.NewSource(s.Seed))
+		r.Shuffle(len(all), func(i, j int) { all[i], all[j] = all[j], all[i] })
+		for i := range all {
+			all[i].Index = i
+		}
+		return all, nil
+	}
+
+	r := rand.New(rand.NewSource(s.Seed))
+	picked := make(map[string]bool, s.Samples)
+	retv := make([]Variant, 0, s.Samples)
+	for len(retv) < s.Samples {
+		n := new(big.Int).Rand(r, count)
+		if picked[n.String()] {
+			continue
+		}
+		picked[n.String()] = true
+		retv = append(retv, s.combination(len(retv), n))
+	}
+	return retv, nil
+}
+
+// Apply sets the variant's values on a graph.  The values are checked against the
+// properties' types, ranges and choices.
+func (v *Variant) Apply(g *graphapi.Graph) error {
+	for _, val := range v.Values {
+		p, err := g.Get(val.Path)
+		if err != nil {
+			return err
+		}
+		if err := p.SetValueStrict(val.Value); err != nil {
+			return fmt.Errorf("%s: %w", val.Path, err)
+		}
+	}
+	return nil
+}
+
+// Params returns the variant's values by path
+func (v *Variant) Params() map[string]interface{} {
+	retv := make(map[string]interface{}, len(v.Values))
+	for _, val := range v.Values {
+		retv[val.Path] = val.Value
+	}
+	return retv
+}
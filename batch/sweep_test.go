@@ -0,0 +1,89 @@
+package batch
+
+import (
+	"fmt"
+	"testing"
+)
+
+func newTestSweep(mode Mode) *Sweep {
+	return &Sweep{
+		Mode: mode,
+		Params: []Param{
+			{Path: "KSampler.seed", Values: IntRange(1, 3, 1)},
+			{Path: "KSampler.cfg", Values: FloatRange(6, 7, 0.5)},
+		},
+	}
+}
+
+// TestCartesianSweep tests that every combination is generated, the last parameter varying fastest
+func TestCartesianSweep(t *testing.T) {
+	variants, err := newTestSweep(Cartesian).Variants()
+	if err != nil {
+		t.Fatalf("Failed to generate variants: %v", err)
+	}
+	if len(variants) != 9 {
+		t.Fatalf("Expected 9 variants, got %d", len(variants))
+	}
+	if got := fmt.Sprint(variants[1].Values[0].Value, variants[1].Values[1].Value); got != "1 6.5" {
+		t.Errorf("Expected variant 1 to be seed 1 cfg 6.5, got %s", got)
+	}
+	if got := fmt.Sprint(variants[8].Values[0].Value, variants[8].Values[1].Value); got != "3 7" {
+		t.Errorf("Expected variant 8 to be seed 3 cfg 7, got %s", got)
+	}
+}
+
+// TestZipSweep tests pairing values, and rejecting parameters of different lengths
+func TestZipSweep(t *testing.T) {
+	variants, err := newTestSweep(Zip).Variants()
+	if err != nil {
+		t.Fatalf("Failed to generate variants: %v", err)
+	}
+	if len(variants) != 3 {
+		t.Fatalf("Expected 3 variants, got %d", len(variants))
+	}
+	if got := fmt.Sprint(variants[2].Params()); got != "map[KSampler.cfg:7 KSampler.seed:3]" {
+		t.Errorf("Unexpected variant 2: %s", got)
+	}
+
+	s := newTestSweep(Zip)
+	s.Params[1].Values = s.Params[1].Values[:2]
+	if _, err := s.Variants(); err == nil {
+		t.Errorf("Expected parameters of different lengths to be rejected")
+	}
+}
+
+// TestRandomSweep tests drawing distinct combinations reproducibly
+func TestRandomSweep(t *testing.T) {
+	s := newTestSweep(Random)
+	s.Samples = 5
+	s.Seed = 7
+	variants, err := s.Variants()
+	if err != nil {
+		t.Fatalf("Failed to generate variants: %v", err)
+	}
+	if len(variants) != 5 {
+		t.Fatalf("Expected 5 variants, got %d", len(variants))
+	}
+	seen := make(map[string]bool)
+	for i, v := range variants {
+		key := fmt.Sprint(v.Params())
+		if seen[key] {
+			t.Errorf("Variant %s drawn twice", key)
+		}
+		seen[key] = true
+		if v.Index != i {
+			t.Errorf("Expected index %d, got %d", i, v.Index)
+		}
+	}
+
+	again, _ := s.Variants()
+	if fmt.Sprint(again) != fmt.Sprint(variants) {
+		t.Errorf("Expected the same seed to draw the same variants")
+	}
+
+	// more samples than combinations returns them all
+	s.Samples = 100
+	if variants, _ := s.Variants(); len(variants) != 9 {
+		t.Errorf("Expected all 9 variants, got %d", len(variants))
+	}
+}
@@ -118,6 +118,11 @@ func (c *ComfyClient) ClientID() string {
 	return c.clientid
 }
 
+// ServerAddress returns the host:port of the ComfyUI backend
+func (c *ComfyClient) ServerAddress() string {
+	return c.serverBaseAddress
+}
+
 // return the underlying http client
 func (c *ComfyClient) HttpClient() *http.Client {
 	return c.httpclient
@@ -164,7 +169,21 @@ func (c *ComfyClient) NewGraphFromJsonString(path string) (*graphapi.Graph, *[]s
 	return graphapi.NewGraphFromJsonString(path, c.nodeobjects)
 }
 
-// NewGraphFromPNGReader extracts the workflow from PNG data read from an io.Reader and creates a new graph
+// NewGraphFromPromptReader creates a new graph from an API format prompt read from an io.Reader
+func (c *ComfyClient) NewGraphFromPromptReader(r io.Reader) (*graphapi.Graph, *[]string, error) {
+	if !c.IsInitialized() {
+		// try to initialize first
+		err := c.Init()
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return graphapi.NewGraphFromPromptReader(r, c.nodeobjects)
+}
+
+// NewGraphFromPNGReader extracts the workflow from PNG data read from an io.Reader and creates a new graph.
+// When the PNG only holds a prompt, as images generated through the API do, the graph is created from the
+// prompt, like NewGraphFromMediaReader does.
 func (c *ComfyClient) NewGraphFromPNGReader(r io.Reader) (*graphapi.Graph, *[]string, error) {
 	metadata, err := GetPngMetadata(r)
 	if err != nil {
@@ -174,6 +193,9 @@ func (c *ComfyClient) NewGraphFromPNGReader(r io.Reader) (*graphapi.Graph, *[]st
 	// get the workflow from the PNG metadata
 	workflow, ok := metadata["workflow"]
 	if !ok {
+		if prompt, ok := metadata["prompt"]; ok {
+			return c.NewGraphFromPromptReader(strings.NewReader(prompt))
+		}
 		return nil, nil, errors.New("png does not contain workflow metadata")
 	}
 	reader := strings.NewReader(workflow)
@@ -195,6 +217,43 @@ func (c *ComfyClient) NewGraphFromPNGFile(path string) (*graphapi.Graph, *[]stri
 	return c.NewGraphFromPNGReader(file)
 }
 
+// NewPromptFromPNGReader reads the API prompt from PNG data read from an io.Reader.  The
+// prompt's inputs can be changed, checked against the client's node objects, and it can
+// be queued again with QueueRawPrompt, without converting it to a graph.
+func (c *ComfyClient) NewPromptFromPNGReader(r io.Reader) (*graphapi.EditablePrompt, *[]string, error) {
+	if !c.IsInitialized() {
+		// try to initialize first
+		err := c.Init()
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	metadata, err := GetPngMetadata(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	prompt, ok := metadata["prompt"]
+	if !ok {
+		return nil, nil, errors.New("png does not contain prompt metadata")
+	}
+	ep, missing, err := graphapi.NewEditablePromptFromReader(strings.NewReader(prompt), c.nodeobjects)
+	if err != nil {
+		return nil, missing, err
+	}
+	ep.Prompt.ClientID = c.clientid
+	return ep, nil, nil
+}
+
+// NewPromptFromPNGFile reads the API prompt from a PNG file
+func (c *ComfyClient) NewPromptFromPNGFile(path string) (*graphapi.EditablePrompt, *[]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+	return c.NewPromptFromPNGReader(file)
+}
+
 // GetQueuedItem returns a QueueItem that was queued with the ComfyClient, that has not been processed yet
 // or is currently being processed.  Once a QueueItem has been processed, it will not be available with this method.
 func (c *ComfyClient) GetQueuedItem(prompt_id string) *QueueItem {
@@ -264,18 +323,7 @@ func (c *ComfyClient) OnWindowSocketMessage(msg string, qi *QueueItem) {
 			} else {
 				// Try to find the node in the workflow
 				// For compound IDs like "57:8", parse the first part
-				var node *graphapi.GraphNode
-				nodeIDStr := *s.Node
-				if nodeID, err := strconv.Atoi(nodeIDStr); err == nil {
-					// Simple integer ID
-					node = qi.Workflow.GetNodeById(nodeID)
-				} else if strings.Contains(nodeIDStr, ":") {
-					// Compound ID like "57:8" - try to get the instance node
-					parts := strings.Split(nodeIDStr, ":")
-					if instanceID, err := strconv.Atoi(parts[0]); err == nil {
-						node = qi.Workflow.GetNodeById(instanceID)
-					}
-				}
+				node := workflowNode(qi.Workflow, *s.Node)
 
 				if node != nil {
 					m := PromptMessage{
@@ -359,16 +407,7 @@ func (c *ComfyClient) OnWindowSocketMessage(msg string, qi *QueueItem) {
 		s := message.Data.(*WSMessageExecutionError)
 		if qi != nil {
 			// Try to find the node in the workflow
-			var tnode *graphapi.GraphNode
-			if nodeID, err := strconv.Atoi(s.Node); err == nil {
-				tnode = qi.Workflow.GetNodeById(nodeID)
-			} else if strings.Contains(s.Node, ":") {
-				// Compound ID - try to get the instance node
-				parts := strings.Split(s.Node, ":")
-				if instanceID, err := strconv.Atoi(parts[0]); err == nil {
-					tnode = qi.Workflow.GetNodeById(instanceID)
-				}
-			}
+			tnode := workflowNode(qi.Workflow, s.Node)
 
 			nodeName := s.Node
 			if tnode != nil {
@@ -441,3 +480,17 @@ func (c *ComfyClient) OnWindowSocketMessage(msg string, qi *QueueItem) {
 		slog.Warn("Unhandled message type: ", "type", message.Type)
 	}
 }
+
+// workflowNode returns the node of a workflow for a prompt node ID.  For compound IDs
+// like "57:8" it is the subgraph instance node.  Prompts queued without a workflow
+// have no nodes.
+func workflowNode(workflow *graphapi.Graph, nodeID string) *graphapi.GraphNode {
+	if workflow == nil {
+		return nil
+	}
+	instanceID, _, _ := strings.Cut(nodeID, ":")
+	if id, err := strconv.Atoi(instanceID); err == nil {
+		return workflow.GetNodeById(id)
+	}
+	return nil
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"net/http"
 	"net/url"
 	"sort"
 	"strconv"
@@ -27,6 +28,8 @@ import (
 @routes.get("/history")
 @routes.get("/history/{prompt_id}")
 @routes.get("/queue")
+@routes.get("/models")
+@routes.get("/models/{folder}")
 
 @routes.post("/prompt")
 @routes.post("/queue")
@@ -208,6 +211,45 @@ func (c *ComfyClient) GetEmbeddings() ([]string, error) {
 	return retv, nil
 }
 
+// GetModelFolders retrieves the names of the model folders on the ComfyUI server, e.g. "checkpoints".
+func (c *ComfyClient) GetModelFolders() ([]string, error) {
+	resp, err := c.httpclient.Get(fmt.Sprintf("http://%s/models", c.serverBaseAddress))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	retv := make([]string, 0)
+	err = json.Unmarshal(body, &retv)
+	if err != nil {
+		return nil, err
+	}
+
+	return retv, nil
+}
+
+// GetModels retrieves the names of the models in a model folder on the ComfyUI server.
+func (c *ComfyClient) GetModels(folder string) ([]string, error) {
+	resp, err := c.httpclient.Get(fmt.Sprintf("http://%s/models/%s", c.serverBaseAddress, url.PathEscape(folder)))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("model folder %s: %s", folder, resp.Status)
+	}
+	retv := make([]string, 0)
+	err = json.Unmarshal(body, &retv)
+	if err != nil {
+		return nil, err
+	}
+
+	return retv, nil
+}
+
 func (c *ComfyClient) GetQueueExecutionInfo() (*QueueExecInfo, error) {
 	resp, err := c.httpclient.Get(fmt.Sprintf("http://%s/prompt", c.serverBaseAddress))
 	if err != nil {
@@ -273,11 +315,29 @@ func (c *ComfyClient) GeneratePrompt(graph *graphapi.Graph) (*graphapi.Prompt, e
 	return &prompt, nil
 }
 
+// QueueRawPrompt queues a prompt that was generated from the graph, or that has no
+// graph when it is nil.  A prompt without a client ID is given the client's, so that
+// its progress messages are received.  A prompt that fails validation is returned
+// with the server's NodeErrors, use QueueRawPromptStrict to have them returned as a
+// *QueuePromptError.
 func (c *ComfyClient) QueueRawPrompt(graph *graphapi.Graph, prompt *graphapi.Prompt) (*QueueItem, error) {
+	return c.queueRawPrompt(graph, prompt, false)
+}
+
+// QueueRawPromptStrict is QueueRawPrompt, but a prompt the server rejects is returned
+// as a *QueuePromptError, with the errors of each node
+func (c *ComfyClient) QueueRawPromptStrict(graph *graphapi.Graph, prompt *graphapi.Prompt) (*QueueItem, error) {
+	return c.queueRawPrompt(graph, prompt, true)
+}
+
+func (c *ComfyClient) queueRawPrompt(graph *graphapi.Graph, prompt *graphapi.Prompt, strict bool) (*QueueItem, error) {
 	err := c.CheckConnection()
 	if err != nil {
 		return nil, err
 	}
+	if prompt.ClientID == "" {
+		prompt.ClientID = c.clientid
+	}
 
 	ws := &WebSocketConnection{
 		WebSocketURL: "ws://" + c.serverBaseAddress + "/ws?clientId=" + c.clientid,
@@ -298,12 +358,21 @@ func (c *ComfyClient) QueueRawPrompt(graph *graphapi.Graph, prompt *graphapi.Pro
 	}
 
 	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	// the prompt failed validation
+	if strict && resp.StatusCode != http.StatusOK {
+		ws.Close()
+		return nil, newQueuePromptError(resp.StatusCode, body)
+	}
 
 	// create the queue item
 	item := &QueueItem{
-		Workflow:  graph,
-		Messages:  make(chan PromptMessage),
-		webSocket: ws,
+		Workflow:     graph,
+		Messages:     make(chan PromptMessage),
+		Seeds:        prompt.Seeds,
+		ExpandedText: prompt.ExpandedText,
+		webSocket:    ws,
 	}
 
 	err = json.Unmarshal(body, &item)
@@ -352,6 +421,22 @@ func (c *ComfyClient) QueuePrompt(graph *graphapi.Graph) (*QueueItem, error) {
 	return c.QueueRawPrompt(graph, &prompt)
 }
 
+// QueuePromptStrict is QueuePrompt, but a prompt the server rejects is returned as a
+// *QueuePromptError, with the errors of each node
+func (c *ComfyClient) QueuePromptStrict(graph *graphapi.Graph) (*QueueItem, error) {
+	err := c.CheckConnection()
+	if err != nil {
+		return nil, err
+	}
+
+	prompt, err := graph.GraphToPrompt(c.clientid)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.QueueRawPromptStrict(graph, &prompt)
+}
+
 func (c *ComfyClient) Interrupt() error {
 	resp, err := c.httpclient.Post(fmt.Sprintf("http://%s/interrupt", c.serverBaseAddress), "application/json", strings.NewReader("{}"))
 	if err != nil {
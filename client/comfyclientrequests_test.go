@@ -0,0 +1,126 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/richinsley/comfy2go/graphapi"
+)
+
+const testRejectedPrompt = `{
+	"error": {"type": "prompt_outputs_failed_validation", "message": "Prompt outputs failed validation", "details": "", "extra_info": {}},
+	"node_errors": {"3": {"errors": [{"type": "value_bigger_than_max", "message": "Value bigger than max", "details": "steps"}], "dependent_outputs": ["9"], "class_type": "KSampler"}}
+}`
+
+const testTextObjectInfo = `{
+	"CLIPTextEncode": {
+		"input": {"required": {"text": ["STRING", {"multiline": true, "dynamicPrompts": true}], "clip": ["CLIP"]}},
+		"output": ["CONDITIONING"], "name": "CLIPTextEncode", "display_name": "CLIP Text Encode (Prompt)"
+	}
+}`
+
+const testTextWorkflow = `{
+	"nodes": [
+		{"id": 1, "type": "CLIPTextEncode", "pos": [0, 0], "size": [400, 200], "order": 0, "mode": 0,
+		 "inputs": [{"name": "clip", "type": "CLIP", "link": null}],
+		 "outputs": [{"name": "CONDITIONING", "type": "CONDITIONING", "links": []}],
+		 "properties": {}, "widgets_values": ["a {cat|dog}"]}
+	],
+	"links": [],
+	"groups": [],
+	"last_node_id": 1,
+	"last_link_id": 0,
+	"version": 0.4
+}`
+
+// newPromptServer starts a ComfyUI server that answers every prompt with the status
+// and body given, passing the prompts it receives to queued
+func newPromptServer(t *testing.T, status int, body string, queued func(map[string]interface{})) *ComfyClient {
+	upgrader := websocket.Upgrader{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/object_info", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, testTextObjectInfo)
+	})
+	mux.HandleFunc("/prompt", func(w http.ResponseWriter, r *http.Request) {
+		var prompt map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&prompt)
+		if queued != nil {
+			queued(prompt)
+		}
+		w.WriteHeader(status)
+		io.WriteString(w, body)
+	})
+	mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.ReadMessage()
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	host, portStr, _ := strings.Cut(strings.TrimPrefix(server.URL, "http://"), ":")
+	port, _ := strconv.Atoi(portStr)
+	return NewComfyClient(host, port, nil)
+}
+
+// TestQueueRawPromptRejected tests that a rejected prompt is returned with its node
+// errors, and as a *QueuePromptError by QueueRawPromptStrict
+func TestQueueRawPromptRejected(t *testing.T) {
+	c := newPromptServer(t, http.StatusBadRequest, testRejectedPrompt, nil)
+	prompt := &graphapi.Prompt{Nodes: map[string]graphapi.PromptNode{}}
+
+	item, err := c.QueueRawPrompt(nil, prompt)
+	if err != nil {
+		t.Fatalf("Expected the node errors to be returned in the item, got %v", err)
+	}
+	defer item.Close()
+	if item.PromptID != "" || item.NodeErrors["3"] == nil {
+		t.Errorf("Expected an item without a prompt ID, with the node errors, got %+v", item)
+	}
+
+	_, err = c.QueueRawPromptStrict(nil, prompt)
+	var qerr *QueuePromptError
+	if !errors.As(err, &qerr) {
+		t.Fatalf("Expected a *QueuePromptError, got %v", err)
+	}
+	if qerr.StatusCode != http.StatusBadRequest || qerr.NodeErrors["3"].ClassType != "KSampler" {
+		t.Errorf("Unexpected error %+v", qerr)
+	}
+}
+
+// TestQueuePromptExpandedText tests that the dynamic prompt text that was queued is
+// recorded in the queue item
+func TestQueuePromptExpandedText(t *testing.T) {
+	var queued map[string]interface{}
+	c := newPromptServer(t, http.StatusOK, `{"prompt_id": "1", "number": 1, "node_errors": {}}`, func(p map[string]interface{}) {
+		queued = p
+	})
+	graph, _, err := c.NewGraphFromJsonString(testTextWorkflow)
+	if err != nil {
+		t.Fatalf("Failed to load workflow: %v", err)
+	}
+
+	item, err := c.QueuePrompt(graph)
+	if err != nil {
+		t.Fatalf("Failed to queue prompt: %v", err)
+	}
+	defer item.Close()
+
+	text := queued["prompt"].(map[string]interface{})["1"].(map[string]interface{})["inputs"].(map[string]interface{})["text"]
+	if text != "a cat" && text != "a dog" {
+		t.Errorf("Expected the queued text to be expanded, got %v", text)
+	}
+	if item.ExpandedText["1"]["text"] != text {
+		t.Errorf("Expected the queue item to record %v, got %v", text, item.ExpandedText)
+	}
+}
@@ -1,6 +1,13 @@
 package client
 
-import "github.com/richinsley/comfy2go/graphapi"
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/richinsley/comfy2go/graphapi"
+)
 
 // There may be other DataOutput types.  We definitely need a text type
 
@@ -56,3 +63,61 @@ type PromptErrorMessage struct {
 	Error      PromptError   `json:"error"`
 	NodeErrors []interface{} `json:"node_errors"`
 }
+
+// PromptNodeError holds the validation errors of a single node in a prompt
+type PromptNodeError struct {
+	ClassType        string        `json:"class_type"`
+	Errors           []PromptError `json:"errors"`
+	DependentOutputs []interface{} `json:"dependent_outputs"`
+}
+
+// QueuePromptError is returned when ComfyUI rejects a prompt, NodeErrors is keyed by node ID
+type QueuePromptError struct {
+	StatusCode int
+	Message    string
+	Details    string
+	NodeErrors map[string]PromptNodeError
+}
+
+func newQueuePromptError(statusCode int, body []byte) *QueuePromptError {
+	retv := &QueuePromptError{StatusCode: statusCode, NodeErrors: make(map[string]PromptNodeError)}
+	var msg struct {
+		Error      PromptError     `json:"error"`
+		NodeErrors json.RawMessage `json:"node_errors"`
+	}
+	if err := json.Unmarshal(body, &msg); err != nil {
+		retv.Message = strings.TrimSpace(string(body))
+		return retv
+	}
+	retv.Message = msg.Error.Message
+	retv.Details = msg.Error.Details
+	// node_errors is an empty list when there are none
+	json.Unmarshal(msg.NodeErrors, &retv.NodeErrors)
+	return retv
+}
+
+func (e *QueuePromptError) Error() string {
+	if e.Message == "" {
+		e.Message = fmt.Sprintf("server returned status %d", e.StatusCode)
+	}
+	retv := e.Message
+	if e.Details != "" {
+		retv += ": " + e.Details
+	}
+
+	ids := make([]string, 0, len(e.NodeErrors))
+	for id := range e.NodeErrors {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		ne := e.NodeErrors[id]
+		for _, pe := range ne.Errors {
+			retv += fmt.Sprintf("\n  node %s (%s): %s", id, ne.ClassType, pe.Message)
+			if pe.Details != "" {
+				retv += ": " + pe.Details
+			}
+		}
+	}
+	return retv
+}
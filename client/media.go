@@ -0,0 +1,778 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/richinsley/comfy2go/graphapi"
+)
+
+// maxMetadataSize limits the size of a metadata block that is read into memory
+const maxMetadataSize = 64 << 20
+
+// ErrUnknownMediaFormat is returned for data that is not in a supported media format
+var ErrUnknownMediaFormat = errors.New("unknown media format")
+
+// GetMediaMetadata returns the text metadata of a PNG, WebP, JPEG, FLAC, Ogg (Opus or
+// Vorbis), MP4/MOV or WebM/Matroska file, keyed by the names the format uses.  The
+// container is detected from the data.
+//
+// The "workflow" and "prompt" entries are also filled in from the places ComfyUI and
+// common custom nodes put them: EXIF values such as "workflow:{...}" in WebP and JPEG
+// files, vorbis comments in audio files, metadata tags in videos, and JSON objects with
+// "workflow" and "prompt" fields, e.g. in a JPEG comment or a video's comment tag.
+func GetMediaMetadata(r io.Reader) (map[string]string, error) {
+	br := bufio.NewReader(r)
+	header, err := br.Peek(12)
+	if err != nil && len(header) < 4 {
+		if err == io.EOF {
+			return nil, ErrUnknownMediaFormat
+		}
+		return nil, err
+	}
+
+	m := make(mediaMetadata)
+	switch {
+	case bytes.HasPrefix(header, pngSignature):
+		text, err := GetPngMetadata(br)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range text {
+			m.add(k, v)
+		}
+	case len(header) >= 12 && string(header[:4]) == "RIFF" && string(header[8:12]) == "WEBP":
+		err = m.readWebP(br)
+	case bytes.HasPrefix(header, []byte{0xFF, 0xD8}):
+		err = m.readJPEG(br)
+	case string(header[:4]) == "fLaC":
+		err = m.readFLAC(br)
+	case string(header[:4]) == "OggS":
+		err = m.readOgg(br)
+	case len(header) >= 8 && string(header[4:8]) == "ftyp":
+		err = m.readMP4(br)
+	case bytes.HasPrefix(header, []byte{0x1A, 0x45, 0xDF, 0xA3}):
+		err = m.readMatroska(br)
+	default:
+		return nil, ErrUnknownMediaFormat
+	}
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// NewGraphFromMediaReader creates a new graph from the workflow embedded in an image,
+// audio or video file.  When the file only holds a prompt, the graph is created from
+// the prompt.  See GetMediaMetadata for the supported formats.
+func (c *ComfyClient) NewGraphFromMediaReader(r io.Reader) (*graphapi.Graph, *[]string, error) {
+	metadata, err := GetMediaMetadata(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	if workflow, ok := metadata["workflow"]; ok {
+		return c.NewGraphFromJsonReader(strings.NewReader(workflow))
+	}
+	if prompt, ok := metadata["prompt"]; ok {
+		return c.NewGraphFromPromptReader(strings.NewReader(prompt))
+	}
+	return nil, nil, errors.New("media does not contain workflow or prompt metadata")
+}
+
+// NewGraphFromMediaFile creates a new graph from the workflow embedded in an image,
+// audio or video file
+func (c *ComfyClient) NewGraphFromMediaFile(path string) (*graphapi.Graph, *[]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+	return c.NewGraphFromMediaReader(file)
+}
+
+// mediaMetadata collects the text metadata of a file
+type mediaMetadata map[string]string
+
+// add records a metadata value, and the workflow or prompt it holds
+func (m mediaMetadata) add(key string, value string) {
+	value = strings.TrimRight(value, "\x00")
+	if _, ok := m[key]; !ok {
+		m[key] = value
+	}
+
+	// EXIF values written by ComfyUI are prefixed with their name
+	for _, name := range []string{"workflow", "prompt"} {
+		if strings.HasPrefix(value, name+":") {
+			m.set(name, value[len(name)+1:])
+			return
+		}
+	}
+
+	switch name := strings.ToLower(strings.TrimSpace(key)); name {
+	case "workflow", "prompt":
+		m.set(name, value)
+		return
+	}
+
+	// a JSON object holding both, e.g. a video's comment
+	trimmed := strings.TrimSpace(value)
+	if !strings.HasPrefix(trimmed, "{") {
+		return
+	}
+	var fields map[string]json.RawMessage
+	if json.Unmarshal([]byte(trimmed), &fields) != nil {
+		return
+	}
+	for name, raw := range fields {
+		name = strings.ToLower(name)
+		if name != "workflow" && name != "prompt" {
+			continue
+		}
+		// the value is either the object, or the object encoded as a string
+		var s string
+		if json.Unmarshal(raw, &s) == nil {
+			m.set(name, s)
+		} else if bytes.HasPrefix(bytes.TrimSpace(raw), []byte("{")) {
+			m.set(name, string(raw))
+		}
+	}
+}
+
+// set records the workflow or prompt, keeping the first one found
+func (m mediaMetadata) set(name string, value string) {
+	value = strings.TrimSpace(value)
+	if _, ok := m[name]; !ok && value != "" {
+		m[name] = value
+	}
+}
+
+// readLimited reads n bytes of metadata
+func readLimited(r io.Reader, n uint64) ([]byte, error) {
+	if n > maxMetadataSize {
+		return nil, fmt.Errorf("metadata block of %d bytes is too large", n)
+	}
+	data := make([]byte, n)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// readWebP reads the EXIF chunk of a WebP file
+func (m mediaMetadata) readWebP(r io.Reader) error {
+	// RIFF header and WEBP form type
+	if _, err := io.CopyN(io.Discard, r, 12); err != nil {
+		return err
+	}
+	for {
+		var header [8]byte
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return nil
+			}
+			return err
+		}
+		size := uint64(binary.LittleEndian.Uint32(header[4:]))
+		// chunks are padded to an even size
+		padded := size + size&1
+		switch string(header[:4]) {
+		case "EXIF":
+			data, err := readLimited(r, padded)
+			if err != nil {
+				return err
+			}
+			m.readExif(data[:size])
+		default:
+			if _, err := io.CopyN(io.Discard, r, int64(padded)); err != nil {
+				if err == io.EOF {
+					return nil
+				}
+				return err
+			}
+		}
+	}
+}
+
+// readJPEG reads the EXIF and comment segments of a JPEG file
+func (m mediaMetadata) readJPEG(r io.Reader) error {
+	br := bufio.NewReader(r)
+	// start of image
+	if _, err := br.Discard(2); err != nil {
+		return err
+	}
+	for {
+		b, err := br.ReadByte()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if b != 0xFF {
+			return errors.New("malformed JPEG segment")
+		}
+		marker, err := br.ReadByte()
+		if err != nil {
+			return err
+		}
+		switch {
+		case marker == 0xFF:
+			// fill byte
+			br.UnreadByte()
+			continue
+		case marker == 0x01 || (marker >= 0xD0 && marker <= 0xD8):
+			// markers without a length
+			continue
+		case marker == 0xD9 || marker == 0xDA:
+			// the metadata is before the image data
+			return nil
+		}
+
+		var length uint16
+		if err := binary.Read(br, binary.BigEndian, &length); err != nil {
+			return err
+		}
+		if length < 2 {
+			return errors.New("malformed JPEG segment")
+		}
+		data, err := readLimited(br, uint64(length-2))
+		if err != nil {
+			return err
+		}
+		switch marker {
+		case 0xE1:
+			if bytes.HasPrefix(data, []byte("Exif\x00\x00")) {
+				m.readExif(data[6:])
+			}
+		case 0xFE:
+			m.add("comment", string(data))
+		}
+	}
+}
+
+// exifTagNames names the EXIF tags that hold text
+var exifTagNames = map[uint16]string{
+	0x010E: "ImageDescription",
+	0x010F: "Make",
+	0x0110: "Model",
+	0x0131: "Software",
+	0x013B: "Artist",
+	0x8298: "Copyright",
+	0x9286: "UserComment",
+}
+
+// readExif reads the text values of EXIF data, which may start with the "Exif" header
+func (m mediaMetadata) readExif(data []byte) {
+	data = bytes.TrimPrefix(data, []byte("Exif\x00\x00"))
+	if len(data) < 8 {
+		return
+	}
+	var order binary.ByteOrder
+	switch string(data[:4]) {
+	case "II*\x00":
+		order = binary.LittleEndian
+	case "MM\x00*":
+		order = binary.BigEndian
+	default:
+		return
+	}
+	visited := make(map[uint32]bool)
+	m.readIFD(data, order, order.Uint32(data[4:]), visited)
+}
+
+// readIFD reads the text values of an image file directory, following the EXIF
+// sub-directory
+func (m mediaMetadata) readIFD(data []byte, order binary.ByteOrder, offset uint32, visited map[uint32]bool) {
+	if visited[offset] || uint64(offset)+2 > uint64(len(data)) {
+		return
+	}
+	visited[offset] = true
+	count := int(order.Uint16(data[offset:]))
+	for i := 0; i < count; i++ {
+		entry := uint64(offset) + 2 + uint64(i)*12
+		if entry+12 > uint64(len(data)) {
+			return
+		}
+		tag := order.Uint16(data[entry:])
+		typ := order.Uint16(data[entry+2:])
+		n := uint64(order.Uint32(data[entry+4:]))
+
+		if tag == 0x8769 {
+			// EXIF sub-directory
+			m.readIFD(data, order, order.Uint32(data[entry+8:]), visited)
+			continue
+		}
+		// ASCII and UNDEFINED values are one byte each
+		if typ != 2 && typ != 7 {
+			continue
+		}
+		value := data[entry+8 : entry+12]
+		if n > 4 {
+			start := uint64(order.Uint32(data[entry+8:]))
+			if start+n > uint64(len(data)) {
+				continue
+			}
+			value = data[start : start+n]
+		} else {
+			value = value[:n]
+		}
+
+		name, ok := exifTagNames[tag]
+		if !ok {
+			name = fmt.Sprintf("0x%04X", tag)
+		}
+		if tag == 0x9286 {
+			m.add(name, exifUserComment(value, order))
+		} else {
+			m.add(name, string(value))
+		}
+	}
+}
+
+// exifUserComment decodes a UserComment, which starts with its character code
+func exifUserComment(value []byte, order binary.ByteOrder) string {
+	if len(value) < 8 {
+		return string(value)
+	}
+	code, text := string(value[:8]), value[8:]
+	if code != "UNICODE\x00" {
+		return string(text)
+	}
+	units := make([]uint16, len(text)/2)
+	for i := range units {
+		units[i] = order.Uint16(text[i*2:])
+	}
+	return string(utf16.Decode(units))
+}
+
+// readFLAC reads the vorbis comment block of a FLAC file
+func (m mediaMetadata) readFLAC(r io.Reader) error {
+	if _, err := io.CopyN(io.Discard, r, 4); err != nil {
+		return err
+	}
+	for {
+		var header [4]byte
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			return err
+		}
+		last := header[0]&0x80 != 0
+		size := uint64(header[1])<<16 | uint64(header[2])<<8 | uint64(header[3])
+		if header[0]&0x7F == 4 {
+			data, err := readLimited(r, size)
+			if err != nil {
+				return err
+			}
+			return m.readVorbisComment(data)
+		}
+		if _, err := io.CopyN(io.Discard, r, int64(size)); err != nil {
+			return err
+		}
+		if last {
+			return nil
+		}
+	}
+}
+
+// readVorbisComment reads the comments of a vorbis comment header, as used by FLAC,
+// Opus and Vorbis
+func (m mediaMetadata) readVorbisComment(data []byte) error {
+	malformed := errors.New("malformed vorbis comment")
+	next := func() ([]byte, bool) {
+		if len(data) < 4 {
+			return nil, false
+		}
+		n := uint64(binary.LittleEndian.Uint32(data))
+		if uint64(len(data)-4) < n {
+			return nil, false
+		}
+		v := data[4 : 4+n]
+		data = data[4+n:]
+		return v, true
+	}
+
+	// vendor string
+	if _, ok := next(); !ok || len(data) < 4 {
+		return malformed
+	}
+	count := binary.LittleEndian.Uint32(data)
+	data = data[4:]
+	for i := uint32(0); i < count; i++ {
+		comment, ok := next()
+		if !ok {
+			return malformed
+		}
+		if key, value, ok := strings.Cut(string(comment), "="); ok {
+			m.add(key, value)
+		}
+	}
+	return nil
+}
+
+// readOgg reads the comment header of the first stream of an Ogg file
+func (m mediaMetadata) readOgg(r io.Reader) error {
+	var serial uint32
+	first := true
+	var packet []byte
+	packets := 0
+	for {
+		var header [27]byte
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if string(header[:4]) != "OggS" {
+			return errors.New("malformed Ogg page")
+		}
+		lacing := make([]byte, header[26])
+		if _, err := io.ReadFull(r, lacing); err != nil {
+			return err
+		}
+		size := 0
+		for _, l := range lacing {
+			size += int(l)
+		}
+		body := make([]byte, size)
+		if _, err := io.ReadFull(r, body); err != nil {
+			return err
+		}
+
+		pageSerial := binary.LittleEndian.Uint32(header[14:])
+		if first {
+			serial = pageSerial
+			first = false
+		}
+		if pageSerial != serial {
+			continue
+		}
+
+		// a lacing value under 255 ends a packet, packets continue across pages
+		for _, l := range lacing {
+			if len(packet)+int(l) > maxMetadataSize {
+				return errors.New("Ogg packet is too large")
+			}
+			packet = append(packet, body[:l]...)
+			body = body[l:]
+			if l == 255 {
+				continue
+			}
+			packets++
+			if packets == 2 {
+				// the comment header follows the identification header
+				switch {
+				case bytes.HasPrefix(packet, []byte("OpusTags")):
+					return m.readVorbisComment(packet[8:])
+				case bytes.HasPrefix(packet, []byte("\x03vorbis")):
+					return m.readVorbisComment(packet[7:])
+				}
+				return nil
+			}
+			packet = packet[:0]
+		}
+	}
+}
+
+// mp4Box is a box of an MP4 or QuickTime file
+type mp4Box struct {
+	typ  string
+	data []byte
+}
+
+// readMP4 reads the metadata in the movie box of an MP4 or QuickTime file
+func (m mediaMetadata) readMP4(r io.Reader) error {
+	for {
+		var header [8]byte
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		size := uint64(binary.BigEndian.Uint32(header[:]))
+		typ := string(header[4:])
+		headerSize := uint64(8)
+		switch size {
+		case 0:
+			// the box extends to the end of the file
+			if typ != "moov" {
+				return nil
+			}
+			data, err := io.ReadAll(io.LimitReader(r, maxMetadataSize))
+			if err != nil {
+				return err
+			}
+			m.readMP4Boxes(data, "moov")
+			return nil
+		case 1:
+			var large uint64
+			if err := binary.Read(r, binary.BigEndian, &large); err != nil {
+				return err
+			}
+			size = large
+			headerSize = 16
+		}
+		if size < headerSize {
+			return errors.New("malformed MP4 box")
+		}
+
+		if typ == "moov" || typ == "meta" || typ == "udta" {
+			data, err := readLimited(r, size-headerSize)
+			if err != nil {
+				return err
+			}
+			m.readMP4Boxes(data, typ)
+			continue
+		}
+		if _, err := io.CopyN(io.Discard, r, int64(size-headerSize)); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// parseMP4Boxes splits data into boxes
+func parseMP4Boxes(data []byte) []mp4Box {
+	boxes := make([]mp4Box, 0)
+	for len(data) >= 8 {
+		size := uint64(binary.BigEndian.Uint32(data))
+		typ := string(data[4:8])
+		headerSize := uint64(8)
+		switch size {
+		case 0:
+			size = uint64(len(data))
+		case 1:
+			if len(data) < 16 {
+				return boxes
+			}
+			size = binary.BigEndian.Uint64(data[8:])
+			headerSize = 16
+		}
+		if size < headerSize || size > uint64(len(data)) {
+			return boxes
+		}
+		boxes = append(boxes, mp4Box{typ: typ, data: data[headerSize:size]})
+		data = data[size:]
+	}
+	return boxes
+}
+
+// readMP4Boxes reads the metadata in the body of a box
+func (m mediaMetadata) readMP4Boxes(data []byte, typ string) {
+	if typ == "meta" {
+		m.readMP4Meta(data)
+		return
+	}
+	for _, box := range parseMP4Boxes(data) {
+		switch {
+		case box.typ == "moov" || box.typ == "udta" || box.typ == "trak" || box.typ == "meta":
+			m.readMP4Boxes(box.data, box.typ)
+		case typ == "udta" && strings.HasPrefix(box.typ, "\xA9") && len(box.data) >= 4:
+			// QuickTime text, a length and language followed by the text
+			n := int(binary.BigEndian.Uint16(box.data))
+			if n <= len(box.data)-4 {
+				m.add(mp4ItemName(box.typ), string(box.data[4:4+n]))
+			}
+		}
+	}
+}
+
+// readMP4Meta reads the item list of a meta box, named by its keys box when it has one
+func (m mediaMetadata) readMP4Meta(data []byte) {
+	// in MP4 files the meta box has a version and flags, in QuickTime files it does not
+	if len(data) >= 8 && string(data[4:8]) != "hdlr" {
+		data = data[4:]
+	}
+
+	boxes := parseMP4Boxes(data)
+	keys := make([]string, 0)
+	for _, box := range boxes {
+		if box.typ != "keys" || len(box.data) < 8 {
+			continue
+		}
+		count := binary.BigEndian.Uint32(box.data[4:])
+		entries := box.data[8:]
+		for i := uint32(0); i < count && len(entries) >= 8; i++ {
+			size := binary.BigEndian.Uint32(entries)
+			if size < 8 || uint64(size) > uint64(len(entries)) {
+				break
+			}
+			keys = append(keys, string(entries[8:size]))
+			entries = entries[size:]
+		}
+	}
+
+	for _, box := range boxes {
+		if box.typ != "ilst" {
+			continue
+		}
+		for _, item := range parseMP4Boxes(box.data) {
+			name := mp4ItemName(item.typ)
+			if index := binary.BigEndian.Uint32([]byte(item.typ)); len(keys) != 0 && index >= 1 && index <= uint32(len(keys)) {
+				name = keys[index-1]
+			}
+			for _, child := range parseMP4Boxes(item.data) {
+				switch child.typ {
+				case "name":
+					// the name of a freeform item, after a version and flags
+					if len(child.data) >= 4 {
+						name = string(child.data[4:])
+					}
+				case "data":
+					// a type and locale, then the value
+					if len(child.data) >= 8 {
+						m.add(name, string(child.data[8:]))
+					}
+				}
+			}
+		}
+	}
+}
+
+// mp4ItemName names the text items of an item list
+func mp4ItemName(typ string) string {
+	switch typ {
+	case "\xA9cmt":
+		return "comment"
+	case "\xA9nam":
+		return "title"
+	case "\xA9des", "desc":
+		return "description"
+	}
+	return strings.TrimPrefix(typ, "\xA9")
+}
+
+// Matroska element IDs
+const (
+	ebmlSegment   = 0x18538067
+	ebmlCluster   = 0x1F43B675
+	ebmlTags      = 0x1254C367
+	ebmlTag       = 0x7373
+	ebmlSimpleTag = 0x67C8
+	ebmlTagName   = 0x45A3
+	ebmlTagString = 0x4487
+)
+
+// readMatroska reads the tags of a WebM or Matroska file
+func (m mediaMetadata) readMatroska(r io.Reader) error {
+	br := bufio.NewReader(r)
+	for {
+		id, err := readEBMLID(br)
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		size, known, err := readEBMLSize(br)
+		if err != nil {
+			return err
+		}
+		switch {
+		case id == ebmlSegment || id == ebmlCluster || !known:
+			// read the children of the segment, and of elements whose size is unknown
+			continue
+		case id == ebmlTags:
+			data, err := readLimited(br, size)
+			if err != nil {
+				return err
+			}
+			m.readMatroskaTags(data)
+		default:
+			if _, err := io.CopyN(io.Discard, br, int64(size)); err != nil {
+				if err == io.EOF {
+					return nil
+				}
+				return err
+			}
+		}
+	}
+}
+
+// readMatroskaTags reads the simple tags in the body of a master element
+func (m mediaMetadata) readMatroskaTags(data []byte) {
+	r := bytes.NewReader(data)
+	name := ""
+	for r.Len() > 0 {
+		id, err := readEBMLID(r)
+		if err != nil {
+			return
+		}
+		size, known, err := readEBMLSize(r)
+		if err != nil || !known || size > uint64(r.Len()) {
+			return
+		}
+		body := data[len(data)-r.Len() : len(data)-r.Len()+int(size)]
+		r.Seek(int64(size), io.SeekCurrent)
+
+		switch id {
+		case ebmlTag, ebmlSimpleTag:
+			m.readMatroskaTags(body)
+		case ebmlTagName:
+			name = string(body)
+		case ebmlTagString:
+			m.add(name, string(body))
+		}
+	}
+}
+
+// readEBMLID reads an element ID, which keeps its length marker
+func readEBMLID(r io.ByteReader) (uint32, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	length := 1
+	for mask := byte(0x80); length <= 4 && b&mask == 0; mask >>= 1 {
+		length++
+	}
+	if length > 4 {
+		return 0, errors.New("malformed EBML element ID")
+	}
+	id := uint32(b)
+	for i := 1; i < length; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		id = id<<8 | uint32(b)
+	}
+	return id, nil
+}
+
+// readEBMLSize reads an element size, returning whether the size is known
+func readEBMLSize(r io.ByteReader) (uint64, bool, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return 0, false, err
+	}
+	length := 1
+	mask := byte(0x80)
+	for ; length <= 8 && b&mask == 0; mask >>= 1 {
+		length++
+	}
+	if length > 8 {
+		return 0, false, errors.New("malformed EBML element size")
+	}
+	size := uint64(b & (mask - 1))
+	unknown := size == uint64(mask-1)
+	for i := 1; i < length; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, false, err
+		}
+		size = size<<8 | uint64(b)
+		unknown = unknown && b == 0xFF
+	}
+	return size, !unknown, nil
+}
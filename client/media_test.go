@@ -0,0 +1,134 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/richinsley/comfy2go/graphapi"
+)
+
+// newTestClient returns a client that knows the node types of the media fixtures
+func newTestClient() *ComfyClient {
+	var widthData interface{} = []interface{}{"INT", map[string]interface{}{"default": float64(512), "min": float64(16), "max": float64(4096)}}
+	var latentData interface{} = []interface{}{"LATENT"}
+	nodeObjects := &graphapi.NodeObjects{
+		Objects: map[string]*graphapi.NodeObject{
+			"EmptyLatentImage": {
+				Name:   "EmptyLatentImage",
+				Input:  &graphapi.NodeObjectInput{Required: map[string]*interface{}{"width": &widthData, "height": &widthData, "batch_size": &widthData}, OrderedRequired: []string{"width", "height", "batch_size"}},
+				Output: &[]interface{}{"LATENT"},
+			},
+			"SaveLatent": {
+				Name:  "SaveLatent",
+				Input: &graphapi.NodeObjectInput{Required: map[string]*interface{}{"samples": &latentData}, OrderedRequired: []string{"samples"}},
+			},
+		},
+	}
+	nodeObjects.PopulateInputProperties()
+	c := NewComfyClient("localhost", 8188, nil)
+	c.nodeobjects = nodeObjects
+	c.initialized = true
+	return c
+}
+
+// TestGetMediaMetadata tests finding the workflow and prompt in each format
+func TestGetMediaMetadata(t *testing.T) {
+	for _, name := range []string{"workflow.webp", "workflow.jpg", "workflow.flac", "workflow.opus", "workflow.mp4", "workflow.webm"} {
+		f, err := os.Open("../examples/testdata/media/" + name)
+		if err != nil {
+			t.Fatalf("Failed to open %s: %v", name, err)
+		}
+		metadata, err := GetMediaMetadata(f)
+		f.Close()
+		if err != nil {
+			t.Errorf("%s: failed to read metadata: %v", name, err)
+			continue
+		}
+
+		var workflow struct {
+			Nodes []map[string]interface{} `json:"nodes"`
+		}
+		if err := json.Unmarshal([]byte(metadata["workflow"]), &workflow); err != nil || len(workflow.Nodes) != 2 {
+			t.Errorf("%s: expected the workflow, got %q", name, metadata["workflow"])
+		}
+		var prompt map[string]graphapi.PromptNode
+		if err := json.Unmarshal([]byte(metadata["prompt"]), &prompt); err != nil || prompt["2"].ClassType != "SaveLatent" {
+			t.Errorf("%s: expected the prompt, got %q", name, metadata["prompt"])
+		}
+	}
+
+	flac, _ := os.ReadFile("../examples/testdata/media/workflow.flac")
+	if _, err := GetMediaMetadata(bytes.NewReader(flac[4:])); !errors.Is(err, ErrUnknownMediaFormat) {
+		t.Errorf("Expected an unknown format, got %v", err)
+	}
+}
+
+// TestNewGraphFromMediaReader tests creating a graph from a video, and from a file
+// that only holds a prompt
+func TestNewGraphFromMediaReader(t *testing.T) {
+	c := newTestClient()
+
+	graph, _, err := c.NewGraphFromMediaFile("../examples/testdata/media/workflow.mp4")
+	if err != nil {
+		t.Fatalf("Failed to create graph: %v", err)
+	}
+	if len(graph.Nodes) != 2 || graph.GetNodeById(1).Type != "EmptyLatentImage" {
+		t.Errorf("Unexpected graph: %+v", graph.Nodes)
+	}
+
+	// only the prompt
+	data, _ := os.ReadFile("../examples/testdata/media/workflow.flac")
+	metadata, _ := GetMediaMetadata(bytes.NewReader(data))
+	var buf bytes.Buffer
+	if err := WritePngMetadata(bytes.NewReader(newTestPng(t)), &buf, map[string]string{"prompt": metadata["prompt"]}); err != nil {
+		t.Fatalf("Failed to write PNG: %v", err)
+	}
+	graph, _, err = c.NewGraphFromMediaReader(&buf)
+	if err != nil {
+		t.Fatalf("Failed to create graph from prompt: %v", err)
+	}
+	if p, err := graph.Get("1.width"); err != nil || fmt.Sprint(p.GetValue()) != "512" {
+		t.Errorf("Expected the prompt's width, got %v %v", p, err)
+	}
+}
+
+// TestNewPromptFromPNGReader tests editing and queueing the prompt of a PNG without a workflow
+func TestNewPromptFromPNGReader(t *testing.T) {
+	c := newTestClient()
+	data, _ := os.ReadFile("../examples/testdata/media/workflow.flac")
+	metadata, _ := GetMediaMetadata(bytes.NewReader(data))
+	var png bytes.Buffer
+	if err := WritePngMetadata(bytes.NewReader(newTestPng(t)), &png, map[string]string{"prompt": metadata["prompt"]}); err != nil {
+		t.Fatalf("Failed to write PNG: %v", err)
+	}
+
+	// a graph is made from the prompt, as it is from other media
+	graph, _, err := c.NewGraphFromPNGReader(bytes.NewReader(png.Bytes()))
+	if err != nil {
+		t.Fatalf("Failed to create graph from prompt: %v", err)
+	}
+	if p, err := graph.Get("1.width"); err != nil || fmt.Sprint(p.GetValue()) != "512" {
+		t.Errorf("Expected the prompt's width, got %v %v", p, err)
+	}
+
+	ep, _, err := c.NewPromptFromPNGReader(bytes.NewReader(png.Bytes()))
+	if err != nil {
+		t.Fatalf("Failed to read prompt: %v", err)
+	}
+	if ep.Prompt.ClientID != c.ClientID() {
+		t.Errorf("Expected the client's ID, got %q", ep.Prompt.ClientID)
+	}
+	if err := ep.Set("EmptyLatentImage.width", 768); err != nil {
+		t.Fatalf("Failed to set width: %v", err)
+	}
+	if err := ep.Set("EmptyLatentImage.width", 8192); err == nil {
+		t.Errorf("Expected an out of range width to be rejected")
+	}
+	if v := ep.Prompt.Nodes["1"].Inputs["width"]; v != int64(768) {
+		t.Errorf("Expected width 768, got %v", v)
+	}
+}
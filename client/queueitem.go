@@ -3,12 +3,18 @@ package client
 import "github.com/richinsley/comfy2go/graphapi"
 
 type QueueItem struct {
-	PromptID    string                 `json:"prompt_id"`
-	Number      int                    `json:"number"`
-	NodeErrors  map[string]interface{} `json:"node_errors"`
-	Messages    chan PromptMessage     `json:"-"`
-	Workflow    *graphapi.Graph        `json:"-"`
-	webSocket *WebSocketConnection   `json:"-"`
+	PromptID   string                 `json:"prompt_id"`
+	Number     int                    `json:"number"`
+	NodeErrors map[string]interface{} `json:"node_errors"`
+	Messages   chan PromptMessage     `json:"-"`
+	Workflow   *graphapi.Graph        `json:"-"`
+	// Seeds are the values of controlled seed inputs that were queued, keyed by
+	// prompt node ID and input name
+	Seeds map[string]map[string]int64 `json:"-"`
+	// ExpandedText is the dynamic prompt text that was queued, keyed by prompt
+	// node ID and input name
+	ExpandedText map[string]map[string]string `json:"-"`
+	webSocket    *WebSocketConnection         `json:"-"`
 }
 
 // Close closes the websocket connection associated with the QueueItem
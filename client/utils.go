@@ -2,11 +2,22 @@ package client
 
 import (
 	"bytes"
+	"compress/zlib"
 	"encoding/binary"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"hash/crc32"
 	"io"
+	"sort"
+
+	"github.com/richinsley/comfy2go/graphapi"
 )
 
+var pngSignature = []byte{137, 80, 78, 71, 13, 10, 26, 10}
+
+// GetPngMetadata returns the text chunks of a PNG file, keyed by their keyword.
+// tEXt chunks are read as is, and compressed zTXt and iTXt chunks are decompressed.
 func GetPngMetadata(r io.Reader) (map[string]string, error) {
 	header := make([]byte, 8)
 	_, err := io.ReadFull(r, header)
@@ -14,7 +25,7 @@ func GetPngMetadata(r io.Reader) (map[string]string, error) {
 		return nil, err
 	}
 
-	if !bytes.Equal(header, []byte{137, 80, 78, 71, 13, 10, 26, 10}) {
+	if !bytes.Equal(header, pngSignature) {
 		return nil, errors.New("not a valid PNG file")
 	}
 
@@ -36,23 +47,21 @@ func GetPngMetadata(r io.Reader) (map[string]string, error) {
 			return nil, err
 		}
 
-		if string(chunkType) == "tEXt" {
+		switch string(chunkType) {
+		case "tEXt", "zTXt", "iTXt":
 			chunkData := make([]byte, length)
 			_, err = io.ReadFull(r, chunkData)
 			if err != nil {
 				return nil, err
 			}
 
-			keywordEnd := bytes.IndexByte(chunkData, 0)
-			if keywordEnd == -1 {
-				return nil, errors.New("malformed tEXt chunk")
+			keyword, text, err := parsePngTextChunk(string(chunkType), chunkData)
+			if err != nil {
+				return nil, err
 			}
-
-			keyword := string(chunkData[:keywordEnd])
-			contentJson := string(chunkData[keywordEnd+1:])
-			txtChunks[keyword] = contentJson
-		} else {
-			// Skip the chunk data if it's not tEXt
+			txtChunks[keyword] = text
+		default:
+			// Skip the chunk data if it's not text
 			_, err = io.CopyN(io.Discard, r, int64(length))
 			if err != nil {
 				return nil, err
@@ -64,7 +73,223 @@ func GetPngMetadata(r io.Reader) (map[string]string, error) {
 		if err != nil {
 			return nil, err
 		}
+
+		if string(chunkType) == "IEND" {
+			break
+		}
 	}
 
 	return txtChunks, nil
 }
+
+// parsePngTextChunk returns the keyword and text of a tEXt, zTXt or iTXt chunk
+func parsePngTextChunk(chunkType string, data []byte) (string, string, error) {
+	keywordEnd := bytes.IndexByte(data, 0)
+	if keywordEnd == -1 {
+		return "", "", fmt.Errorf("malformed %s chunk", chunkType)
+	}
+	keyword := string(data[:keywordEnd])
+	data = data[keywordEnd+1:]
+
+	switch chunkType {
+	case "zTXt":
+		// compression method, then the compressed text
+		if len(data) < 1 || data[0] != 0 {
+			return "", "", errors.New("malformed zTXt chunk")
+		}
+		text, err := inflate(data[1:])
+		if err != nil {
+			return "", "", fmt.Errorf("zTXt chunk %q: %w", keyword, err)
+		}
+		return keyword, text, nil
+	case "iTXt":
+		// compression flag and method, language tag, translated keyword, then the text
+		if len(data) < 2 {
+			return "", "", errors.New("malformed iTXt chunk")
+		}
+		compressed := data[0] == 1
+		data = data[2:]
+		for i := 0; i < 2; i++ {
+			end := bytes.IndexByte(data, 0)
+			if end == -1 {
+				return "", "", errors.New("malformed iTXt chunk")
+			}
+			data = data[end+1:]
+		}
+		if compressed {
+			text, err := inflate(data)
+			if err != nil {
+				return "", "", fmt.Errorf("iTXt chunk %q: %w", keyword, err)
+			}
+			return keyword, text, nil
+		}
+	}
+	return keyword, string(data), nil
+}
+
+func inflate(data []byte) (string, error) {
+	zr, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	defer zr.Close()
+	text, err := io.ReadAll(zr)
+	if err != nil {
+		return "", err
+	}
+	return string(text), nil
+}
+
+// WritePngMetadata copies a PNG file from r to w, with the given text metadata.  Text
+// chunks with the same keywords are replaced, and the others are kept.  ASCII text is
+// written as tEXt chunks, and any other text as uncompressed UTF-8 iTXt chunks.  The
+// chunks are inserted before the image data, ordered by keyword.
+func WritePngMetadata(r io.Reader, w io.Writer, metadata map[string]string) error {
+	keywords := make([]string, 0, len(metadata))
+	for k := range metadata {
+		if len(k) == 0 || len(k) > 79 || bytes.IndexByte([]byte(k), 0) != -1 {
+			return fmt.Errorf("invalid PNG text keyword %q", k)
+		}
+		keywords = append(keywords, k)
+	}
+	sort.Strings(keywords)
+
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return err
+	}
+	if !bytes.Equal(header, pngSignature) {
+		return errors.New("not a valid PNG file")
+	}
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+
+	written := false
+	writeText := func() error {
+		written = true
+		for _, k := range keywords {
+			chunkType, data := pngTextChunk(k, metadata[k])
+			if err := writePngChunk(w, chunkType, data); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for {
+		var length uint32
+		if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+			if err == io.EOF {
+				return errors.New("PNG file has no IEND chunk")
+			}
+			return err
+		}
+		chunkType := make([]byte, 4)
+		if _, err := io.ReadFull(r, chunkType); err != nil {
+			return err
+		}
+		// the data and CRC are copied as they are
+		chunk := make([]byte, int(length)+4)
+		if _, err := io.ReadFull(r, chunk); err != nil {
+			return err
+		}
+
+		switch string(chunkType) {
+		case "tEXt", "zTXt", "iTXt":
+			if end := bytes.IndexByte(chunk[:length], 0); end != -1 {
+				if _, ok := metadata[string(chunk[:end])]; ok {
+					// replaced
+					continue
+				}
+			}
+		case "IDAT", "IEND":
+			if !written {
+				if err := writeText(); err != nil {
+					return err
+				}
+			}
+		}
+
+		if err := binary.Write(w, binary.BigEndian, length); err != nil {
+			return err
+		}
+		if _, err := w.Write(chunkType); err != nil {
+			return err
+		}
+		if _, err := w.Write(chunk); err != nil {
+			return err
+		}
+		if string(chunkType) == "IEND" {
+			return nil
+		}
+	}
+}
+
+// pngTextChunk returns the type and data of the chunk for a keyword and text
+func pngTextChunk(keyword string, text string) (string, []byte) {
+	var buf bytes.Buffer
+	buf.WriteString(keyword)
+	buf.WriteByte(0)
+	for i := 0; i < len(text); i++ {
+		if text[i] >= 0x80 {
+			// no compression, and no language tag or translated keyword
+			buf.Write([]byte{0, 0, 0, 0})
+			buf.WriteString(text)
+			return "iTXt", buf.Bytes()
+		}
+	}
+	buf.WriteString(text)
+	return "tEXt", buf.Bytes()
+}
+
+func writePngChunk(w io.Writer, chunkType string, data []byte) error {
+	if err := binary.Write(w, binary.BigEndian, uint32(len(data))); err != nil {
+		return err
+	}
+	crc := crc32.NewIEEE()
+	crc.Write([]byte(chunkType))
+	crc.Write(data)
+	if _, err := io.WriteString(w, chunkType); err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	return binary.Write(w, binary.BigEndian, crc.Sum32())
+}
+
+// GetWorkflowPngMetadata returns the metadata ComfyUI's SaveImage embeds: the graph as
+// "workflow", and the prompt's nodes as "prompt".  When graph is nil, the prompt's
+// workflow is used.  Either can be nil.
+func GetWorkflowPngMetadata(graph *graphapi.Graph, prompt *graphapi.Prompt) (map[string]string, error) {
+	metadata := make(map[string]string)
+	if graph == nil && prompt != nil {
+		graph = prompt.ExtraData.PngInfo.Workflow
+	}
+	if graph != nil {
+		workflow, err := graph.GraphToJSON()
+		if err != nil {
+			return nil, err
+		}
+		metadata["workflow"] = workflow
+	}
+	if prompt != nil {
+		data, err := json.Marshal(prompt.Nodes)
+		if err != nil {
+			return nil, err
+		}
+		metadata["prompt"] = string(data)
+	}
+	return metadata, nil
+}
+
+// WritePngWorkflow copies a PNG file from r to w, embedding a graph and prompt the
+// way ComfyUI's SaveImage does.  See GetWorkflowPngMetadata.
+func WritePngWorkflow(r io.Reader, w io.Writer, graph *graphapi.Graph, prompt *graphapi.Prompt) error {
+	metadata, err := GetWorkflowPngMetadata(graph, prompt)
+	if err != nil {
+		return err
+	}
+	return WritePngMetadata(r, w, metadata)
+}
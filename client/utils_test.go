@@ -0,0 +1,109 @@
+package client
+
+import (
+	"bytes"
+	"compress/zlib"
+	"image"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/richinsley/comfy2go/graphapi"
+)
+
+func newTestPng(t *testing.T) []byte {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 4, 4))); err != nil {
+		t.Fatalf("Failed to encode PNG: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// TestWritePngMetadata tests that written metadata reads back, replaces existing
+// chunks, and leaves a valid PNG
+func TestWritePngMetadata(t *testing.T) {
+	var first bytes.Buffer
+	err := WritePngMetadata(bytes.NewReader(newTestPng(t)), &first, map[string]string{"workflow": "old", "other": "kept"})
+	if err != nil {
+		t.Fatalf("Failed to write metadata: %v", err)
+	}
+
+	var second bytes.Buffer
+	err = WritePngMetadata(bytes.NewReader(first.Bytes()), &second, map[string]string{"workflow": "{\"title\": \"Café ☕\"}"})
+	if err != nil {
+		t.Fatalf("Failed to write metadata: %v", err)
+	}
+
+	metadata, err := GetPngMetadata(bytes.NewReader(second.Bytes()))
+	if err != nil {
+		t.Fatalf("Failed to read metadata: %v", err)
+	}
+	if metadata["workflow"] != "{\"title\": \"Café ☕\"}" || metadata["other"] != "kept" {
+		t.Errorf("Unexpected metadata: %v", metadata)
+	}
+	if n := bytes.Count(second.Bytes(), []byte("workflow\x00")); n != 1 {
+		t.Errorf("Expected the workflow chunk to be replaced, found %d", n)
+	}
+	if !bytes.Contains(second.Bytes(), []byte("iTXtworkflow")) {
+		t.Errorf("Expected non-ASCII text to be written as iTXt")
+	}
+
+	// the image decoder checks the CRCs
+	if _, err := png.Decode(bytes.NewReader(second.Bytes())); err != nil {
+		t.Errorf("Failed to decode the written PNG: %v", err)
+	}
+
+	if err := WritePngMetadata(bytes.NewReader(newTestPng(t)), &bytes.Buffer{}, map[string]string{"": "x"}); err == nil {
+		t.Errorf("Expected an empty keyword to be rejected")
+	}
+}
+
+// TestGetPngMetadataCompressed tests reading zTXt and compressed iTXt chunks
+func TestGetPngMetadataCompressed(t *testing.T) {
+	compress := func(s string) []byte {
+		var buf bytes.Buffer
+		zw := zlib.NewWriter(&buf)
+		zw.Write([]byte(s))
+		zw.Close()
+		return buf.Bytes()
+	}
+
+	data := newTestPng(t)
+	var buf bytes.Buffer
+	buf.Write(data[:33]) // signature and IHDR
+	writePngChunk(&buf, "zTXt", append([]byte("prompt\x00\x00"), compress("{\"1\": {}}")...))
+	writePngChunk(&buf, "iTXt", append([]byte("workflow\x00\x01\x00en\x00Workflow\x00"), compress("{\"nodes\": []}")...))
+	buf.Write(data[33:])
+
+	metadata, err := GetPngMetadata(&buf)
+	if err != nil {
+		t.Fatalf("Failed to read metadata: %v", err)
+	}
+	if metadata["prompt"] != "{\"1\": {}}" || metadata["workflow"] != "{\"nodes\": []}" {
+		t.Errorf("Unexpected metadata: %v", metadata)
+	}
+}
+
+// TestWritePngWorkflow tests embedding a graph and prompt the way SaveImage does
+func TestWritePngWorkflow(t *testing.T) {
+	graph := &graphapi.Graph{Nodes: []*graphapi.GraphNode{}, Version: 0.4}
+	prompt := &graphapi.Prompt{
+		Nodes: map[string]graphapi.PromptNode{"1": {ClassType: "SaveImage", Inputs: map[string]interface{}{"filename_prefix": "ComfyUI"}}},
+	}
+	prompt.ExtraData.PngInfo.Workflow = graph
+
+	var buf bytes.Buffer
+	if err := WritePngWorkflow(bytes.NewReader(newTestPng(t)), &buf, nil, prompt); err != nil {
+		t.Fatalf("Failed to write workflow: %v", err)
+	}
+	metadata, err := GetPngMetadata(&buf)
+	if err != nil {
+		t.Fatalf("Failed to read metadata: %v", err)
+	}
+	if !strings.HasPrefix(metadata["prompt"], "{\"1\":{\"inputs\"") {
+		t.Errorf("Expected the prompt's nodes, got %s", metadata["prompt"])
+	}
+	if !strings.Contains(metadata["workflow"], "\"version\":0.4") {
+		t.Errorf("Expected the prompt's workflow, got %s", metadata["workflow"])
+	}
+}
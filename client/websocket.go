@@ -3,6 +3,7 @@ package client
 import (
 	"fmt"
 	"log/slog"
+	"sync"
 
 	"github.com/gorilla/websocket"
 )
@@ -12,6 +13,7 @@ type WebSocketConnection struct {
 	Conn         *websocket.Conn
 	IsConnected  bool
 	Dialer       websocket.Dialer
+	closeMu      sync.Mutex
 }
 
 // Connect connects to the WebSocket
@@ -44,6 +46,10 @@ func (w *WebSocketConnection) HandleMessages(handler func(message string)) {
 
 // Close the WebSocket connection
 func (w *WebSocketConnection) Close() {
+	// the message handler closes the connection when reading fails, which may
+	// race with the QueueItem being closed
+	w.closeMu.Lock()
+	defer w.closeMu.Unlock()
 	if w.IsConnected && w.Conn != nil {
 		w.Conn.Close()
 		w.IsConnected = false
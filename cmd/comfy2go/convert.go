@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/richinsley/comfy2go/client"
+	"github.com/richinsley/comfy2go/graphapi"
+)
+
+// workflow formats
+const (
+	formatWorkflow = "workflow"
+	formatAPI      = "api"
+)
+
+func runConvert(args []string) error {
+	fs, serverAddress, serverPort := newFlagSet("convert")
+	to := fs.String("to", "", "Format to convert to, \"workflow\" or \"api\".  Defaults to workflow for media and API files, and api for workflow files")
+	output := fs.String("o", "", "File to write to, defaults to stdout")
+	schema := fs.String("schema", "", "Schema version of the workflow written, \"0.4\" or \"1\".  Defaults to the version read")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("expected one input file")
+	}
+	if *to != "" && *to != formatWorkflow && *to != formatAPI {
+		return fmt.Errorf("unknown format %q", *to)
+	}
+	var version float32
+	switch *schema {
+	case "":
+	case "0.4":
+		version = graphapi.SchemaVersion04
+	case "1":
+		version = graphapi.SchemaVersion1
+	default:
+		return fmt.Errorf("unknown schema version %q", *schema)
+	}
+
+	data, from, media, err := readWorkflowFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	// workflow files are converted to API prompts, unless only their schema is converted
+	if *to == "" {
+		*to = formatWorkflow
+		if from == formatWorkflow && !media && version == 0 {
+			*to = formatAPI
+		}
+	}
+
+	// converting between formats needs the node definitions of a server
+	if from != *to {
+		clients, err := newClients(*serverAddress, *serverPort)
+		if err != nil {
+			return err
+		}
+		data, err = convertWorkflow(clients[0], data, from)
+		if err != nil {
+			return err
+		}
+	}
+	if *to == formatWorkflow && version != 0 {
+		if data, err = convertSchema(data, version); err != nil {
+			return err
+		}
+	}
+
+	var out bytes.Buffer
+	if err := json.Indent(&out, data, "", "  "); err != nil {
+		return err
+	}
+	out.WriteByte('\n')
+	if *output == "" {
+		_, err = os.Stdout.Write(out.Bytes())
+		return err
+	}
+	return os.WriteFile(*output, out.Bytes(), 0644)
+}
+
+// readWorkflowFile reads a workflow or an API prompt from a JSON file, or from the
+// metadata of an image, audio or video file, returning the JSON, its format, and
+// whether it was read from a media file
+func readWorkflowFile(path string) ([]byte, string, bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", false, err
+	}
+	if !bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		metadata, err := client.GetMediaMetadata(bytes.NewReader(data))
+		if err != nil {
+			return nil, "", true, fmt.Errorf("%s: %w", path, err)
+		}
+		if workflow, ok := metadata["workflow"]; ok {
+			return []byte(workflow), formatWorkflow, true, nil
+		}
+		if prompt, ok := metadata["prompt"]; ok {
+			return []byte(prompt), formatAPI, true, nil
+		}
+		return nil, "", true, fmt.Errorf("%s does not contain a workflow", path)
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, "", false, fmt.Errorf("%s: %w", path, err)
+	}
+	if nodes, ok := fields["nodes"]; ok && bytes.HasPrefix(bytes.TrimSpace(nodes), []byte("[")) {
+		return data, formatWorkflow, false, nil
+	}
+	return data, formatAPI, false, nil
+}
+
+// convertWorkflow converts a workflow to an API prompt, or an API prompt to a workflow
+func convertWorkflow(c *client.ComfyClient, data []byte, from string) ([]byte, error) {
+	if from == formatAPI {
+		graph, missing, err := c.NewGraphFromPromptReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, missingError(err, missing)
+		}
+		data, err := graph.GraphToJSON()
+		return []byte(data), err
+	}
+
+	graph, missing, err := c.NewGraphFromJsonReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, missingError(err, missing)
+	}
+	prompt, err := graph.GraphToPrompt(c.ClientID())
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(prompt.Nodes)
+}
+
+// convertSchema converts a workflow to another schema version
+func convertSchema(data []byte, version float32) ([]byte, error) {
+	graph := &graphapi.Graph{}
+	if err := json.Unmarshal(data, graph); err != nil {
+		return nil, err
+	}
+	if err := graph.ConvertSchema(version); err != nil {
+		return nil, err
+	}
+	workflow, err := graph.GraphToJSON()
+	return []byte(workflow), err
+}
+
+func missingError(err error, missing *[]string) error {
+	if missing != nil && len(*missing) != 0 {
+		return fmt.Errorf("%w: %s", err, strings.Join(*missing, ", "))
+	}
+	return err
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/richinsley/comfy2go/client"
+)
+
+// TestConvertPngToWorkflow converts the workflow embedded in a PNG without -to,
+// which must write the workflow without contacting a server
+func TestConvertPngToWorkflow(t *testing.T) {
+	workflow, err := os.ReadFile("../../examples/testdata/reroutes.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var img bytes.Buffer
+	if err := png.Encode(&img, image.NewRGBA(image.Rect(0, 0, 1, 1))); err != nil {
+		t.Fatal(err)
+	}
+	var withMetadata bytes.Buffer
+	if err := client.WritePngMetadata(&img, &withMetadata, map[string]string{"workflow": string(workflow)}); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	input := filepath.Join(dir, "input.png")
+	output := filepath.Join(dir, "output.json")
+	if err := os.WriteFile(input, withMetadata.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// no server listens on port 1, so any attempt to convert through one fails
+	if err := runConvert([]string{"-address", "127.0.0.1", "-port", "1", "-o", output, input}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want bytes.Buffer
+	if err := json.Indent(&want, workflow, "", "  "); err != nil {
+		t.Fatal(err)
+	}
+	want.WriteByte('\n')
+	if !bytes.Equal(got, want.Bytes()) {
+		t.Errorf("converted workflow differs from the embedded workflow")
+	}
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/richinsley/comfy2go/graphapi"
+)
+
+// inspection is the description of a workflow printed by the inspect command
+type inspection struct {
+	Nodes      []inspectedNode     `json:"nodes"`
+	Groups     []inspectedGroup    `json:"groups"`
+	Subgraphs  []inspectedSubgraph `json:"subgraphs"`
+	Properties []inspectedProperty `json:"properties"`
+	Outputs    []inspectedNode     `json:"outputs"`
+}
+
+type inspectedNode struct {
+	ID       int    `json:"id"`
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Mode     string `json:"mode"`
+	Subgraph string `json:"subgraph,omitempty"` // the definition of a subgraph instance
+}
+
+type inspectedGroup struct {
+	Title string `json:"title"`
+	Nodes []int  `json:"nodes"`
+}
+
+type inspectedSubgraph struct {
+	ID        string   `json:"id"`
+	Name      string   `json:"name"`
+	Nodes     int      `json:"nodes"`
+	Inputs    []string `json:"inputs"`
+	Outputs   []string `json:"outputs"`
+	Instances []int    `json:"instances"`
+}
+
+type inspectedProperty struct {
+	Path    string      `json:"path"` // the path to use with run -set
+	Type    string      `json:"type"`
+	Value   interface{} `json:"value"`
+	Default interface{} `json:"default,omitempty"`
+	Choices []string    `json:"choices,omitempty"`
+}
+
+func runInspect(args []string) error {
+	fs, serverAddress, serverPort := newFlagSet("inspect")
+	asJSON := fs.Bool("json", false, "Print JSON")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("expected one workflow file")
+	}
+
+	clients, err := newClients(*serverAddress, *serverPort)
+	if err != nil {
+		return err
+	}
+	graph, err := loadGraph(clients[0], fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	info := inspectGraph(graph)
+	if *asJSON {
+		return writeJSON(info)
+	}
+	printInspection(info)
+	return nil
+}
+
+func inspectGraph(graph *graphapi.Graph) *inspection {
+	retv := &inspection{
+		Nodes:      make([]inspectedNode, 0),
+		Groups:     make([]inspectedGroup, 0),
+		Subgraphs:  make([]inspectedSubgraph, 0),
+		Properties: make([]inspectedProperty, 0),
+		Outputs:    make([]inspectedNode, 0),
+	}
+
+	instances := make(map[string][]int)
+	for _, n := range graph.NodesInExecutionOrder {
+		in := inspectedNode{ID: n.ID, Type: n.Type, Title: displayTitle(n), Mode: modeName(n.Mode)}
+		if n.IsSubgraph && n.SubgraphDef != nil {
+			in.Type = "subgraph"
+			in.Subgraph = n.SubgraphDef.ID
+			instances[n.SubgraphDef.ID] = append(instances[n.SubgraphDef.ID], n.ID)
+		}
+		retv.Nodes = append(retv.Nodes, in)
+
+		retv.Properties = append(retv.Properties, inspectProperties(fmt.Sprint(n.ID), n)...)
+		if n.IsSubgraph && n.SubgraphDef != nil {
+			for _, sn := range n.SubgraphDef.Nodes {
+				retv.Properties = append(retv.Properties, inspectProperties(fmt.Sprintf("%d:%d", n.ID, sn.ID), sn)...)
+			}
+		}
+		if n.IsOutput {
+			retv.Outputs = append(retv.Outputs, in)
+		}
+	}
+
+	for _, g := range graph.Groups {
+		ig := inspectedGroup{Title: g.Title, Nodes: make([]int, 0)}
+		for _, n := range graph.GetNodesInGroup(g) {
+			ig.Nodes = append(ig.Nodes, n.ID)
+		}
+		retv.Groups = append(retv.Groups, ig)
+	}
+
+	if graph.Definitions != nil {
+		for _, sg := range graph.Definitions.Subgraphs {
+			is := inspectedSubgraph{
+				ID:        sg.ID,
+				Name:      sg.Name,
+				Nodes:     len(sg.Nodes),
+				Inputs:    make([]string, 0, len(sg.Inputs)),
+				Outputs:   make([]string, 0, len(sg.Outputs)),
+				Instances: instances[sg.ID],
+			}
+			for _, p := range sg.Inputs {
+				is.Inputs = append(is.Inputs, fmt.Sprintf("%s (%s)", p.Name, p.Type))
+			}
+			for _, p := range sg.Outputs {
+				is.Outputs = append(is.Outputs, fmt.Sprintf("%s (%s)", p.Name, p.Type))
+			}
+			if is.Instances == nil {
+				is.Instances = make([]int, 0)
+			}
+			retv.Subgraphs = append(retv.Subgraphs, is)
+		}
+	}
+	return retv
+}
+
+// inspectProperties returns the settable properties of a node
+func inspectProperties(nodePath string, n *graphapi.GraphNode) []inspectedProperty {
+	retv := make([]inspectedProperty, 0)
+	for _, p := range n.GetPropertiesByIndex() {
+		if !p.Settable() && p.TypeString() != "IMAGEUPLOAD" {
+			continue
+		}
+		// primitives expose the properties of the nodes they are connected to
+		if p.GetTargetNode() != nil && p.GetTargetNode() != n {
+			continue
+		}
+		ip := inspectedProperty{
+			Path:  nodePath + "." + p.Name(),
+			Type:  p.TypeString(),
+			Value: p.GetValue(),
+		}
+		if p.HasDefault() {
+			ip.Default = p.GetDefault()
+		}
+		if cp, ok := p.ToComboProperty(); ok && !cp.IsBool {
+			ip.Choices = cp.Values
+		}
+		retv = append(retv, ip)
+	}
+	return retv
+}
+
+func printInspection(info *inspection) {
+	fmt.Println("Nodes:")
+	for _, n := range info.Nodes {
+		fmt.Printf("  %-6d %-30s %s", n.ID, n.Title, n.Type)
+		if n.Mode != "always" {
+			fmt.Printf(" (%s)", n.Mode)
+		}
+		fmt.Println()
+	}
+
+	if len(info.Groups) != 0 {
+		fmt.Println("\nGroups:")
+		for _, g := range info.Groups {
+			fmt.Printf("  %-30s nodes %s\n", g.Title, joinInts(g.Nodes))
+		}
+	}
+
+	if len(info.Subgraphs) != 0 {
+		fmt.Println("\nSubgraphs:")
+		for _, sg := range info.Subgraphs {
+			fmt.Printf("  %s (%s): %d nodes, instances %s\n", sg.Name, sg.ID, sg.Nodes, joinInts(sg.Instances))
+			fmt.Printf("    inputs:  %s\n", strings.Join(sg.Inputs, ", "))
+			fmt.Printf("    outputs: %s\n", strings.Join(sg.Outputs, ", "))
+		}
+	}
+
+	fmt.Println("\nProperties:")
+	for _, p := range info.Properties {
+		fmt.Printf("  %-40s %-12s %v\n", p.Path, p.Type, p.Value)
+	}
+
+	fmt.Println("\nOutputs:")
+	for _, n := range info.Outputs {
+		fmt.Printf("  %-6d %-30s %s\n", n.ID, n.Title, n.Type)
+	}
+}
+
+// displayTitle returns the title of a node as it is shown in the editor
+func displayTitle(n *graphapi.GraphNode) string {
+	if n.Title != "" {
+		return n.Title
+	}
+	if n.DisplayName != "" {
+		return n.DisplayName
+	}
+	if n.IsSubgraph && n.SubgraphDef != nil {
+		return n.SubgraphDef.Name
+	}
+	return n.Type
+}
+
+func modeName(mode int) string {
+	switch mode {
+	case 0:
+		return "always"
+	case 2:
+		return "muted"
+	case 4:
+		return "bypassed"
+	}
+	return fmt.Sprint(mode)
+}
+
+func joinInts(v []int) string {
+	s := make([]string, len(v))
+	for i, n := range v {
+		s[i] = fmt.Sprint(n)
+	}
+	return strings.Join(s, ", ")
+}
+
+// writeJSON prints a value as indented JSON
+func writeJSON(v interface{}) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
@@ -0,0 +1,156 @@
+// Command comfy2go runs and serves ComfyUI workflows from the command line.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/richinsley/comfy2go/client"
+)
+
+// command is a comfy2go subcommand
+type command struct {
+	usage string
+	help  string
+	run   func(args []string) error
+}
+
+var commands map[string]*command
+
+func init() {
+	commands = map[string]*command{
+		"convert": {
+			usage: "convert [OPTIONS] workflow.json|image/audio/video|prompt.json",
+			help:  "convert between media, workflow and API formats",
+			run:   runConvert,
+		},
+		"inspect": {
+			usage: "inspect [OPTIONS] workflow.json|image/audio/video",
+			help:  "list the nodes, groups, subgraphs, properties and outputs of a workflow",
+			run:   runInspect,
+		},
+		"models": {
+			usage: "models [OPTIONS] [folder...]",
+			help:  "list the model folders, or the models in folders",
+			run:   runModels,
+		},
+		"nodes": {
+			usage: "nodes [OPTIONS] [type...]",
+			help:  "list the node types of the server with their inputs and outputs",
+			run:   runNodes,
+		},
+		"render": {
+			usage: "render [OPTIONS] workflow.json|image/audio/video",
+			help:  "draw a workflow as SVG, Graphviz DOT or Mermaid",
+			run:   runRender,
+		},
+		"run": {
+			usage: "run [OPTIONS] workflow.json|image/audio/video",
+			help:  "run a workflow and save its outputs",
+			run:   runRun,
+		},
+		"serve": {
+			usage: "serve [OPTIONS] workflow.json...",
+			help:  "mount workflows as HTTP endpoints",
+			run:   runServe,
+		},
+	}
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s <command> [OPTIONS] [ARGS]\n\nCommands:\n", os.Args[0])
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", name, commands[name].help)
+	}
+	fmt.Fprintf(os.Stderr, "\nRun '%s <command> -h' for the options of a command.\n", os.Args[0])
+}
+
+func main() {
+	log.SetFlags(0)
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", os.Args[1])
+		usage()
+		os.Exit(2)
+	}
+	if err := cmd.run(os.Args[2:]); err != nil {
+		log.Println("Error:", err)
+		os.Exit(1)
+	}
+}
+
+// newFlagSet creates the flag set of a command, with the options for connecting to ComfyUI
+func newFlagSet(name string) (*flag.FlagSet, *string, *int) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	serverAddress := fs.String("address", "localhost", "Server address, or a comma separated list of host[:port] addresses")
+	serverPort := fs.Int("port", 8188, "Server port")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s %s\n\nOptions:\n", os.Args[0], commands[name].usage)
+		fs.PrintDefaults()
+	}
+	return fs, serverAddress, serverPort
+}
+
+// newClients creates and initializes a client for each address
+func newClients(addresses string, port int) ([]*client.ComfyClient, error) {
+	retv := make([]*client.ComfyClient, 0)
+	for _, addr := range strings.Split(addresses, ",") {
+		addr = strings.TrimSpace(addr)
+		if addr == "" {
+			continue
+		}
+		host, p := addr, port
+		if i := strings.LastIndex(addr, ":"); i != -1 {
+			v, err := strconv.Atoi(addr[i+1:])
+			if err != nil {
+				return nil, fmt.Errorf("invalid address %q", addr)
+			}
+			host, p = addr[:i], v
+		}
+
+		c, err := newClient(host, p)
+		if err != nil {
+			return nil, err
+		}
+		retv = append(retv, c)
+	}
+	if len(retv) == 0 {
+		return nil, fmt.Errorf("no server address given")
+	}
+	return retv, nil
+}
+
+// newClient creates and initializes a client
+func newClient(host string, port int) (*client.ComfyClient, error) {
+	c := client.NewComfyClient(host, port, nil)
+	if err := c.Init(); err != nil {
+		return nil, fmt.Errorf("initializing client for %s:%d: %w", host, port, err)
+	}
+	return c, nil
+}
+
+// stringList is a flag that can be repeated
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ", ")
+}
+
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
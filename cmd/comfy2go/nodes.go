@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/richinsley/comfy2go/graphapi"
+)
+
+// nodeInfo is the description of a node type printed by the nodes command
+type nodeInfo struct {
+	Name        string       `json:"name"`
+	DisplayName string       `json:"display_name"`
+	Category    string       `json:"category"`
+	Description string       `json:"description,omitempty"`
+	OutputNode  bool         `json:"output_node"`
+	Inputs      []inputInfo  `json:"inputs"`
+	Outputs     []outputInfo `json:"outputs"`
+}
+
+type inputInfo struct {
+	Name     string      `json:"name"`
+	Type     string      `json:"type"`
+	Optional bool        `json:"optional"`
+	Spec     interface{} `json:"spec"` // the input's specification as sent by the server
+}
+
+type outputInfo struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+func runNodes(args []string) error {
+	fs, serverAddress, serverPort := newFlagSet("nodes")
+	asJSON := fs.Bool("json", false, "Print JSON")
+	category := fs.String("category", "", "Only list nodes whose category starts with this")
+	fs.Parse(args)
+
+	clients, err := newClients(*serverAddress, *serverPort)
+	if err != nil {
+		return err
+	}
+	objects, err := clients[0].GetObjectInfos()
+	if err != nil {
+		return err
+	}
+
+	// list the named nodes, or all of them
+	names := fs.Args()
+	if len(names) == 0 {
+		for name, o := range objects.Objects {
+			if strings.HasPrefix(o.Category, *category) {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+	}
+
+	nodes := make([]nodeInfo, 0, len(names))
+	for _, name := range names {
+		o := objects.GetNodeObjectByName(name)
+		if o == nil {
+			return fmt.Errorf("unknown node type %q", name)
+		}
+		nodes = append(nodes, describeNodeObject(o))
+	}
+
+	if *asJSON {
+		return writeJSON(nodes)
+	}
+	for _, n := range nodes {
+		fmt.Printf("%s (%s) [%s]\n", n.Name, n.DisplayName, n.Category)
+		for _, in := range n.Inputs {
+			optional := ""
+			if in.Optional {
+				optional = " (optional)"
+			}
+			fmt.Printf("  in  %-24s %s%s\n", in.Name, in.Type, optional)
+		}
+		for _, out := range n.Outputs {
+			fmt.Printf("  out %-24s %s\n", out.Name, out.Type)
+		}
+	}
+	return nil
+}
+
+func describeNodeObject(o *graphapi.NodeObject) nodeInfo {
+	retv := nodeInfo{
+		Name:        o.Name,
+		DisplayName: o.DisplayName,
+		Category:    o.Category,
+		Description: o.Description,
+		OutputNode:  o.OutputNode,
+		Inputs:      make([]inputInfo, 0),
+		Outputs:     make([]outputInfo, 0),
+	}
+
+	if o.Input != nil {
+		for _, k := range o.Input.OrderedRequired {
+			retv.Inputs = append(retv.Inputs, describeInput(k, false, o.Input.Required[k]))
+		}
+		for _, k := range o.Input.OrderedOptional {
+			retv.Inputs = append(retv.Inputs, describeInput(k, true, o.Input.Optional[k]))
+		}
+	}
+
+	if o.Output != nil {
+		var names []interface{}
+		if o.OutputName != nil {
+			names, _ = (*o.OutputName).([]interface{})
+		}
+		for i, t := range *o.Output {
+			out := outputInfo{Type: "COMBO"}
+			if s, ok := t.(string); ok {
+				out.Type = s
+			}
+			out.Name = out.Type
+			if i < len(names) {
+				if s, ok := names[i].(string); ok {
+					out.Name = s
+				}
+			}
+			retv.Outputs = append(retv.Outputs, out)
+		}
+	}
+	return retv
+}
+
+func describeInput(name string, optional bool, spec *interface{}) inputInfo {
+	retv := inputInfo{Name: name, Type: "UNKNOWN", Optional: optional}
+	if spec == nil {
+		return retv
+	}
+	retv.Spec = *spec
+	switch s := (*spec).(type) {
+	case []interface{}:
+		if len(s) != 0 {
+			switch t := s[0].(type) {
+			case string:
+				retv.Type = t
+			case []interface{}:
+				retv.Type = "COMBO"
+			}
+		}
+	case string:
+		retv.Type = s
+	}
+	return retv
+}
+
+func runModels(args []string) error {
+	fs, serverAddress, serverPort := newFlagSet("models")
+	asJSON := fs.Bool("json", false, "Print JSON")
+	fs.Parse(args)
+
+	clients, err := newClients(*serverAddress, *serverPort)
+	if err != nil {
+		return err
+	}
+	c := clients[0]
+
+	// list the named folders, or just the folder names
+	var result interface{}
+	var lines []string
+	if fs.NArg() == 0 {
+		folders, err := c.GetModelFolders()
+		if err != nil {
+			return err
+		}
+		result, lines = folders, folders
+	} else {
+		models := make(map[string][]string)
+		for _, folder := range fs.Args() {
+			m, err := c.GetModels(folder)
+			if err != nil {
+				return err
+			}
+			models[folder] = m
+			for _, name := range m {
+				lines = append(lines, folder+"/"+name)
+			}
+		}
+		result = models
+	}
+
+	if *asJSON {
+		return writeJSON(result)
+	}
+	for _, l := range lines {
+		fmt.Println(l)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/richinsley/comfy2go/graphapi"
+)
+
+func runRender(args []string) error {
+	fs, _, _ := newFlagSet("render")
+	format := fs.String("format", "svg", "Format to render, \"svg\", \"dot\" or \"mermaid\"")
+	subgraphs := fs.Bool("subgraphs", false, "Draw each subgraph definition below the workflow, for svg")
+	subgraph := fs.String("subgraph", "", "Render the subgraph definition with this name or id instead of the workflow")
+	output := fs.String("o", "", "File to write to, defaults to stdout")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("expected one workflow file")
+	}
+
+	// rendering does not need the node definitions of a server
+	data, from, _, err := readWorkflowFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if from != formatWorkflow {
+		return fmt.Errorf("%s is not a workflow", fs.Arg(0))
+	}
+	graph := &graphapi.Graph{}
+	if err := json.Unmarshal(data, graph); err != nil {
+		return err
+	}
+
+	var out string
+	if *subgraph != "" {
+		sg := findSubgraph(graph, *subgraph)
+		if sg == nil {
+			return fmt.Errorf("%s has no subgraph %s", fs.Arg(0), *subgraph)
+		}
+		switch *format {
+		case "svg":
+			out = sg.RenderSVG()
+		case "dot":
+			out = sg.ToDOT()
+		case "mermaid":
+			out = sg.ToMermaid()
+		default:
+			return fmt.Errorf("unknown format %q", *format)
+		}
+	} else {
+		switch *format {
+		case "svg":
+			out = graph.RenderSVG(&graphapi.SVGOptions{Subgraphs: *subgraphs})
+		case "dot":
+			out = graph.ToDOT()
+		case "mermaid":
+			out = graph.ToMermaid()
+		default:
+			return fmt.Errorf("unknown format %q", *format)
+		}
+	}
+	if *output == "" {
+		_, err = os.Stdout.WriteString(out)
+		return err
+	}
+	return os.WriteFile(*output, []byte(out), 0644)
+}
+
+// findSubgraph returns the subgraph definition with the given id, or the given name
+func findSubgraph(graph *graphapi.Graph, name string) *graphapi.SubgraphDefinition {
+	if graph.Definitions == nil {
+		return nil
+	}
+	for _, sg := range graph.Definitions.Subgraphs {
+		if sg.ID == name {
+			return sg
+		}
+	}
+	for _, sg := range graph.Definitions.Subgraphs {
+		if sg.Name == name {
+			return sg
+		}
+	}
+	return nil
+}
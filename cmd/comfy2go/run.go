@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/richinsley/comfy2go/client"
+	"github.com/richinsley/comfy2go/graphapi"
+)
+
+func runRun(args []string) error {
+	fs, serverAddress, serverPort := newFlagSet("run")
+	var sets stringList
+	fs.Var(&sets, "set", "Set a property with path=value, e.g. \"KSampler.seed=42\".  Setting a LoadImage node's image or file to a local file uploads it.  May be repeated")
+	outputDir := fs.String("output", ".", "Directory to save outputs to")
+	quiet := fs.Bool("quiet", false, "Do not display progress")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("expected one workflow file")
+	}
+
+	clients, err := newClients(*serverAddress, *serverPort)
+	if err != nil {
+		return err
+	}
+	c := clients[0]
+
+	graph, err := loadGraph(c, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	for _, s := range sets {
+		if err := applySet(c, graph, s); err != nil {
+			return err
+		}
+	}
+
+	if err := os.MkdirAll(*outputDir, 0755); err != nil {
+		return err
+	}
+
+	item, err := c.QueuePromptStrict(graph)
+	if err != nil {
+		return err
+	}
+	defer item.Close()
+
+	var progress io.Writer = os.Stderr
+	if *quiet {
+		progress = io.Discard
+	}
+	display := &progressDisplay{w: progress}
+
+	var saveErr error
+	var nodeErr *client.PromptMessageStoppedException
+	err = item.ProcessMessages(&client.MessageHandlers{
+		OnExecuting: func(msg *client.PromptMessageExecuting) {
+			display.node(msg.NodeID, msg.Title)
+		},
+		OnProgress: func(msg *client.PromptMessageProgress) {
+			display.progress(msg.Value, msg.Max)
+		},
+		OnData: func(msg *client.PromptMessageData) {
+			for _, outputs := range msg.Data {
+				for _, o := range outputs {
+					path, err := saveOutput(c, *outputDir, o)
+					if err != nil {
+						saveErr = err
+						continue
+					}
+					display.println(path)
+				}
+			}
+		},
+		OnError: func(e *client.PromptMessageStoppedException) {
+			nodeErr = e
+		},
+	})
+	display.done()
+
+	if nodeErr != nil {
+		return formatNodeError(graph, nodeErr)
+	}
+	if err != nil {
+		return err
+	}
+	return saveErr
+}
+
+// loadGraph loads a workflow from a JSON or media file, or a graph from an API prompt
+func loadGraph(c *client.ComfyClient, path string) (*graphapi.Graph, error) {
+	data, format, _, err := readWorkflowFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var graph *graphapi.Graph
+	var missing *[]string
+	if format == formatAPI {
+		graph, missing, err = c.NewGraphFromPromptReader(bytes.NewReader(data))
+	} else {
+		graph, missing, err = c.NewGraphFromJsonReader(bytes.NewReader(data))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, missingError(err, missing))
+	}
+	return graph, nil
+}
+
+// applySet sets a property from a path=value argument, uploading local files to
+// image uploaders
+func applySet(c *client.ComfyClient, graph *graphapi.Graph, arg string) error {
+	path, value, ok := strings.Cut(arg, "=")
+	if !ok {
+		return fmt.Errorf("--set %q: expected path=value", arg)
+	}
+	p, err := graph.Get(path)
+	if err != nil {
+		return err
+	}
+
+	if uploader := imageUploaderFor(p); uploader != nil {
+		if _, err := os.Stat(value); err == nil {
+			// the server renames the upload when a different file has its name
+			if _, err := c.UploadFileFromPath(value, false, client.InputImageType, "", uploader); err != nil {
+				return fmt.Errorf("uploading %s: %w", value, err)
+			}
+			return nil
+		} else if p.TypeString() == "IMAGEUPLOAD" {
+			return fmt.Errorf("--set %s: %w", path, err)
+		}
+	}
+
+	if err := p.SetValueStrict(value); err != nil {
+		return fmt.Errorf("--set %s: %w", path, err)
+	}
+	return nil
+}
+
+// imageUploaderFor returns the image uploader of a property's node when the
+// property is the uploader, or the combo it uploads to
+func imageUploaderFor(p graphapi.Property) *graphapi.ImageUploadProperty {
+	if up, ok := p.ToImageUploadProperty(); ok {
+		return up
+	}
+	node := p.GetTargetNode()
+	if node == nil {
+		return nil
+	}
+	for _, np := range node.Properties {
+		if up, ok := np.ToImageUploadProperty(); ok && up.TargetProperty != nil && graphapi.Property(up.TargetProperty) == p {
+			return up
+		}
+	}
+	return nil
+}
+
+// saveOutput downloads an output file into dir, returning its path.  Text outputs are
+// written to stdout.
+func saveOutput(c *client.ComfyClient, dir string, o client.DataOutput) (string, error) {
+	if o.Filename == "" {
+		fmt.Println(o.Text)
+		return "", nil
+	}
+	data, err := c.GetImage(o)
+	if err != nil {
+		return "", fmt.Errorf("downloading %s: %w", o.Filename, err)
+	}
+	path := filepath.Join(dir, filepath.Base(o.Filename))
+	if err := os.WriteFile(path, *data, 0644); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// formatNodeError describes the node that raised an exception
+func formatNodeError(graph *graphapi.Graph, e *client.PromptMessageStoppedException) error {
+	name := e.NodeType
+	if n, err := graph.GetNode(e.NodeID); err == nil && n.Title != "" {
+		name = fmt.Sprintf("%s %q", e.NodeType, n.Title)
+	}
+	return fmt.Errorf("node %s (%s) failed: %s: %s", e.NodeID, name, e.ExceptionType, strings.TrimSpace(e.ExceptionMessage))
+}
+
+// progressDisplay draws a line with the executing node and its progress
+type progressDisplay struct {
+	w     io.Writer
+	title string
+	drawn bool
+}
+
+func (d *progressDisplay) node(id string, title string) {
+	d.done()
+	d.title = fmt.Sprintf("[%s] %s", id, title)
+	fmt.Fprintf(d.w, "\r%s", d.title)
+	d.drawn = true
+}
+
+func (d *progressDisplay) progress(value int, max int) {
+	const width = 30
+	if max <= 0 {
+		return
+	}
+	filled := width * value / max
+	if filled > width {
+		filled = width
+	}
+	fmt.Fprintf(d.w, "\r%s [%s%s] %d/%d", d.title, strings.Repeat("#", filled), strings.Repeat(".", width-filled), value, max)
+	d.drawn = true
+}
+
+func (d *progressDisplay) println(s string) {
+	if s == "" {
+		return
+	}
+	d.done()
+	fmt.Fprintln(d.w, "saved", s)
+}
+
+// done ends the current line
+func (d *progressDisplay) done() {
+	if d.drawn {
+		fmt.Fprintln(d.w)
+		d.drawn = false
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/richinsley/comfy2go/client"
+)
+
+const testLoadImageInfo = `{
+	"LoadImage": {
+		"input": {"required": {"image": [["example.png"], {"image_upload": true}]}},
+		"output": ["IMAGE", "MASK"], "name": "LoadImage", "display_name": "Load Image"
+	}
+}`
+
+const testLoadImageWorkflow = `{
+	"nodes": [
+		{"id": 1, "type": "LoadImage", "pos": [0, 0], "size": [300, 300], "order": 0, "mode": 0,
+		 "outputs": [{"name": "IMAGE", "type": "IMAGE", "links": []}, {"name": "MASK", "type": "MASK", "links": []}],
+		 "properties": {}, "widgets_values": ["example.png", "image"]}
+	],
+	"links": [],
+	"groups": [],
+	"last_node_id": 1,
+	"last_link_id": 0,
+	"version": 0.4
+}`
+
+// TestSetUploadsWithoutOverwrite tests that setting a LoadImage to a local file
+// uploads it without replacing a file of the same name on the server
+func TestSetUploadsWithoutOverwrite(t *testing.T) {
+	var overwrite, filename string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/object_info", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, testLoadImageInfo)
+	})
+	mux.HandleFunc("/upload/image", func(w http.ResponseWriter, r *http.Request) {
+		if _, header, err := r.FormFile("image"); err == nil {
+			filename = header.Filename
+		}
+		overwrite = r.FormValue("overwrite")
+		// the server renames uploads that would replace a different file
+		io.WriteString(w, `{"name": "input (1).png", "subfolder": "", "type": "input"}`)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	host, portStr, _ := strings.Cut(strings.TrimPrefix(server.URL, "http://"), ":")
+	port, _ := strconv.Atoi(portStr)
+	c := client.NewComfyClient(host, port, nil)
+	graph, _, err := c.NewGraphFromJsonString(testLoadImageWorkflow)
+	if err != nil {
+		t.Fatalf("Failed to load workflow: %v", err)
+	}
+
+	input := filepath.Join(t.TempDir(), "input.png")
+	if err := os.WriteFile(input, []byte("png"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := applySet(c, graph, "LoadImage.image="+input); err != nil {
+		t.Fatalf("Failed to set image: %v", err)
+	}
+	if filename != "input.png" || overwrite != "false" {
+		t.Errorf("Expected input.png to be uploaded without overwriting, got %q overwrite=%q", filename, overwrite)
+	}
+	if p, _ := graph.Get("LoadImage.image"); p.GetValue() != "input (1).png" {
+		t.Errorf("Expected the image to be the uploaded name, got %v", p.GetValue())
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"path/filepath"
+	"strings"
+
+	"github.com/richinsley/comfy2go/server"
+)
+
+func runServe(args []string) error {
+	fs, serverAddress, serverPort := newFlagSet("serve")
+	listen := fs.String("listen", ":8080", "Address to serve the HTTP endpoints on")
+	group := fs.String("group", "API", "Title of the group whose nodes are exposed")
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("no workflow given")
+	}
+
+	clients, err := newClients(*serverAddress, *serverPort)
+	if err != nil {
+		return err
+	}
+
+	srv := server.NewServer(clients...)
+	srv.APIGroup = *group
+	for _, path := range fs.Args() {
+		// endpoints are named after their files
+		name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		if err := srv.AddWorkflowFile(name, path); err != nil {
+			return err
+		}
+		log.Printf("Serving %s at /workflows/%s", path, name)
+	}
+
+	log.Printf("Listening on %s with %d client(s)", *listen, len(clients))
+	return srv.ListenAndServe(*listen)
+}
@@ -0,0 +1,419 @@
+package graphapi
+
+import "log/slog"
+
+// Clone returns a deep copy of the graph.  Nodes, links, groups and subgraph
+// definitions are copied, and every property is rebound to the copied nodes, so a
+// clone can be changed and serialized while other clones of the same graph are.
+// Random is not copied, a clone uses the shared source until it is given its own.
+func (t *Graph) Clone() *Graph {
+	c := newGraphCloner()
+
+	retv := &Graph{
+		LastNodeID:   t.LastNodeID,
+		LastLinkID:   t.LastLinkID,
+		Version:      t.Version,
+		HasErrors:    t.HasErrors,
+		ValueControl: t.ValueControl,
+		WildcardDir:  t.WildcardDir,
+		hasGenerated: t.hasGenerated,
+		node_objects: t.node_objects,
+		raw:          t.raw,
+	}
+
+	// subgraph definitions are copied first, their instances refer to them
+	if t.Definitions != nil {
+		retv.Definitions = &GraphDefinitions{raw: t.Definitions.raw}
+		if t.Definitions.Subgraphs != nil {
+			retv.Definitions.Subgraphs = make([]*SubgraphDefinition, len(t.Definitions.Subgraphs))
+			for i, sg := range t.Definitions.Subgraphs {
+				retv.Definitions.Subgraphs[i] = c.copySubgraph(sg, retv)
+			}
+		}
+	}
+	if t.SubgraphsByID != nil {
+		retv.SubgraphsByID = make(map[string]*SubgraphDefinition, len(t.SubgraphsByID))
+		for id, sg := range t.SubgraphsByID {
+			retv.SubgraphsByID[id] = c.subgraph(sg, retv)
+		}
+	}
+
+	retv.Nodes = c.copyNodes(t.Nodes)
+	retv.Links = copyLinks(t.Links)
+	retv.Groups = copyGroups(t.Groups)
+	retv.FloatingLinks = copyLinks(t.FloatingLinks)
+	retv.Reroutes = copyReroutes(t.Reroutes)
+	retv.Extra = deepCopyMap(t.Extra)
+	if t.State != nil {
+		state := *t.State
+		retv.State = &state
+	}
+	// group node definitions are not changed, the copies share them
+	retv.GroupNodes = t.GroupNodes
+
+	if t.NodesByID != nil {
+		retv.NodesByID = make(map[int]*GraphNode, len(t.NodesByID))
+		for id, n := range t.NodesByID {
+			retv.NodesByID[id] = c.node(n)
+		}
+	}
+	if t.LinksByID != nil {
+		retv.LinksByID = make(map[int]*Link, len(retv.Links))
+		for _, l := range retv.Links {
+			retv.LinksByID[l.ID] = l
+		}
+	}
+	if t.ReroutesByID != nil {
+		retv.ReroutesByID = make(map[int]*Reroute, len(retv.Reroutes))
+		for _, r := range retv.Reroutes {
+			retv.ReroutesByID[r.ID] = r
+		}
+	}
+	if t.NodesInExecutionOrder != nil {
+		retv.NodesInExecutionOrder = make([]*GraphNode, len(t.NodesInExecutionOrder))
+		for i, n := range t.NodesInExecutionOrder {
+			retv.NodesInExecutionOrder[i] = c.node(n)
+		}
+	}
+
+	// with every node and widget value copied, the properties can be rebound
+	c.bindNodes(t.Nodes, retv)
+	for sg, nsg := range c.subgraphs {
+		c.bindNodes(sg.Nodes, nsg.ParentGraph)
+	}
+	return retv
+}
+
+// graphCloner maps the parts of a graph to their copies
+type graphCloner struct {
+	nodes     map[*GraphNode]*GraphNode
+	props     map[Property]Property
+	subgraphs map[*SubgraphDefinition]*SubgraphDefinition
+	// values maps the elements of widget value arrays to their copies, for properties
+	// that point directly at a value
+	values map[*interface{}]*interface{}
+}
+
+func newGraphCloner() *graphCloner {
+	return &graphCloner{
+		nodes:     make(map[*GraphNode]*GraphNode),
+		props:     make(map[Property]Property),
+		subgraphs: make(map[*SubgraphDefinition]*SubgraphDefinition),
+		values:    make(map[*interface{}]*interface{}),
+	}
+}
+
+// node returns the copy of a node, nodes that are not part of the graph are kept
+func (c *graphCloner) node(n *GraphNode) *GraphNode {
+	if n == nil {
+		return nil
+	}
+	if nn, ok := c.nodes[n]; ok {
+		return nn
+	}
+	return n
+}
+
+// subgraph returns the copy of a subgraph definition
+func (c *graphCloner) subgraph(sg *SubgraphDefinition, g *Graph) *SubgraphDefinition {
+	if sg == nil {
+		return nil
+	}
+	if nsg, ok := c.subgraphs[sg]; ok {
+		return nsg
+	}
+	return c.copySubgraph(sg, g)
+}
+
+func (c *graphCloner) copySubgraph(sg *SubgraphDefinition, g *Graph) *SubgraphDefinition {
+	if nsg, ok := c.subgraphs[sg]; ok {
+		return nsg
+	}
+	nsg := &SubgraphDefinition{}
+	*nsg = *sg
+	c.subgraphs[sg] = nsg
+
+	nsg.Config = deepCopyMap(sg.Config)
+	nsg.InputNode.Bounding = copyFloats(sg.InputNode.Bounding)
+	nsg.OutputNode.Bounding = copyFloats(sg.OutputNode.Bounding)
+	nsg.Inputs = copyPorts(sg.Inputs)
+	nsg.Outputs = copyPorts(sg.Outputs)
+	if sg.Widgets != nil {
+		nsg.Widgets = deepCopyValue(sg.Widgets).([]interface{})
+	}
+	nsg.Nodes = c.copyNodes(sg.Nodes)
+	nsg.Groups = copyGroups(sg.Groups)
+	nsg.Links = copyLinks(sg.Links)
+	nsg.Reroutes = copyReroutes(sg.Reroutes)
+	nsg.FloatingLinks = copyLinks(sg.FloatingLinks)
+	nsg.Extra = deepCopyMap(sg.Extra)
+	nsg.ParentGraph = g
+	if sg.NodesByID != nil || sg.LinksByID != nil {
+		nsg.BuildInternalMaps()
+	}
+	return nsg
+}
+
+// copyNodes copies nodes without their properties, which are bound by bindNodes
+func (c *graphCloner) copyNodes(nodes []*GraphNode) []*GraphNode {
+	if nodes == nil {
+		return nil
+	}
+	retv := make([]*GraphNode, len(nodes))
+	for i, n := range nodes {
+		nn := &GraphNode{}
+		*nn = *n
+		c.nodes[n] = nn
+
+		nn.Position = deepCopyValue(n.Position)
+		if n.Flags != nil {
+			f := deepCopyValue(*n.Flags)
+			nn.Flags = &f
+		}
+		if n.InternalProperties != nil {
+			p := deepCopyMap(*n.InternalProperties)
+			nn.InternalProperties = &p
+		}
+		nn.WidgetValues = deepCopyValue(n.WidgetValues)
+		if arr := n.WidgetValuesArray(); arr != nil {
+			narr := nn.WidgetValuesArray()
+			for j := range arr {
+				c.values[&arr[j]] = &narr[j]
+			}
+		}
+		if n.CustomData != nil {
+			d := deepCopyValue(*n.CustomData)
+			nn.CustomData = &d
+		}
+		nn.Inputs = copySlots(n.Inputs)
+		nn.Outputs = copySlots(n.Outputs)
+		if n.Widgets != nil {
+			nn.Widgets = make([]*Widget, len(n.Widgets))
+			for j, w := range n.Widgets {
+				nn.Widgets[j] = copyWidget(w)
+			}
+		}
+		nn.Properties = nil
+		retv[i] = nn
+	}
+	return retv
+}
+
+// bindNodes copies the properties of nodes, and binds them to the copied nodes
+func (c *graphCloner) bindNodes(nodes []*GraphNode, g *Graph) {
+	for _, n := range nodes {
+		nn := c.nodes[n]
+		if nn.Graph != nil {
+			nn.Graph = g
+		}
+		if n.SubgraphDef != nil {
+			nn.SubgraphDef = c.subgraph(n.SubgraphDef, g)
+		}
+		for i := range n.Inputs {
+			nn.Inputs[i].Node = c.node(n.Inputs[i].Node)
+			nn.Inputs[i].Property = c.property(n.Inputs[i].Property)
+		}
+		for i := range n.Outputs {
+			nn.Outputs[i].Node = c.node(n.Outputs[i].Node)
+			nn.Outputs[i].Property = c.property(n.Outputs[i].Property)
+		}
+		if n.Properties != nil {
+			nn.Properties = make(map[string]Property, len(n.Properties))
+			for k, p := range n.Properties {
+				nn.Properties[k] = c.property(p)
+			}
+		}
+	}
+}
+
+// property returns the copy of a property, bound to the copied nodes
+func (c *graphCloner) property(p Property) Property {
+	if p == nil {
+		return nil
+	}
+	if np, ok := c.props[p]; ok {
+		return np
+	}
+
+	var np Property
+	switch prop := p.(type) {
+	case *BoolProperty:
+		v := *prop
+		np = &v
+	case *IntProperty:
+		v := *prop
+		np = &v
+	case *FloatProperty:
+		v := *prop
+		np = &v
+	case *StringProperty:
+		v := *prop
+		np = &v
+	case *ComboProperty:
+		v := *prop
+		// Append adds values, don't share them
+		v.Values = append([]string(nil), prop.Values...)
+		np = &v
+	case *CascadingProperty:
+		// the groups hold the input specs of the choices, which are not bound
+		v := *prop
+		np = &v
+	case *ImageUploadProperty:
+		v := *prop
+		np = &v
+	case *UnknownProperty:
+		v := *prop
+		np = &v
+	default:
+		slog.Warn("Cannot clone property of unknown type", "type", p.TypeString())
+		return p
+	}
+	np.UpdateParent(np)
+	// record the copy before following references, properties can refer to each other
+	c.props[p] = np
+
+	b := np.base()
+	b.target_node = c.node(b.target_node)
+	if b.direct_value != nil {
+		if v, ok := c.values[b.direct_value]; ok {
+			b.direct_value = v
+		} else {
+			// not a widget value of the graph, copy the value itself
+			v := deepCopyValue(*b.direct_value)
+			b.direct_value = &v
+		}
+	}
+	if b.secondaries != nil {
+		secondaries := make([]Property, len(b.secondaries))
+		for i, s := range b.secondaries {
+			secondaries[i] = c.property(s)
+		}
+		b.secondaries = secondaries
+	}
+	if ip, ok := np.(*IntProperty); ok && ip.control != nil {
+		ip.control = c.property(ip.control)
+	}
+	if up, ok := np.(*ImageUploadProperty); ok && up.TargetProperty != nil {
+		if target, ok := c.property(up.TargetProperty).(*ComboProperty); ok {
+			up.TargetProperty = target
+		}
+	}
+	return np
+}
+
+func copySlots(slots []Slot) []Slot {
+	if slots == nil {
+		return nil
+	}
+	retv := make([]Slot, len(slots))
+	copy(retv, slots)
+	for i, s := range slots {
+		if s.Links != nil {
+			links := append([]int{}, *s.Links...)
+			retv[i].Links = &links
+		}
+		if s.Shape != nil {
+			shape := *s.Shape
+			retv[i].Shape = &shape
+		}
+		if s.SlotIndex != nil {
+			index := *s.SlotIndex
+			retv[i].SlotIndex = &index
+		}
+		retv[i].Widget = copyWidget(s.Widget)
+	}
+	return retv
+}
+
+func copyWidget(w *Widget) *Widget {
+	if w == nil {
+		return nil
+	}
+	retv := &Widget{raw: w.raw}
+	if w.Name != nil {
+		name := *w.Name
+		retv.Name = &name
+	}
+	if w.Config != nil {
+		config := deepCopyValue(*w.Config)
+		retv.Config = &config
+	}
+	return retv
+}
+
+func copyLinks(links []*Link) []*Link {
+	if links == nil {
+		return nil
+	}
+	retv := make([]*Link, len(links))
+	for i, l := range links {
+		nl := *l
+		retv[i] = &nl
+	}
+	return retv
+}
+
+func copyGroups(groups []*Group) []*Group {
+	if groups == nil {
+		return nil
+	}
+	retv := make([]*Group, len(groups))
+	for i, g := range groups {
+		ng := *g
+		ng.Bounding = copyFloats(g.Bounding)
+		retv[i] = &ng
+	}
+	return retv
+}
+
+func copyPorts(ports []SubgraphPort) []SubgraphPort {
+	if ports == nil {
+		return nil
+	}
+	retv := make([]SubgraphPort, len(ports))
+	for i, p := range ports {
+		retv[i] = p
+		if p.LinkIds != nil {
+			retv[i].LinkIds = append([]int{}, p.LinkIds...)
+		}
+		retv[i].Pos = copyFloats(p.Pos)
+	}
+	return retv
+}
+
+func copyFloats(v []float64) []float64 {
+	if v == nil {
+		return nil
+	}
+	return append([]float64{}, v...)
+}
+
+func deepCopyMap(m map[string]interface{}) map[string]interface{} {
+	if m == nil {
+		return nil
+	}
+	return deepCopyValue(m).(map[string]interface{})
+}
+
+// deepCopyValue copies a value decoded from JSON
+func deepCopyValue(v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		retv := make(map[string]interface{}, len(value))
+		for k, e := range value {
+			retv[k] = deepCopyValue(e)
+		}
+		return retv
+	case []interface{}:
+		retv := make([]interface{}, len(value))
+		for i, e := range value {
+			retv[i] = deepCopyValue(e)
+		}
+		return retv
+	case []float64:
+		return append([]float64{}, value...)
+	case []string:
+		return append([]string{}, value...)
+	}
+	return v
+}
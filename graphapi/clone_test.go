@@ -0,0 +1,164 @@
+package graphapi
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+const cloneTestWorkflow = `{
+	"nodes": [
+		{"id": 1, "type": "LoadImage", "pos": [0, 0], "size": [300, 100], "order": 0, "mode": 0,
+		 "outputs": [{"name": "IMAGE", "type": "IMAGE", "links": []}], "properties": {}, "widgets_values": ["example.png", "image"]},
+		{"id": 2, "type": "PrimitiveNode", "title": "Seed", "pos": [0, 200], "size": [300, 100], "order": 1, "mode": 0,
+		 "outputs": [{"name": "INT", "type": "INT", "links": [1, 2], "widget": {"name": "seed"}}], "properties": {}, "widgets_values": [5, "fixed"]},
+		{"id": 3, "type": "KSampler", "pos": [400, 0], "size": [300, 100], "order": 2, "mode": 0,
+		 "inputs": [{"name": "seed", "type": "INT", "link": 1, "widget": {"name": "seed"}}], "properties": {}, "widgets_values": [5, "fixed"]},
+		{"id": 4, "type": "KSampler", "pos": [400, 200], "size": [300, 100], "order": 3, "mode": 0,
+		 "inputs": [{"name": "seed", "type": "INT", "link": 2, "widget": {"name": "seed"}}], "properties": {}, "widgets_values": [5, "fixed"]},
+		{"id": 5, "type": "Note", "pos": [0, 400], "size": [300, 100], "order": 4, "mode": 0, "properties": {}, "widgets_values": ["hello"]}
+	],
+	"links": [[1, 2, 0, 3, 0, "INT"], [2, 2, 0, 4, 0, "INT"]],
+	"groups": [{"title": "API", "bounding": [-50, -50, 1000, 600], "color": "#3f789e"}],
+	"last_node_id": 5,
+	"last_link_id": 2,
+	"version": 0.4
+}`
+
+func newCloneTestGraph(t testing.TB) *Graph {
+	var imageData interface{} = []interface{}{[]interface{}{"example.png", "other.png"}, map[string]interface{}{"image_upload": true}}
+	var seedData interface{} = []interface{}{"INT", map[string]interface{}{"default": float64(0), "min": float64(0), "max": float64(1000000)}}
+	nodeObjects := &NodeObjects{
+		Objects: map[string]*NodeObject{
+			"LoadImage": {
+				Name:        "LoadImage",
+				DisplayName: "Load Image",
+				Input: &NodeObjectInput{
+					Required:        map[string]*interface{}{"image": &imageData},
+					OrderedRequired: []string{"image"},
+				},
+			},
+			"KSampler": {
+				Name:        "KSampler",
+				DisplayName: "KSampler",
+				Input: &NodeObjectInput{
+					Required:        map[string]*interface{}{"seed": &seedData},
+					OrderedRequired: []string{"seed"},
+				},
+			},
+		},
+	}
+	nodeObjects.PopulateInputProperties()
+
+	graph, missing, err := NewGraphFromJsonString(cloneTestWorkflow, nodeObjects)
+	if err != nil {
+		t.Fatalf("Failed to create graph: %v %v", err, missing)
+	}
+	return graph
+}
+
+// TestCloneRebindsProperties tests that setting the properties of a clone, including
+// primitives, notes and image uploads, leaves the original untouched
+func TestCloneRebindsProperties(t *testing.T) {
+	graph := newCloneTestGraph(t)
+	before, _ := graph.GraphToJSON()
+
+	clone := graph.Clone()
+	if err := clone.GetNodeById(2).GetPropertyWithName("value").SetValue(42); err != nil {
+		t.Fatalf("Failed to set primitive: %v", err)
+	}
+	if err := clone.GetNodeById(5).GetPropertyWithName("text").SetValue("goodbye"); err != nil {
+		t.Fatalf("Failed to set note: %v", err)
+	}
+	upload, _ := clone.GetNodeById(1).GetPropertyWithName("file").ToImageUploadProperty()
+	upload.SetFilename("uploaded.png")
+
+	if after, _ := graph.GraphToJSON(); after != before {
+		t.Fatalf("Setting the clone changed the original:\n%s\n%s", before, after)
+	}
+
+	for _, id := range []int{3, 4} {
+		if v := clone.GetNodeById(id).WidgetValuesArray()[0]; fmt.Sprint(v) != "42" {
+			t.Errorf("Expected the primitive to set node %d of the clone, got %v", id, v)
+		}
+	}
+	if v := clone.GetNodeById(5).WidgetValuesArray()[0]; v != "goodbye" {
+		t.Errorf("Expected the note of the clone to be set, got %v", v)
+	}
+	if v := clone.GetNodeById(1).WidgetValuesArray()[0]; v != "uploaded.png" {
+		t.Errorf("Expected the upload to set the clone's image, got %v", v)
+	}
+
+	if clone.GetNodeById(3).Graph != clone || clone.NodesByID[3] != clone.GetNodeById(3) || clone.NodesInExecutionOrder[2] != clone.GetNodeById(3) {
+		t.Errorf("Expected the clone's maps to hold the cloned nodes")
+	}
+	if clone.GetNodeById(3).Inputs[0].Property != clone.GetNodeById(3).Properties["seed"] {
+		t.Errorf("Expected the clone's input slot to hold the cloned property")
+	}
+}
+
+// TestCloneSubgraphs tests that subgraph definitions and their nodes are copied
+func TestCloneSubgraphs(t *testing.T) {
+	graph := newSelectorTestGraph(t)
+	before, _ := graph.GraphToJSON()
+
+	clone := graph.Clone()
+	if err := clone.Set("57:3.cfg", 4.5); err != nil {
+		t.Fatalf("Failed to set the clone: %v", err)
+	}
+	if after, _ := graph.GraphToJSON(); after != before {
+		t.Fatalf("Setting the clone changed the original")
+	}
+
+	sg := clone.GetNodeById(57).SubgraphDef
+	if sg == graph.GetNodeById(57).SubgraphDef || sg.ParentGraph != clone || clone.SubgraphsByID[sg.ID] != sg {
+		t.Errorf("Expected the clone to refer to its own subgraph definition")
+	}
+	if sg.NodesByID[3] != sg.Nodes[indexOfNode(sg.Nodes, 3)] {
+		t.Errorf("Expected the definition's map to hold the cloned nodes")
+	}
+
+	p, err := clone.GraphToPrompt("")
+	if err != nil {
+		t.Fatalf("Failed to generate prompt: %v", err)
+	}
+	if v := p.Nodes["57:3"].Inputs["cfg"]; fmt.Sprint(v) != "4.5" {
+		t.Errorf("Expected the clone's cfg in its prompt, got %v", v)
+	}
+}
+
+// TestCloneConcurrently tests that clones can be changed and serialized concurrently
+func TestCloneConcurrently(t *testing.T) {
+	graph := newCloneTestGraph(t)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			clone := graph.Clone()
+			clone.GetNodeById(2).GetPropertyWithName("value").SetValue(i)
+			p, err := clone.GraphToPrompt("")
+			if err != nil {
+				t.Errorf("Failed to generate prompt: %v", err)
+				return
+			}
+			if v := p.Nodes["4"].Inputs["seed"]; fmt.Sprint(v) != fmt.Sprint(i) {
+				t.Errorf("Expected seed %d, got %v", i, v)
+			}
+			if _, err := clone.GraphToJSON(); err != nil {
+				t.Errorf("Failed to serialize: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func indexOfNode(nodes []*GraphNode, id int) int {
+	for i, n := range nodes {
+		if n.ID == id {
+			return i
+		}
+	}
+	return -1
+}
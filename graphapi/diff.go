@@ -0,0 +1,554 @@
+package graphapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// NodeRef identifies a node in a GraphPatch.  Subgraph is the ID of the subgraph
+// definition containing the node, or empty for top-level nodes.
+type NodeRef struct {
+	ID       int    `json:"id"`
+	Title    string `json:"title,omitempty"`
+	Type     string `json:"type"`
+	Subgraph string `json:"subgraph,omitempty"`
+}
+
+// NodePatch is a node that was added, along with its serialized form
+type NodePatch struct {
+	NodeRef
+	Node json.RawMessage `json:"node"`
+}
+
+// LinkEndpoint is the origin of a link that feeds an input
+type LinkEndpoint struct {
+	OriginID   int    `json:"origin_id"`
+	OriginSlot int    `json:"origin_slot"`
+	Type       string `json:"type,omitempty"`
+}
+
+// LinkPatch describes an input that was connected, disconnected, or rewired.
+// A nil Old or New endpoint means the input is unconnected.
+type LinkPatch struct {
+	Target NodeRef       `json:"target"`
+	Input  string        `json:"input"`
+	Old    *LinkEndpoint `json:"old,omitempty"`
+	New    *LinkEndpoint `json:"new,omitempty"`
+}
+
+// ModePatch describes a change of a node's mode (0 always, 2 muted, 4 bypassed)
+type ModePatch struct {
+	NodeRef
+	Old int `json:"old"`
+	New int `json:"new"`
+}
+
+// ValuePatch describes a change to a node's widget value.  Property is the name
+// of the property for the widget when it is known.  Widget is the index of the
+// value within widgets_values, or -1 when the widgets values are a map.  Added and
+// Removed are set for values that only one of the graphs has, when a node's
+// widgets_values changed length or a key of its map was added or removed.
+type ValuePatch struct {
+	NodeRef
+	Property string      `json:"property"`
+	Widget   int         `json:"widget"`
+	Old      interface{} `json:"old"`
+	New      interface{} `json:"new"`
+	Added    bool        `json:"added,omitempty"`
+	Removed  bool        `json:"removed,omitempty"`
+}
+
+// GraphPatch is the set of differences between two graphs.  It can be serialized
+// to JSON and applied to another graph with Graph.ApplyPatch.
+type GraphPatch struct {
+	AddedNodes   []NodePatch  `json:"added_nodes,omitempty"`
+	RemovedNodes []NodeRef    `json:"removed_nodes,omitempty"`
+	Links        []LinkPatch  `json:"links,omitempty"`
+	Modes        []ModePatch  `json:"modes,omitempty"`
+	Values       []ValuePatch `json:"values,omitempty"`
+}
+
+// IsEmpty returns true if the patch contains no changes
+func (p *GraphPatch) IsEmpty() bool {
+	return len(p.AddedNodes) == 0 && len(p.RemovedNodes) == 0 && len(p.Links) == 0 &&
+		len(p.Modes) == 0 && len(p.Values) == 0
+}
+
+// PatchConflict describes a part of a patch that does not match the graph it is applied to
+type PatchConflict struct {
+	Node    NodeRef
+	Message string
+}
+
+func (c PatchConflict) String() string {
+	return fmt.Sprintf("node %s: %s", c.Node, c.Message)
+}
+
+func (r NodeRef) String() string {
+	s := fmt.Sprintf("%d", r.ID)
+	if r.Subgraph != "" {
+		s = r.Subgraph + "/" + s
+	}
+	if r.Title != "" {
+		s += fmt.Sprintf(" (%s)", r.Title)
+	}
+	return s
+}
+
+// PatchConflictError is returned by ApplyPatch when the target graph has diverged
+// from the graph the patch was created against
+type PatchConflictError struct {
+	Conflicts []PatchConflict
+}
+
+func (e *PatchConflictError) Error() string {
+	msgs := make([]string, len(e.Conflicts))
+	for i, c := range e.Conflicts {
+		msgs[i] = c.String()
+	}
+	return fmt.Sprintf("patch conflicts: %s", strings.Join(msgs, "; "))
+}
+
+func nodeRef(n *GraphNode, subgraph string) NodeRef {
+	title := n.Title
+	if title == "" {
+		title = n.DisplayName
+	}
+	return NodeRef{ID: n.ID, Title: title, Type: n.Type, Subgraph: subgraph}
+}
+
+// Diff reports the differences between graph a and graph b.  Nodes are matched by
+// ID, and a node whose type changed is reported as removed and added again.  Added
+// and removed nodes and links are reported for the top-level graph, while mode and
+// value changes also include the nodes of subgraph definitions.  Applying the result
+// to a with ApplyPatch makes it match b.
+func Diff(a, b *Graph) *GraphPatch {
+	p := &GraphPatch{}
+
+	// nodes whose type changed are replaced, along with the links to and from them
+	replaced := make(map[int]bool)
+	for _, n := range b.Nodes {
+		if na := a.GetNodeById(n.ID); na != nil && na.Type != n.Type {
+			replaced[n.ID] = true
+		}
+	}
+
+	for _, n := range sortedNodes(b.Nodes) {
+		if a.GetNodeById(n.ID) == nil || replaced[n.ID] {
+			data, err := json.Marshal(n)
+			if err != nil {
+				continue
+			}
+			p.AddedNodes = append(p.AddedNodes, NodePatch{NodeRef: nodeRef(n, ""), Node: data})
+		}
+	}
+	for _, n := range sortedNodes(a.Nodes) {
+		if b.GetNodeById(n.ID) == nil || replaced[n.ID] {
+			p.RemovedNodes = append(p.RemovedNodes, nodeRef(n, ""))
+		}
+	}
+
+	// links are compared by the input they feed
+	for _, nb := range sortedNodes(b.Nodes) {
+		na := a.GetNodeById(nb.ID)
+		if replaced[nb.ID] {
+			na = nil
+		}
+		for _, slot := range nb.Inputs {
+			newEnd := linkEndpoint(b, slot.Link)
+			var oldEnd *LinkEndpoint
+			if na != nil {
+				if sa := na.GetInputWithName(slot.Name); sa != nil {
+					oldEnd = linkEndpoint(a, sa.Link)
+				}
+			}
+			if !sameEndpoint(oldEnd, newEnd) || (newEnd != nil && replaced[newEnd.OriginID]) {
+				p.Links = append(p.Links, LinkPatch{Target: nodeRef(nb, ""), Input: slot.Name, Old: oldEnd, New: newEnd})
+			}
+		}
+		if na == nil {
+			continue
+		}
+		// inputs that no longer exist on b's node
+		for _, slot := range na.Inputs {
+			if nb.GetInputWithName(slot.Name) == nil && slot.Link != 0 {
+				p.Links = append(p.Links, LinkPatch{Target: nodeRef(nb, ""), Input: slot.Name, Old: linkEndpoint(a, slot.Link)})
+			}
+		}
+	}
+
+	diffNodes(p, a.Nodes, b.NodesByID, "")
+	if a.Definitions != nil && b.SubgraphsByID != nil {
+		for _, sga := range a.Definitions.Subgraphs {
+			if sgb, ok := b.SubgraphsByID[sga.ID]; ok {
+				diffNodes(p, sga.Nodes, sgb.NodesByID, sga.ID)
+			}
+		}
+	}
+	return p
+}
+
+func diffNodes(p *GraphPatch, anodes []*GraphNode, bnodes map[int]*GraphNode, subgraph string) {
+	for _, na := range sortedNodes(anodes) {
+		// nodes whose type changed are compared as a whole
+		nb, ok := bnodes[na.ID]
+		if !ok || nb.Type != na.Type {
+			continue
+		}
+		if na.Mode != nb.Mode {
+			p.Modes = append(p.Modes, ModePatch{NodeRef: nodeRef(nb, subgraph), Old: na.Mode, New: nb.Mode})
+		}
+
+		if va, vb := na.WidgetValuesArray(), nb.WidgetValuesArray(); va != nil && vb != nil {
+			for i := 0; i < len(va) && i < len(vb); i++ {
+				if !valuesEqual(va[i], vb[i]) {
+					p.Values = append(p.Values, ValuePatch{NodeRef: nodeRef(nb, subgraph), Property: widgetPropertyName(nb, i), Widget: i, Old: va[i], New: vb[i]})
+				}
+			}
+			// values past the end of the shorter array, removed from the end first
+			for i := len(va) - 1; i >= len(vb); i-- {
+				p.Values = append(p.Values, ValuePatch{NodeRef: nodeRef(nb, subgraph), Property: widgetPropertyName(na, i), Widget: i, Old: va[i], Removed: true})
+			}
+			for i := len(va); i < len(vb); i++ {
+				p.Values = append(p.Values, ValuePatch{NodeRef: nodeRef(nb, subgraph), Property: widgetPropertyName(nb, i), Widget: i, New: vb[i], Added: true})
+			}
+		} else if ma, mb := na.WidgetValuesMap(), nb.WidgetValuesMap(); ma != nil && mb != nil {
+			keys := make([]string, 0, len(mb))
+			for k := range mb {
+				keys = append(keys, k)
+			}
+			for k := range ma {
+				if _, ok := mb[k]; !ok {
+					keys = append(keys, k)
+				}
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				va, aok := ma[k]
+				vb, bok := mb[k]
+				if aok && bok && valuesEqual(va, vb) {
+					continue
+				}
+				p.Values = append(p.Values, ValuePatch{NodeRef: nodeRef(nb, subgraph), Property: k, Widget: -1, Old: va, New: vb, Added: !aok, Removed: !bok})
+			}
+		}
+	}
+}
+
+// ApplyPatch applies a patch created by Diff to the graph.  The patch is checked
+// against the graph first, and if the graph has diverged from the patch's
+// original graph a *PatchConflictError is returned and nothing is changed.
+// The patch is applied to a copy of the graph before the graph itself, so a patch
+// that fails part way, e.g. with an added node that cannot be read, also leaves
+// the graph unchanged.  If the graph's properties were created, those of the added
+// nodes are created from the same node objects.
+func (t *Graph) ApplyPatch(p *GraphPatch) error {
+	if err := t.checkPatch(p); err != nil {
+		return err
+	}
+	if err := t.Clone().applyPatch(p); err != nil {
+		return err
+	}
+	return t.applyPatch(p)
+}
+
+// applyPatch applies a checked patch, stopping at the first error
+func (t *Graph) applyPatch(p *GraphPatch) error {
+	defer t.deferOrder()()
+
+	// nodes are removed first, as the nodes whose type changed are added again
+	for _, r := range p.RemovedNodes {
+		if err := t.RemoveNode(r.ID); err != nil {
+			return err
+		}
+	}
+
+	added := make([]*GraphNode, 0, len(p.AddedNodes))
+	for _, np := range p.AddedNodes {
+		n := &GraphNode{}
+		if err := json.Unmarshal(np.Node, n); err != nil {
+			return fmt.Errorf("node %s: %w", np.NodeRef, err)
+		}
+		// links are re-created from the link patches
+		for i := range n.Inputs {
+			n.Inputs[i].Link = 0
+		}
+		for i := range n.Outputs {
+			n.Outputs[i].Links = &[]int{}
+		}
+		if err := t.AddNode(n); err != nil {
+			return err
+		}
+		added = append(added, n)
+	}
+
+	for _, lp := range p.Links {
+		target := t.GetNodeById(lp.Target.ID)
+		if target == nil {
+			// the target is a removed node
+			continue
+		}
+		slotIndex := -1
+		for i, s := range target.Inputs {
+			if s.Name == lp.Input {
+				slotIndex = i
+				break
+			}
+		}
+		if slotIndex == -1 {
+			continue
+		}
+		if lp.New == nil {
+			if target.Inputs[slotIndex].Link != 0 {
+				t.RemoveLink(target.Inputs[slotIndex].Link)
+			}
+			continue
+		}
+		if _, err := t.AddLink(lp.New.OriginID, lp.New.OriginSlot, target.ID, slotIndex); err != nil {
+			return err
+		}
+	}
+
+	// the properties of PrimitiveNodes are made from the widgets they are linked to
+	if t.node_objects != nil {
+		primitives := make([]*GraphNode, 0)
+		for _, n := range added {
+			t.createNodeProperties(n, t.node_objects, &primitives)
+		}
+		for _, n := range primitives {
+			createPrimitiveProperties(t, n)
+		}
+	}
+
+	// changes to nodes that were removed are skipped
+	for _, mp := range p.Modes {
+		if n := t.findPatchNode(mp.NodeRef); n != nil {
+			n.Mode = mp.New
+		}
+	}
+
+	for _, vp := range p.Values {
+		n := t.findPatchNode(vp.NodeRef)
+		if n == nil {
+			continue
+		}
+		switch {
+		case vp.Widget < 0 && vp.Removed:
+			delete(n.WidgetValuesMap(), vp.Property)
+		case vp.Widget < 0:
+			n.WidgetValuesMap()[vp.Property] = vp.New
+		case vp.Removed:
+			if arr := n.WidgetValuesArray(); vp.Widget < len(arr) {
+				n.WidgetValues = arr[:vp.Widget]
+			}
+		case vp.Added && vp.Widget == len(n.WidgetValuesArray()):
+			n.WidgetValues = append(n.WidgetValuesArray(), vp.New)
+		default:
+			n.WidgetValuesArray()[vp.Widget] = vp.New
+		}
+	}
+	return nil
+}
+
+// checkPatch collects the conflicts between the patch and the graph
+func (t *Graph) checkPatch(p *GraphPatch) error {
+	conflicts := make([]PatchConflict, 0)
+	conflict := func(r NodeRef, format string, args ...interface{}) {
+		conflicts = append(conflicts, PatchConflict{Node: r, Message: fmt.Sprintf(format, args...)})
+	}
+
+	removed := make(map[int]bool)
+	for _, r := range p.RemovedNodes {
+		n := t.GetNodeById(r.ID)
+		if n == nil {
+			conflict(r, "node to be removed does not exist")
+		} else if n.Type != r.Type {
+			conflict(r, "node to be removed is of type %s", n.Type)
+		}
+		removed[r.ID] = true
+	}
+	added := make(map[int]bool)
+	for _, np := range p.AddedNodes {
+		if t.GetNodeById(np.ID) != nil && !removed[np.ID] {
+			conflict(np.NodeRef, "node to be added already exists")
+		}
+		added[np.ID] = true
+	}
+
+	for _, lp := range p.Links {
+		if lp.New != nil && t.GetNodeById(lp.New.OriginID) == nil && !added[lp.New.OriginID] {
+			conflict(lp.Target, "input %s links from missing node %d", lp.Input, lp.New.OriginID)
+		}
+		if added[lp.Target.ID] {
+			continue
+		}
+		target := t.GetNodeById(lp.Target.ID)
+		if target == nil {
+			conflict(lp.Target, "node does not exist")
+			continue
+		}
+		var current *LinkEndpoint
+		if slot := target.GetInputWithName(lp.Input); slot != nil {
+			current = linkEndpoint(t, slot.Link)
+		} else if lp.New != nil {
+			conflict(lp.Target, "node has no input %s", lp.Input)
+			continue
+		}
+		if !sameEndpoint(current, lp.Old) && !sameEndpoint(current, lp.New) {
+			conflict(lp.Target, "input %s has been rewired", lp.Input)
+		}
+	}
+
+	for _, mp := range p.Modes {
+		n := t.findPatchNode(mp.NodeRef)
+		if n == nil {
+			conflict(mp.NodeRef, "node does not exist")
+		} else if n.Mode != mp.Old && n.Mode != mp.New {
+			conflict(mp.NodeRef, "mode is %d, expected %d", n.Mode, mp.Old)
+		}
+	}
+
+	// the number of values added to the end of each node's widgets_values
+	grown := make(map[*GraphNode]int)
+	for _, vp := range p.Values {
+		n := t.findPatchNode(vp.NodeRef)
+		if n == nil {
+			conflict(vp.NodeRef, "node does not exist")
+			continue
+		}
+		var current interface{}
+		exists := false
+		if vp.Widget < 0 {
+			m := n.WidgetValuesMap()
+			if m == nil {
+				conflict(vp.NodeRef, "node has no widget values map")
+				continue
+			}
+			current, exists = m[vp.Property]
+		} else {
+			arr := n.WidgetValuesArray()
+			if arr == nil && !vp.Added {
+				conflict(vp.NodeRef, "node has no widget %d (%s)", vp.Widget, vp.Property)
+				continue
+			}
+			// values are added after the last one and removed from the end
+			switch {
+			case vp.Added && vp.Widget > len(arr)+grown[n]:
+				conflict(vp.NodeRef, "node has %d widget values, expected %d", len(arr), vp.Widget)
+				continue
+			case vp.Added && vp.Widget >= len(arr):
+				grown[n]++
+			case vp.Removed && vp.Widget >= len(arr):
+			case vp.Widget >= len(arr) && !vp.Added:
+				conflict(vp.NodeRef, "node has no widget %d (%s)", vp.Widget, vp.Property)
+				continue
+			}
+			if vp.Widget < len(arr) {
+				current, exists = arr[vp.Widget], true
+			}
+		}
+		switch {
+		case vp.Added && !exists, vp.Removed && !exists:
+		case vp.Added && valuesEqual(current, vp.New), vp.Removed && valuesEqual(current, vp.Old):
+		case vp.Added || vp.Removed:
+			conflict(vp.NodeRef, "%s is %v, expected %v", vp.Property, current, vp.Old)
+		case !valuesEqual(current, vp.Old) && !valuesEqual(current, vp.New):
+			conflict(vp.NodeRef, "%s is %v, expected %v", vp.Property, current, vp.Old)
+		}
+	}
+
+	if len(conflicts) > 0 {
+		return &PatchConflictError{Conflicts: conflicts}
+	}
+	return nil
+}
+
+// findPatchNode finds the node a patch entry refers to, either at the top level or
+// within a subgraph definition
+func (t *Graph) findPatchNode(r NodeRef) *GraphNode {
+	if r.Subgraph == "" {
+		n := t.GetNodeById(r.ID)
+		if n == nil || n.Type != r.Type {
+			return nil
+		}
+		return n
+	}
+	sg, ok := t.SubgraphsByID[r.Subgraph]
+	if !ok {
+		return nil
+	}
+	n := sg.GetNodeById(r.ID)
+	if n == nil || n.Type != r.Type {
+		return nil
+	}
+	return n
+}
+
+// widgetPropertyName returns the name of the property targeting the widget index,
+// or a name in the form "widgets_values[1]" if there is none
+func widgetPropertyName(n *GraphNode, index int) string {
+	for name, p := range n.Properties {
+		if p.GetTargetNode() == n && p.GetTargetWidget() == index && p.TypeString() != "IMAGEUPLOAD" {
+			return name
+		}
+	}
+	return fmt.Sprintf("widgets_values[%d]", index)
+}
+
+func linkEndpoint(t *Graph, linkID int) *LinkEndpoint {
+	if linkID == 0 {
+		return nil
+	}
+	l := t.GetLinkById(linkID)
+	if l == nil {
+		return nil
+	}
+	return &LinkEndpoint{OriginID: l.OriginID, OriginSlot: l.OriginSlot, Type: l.Type}
+}
+
+func sameEndpoint(a, b *LinkEndpoint) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return a.OriginID == b.OriginID && a.OriginSlot == b.OriginSlot
+}
+
+// valuesEqual compares widget values, treating all numeric types as equal when
+// they hold the same number
+func valuesEqual(a, b interface{}) bool {
+	fa, aok := toFloat64(a)
+	fb, bok := toFloat64(b)
+	if aok && bok {
+		return fa == fb
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func toFloat64(v interface{}) (float64, bool) {
+	switch val := v.(type) {
+	case float64:
+		return val, true
+	case float32:
+		return float64(val), true
+	case int:
+		return float64(val), true
+	case int32:
+		return float64(val), true
+	case int64:
+		return float64(val), true
+	case json.Number:
+		f, err := val.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func sortedNodes(nodes []*GraphNode) []*GraphNode {
+	retv := make([]*GraphNode, len(nodes))
+	copy(retv, nodes)
+	sort.Slice(retv, func(i, j int) bool { return retv[i].ID < retv[j].ID })
+	return retv
+}
@@ -0,0 +1,246 @@
+package graphapi
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+)
+
+func loadTestGraph(t *testing.T, path string) *Graph {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read test file: %v", err)
+	}
+	var graph Graph
+	if err := json.Unmarshal(data, &graph); err != nil {
+		t.Fatalf("Failed to unmarshal graph: %v", err)
+	}
+	return &graph
+}
+
+// loadTestGraphWithProperties reads a graph and creates the properties of the nodes
+// in the test object info
+func loadTestGraphWithProperties(t *testing.T, path string) *Graph {
+	graph := loadTestGraph(t, path)
+	graph.CreateNodeProperties(readObjectInfo(t, "../examples/testdata/subgraphs/object_info.json"))
+	return graph
+}
+
+// TestDiffAndApplyPatch tests that a patch serialized to JSON turns a into b
+func TestDiffAndApplyPatch(t *testing.T) {
+	a := loadTestGraphWithProperties(t, "../examples/img2img/img2img.json")
+	b := loadTestGraphWithProperties(t, "../examples/img2img/img2img.json")
+
+	// change a value and a mode
+	b.GetNodeById(3).WidgetValuesArray()[2] = float64(30)
+	b.GetNodeById(7).Mode = 2
+
+	// swap the positive and negative conditioning
+	if _, err := b.AddLink(7, 0, 3, 1); err != nil {
+		t.Fatalf("Failed to add link: %v", err)
+	}
+	if _, err := b.AddLink(6, 0, 3, 2); err != nil {
+		t.Fatalf("Failed to add link: %v", err)
+	}
+
+	// replace the SaveImage node
+	if err := b.RemoveNode(9); err != nil {
+		t.Fatalf("Failed to remove node: %v", err)
+	}
+	save := &GraphNode{
+		Type:         "SaveImage",
+		Inputs:       []Slot{{Name: "images", Type: "IMAGE"}},
+		WidgetValues: []interface{}{"patched"},
+	}
+	if err := b.AddNode(save); err != nil {
+		t.Fatalf("Failed to add node: %v", err)
+	}
+	if _, err := b.AddLink(8, 0, save.ID, 0); err != nil {
+		t.Fatalf("Failed to add link: %v", err)
+	}
+
+	patch := Diff(a, b)
+	if len(patch.AddedNodes) != 1 || len(patch.RemovedNodes) != 1 {
+		t.Errorf("Expected 1 added and 1 removed node, got %d and %d", len(patch.AddedNodes), len(patch.RemovedNodes))
+	}
+	if len(patch.Modes) != 1 || len(patch.Values) != 1 {
+		t.Errorf("Expected 1 mode and 1 value change, got %d and %d", len(patch.Modes), len(patch.Values))
+	}
+	if len(patch.Values) == 1 && patch.Values[0].Property != "steps" {
+		t.Errorf("Expected the steps property, got %s", patch.Values[0].Property)
+	}
+
+	// the patch must survive serialization
+	data, err := json.Marshal(patch)
+	if err != nil {
+		t.Fatalf("Failed to marshal patch: %v", err)
+	}
+	var decoded GraphPatch
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Failed to unmarshal patch: %v", err)
+	}
+
+	if err := a.ApplyPatch(&decoded); err != nil {
+		t.Fatalf("Failed to apply patch: %v", err)
+	}
+	if remaining := Diff(a, b); !remaining.IsEmpty() {
+		out, _ := json.MarshalIndent(remaining, "", "  ")
+		t.Errorf("Expected no differences after applying patch, got:\n%s", out)
+	}
+
+	// the properties of added nodes are created
+	if p := a.GetNodeById(save.ID).GetPropertyWithName("filename_prefix"); p == nil || p.GetValue() != "patched" {
+		t.Errorf("Expected the added node to have its properties, got %v", p)
+	}
+}
+
+// TestDiffTypeChange tests that a node whose type changed is replaced with its links
+func TestDiffTypeChange(t *testing.T) {
+	a := loadTestGraph(t, "../examples/img2img/img2img.json")
+	b := loadTestGraph(t, "../examples/img2img/img2img.json")
+
+	// node 8 keeps its id and links, but decodes in tiles
+	if err := b.RemoveNode(8); err != nil {
+		t.Fatalf("Failed to remove node: %v", err)
+	}
+	tiled := &GraphNode{
+		ID:           8,
+		Type:         "VAEDecodeTiled",
+		Inputs:       []Slot{{Name: "samples", Type: "LATENT"}, {Name: "vae", Type: "VAE"}},
+		Outputs:      []Slot{{Name: "IMAGE", Type: "IMAGE", Links: &[]int{}}},
+		WidgetValues: []interface{}{float64(512)},
+	}
+	if err := b.AddNode(tiled); err != nil {
+		t.Fatalf("Failed to add node: %v", err)
+	}
+	for _, l := range [][4]int{{3, 0, 8, 0}, {4, 2, 8, 1}, {8, 0, 9, 0}} {
+		if _, err := b.AddLink(l[0], l[1], l[2], l[3]); err != nil {
+			t.Fatalf("Failed to add link: %v", err)
+		}
+	}
+
+	patch := Diff(a, b)
+	if len(patch.RemovedNodes) != 1 || len(patch.AddedNodes) != 1 || patch.AddedNodes[0].Type != "VAEDecodeTiled" {
+		t.Fatalf("Expected node 8 to be removed and added, got %+v", patch)
+	}
+	if err := a.ApplyPatch(patch); err != nil {
+		t.Fatalf("Failed to apply patch: %v", err)
+	}
+	if remaining := Diff(a, b); !remaining.IsEmpty() {
+		out, _ := json.MarshalIndent(remaining, "", "  ")
+		t.Errorf("Expected no differences after applying patch, got:\n%s", out)
+	}
+	if n := a.GetNodeById(8); n.Type != "VAEDecodeTiled" || a.GetNodeById(9).Inputs[0].Link == 0 {
+		t.Errorf("Expected node 8 to be replaced and linked to node 9")
+	}
+}
+
+// TestApplyPatchRemovedNode tests that changes to a node that is removed are skipped
+func TestApplyPatchRemovedNode(t *testing.T) {
+	a := loadTestGraph(t, "../examples/img2img/img2img.json")
+	b := loadTestGraph(t, "../examples/img2img/img2img.json")
+	b.GetNodeById(3).Mode = 4
+	b.GetNodeById(3).WidgetValuesArray()[2] = float64(30)
+
+	patch := Diff(a, b)
+	patch.RemovedNodes = append(patch.RemovedNodes, nodeRef(a.GetNodeById(3), ""))
+	if err := a.ApplyPatch(patch); err != nil {
+		t.Fatalf("Failed to apply patch: %v", err)
+	}
+	if a.GetNodeById(3) != nil {
+		t.Errorf("Expected node 3 to be removed")
+	}
+}
+
+// TestApplyPatchConflict tests that a diverged graph is not patched
+func TestApplyPatchConflict(t *testing.T) {
+	a := loadTestGraph(t, "../examples/img2img/img2img.json")
+	b := loadTestGraph(t, "../examples/img2img/img2img.json")
+	b.GetNodeById(3).WidgetValuesArray()[2] = float64(30)
+	patch := Diff(a, b)
+
+	target := loadTestGraph(t, "../examples/img2img/img2img.json")
+	target.GetNodeById(3).WidgetValuesArray()[2] = float64(12)
+
+	err := target.ApplyPatch(patch)
+	var conflictErr *PatchConflictError
+	if !errors.As(err, &conflictErr) {
+		t.Fatalf("Expected a PatchConflictError, got %v", err)
+	}
+	if len(conflictErr.Conflicts) != 1 {
+		t.Errorf("Expected 1 conflict, got %d", len(conflictErr.Conflicts))
+	}
+	if v := target.GetNodeById(3).WidgetValuesArray()[2]; v != float64(12) {
+		t.Errorf("Expected conflicting graph to be left unchanged, got %v", v)
+	}
+}
+
+// TestDiffWidgetValuesLength tests that values added to or removed from the end of
+// widgets_values are patched
+func TestDiffWidgetValuesLength(t *testing.T) {
+	a := loadTestGraph(t, "../examples/img2img/img2img.json")
+	b := loadTestGraph(t, "../examples/img2img/img2img.json")
+	sampler := b.GetNodeById(3)
+	sampler.WidgetValues = append(sampler.WidgetValuesArray(), "extra", float64(2))
+	save := b.GetNodeById(9)
+	save.WidgetValues = save.WidgetValuesArray()[:0]
+
+	patch := Diff(a, b)
+	added, removed := 0, 0
+	for _, vp := range patch.Values {
+		if vp.Added {
+			added++
+		}
+		if vp.Removed {
+			removed++
+		}
+	}
+	if added != 2 || removed != 1 {
+		t.Fatalf("Expected 2 added and 1 removed value, got %d and %d", added, removed)
+	}
+
+	data, _ := json.Marshal(patch)
+	var decoded GraphPatch
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Failed to unmarshal patch: %v", err)
+	}
+	if err := a.ApplyPatch(&decoded); err != nil {
+		t.Fatalf("Failed to apply patch: %v", err)
+	}
+	if !Diff(a, b).IsEmpty() {
+		t.Errorf("Expected no differences after applying, got %s", data)
+	}
+	// applying the patch again changes nothing
+	if err := a.ApplyPatch(&decoded); err != nil || !Diff(a, b).IsEmpty() {
+		t.Errorf("Expected the patch to apply again without changes, got %v", err)
+	}
+}
+
+// TestApplyPatchFailureLeavesGraph tests that a patch that fails part way does not
+// change the graph
+func TestApplyPatchFailureLeavesGraph(t *testing.T) {
+	a := loadTestGraph(t, "../examples/img2img/img2img.json")
+	b := loadTestGraph(t, "../examples/img2img/img2img.json")
+	if err := b.RemoveNode(9); err != nil {
+		t.Fatalf("Failed to remove node: %v", err)
+	}
+	if err := b.AddNode(&GraphNode{Type: "SaveImage", WidgetValues: []interface{}{"patched"}}); err != nil {
+		t.Fatalf("Failed to add node: %v", err)
+	}
+	patch := Diff(a, b)
+	if len(patch.RemovedNodes) != 1 || len(patch.AddedNodes) != 1 {
+		t.Fatalf("Expected a removed and an added node")
+	}
+	// the node is removed before the added node fails to unmarshal
+	patch.AddedNodes[0].Node = json.RawMessage(`{"id": "invalid"}`)
+
+	before, _ := json.Marshal(a)
+	if err := a.ApplyPatch(patch); err == nil {
+		t.Fatalf("Expected the patch to fail")
+	}
+	after, _ := json.Marshal(a)
+	if string(before) != string(after) || a.GetNodeById(9) == nil {
+		t.Errorf("Expected the failed patch to leave the graph unchanged")
+	}
+}
@@ -0,0 +1,254 @@
+package graphapi
+
+import (
+	"bufio"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// the maximum depth of nested wildcard expansion before we give up
+const maxWildcardDepth = 32
+
+var dynamicPromptComments = regexp.MustCompile(`/\*[\s\S]*?\*/|//.*`)
+var dynamicPromptWildcard = regexp.MustCompile(`__([\w\-./\\ ]+?)__`)
+
+// DynamicPromptExpander expands the dynamic prompt syntax used in text widgets
+// that are flagged with "dynamicPrompts":
+//
+//	{red|green|blue}	one of the choices is selected at random
+//	__colors__			a random line from colors.txt in the wildcard directory
+//
+// Braces can be escaped with a backslash, and choices may be nested.  As with
+// the ComfyUI frontend, /* */ and // comments are stripped before expansion.
+type DynamicPromptExpander struct {
+	// WildcardDir is the directory that wildcard files are read from.  When
+	// empty, wildcards are left untouched.
+	WildcardDir string
+	// Random is the source used for choices. When nil, the shared math/rand source is used
+	Random *rand.Rand
+
+	wildcards map[string][]string
+}
+
+// NewDynamicPromptExpander creates a new expander with the given wildcard
+// directory and random source
+func NewDynamicPromptExpander(wildcardDir string, r *rand.Rand) *DynamicPromptExpander {
+	return &DynamicPromptExpander{
+		WildcardDir: wildcardDir,
+		Random:      r,
+		wildcards:   make(map[string][]string),
+	}
+}
+
+// ExpandDynamicPrompt expands text with a one-off expander
+func ExpandDynamicPrompt(text string, wildcardDir string, r *rand.Rand) (string, error) {
+	return NewDynamicPromptExpander(wildcardDir, r).Expand(text)
+}
+
+// Expand returns text with all choices and wildcards resolved
+func (d *DynamicPromptExpander) Expand(text string) (string, error) {
+	return d.expand(dynamicPromptComments.ReplaceAllString(text, ""), 0)
+}
+
+func (d *DynamicPromptExpander) expand(text string, depth int) (string, error) {
+	if depth > maxWildcardDepth {
+		return "", fmt.Errorf("dynamic prompt nested too deeply")
+	}
+
+	var err error
+	text, err = d.expandWildcards(text, depth)
+	if err != nil {
+		return "", err
+	}
+
+	// resolve the innermost choices first: the first unescaped closing brace that
+	// follows an unescaped opening brace closes an innermost set of choices
+	for {
+		start, end := innermostChoices(text)
+		if end == -1 {
+			break
+		}
+		options := splitUnescaped(text[start+1:end], '|')
+		choice := options[d.intn(len(options))]
+		text = text[:start] + choice + text[end+1:]
+	}
+
+	// unescape the remaining braces
+	text = strings.ReplaceAll(text, `\{`, "{")
+	text = strings.ReplaceAll(text, `\}`, "}")
+	return text, nil
+}
+
+func (d *DynamicPromptExpander) expandWildcards(text string, depth int) (string, error) {
+	if d.WildcardDir == "" {
+		return text, nil
+	}
+
+	var ferr error
+	expanded := dynamicPromptWildcard.ReplaceAllStringFunc(text, func(m string) string {
+		if ferr != nil {
+			return m
+		}
+		name := m[2 : len(m)-2]
+		lines, err := d.loadWildcard(name)
+		if err != nil {
+			ferr = err
+			return m
+		}
+		if len(lines) == 0 {
+			return ""
+		}
+		line, err := d.expand(lines[d.intn(len(lines))], depth+1)
+		if err != nil {
+			ferr = err
+			return m
+		}
+		return line
+	})
+	return expanded, ferr
+}
+
+// loadWildcard reads the non-empty, non-comment lines of a wildcard file
+func (d *DynamicPromptExpander) loadWildcard(name string) ([]string, error) {
+	if d.wildcards == nil {
+		d.wildcards = make(map[string][]string)
+	}
+	if lines, ok := d.wildcards[name]; ok {
+		return lines, nil
+	}
+
+	clean := filepath.Clean(filepath.FromSlash(strings.ReplaceAll(name, `\`, "/")))
+	if filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return nil, fmt.Errorf("invalid wildcard name %q", name)
+	}
+
+	f, err := os.Open(filepath.Join(d.WildcardDir, clean+".txt"))
+	if err != nil {
+		return nil, fmt.Errorf("cannot load wildcard %q: %w", name, err)
+	}
+	defer f.Close()
+
+	lines := make([]string, 0)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	d.wildcards[name] = lines
+	return lines, nil
+}
+
+func (d *DynamicPromptExpander) intn(n int) int {
+	if d.Random != nil {
+		return d.Random.Intn(n)
+	}
+	return rand.Intn(n)
+}
+
+func isEscaped(s string, i int) bool {
+	backslashes := 0
+	for j := i - 1; j >= 0 && s[j] == '\\'; j-- {
+		backslashes++
+	}
+	return backslashes%2 == 1
+}
+
+// innermostChoices returns the positions of the braces around the first
+// innermost set of choices, or -1, -1
+func innermostChoices(s string) (int, int) {
+	start := -1
+	for i := 0; i < len(s); i++ {
+		if isEscaped(s, i) {
+			continue
+		}
+		switch s[i] {
+		case '{':
+			start = i
+		case '}':
+			if start != -1 {
+				return start, i
+			}
+		}
+	}
+	return -1, -1
+}
+
+func splitUnescaped(s string, sep byte) []string {
+	retv := make([]string, 0)
+	last := 0
+	for i := 0; i < len(s); i++ {
+		if s[i] == sep && !isEscaped(s, i) {
+			retv = append(retv, s[last:i])
+			last = i + 1
+		}
+	}
+	return append(retv, s[last:])
+}
+
+// expandDynamicPrompts expands the serialized values of STRING properties that
+// are flagged with dynamicPrompts, recording the expanded text in the prompt
+func (t *Graph) expandDynamicPrompts(p *Prompt, promptIDs map[*GraphNode][]string) error {
+	// visit the prompt nodes in a stable order so a seeded source is reproducible
+	nodesByPromptID := make(map[string]*GraphNode)
+	ids := make([]string, 0)
+	for node, nids := range promptIDs {
+		for _, id := range nids {
+			nodesByPromptID[id] = node
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	var expander *DynamicPromptExpander
+	for _, id := range ids {
+		node := nodesByPromptID[id]
+		pn, ok := p.Nodes[id]
+		if !ok {
+			continue
+		}
+
+		names := make([]string, 0)
+		for name, prop := range node.Properties {
+			sp, ok := prop.ToStringProperty()
+			if ok && sp.DynamicPrompts && sp.Serializable() {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			text, ok := pn.Inputs[name].(string)
+			if !ok {
+				// linked inputs are not expanded
+				continue
+			}
+			if expander == nil {
+				expander = NewDynamicPromptExpander(t.WildcardDir, t.Random)
+			}
+			expanded, err := expander.Expand(text)
+			if err != nil {
+				return fmt.Errorf("node %s input %s: %w", id, name, err)
+			}
+			pn.Inputs[name] = expanded
+			if p.ExpandedText == nil {
+				p.ExpandedText = make(map[string]map[string]string)
+			}
+			if p.ExpandedText[id] == nil {
+				p.ExpandedText[id] = make(map[string]string)
+			}
+			p.ExpandedText[id][name] = expanded
+		}
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package graphapi
+
+import (
+	"encoding/json"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestExpandDynamicPrompt tests choices, nesting, escapes, comments and wildcards
+func TestExpandDynamicPrompt(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "colors.txt"), []byte("# a comment\nred\n\n{dark|light} blue\n"), 0644)
+	if err != nil {
+		t.Fatalf("Failed to write wildcard: %v", err)
+	}
+
+	valid := map[string]bool{"a red cat": true, "a dark blue cat": true, "a light blue cat": true}
+	r := rand.New(rand.NewSource(42))
+	for i := 0; i < 20; i++ {
+		out, err := ExpandDynamicPrompt("a __colors__ {cat|{cat}} // ignored", dir, r)
+		if err != nil {
+			t.Fatalf("Failed to expand: %v", err)
+		}
+		// the stripped comment leaves its leading space behind
+		if !valid[strings.TrimSpace(out)] {
+			t.Errorf("Unexpected expansion %q", out)
+		}
+	}
+
+	out, err := ExpandDynamicPrompt(`\{literal\} {only}`, "", r)
+	if err != nil {
+		t.Fatalf("Failed to expand: %v", err)
+	}
+	if out != "{literal} only" {
+		t.Errorf("Expected escaped braces to be kept, got %q", out)
+	}
+
+	// wildcards are left alone without a wildcard directory
+	out, _ = ExpandDynamicPrompt("__colors__", "", r)
+	if out != "__colors__" {
+		t.Errorf("Expected wildcard to be untouched, got %q", out)
+	}
+
+	if _, err := ExpandDynamicPrompt("__missing__", dir, r); err == nil {
+		t.Error("Expected an error for a missing wildcard file")
+	}
+
+	// the same seed gives the same result
+	a, _ := ExpandDynamicPrompt("{a|b|c|d|e|f} {a|b|c|d|e|f}", "", rand.New(rand.NewSource(7)))
+	b, _ := ExpandDynamicPrompt("{a|b|c|d|e|f} {a|b|c|d|e|f}", "", rand.New(rand.NewSource(7)))
+	if a != b {
+		t.Errorf("Expected reproducible expansion, got %q and %q", a, b)
+	}
+}
+
+// TestGraphToPromptExpandsDynamicPrompts tests that generating a prompt expands the
+// inputs flagged with dynamicPrompts, records the text, and leaves linked inputs alone
+func TestGraphToPromptExpandsDynamicPrompts(t *testing.T) {
+	data, err := os.ReadFile("../examples/testdata/subgraphs/object_info.json")
+	if err != nil {
+		t.Fatalf("Failed to read object info: %v", err)
+	}
+	nodeObjects := &NodeObjects{}
+	if err := json.Unmarshal(data, &nodeObjects.Objects); err != nil {
+		t.Fatalf("Failed to unmarshal object info: %v", err)
+	}
+	source := &NodeObject{}
+	json.Unmarshal([]byte(`{"input": {"required": {"value": ["STRING", {}]}}, "output": ["STRING"], "name": "StringSource", "display_name": "String Source"}`), source)
+	nodeObjects.Objects["StringSource"] = source
+	nodeObjects.PopulateInputProperties()
+
+	workflow := `{
+		"nodes": [
+			{"id": 1, "type": "CLIPTextEncode", "pos": [0, 0], "size": [400, 200], "order": 1, "mode": 0,
+			 "inputs": [{"name": "clip", "type": "CLIP", "link": null}],
+			 "outputs": [{"name": "CONDITIONING", "type": "CONDITIONING", "links": []}],
+			 "properties": {}, "widgets_values": ["a {cat|dog}"]},
+			{"id": 2, "type": "CLIPTextEncode", "pos": [0, 300], "size": [400, 200], "order": 2, "mode": 0,
+			 "inputs": [{"name": "clip", "type": "CLIP", "link": null}, {"name": "text", "type": "STRING", "widget": {"name": "text"}, "link": 1}],
+			 "outputs": [{"name": "CONDITIONING", "type": "CONDITIONING", "links": []}],
+			 "properties": {}, "widgets_values": ["{x|y}"]},
+			{"id": 3, "type": "StringSource", "pos": [-400, 300], "size": [300, 100], "order": 0, "mode": 0,
+			 "outputs": [{"name": "STRING", "type": "STRING", "links": [1]}],
+			 "properties": {}, "widgets_values": ["{left|alone}"]}
+		],
+		"links": [[1, 3, 0, 2, 1, "STRING"]],
+		"groups": [],
+		"last_node_id": 3,
+		"last_link_id": 1,
+		"version": 0.4
+	}`
+	graph, _, err := NewGraphFromJsonString(workflow, nodeObjects)
+	if err != nil {
+		t.Fatalf("Failed to load workflow: %v", err)
+	}
+	graph.Random = rand.New(rand.NewSource(1))
+
+	p, err := graph.GraphToPrompt("")
+	if err != nil {
+		t.Fatalf("Failed to generate prompt: %v", err)
+	}
+	text := p.Nodes["1"].Inputs["text"]
+	if text != "a cat" && text != "a dog" {
+		t.Errorf("Expected the text to be expanded, got %v", text)
+	}
+	if p.ExpandedText["1"]["text"] != text {
+		t.Errorf("Expected the expanded text to be recorded, got %v", p.ExpandedText)
+	}
+	if link, ok := p.Nodes["2"].Inputs["text"].([]interface{}); !ok || len(link) != 2 || link[0] != "3" {
+		t.Errorf("Expected the linked input to be left alone, got %v", p.Nodes["2"].Inputs["text"])
+	}
+	if _, ok := p.ExpandedText["2"]; ok {
+		t.Errorf("Expected no expanded text for the linked input")
+	}
+	if v := p.Nodes["3"].Inputs["value"]; v != "{left|alone}" {
+		t.Errorf("Expected inputs without dynamicPrompts to be left alone, got %v", v)
+	}
+	// the workflow keeps the text that was expanded
+	if v := graph.GetNodeById(1).WidgetValuesArray()[0]; v != "a {cat|dog}" {
+		t.Errorf("Expected the workflow to be unchanged, got %v", v)
+	}
+}
+
+// TestWildcardNames tests that wildcards may not leave the wildcard directory, but
+// may start with dots
+func TestWildcardNames(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "..dots.txt"), []byte("dotted\n"), 0644); err != nil {
+		t.Fatalf("Failed to write wildcard: %v", err)
+	}
+	out, err := ExpandDynamicPrompt("__..dots__", dir, nil)
+	if err != nil || out != "dotted" {
+		t.Errorf("Expected a wildcard starting with dots to load, got %q, %v", out, err)
+	}
+	for _, name := range []string{"__../secret__", "__..__", "__a/../../secret__"} {
+		if _, err := ExpandDynamicPrompt(name, dir, nil); err == nil || !strings.Contains(err.Error(), "invalid wildcard name") {
+			t.Errorf("Expected %s to be rejected, got %v", name, err)
+		}
+	}
+}
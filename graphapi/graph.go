@@ -3,9 +3,9 @@ package graphapi
 import (
 	"encoding/json"
 	"errors"
-	"fmt"
 	"io"
 	"log/slog"
+	"math/rand"
 	"os"
 
 	"sort"
@@ -21,18 +21,35 @@ func (a ByGraphOrdinal) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
 func (a ByGraphOrdinal) Less(i, j int) bool { return a[i].Order < a[j].Order }
 
 type Graph struct {
-	Nodes                 []*GraphNode                   `json:"nodes"`
-	Links                 []*Link                        `json:"links"`
-	Groups                []*Group                       `json:"groups"`
-	Definitions           *GraphDefinitions              `json:"definitions,omitempty"`
-	LastNodeID            int                            `json:"last_node_id"`
-	LastLinkID            int                            `json:"last_link_id"`
-	Version               float32                        `json:"version"`
-	NodesByID             map[int]*GraphNode             `json:"-"`
-	LinksByID             map[int]*Link                  `json:"-"`
-	SubgraphsByID         map[string]*SubgraphDefinition `json:"-"`
-	NodesInExecutionOrder []*GraphNode                   `json:"-"`
-	HasErrors             bool                           `json:"-"`
+	Nodes                 []*GraphNode                    `json:"nodes"`
+	Links                 []*Link                         `json:"links"`
+	Groups                []*Group                        `json:"groups"`
+	Definitions           *GraphDefinitions               `json:"definitions,omitempty"`
+	State                 *SubgraphState                  `json:"state,omitempty"` // the last ids, in schema version 1
+	FloatingLinks         []*Link                         `json:"floatingLinks,omitempty"`
+	Extra                 map[string]interface{}          `json:"extra,omitempty"`
+	LastNodeID            int                             `json:"last_node_id"`
+	LastLinkID            int                             `json:"last_link_id"`
+	Version               float32                         `json:"version"`
+	NodesByID             map[int]*GraphNode              `json:"-"`
+	LinksByID             map[int]*Link                   `json:"-"`
+	SubgraphsByID         map[string]*SubgraphDefinition  `json:"-"`
+	Reroutes              []*Reroute                      `json:"-"`
+	ReroutesByID          map[int]*Reroute                `json:"-"`
+	GroupNodes            map[string]*GroupNodeDefinition `json:"-"`
+	NodesInExecutionOrder []*GraphNode                    `json:"-"`
+	HasErrors             bool                            `json:"-"`
+	// ValueControl enables applying "control_after_generate" widgets when generating prompts
+	ValueControl ValueControlMode `json:"-"`
+	// Random is the source used for randomized values.  When nil, the shared math/rand source is used
+	Random *rand.Rand `json:"-"`
+	// WildcardDir is the directory that __wildcard__ files are read from when expanding dynamic prompts
+	WildcardDir  string `json:"-"`
+	hasGenerated bool
+	node_objects *NodeObjects // the node objects the properties were created from
+	// order_deferred is above zero while edits do not recompute the execution order
+	order_deferred int
+	raw            *rawJSON
 }
 
 // GetGroupWithTitle returns the 'first' group with the given title
@@ -61,18 +78,23 @@ func (t *Graph) UnmarshalJSON(b []byte) error {
 
 	alias := &Alias{}
 
-	if err := json.Unmarshal(b, alias); err != nil {
+	raw, err := unmarshalPreserving(b, alias)
+	if err != nil {
 		return err
 	}
+	t.raw = raw
 
 	// Copy the fields from the alias to the original struct
 	t.Nodes = alias.Nodes
 	t.Links = alias.Links
 	t.Groups = alias.Groups
 	t.Definitions = alias.Definitions
+	t.FloatingLinks = alias.FloatingLinks
+	t.Extra = alias.Extra
 	t.LastNodeID = alias.LastNodeID
 	t.LastLinkID = alias.LastLinkID
 	t.Version = alias.Version
+	t.State = alias.State
 	t.NodesByID = make(map[int]*GraphNode)
 	t.LinksByID = make(map[int]*Link)
 	t.SubgraphsByID = make(map[string]*SubgraphDefinition)
@@ -102,6 +124,17 @@ func (t *Graph) UnmarshalJSON(b []byte) error {
 	for _, link := range t.Links {
 		t.LinksByID[link.ID] = link
 	}
+	if t.SchemaVersion() == SchemaVersion1 {
+		if err := t.readSchemaV1(b); err != nil {
+			return err
+		}
+	}
+	if err := t.readReroutes(); err != nil {
+		return err
+	}
+	if err := t.readGroupNodes(); err != nil {
+		return err
+	}
 
 	// get the ordinality of nodes
 	t.NodesInExecutionOrder = make([]*GraphNode, len(t.Nodes))
@@ -111,6 +144,19 @@ func (t *Graph) UnmarshalJSON(b []byte) error {
 	return nil
 }
 
+func (t *Graph) MarshalJSON() ([]byte, error) {
+	if t.SchemaVersion() == SchemaVersion1 {
+		return t.marshalSchemaV1()
+	}
+
+	// Create an alias type to avoid recursive call to MarshalJSON
+	type Alias Graph
+
+	alias := Alias(*t)
+	alias.Extra = t.serializedExtra()
+	return marshalPreserving(&alias, t.raw)
+}
+
 func duplicateProperty(prop Property) Property {
 	switch prop.TypeString() {
 	case "STRING":
@@ -154,194 +200,187 @@ func (t *Graph) CreateNodeProperties(node_objects *NodeObjects) *[]string {
 	// had thier properties created
 	primitives := make([]*GraphNode, 0)
 	var retv *[]string = nil
-	for _, n := range t.Nodes {
-		pindex := 0
-
-		// random numbers seem to have an additional widget added in widget.js addValueControlWidget @ln 15
-		// when an INT widget is created with either the name "seed" or "noise_seed", the additional
-		// widget is added directly after.
-		// it is a COMBO called "control_after_generate" with one of:
-		// 	fixed
-		//	increment
-		//	decrement
-		// 	randomize
+	t.node_objects = node_objects
 
-		// create a new map to hold the properties by name
-		n.Properties = make(map[string]Property)
-
-		// Handle subgraph nodes specially
-		if n.IsSubgraph && n.SubgraphDef != nil {
-			t.createSubgraphProperties(n, &pindex)
-			// Also create properties for internal nodes of the subgraph
-			missing := t.createInternalNodeProperties(n.SubgraphDef, node_objects)
-			if missing != nil && len(*missing) > 0 {
-				if retv == nil {
-					retv = missing
-				} else {
-					for _, m := range *missing {
-						if !containsString(retv, m) {
-							*retv = append(*retv, m)
-						}
-					}
+	// the properties of subgraph instances can refer to the nodes within them, so those
+	// are created first.  Instances nested in a subgraph need every definition's nodes.
+	if t.Definitions != nil {
+		for _, sg := range t.Definitions.Subgraphs {
+			retv = mergeMissing(retv, t.createInternalNodeProperties(sg, node_objects))
+		}
+		for _, sg := range t.Definitions.Subgraphs {
+			for _, n := range sg.Nodes {
+				if n.IsSubgraph && n.SubgraphDef != nil {
+					pindex := 0
+					t.createSubgraphProperties(n, &pindex)
 				}
 			}
-			continue
 		}
+	}
 
-		nobject := node_objects.GetNodeObjectByName(n.Type)
-
-		if nobject != nil {
-			// get the display name and description
-			n.DisplayName = nobject.DisplayName
-			n.Description = nobject.Description
+	for _, n := range t.Nodes {
+		retv = mergeMissing(retv, t.createNodeProperties(n, node_objects, &primitives))
+	}
 
-			// is this node an output node?
-			n.IsOutput = nobject.OutputNode
+	// process primitives
+	// Can a primitive?:
+	// 		Connect to reroute: 					Nope (thank god)
+	//		Connect combo to two different types: 	Nope
+	for _, primitive_node := range primitives {
+		createPrimitiveProperties(t, primitive_node)
+	}
 
-			// get the settable properties and associate them with correct widgets
-			props := nobject.GetSettableProperties()
-			t.ProcessSettableProperties(n, &props, &pindex)
+	return retv
+}
 
-			// check if the number of properties is the same as the number of widget values
-			if n.WidgetValueCount() != len(props) {
-				// If the count of WidgetValues is not the same as props there may be potential issues
-				// which may arrise here if not handled properly.  An example is LoadImage and LoadImageMask where
-				// there is a widget "choose file to upload" whose field points to the
-				// property that the upload would be set to.  This widget is added in web/extensions/core/uploadImage.js
-				if nobject.Name == "LoadImage" || nobject.Name == "LoadImageMask" {
-					// create an imageuploader property and point to it's associated COMBO property
-					targetProp := n.GetPropertyWithName("image")
-					if targetProp != nil {
-						np := newImageUploadProperty("choose file to upload", targetProp.(*ComboProperty), len(n.Properties))
-						// set the alias to "file"
-						(*np).SetAlias("file")
-						n.Properties["choose file to upload"] = *np
-					} else {
-						slog.Error("Cannot find \"image\" property")
-					}
+// createNodeProperties creates the properties of a top-level node, and returns its type
+// if it is missing from node_objects.  PrimitiveNodes are added to primitives, as their
+// properties are made from those of the widgets they are linked to.
+func (t *Graph) createNodeProperties(n *GraphNode, node_objects *NodeObjects, primitives *[]*GraphNode) *[]string {
+	pindex := 0
+
+	// random numbers seem to have an additional widget added in widget.js addValueControlWidget @ln 15
+	// when an INT widget is created with either the name "seed" or "noise_seed", the additional
+	// widget is added directly after.
+	// it is a COMBO called "control_after_generate" with one of:
+	// 	fixed
+	//	increment
+	//	decrement
+	// 	randomize
+
+	// create a new map to hold the properties by name
+	n.Properties = make(map[string]Property)
+
+	// Handle subgraph nodes specially
+	if n.IsSubgraph && n.SubgraphDef != nil {
+		t.createSubgraphProperties(n, &pindex)
+		return nil
+	}
+	if n.GroupNodeDef != nil {
+		return t.createGroupNodeProperties(n, node_objects)
+	}
+
+	nobject := node_objects.GetNodeObjectByName(n.Type)
+
+	if nobject != nil {
+		// get the display name and description
+		n.DisplayName = nobject.DisplayName
+		n.Description = nobject.Description
+
+		// is this node an output node?
+		n.IsOutput = nobject.OutputNode
+
+		// get the settable properties and associate them with correct widgets
+		props := nobject.GetSettableProperties()
+		t.ProcessSettableProperties(n, &props, &pindex)
+
+		// check if the number of properties is the same as the number of widget values
+		if n.WidgetValueCount() != len(props) {
+			// If the count of WidgetValues is not the same as props there may be potential issues
+			// which may arrise here if not handled properly.  An example is LoadImage and LoadImageMask where
+			// there is a widget "choose file to upload" whose field points to the
+			// property that the upload would be set to.  This widget is added in web/extensions/core/uploadImage.js
+			if nobject.Name == "LoadImage" || nobject.Name == "LoadImageMask" {
+				// create an imageuploader property and point to it's associated COMBO property
+				targetProp := n.GetPropertyWithName("image")
+				if targetProp != nil {
+					np := newImageUploadProperty("choose file to upload", targetProp.(*ComboProperty), len(n.Properties))
+					// set the alias to "file"
+					(*np).SetAlias("file")
+					n.Properties["choose file to upload"] = *np
 				} else {
-					slog.Debug("size missmatch for", "node type", n.Type)
+					slog.Error("Cannot find \"image\" property")
 				}
-			}
-		} else {
-			if n.Type == "PrimitiveNode" {
-				primitives = append(primitives, n)
-			} else if n.Type == "Note" {
-				notewidgets := n.WidgetValues.([]interface{})
-				// get the pointer to the first widget value
-				// we'll set the property direct_value to point to the widget inteface we want to target
-				np := newStringProperty("text", false, nil, 0)
-				(*np).SetDirectValue(&notewidgets[0])
-				n.Properties["text"] = *np
-				continue
-			} else if n.Type == "Reroute" || n.Type == "MarkdownNote" {
-				// skip Reroute and MarkdownNote
-				continue
 			} else {
-				slog.Error("Could not get node object for", "node type", n.Type)
-				if retv == nil {
-					r := make([]string, 0)
-					retv = &r
-				}
-				if !containsString(retv, n.Type) {
-					r := append(*retv, n.Type)
-					retv = &r
-				}
+				slog.Debug("size missmatch for", "node type", n.Type)
 			}
 		}
+	} else {
+		if n.Type == "PrimitiveNode" {
+			*primitives = append(*primitives, n)
+		} else if n.Type == "Note" {
+			notewidgets := n.WidgetValues.([]interface{})
+			// get the pointer to the first widget value
+			// we'll set the property direct_value to point to the widget inteface we want to target
+			np := newStringProperty("text", false, nil, 0)
+			(*np).SetDirectValue(&notewidgets[0])
+			n.Properties["text"] = *np
+			return nil
+		} else if n.Type == "Reroute" || n.Type == "MarkdownNote" {
+			// skip Reroute and MarkdownNote
+			return nil
+		} else {
+			slog.Error("Could not get node object for", "node type", n.Type)
+			return &[]string{n.Type}
+		}
 	}
+	return nil
+}
 
-	// process primitives
-	// Can a primitive?:
-	// 		Connect to reroute: 					Nope (thank god)
-	//		Connect combo to two different types: 	Nope
-	for _, primitive_node := range primitives {
-		for _, primitive_node_output := range primitive_node.Outputs {
-			// For outputs, we need to contend with multiple links.
-			// Go through each output, get the link, then the target node,
-			// then the target property of that node.
-			if primitive_node_output.Links != nil && len(*primitive_node_output.Links) != 0 {
-				// we'll use the type and value of primitive_node_output.Links[0].  I'll assume that.
-				// the link IDs are ordered and [0] would be the first on linked
-				var first_property Property
-				pindex := 0
-				for _, l := range *primitive_node_output.Links {
-					primitive_node_output_link := t.GetLinkById(l)
-					if primitive_node_output_link != nil {
-						// get the target node
-						target_node := t.GetNodeById(primitive_node_output_link.TargetID)
-						if target_node != nil {
+// nodeContainer is a graph, or a subgraph definition, that nodes and links are looked up in
+type nodeContainer interface {
+	GetNodeById(id int) *GraphNode
+	GetLinkById(id int) *Link
+}
+
+// createPrimitiveProperties gives a PrimitiveNode a "value" property like that of the
+// first widget it is linked to, with the others as secondaries
+func createPrimitiveProperties(g nodeContainer, primitive_node *GraphNode) {
+	for _, primitive_node_output := range primitive_node.Outputs {
+		// For outputs, we need to contend with multiple links.
+		// Go through each output, get the link, then the target node,
+		// then the target property of that node.
+		if primitive_node_output.Links != nil && len(*primitive_node_output.Links) != 0 {
+			// we'll use the type and value of primitive_node_output.Links[0].  I'll assume that.
+			// the link IDs are ordered and [0] would be the first on linked
+			var first_property Property
+			pindex := 0
+			for _, l := range *primitive_node_output.Links {
+				primitive_node_output_link := g.GetLinkById(l)
+				if primitive_node_output_link != nil {
+					// get the target node
+					target_node := g.GetNodeById(primitive_node_output_link.TargetID)
+					if target_node != nil {
+						if first_property == nil {
+							first_property = target_node.Inputs[primitive_node_output_link.TargetSlot].Property
 							if first_property == nil {
-								first_property = target_node.Inputs[primitive_node_output_link.TargetSlot].Property
-								if first_property == nil {
-									slog.Warn("Could not get primitive target slot property %s for node %s", target_node.Inputs[primitive_node_output_link.TargetSlot].Name, target_node.Title)
-									continue
-								}
-								// copy the property and assign it the node's "value" property
-								np := duplicateProperty(first_property)
-								np.SetIndex(pindex)
-								primitive_node.Properties["value"] = np
-							} else {
-								// copy the property and add the node's "value" property as a secondary
-								p := target_node.Inputs[primitive_node_output_link.TargetSlot].Property
-								if p != nil {
-									newp := duplicateProperty(p)
-									newp.SetIndex(pindex)
-									primitive_node.Properties["value"].AttachSecondaryProperty(newp)
-								}
+								slog.Warn("Could not get primitive target slot property %s for node %s", target_node.Inputs[primitive_node_output_link.TargetSlot].Name, target_node.Title)
+								continue
+							}
+							// copy the property and assign it the node's "value" property
+							np := duplicateProperty(first_property)
+							np.SetIndex(pindex)
+							primitive_node.Properties["value"] = np
+						} else {
+							// copy the property and add the node's "value" property as a secondary
+							p := target_node.Inputs[primitive_node_output_link.TargetSlot].Property
+							if p != nil {
+								newp := duplicateProperty(p)
+								newp.SetIndex(pindex)
+								primitive_node.Properties["value"].AttachSecondaryProperty(newp)
 							}
 						}
 					}
-					pindex++
 				}
+				pindex++
 			}
 		}
 	}
+}
 
-	// Process internal nodes of all subgraphs
-	if t.Definitions != nil && t.Definitions.Subgraphs != nil {
-		for _, sg := range t.Definitions.Subgraphs {
-			for _, n := range sg.Nodes {
-				// Skip virtual nodes
-				if n.IsVirtual() {
-					continue
-				}
-
-				// Create properties for this internal node
-				pindex := 0
-				n.Properties = make(map[string]Property)
-
-				nobject := node_objects.GetNodeObjectByName(n.Type)
-				if nobject != nil {
-					n.DisplayName = nobject.DisplayName
-					n.Description = nobject.Description
-					n.IsOutput = nobject.OutputNode
-
-					props := nobject.GetSettableProperties()
-					t.ProcessSettableProperties(n, &props, &pindex)
-				} else {
-					// Handle special node types
-					if n.Type == "Note" {
-						notewidgets := n.WidgetValues.([]interface{})
-						np := newStringProperty("text", false, nil, 0)
-						(*np).SetDirectValue(&notewidgets[0])
-						n.Properties["text"] = *np
-					} else if n.Type != "Reroute" && n.Type != "MarkdownNote" {
-						// Track missing node types
-						if retv == nil {
-							r := make([]string, 0)
-							retv = &r
-						}
-						if !containsString(retv, n.Type) {
-							r := append(*retv, n.Type)
-							retv = &r
-						}
-					}
-				}
-			}
+// mergeMissing adds the missing node types of missing to retv
+func mergeMissing(retv *[]string, missing *[]string) *[]string {
+	if missing == nil || len(*missing) == 0 {
+		return retv
+	}
+	if retv == nil {
+		return missing
+	}
+	for _, m := range *missing {
+		if !containsString(retv, m) {
+			*retv = append(*retv, m)
 		}
 	}
-
 	return retv
 }
 
@@ -353,53 +392,15 @@ func (t *Graph) createSubgraphProperties(n *GraphNode, pindex *int) {
 		return
 	}
 
-	// Get widget values array
-	widgetValues := n.WidgetValuesArray()
-	if widgetValues == nil {
-		widgetValues = make([]interface{}, 0)
-	}
-
-	// Extract proxyWidgets mapping: [[nodeId, widgetName], ...]
-	// For subgraph inputs, nodeId will be "-1" or -10
-	proxyWidgetsMap := make(map[string]int) // map[widgetName]widgetIndex
-	if n.InternalProperties != nil {
-		if pw, ok := (*n.InternalProperties)["proxyWidgets"]; ok {
-			if pwArray, ok := pw.([]interface{}); ok {
-				for widgetIndex, entry := range pwArray {
-					if entryArray, ok := entry.([]interface{}); ok {
-						if len(entryArray) >= 2 {
-							// Parse node ID
-							var nodeID string
-							switch v := entryArray[0].(type) {
-							case string:
-								nodeID = v
-							case float64:
-								nodeID = fmt.Sprintf("%.0f", v)
-							}
-
-							// Only map entries targeting "-1" (subgraph inputs)
-							if nodeID == "-1" || nodeID == "-10" {
-								if widgetName, ok := entryArray[1].(string); ok {
-									proxyWidgetsMap[widgetName] = widgetIndex
-								}
-							}
-						}
-					}
-				}
-			}
-		}
-	}
-
-	// Create a property for each subgraph input
-	for inputIndex, input := range sg.Inputs {
+	// Create a property for each subgraph input that has a widget
+	for _, input := range sg.Inputs {
 		propName := input.Name
 		propType := input.Type
 
-		// Determine which widget index to use for this property
-		// If proxyWidgets specifies a mapping, use that; otherwise use sequential index
-		targetWidgetIndex := inputIndex
-		if mappedIndex, found := proxyWidgetsMap[propName]; found {
-			targetWidgetIndex = mappedIndex
+		// the widget values of the instance are those of the promoted widgets
+		targetWidgetIndex := promotedWidgetIndex(n, sg, propName)
+		if targetWidgetIndex < 0 {
+			continue
 		}
 
 		// Create property based on type and link it to the node's widget
@@ -450,16 +451,19 @@ func (t *Graph) createSubgraphProperties(n *GraphNode, pindex *int) {
 // createInternalNodeProperties creates properties for internal nodes of a subgraph
 func (t *Graph) createInternalNodeProperties(sg *SubgraphDefinition, node_objects *NodeObjects) *[]string {
 	var retv *[]string = nil
+	primitives := make([]*GraphNode, 0)
 
 	for _, n := range sg.Nodes {
-		// Skip virtual nodes (input/output nodes)
-		if n.IsVirtual() {
-			continue
-		}
-
 		pindex := 0
 		n.Properties = make(map[string]Property)
 
+		// instances of other subgraphs get their properties once all definitions have theirs
+		if nested := sg.GetSubgraphForNode(n); nested != nil {
+			n.IsSubgraph = true
+			n.SubgraphDef = nested
+			continue
+		}
+
 		nobject := node_objects.GetNodeObjectByName(n.Type)
 
 		if nobject != nil {
@@ -476,7 +480,7 @@ func (t *Graph) createInternalNodeProperties(sg *SubgraphDefinition, node_object
 		} else {
 			// Handle special node types
 			if n.Type == "PrimitiveNode" {
-				// PrimitiveNode handling would go here if needed
+				primitives = append(primitives, n)
 			} else if n.Type == "Note" {
 				notewidgets := n.WidgetValues.([]interface{})
 				np := newStringProperty("text", false, nil, 0)
@@ -500,10 +504,17 @@ func (t *Graph) createInternalNodeProperties(sg *SubgraphDefinition, node_object
 		}
 	}
 
+	for _, primitive_node := range primitives {
+		createPrimitiveProperties(sg, primitive_node)
+	}
+
 	return retv
 }
 
 func (t *Graph) ProcessSettableProperties(n *GraphNode, props *[]Property, pindex *int) {
+	// the last INT, paired with the value control widget added after it.  A node can
+	// have more than one, while only the last is in its properties by name.
+	var controlled *IntProperty
 	for _, prop := range *props {
 		// convert to actual property type, deep copy
 		// store a pointer to the property in the node's
@@ -530,6 +541,9 @@ func (t *Graph) ProcessSettableProperties(n *GraphNode, props *[]Property, pinde
 			*pindex++
 			n.Properties[prop.Name()] = &np
 			n.affixPropertyToInputSlot(prop.Name(), &np)
+			if prop.Name() == "control_after_generate" && controlled != nil && controlled.GetTargetWidget() == np.GetTargetWidget()-1 {
+				controlled.control = &np
+			}
 		case "INT":
 			np := *prop.(*IntProperty)
 			np.UpdateParent(&np)
@@ -537,6 +551,7 @@ func (t *Graph) ProcessSettableProperties(n *GraphNode, props *[]Property, pinde
 			*pindex++
 			n.Properties[prop.Name()] = &np
 			n.affixPropertyToInputSlot(prop.Name(), &np)
+			controlled = &np
 		case "BOOLEAN":
 			np := *prop.(*BoolProperty)
 			np.UpdateParent(&np)
@@ -656,6 +671,27 @@ func (t *Graph) GetNodesWithType(nodeType string) []*GraphNode {
 	return retv
 }
 
+// ResetAllToDefaults resets every property in the graph, including those of nodes
+// within subgraph definitions, that declares a default value
+func (t *Graph) ResetAllToDefaults() error {
+	errs := make([]error, 0)
+	for _, n := range t.Nodes {
+		if err := n.ResetToDefaults(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if t.Definitions != nil {
+		for _, sg := range t.Definitions.Subgraphs {
+			for _, n := range sg.Nodes {
+				if err := n.ResetToDefaults(); err != nil {
+					errs = append(errs, err)
+				}
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
 func NewGraphFromJsonReader(r io.Reader, node_objects *NodeObjects) (*Graph, *[]string, error) {
 	fileContent, err := io.ReadAll(r)
 	if err != nil {
@@ -693,7 +729,7 @@ func NewGraphFromJsonString(data string, node_objects *NodeObjects) (*Graph, *[]
 }
 
 func (t *Graph) GraphToJSON() (string, error) {
-	data, err := json.Marshal(t)
+	data, err := marshalJSON(t)
 	if err != nil {
 		return "", err
 	}
@@ -724,10 +760,56 @@ func (t *Graph) GraphToPrompt(clientID string) (Prompt, error) {
 		// PID:      "floopy-thingy-ma-bob", // we can add additionl information that is ignored by ComfyUI
 	}
 
-	// Check if the graph contains any subgraphs
+	// gather the controlled values (seeds) and apply them now if they are run before generation.
+	// The frontend does not apply them before the very first generation.
+	var controlled []controlledValue
+	if t.ValueControl != ValueControlDisabled {
+		controlled = t.collectControlledValues()
+		if t.ValueControl == ValueControlBeforeGenerate && t.hasGenerated {
+			for _, cv := range controlled {
+				if err := t.applyControlledValue(cv); err != nil {
+					return p, err
+				}
+			}
+		}
+	}
+	promptIDs, err := t.serializePromptNodes(&p)
+	if err != nil {
+		return p, err
+	}
+
+	// expand {a|b} choices in text that is flagged with dynamicPrompts
+	if err := t.expandDynamicPrompts(&p, promptIDs); err != nil {
+		return p, err
+	}
+
+	// record the values that were used, then apply them for the next generation
+	if controlled != nil {
+		recordControlledValues(&p, controlled, promptIDs)
+		if t.ValueControl == ValueControlAfterGenerate {
+			for _, cv := range controlled {
+				if err := t.applyControlledValue(cv); err != nil {
+					return p, err
+				}
+			}
+		}
+	}
+	t.hasGenerated = true
+
+	// assign our current graph as the workflow
+	p.ExtraData.PngInfo.Workflow = t
+	return p, nil
+}
+
+// serializePromptNodes adds the nodes of the graph to the prompt, returning the
+// prompt node IDs of each graph node
+func (t *Graph) serializePromptNodes(p *Prompt) (map[*GraphNode][]string, error) {
+	promptIDs := make(map[*GraphNode][]string)
+
+	// Check if the graph contains any subgraphs, or legacy group nodes
 	hasSubgraphs := false
 	for _, node := range t.Nodes {
-		if node.IsSubgraph {
+		if node.IsSubgraph || node.GroupNodeDef != nil {
 			hasSubgraphs = true
 			break
 		}
@@ -737,9 +819,12 @@ func (t *Graph) GraphToPrompt(clientID string) (Prompt, error) {
 	if hasSubgraphs {
 		expander := NewSubgraphExpander(t)
 		if err := expander.ExpandAll(); err != nil {
-			return p, err
+			return nil, err
 		}
 		p.Nodes = expander.ToPromptNodes()
+		for id, en := range expander.ExpandedNodes {
+			promptIDs[en.Node] = append(promptIDs[en.Node], id)
+		}
 	} else {
 		// Use original logic for backward compatibility
 		for _, node := range t.NodesInExecutionOrder {
@@ -790,10 +875,8 @@ func (t *Graph) GraphToPrompt(clientID string) (Prompt, error) {
 				}
 			}
 			p.Nodes[strconv.Itoa(node.ID)] = pn
+			promptIDs[node] = append(promptIDs[node], strconv.Itoa(node.ID))
 		}
 	}
-
-	// assign our current graph as the workflow
-	p.ExtraData.PngInfo.Workflow = t
-	return p, nil
+	return promptIDs, nil
 }
@@ -0,0 +1,146 @@
+package graphapi
+
+import "fmt"
+
+// AddNode adds a node to the graph.  If the node's ID is zero, the next free ID
+// is assigned.  The node's links are not connected, use AddLink for that.
+func (t *Graph) AddNode(n *GraphNode) error {
+	if n.ID == 0 {
+		n.ID = t.LastNodeID + 1
+	}
+	if _, exists := t.NodesByID[n.ID]; exists {
+		return fmt.Errorf("node %d already exists", n.ID)
+	}
+	if t.NodesByID == nil {
+		t.NodesByID = make(map[int]*GraphNode)
+	}
+
+	n.Graph = t
+	if sg, exists := t.SubgraphsByID[n.Type]; exists {
+		n.IsSubgraph = true
+		n.SubgraphDef = sg
+	}
+	t.Nodes = append(t.Nodes, n)
+	t.NodesByID[n.ID] = n
+	if n.ID > t.LastNodeID {
+		t.LastNodeID = n.ID
+	}
+	t.updateExecutionOrder()
+	return nil
+}
+
+// RemoveNode removes a node, and all links to and from it, from the graph
+func (t *Graph) RemoveNode(id int) error {
+	n := t.GetNodeById(id)
+	if n == nil {
+		return fmt.Errorf("node %d does not exist", id)
+	}
+
+	for _, slot := range n.Inputs {
+		if slot.Link != 0 {
+			t.RemoveLink(slot.Link)
+		}
+	}
+	for _, slot := range n.Outputs {
+		if slot.Links == nil {
+			continue
+		}
+		// copy, RemoveLink will alter the slice
+		links := append([]int(nil), *slot.Links...)
+		for _, l := range links {
+			t.RemoveLink(l)
+		}
+	}
+
+	for i, gn := range t.Nodes {
+		if gn == n {
+			t.Nodes = append(t.Nodes[:i], t.Nodes[i+1:]...)
+			break
+		}
+	}
+	delete(t.NodesByID, id)
+	n.Graph = nil
+	t.updateExecutionOrder()
+	return nil
+}
+
+// AddLink connects an output slot of one node to an input slot of another.  Any link
+// already connected to the input slot is removed first.  A link that would form a cycle
+// is not added, and a *CycleError is returned.
+func (t *Graph) AddLink(originID int, originSlot int, targetID int, targetSlot int) (*Link, error) {
+	origin := t.GetNodeById(originID)
+	if origin == nil {
+		return nil, fmt.Errorf("origin node %d does not exist", originID)
+	}
+	target := t.GetNodeById(targetID)
+	if target == nil {
+		return nil, fmt.Errorf("target node %d does not exist", targetID)
+	}
+	if originSlot < 0 || originSlot >= len(origin.Outputs) {
+		return nil, fmt.Errorf("node %d has no output slot %d", originID, originSlot)
+	}
+	if targetSlot < 0 || targetSlot >= len(target.Inputs) {
+		return nil, fmt.Errorf("node %d has no input slot %d", targetID, targetSlot)
+	}
+
+	if path := t.linkPath(targetID, originID); path != nil {
+		return nil, &CycleError{Nodes: path}
+	}
+
+	if existing := target.Inputs[targetSlot].Link; existing != 0 {
+		t.RemoveLink(existing)
+	}
+
+	l := &Link{
+		ID:         t.LastLinkID + 1,
+		OriginID:   originID,
+		OriginSlot: originSlot,
+		TargetID:   targetID,
+		TargetSlot: targetSlot,
+		Type:       origin.Outputs[originSlot].Type,
+		// links of schema version 1 graphs are saved as objects
+		isObjectFormat: t.SchemaVersion() == SchemaVersion1,
+	}
+	t.LastLinkID = l.ID
+	t.Links = append(t.Links, l)
+	if t.LinksByID == nil {
+		t.LinksByID = make(map[int]*Link)
+	}
+	t.LinksByID[l.ID] = l
+
+	target.Inputs[targetSlot].Link = l.ID
+	out := &origin.Outputs[originSlot]
+	if out.Links == nil {
+		out.Links = &[]int{}
+	}
+	*out.Links = append(*out.Links, l.ID)
+	t.updateExecutionOrder()
+	return l, nil
+}
+
+// RemoveLink removes a link from the graph and disconnects it from its nodes
+func (t *Graph) RemoveLink(id int) {
+	l := t.GetLinkById(id)
+	if l == nil {
+		return
+	}
+
+	if target := t.GetNodeById(l.TargetID); target != nil {
+		if l.TargetSlot < len(target.Inputs) && target.Inputs[l.TargetSlot].Link == id {
+			target.Inputs[l.TargetSlot].Link = 0
+		}
+	}
+	if origin := t.GetNodeById(l.OriginID); origin != nil {
+		removeSlotLink(origin, l.OriginSlot, id)
+	}
+	t.detachReroutes(l)
+
+	for i, gl := range t.Links {
+		if gl == l {
+			t.Links = append(t.Links[:i], t.Links[i+1:]...)
+			break
+		}
+	}
+	delete(t.LinksByID, id)
+	t.updateExecutionOrder()
+}
@@ -6,9 +6,24 @@ import (
 )
 
 type Group struct {
+	ID       int       `json:"id,omitempty"`
 	Title    string    `json:"title"`
 	Bounding []float64 `json:"bounding"`
 	Color    string    `json:"color"`
+	raw      *rawJSON
+}
+
+func (r *Group) UnmarshalJSON(b []byte) error {
+	type Alias Group
+	raw, err := unmarshalPreserving(b, (*Alias)(r))
+	r.raw = raw
+	return err
+}
+
+// MarshalJSON writes the group with the fields it was read with, such as "id", "font_size" and "flags"
+func (r *Group) MarshalJSON() ([]byte, error) {
+	type Alias Group
+	return marshalPreserving((*Alias)(r), r.raw)
 }
 
 func (r *Group) IntersectsOrContains(node *GraphNode) bool {
@@ -23,7 +38,23 @@ func (r *Group) IntersectsOrContains(node *GraphNode) bool {
 	rw := r.Bounding[2]
 	rh := r.Bounding[3]
 
-	// The structure of the pos has changed with a newer version of ComfyUi
+	nx, ny, ok := nodePosition(node)
+	if !ok {
+		slog.Warn("Node position is not a pair of numbers", "type", fmt.Sprintf("%T", node.Position))
+		return false
+	}
+	nw := node.Size.Width
+	nh := node.Size.Height
+
+	return !(rx > nx+nw ||
+		rx+rw < nx ||
+		ry > ny+nh ||
+		ry+rh < ny)
+}
+
+// nodePosition returns the position of a node.  The structure of the pos has changed
+// with a newer version of ComfyUi, it is either an array or a map of indices to values.
+func nodePosition(node *GraphNode) (float64, float64, bool) {
 	var pos []interface{}
 	switch v := node.Position.(type) {
 	case []interface{}:
@@ -33,26 +64,22 @@ func (r *Group) IntersectsOrContains(node *GraphNode) bool {
 		for i := 0; i < len(v); i++ {
 			pos[i] = v[fmt.Sprintf("%d", i)]
 		}
-	default:
-		slog.Warn("Node position is not of expected type []interface{} or map[string]interface{}", "type", fmt.Sprintf("%T", node.Position))
-		return false
+	case []float64:
+		pos = []interface{}{}
+		for _, f := range v {
+			pos = append(pos, f)
+		}
 	}
-
-	nx, ok := pos[0].(float64)
+	if len(pos) < 2 {
+		return 0, 0, false
+	}
+	x, ok := pos[0].(float64)
 	if !ok {
-		slog.Warn("Node position x is not of type float64")
-		return false
+		return 0, 0, false
 	}
-	ny, ok := pos[1].(float64)
+	y, ok := pos[1].(float64)
 	if !ok {
-		slog.Warn("Node position y is not of type float64")
-		return false
+		return 0, 0, false
 	}
-	nw := node.Size.Width
-	nh := node.Size.Height
-
-	return !(rx > nx+nw ||
-		rx+rw < nx ||
-		ry > ny+nh ||
-		ry+rh < ny)
+	return x, y, true
 }
@@ -0,0 +1,479 @@
+package graphapi
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strconv"
+	"strings"
+)
+
+// the node types of group node instances are the name of their definition with one of
+// these prefixes, older frontends used "workflow/"
+var groupNodePrefixes = []string{"workflow>", "workflow/"}
+
+// GroupNodeDefinition is a "group node" of older frontends, saved in the graph's
+// extra.groupNodes.  The nodes of a group are referred to by their index in Nodes.
+// An instance of a group has the group's inputs and outputs that are not linked within
+// it, and the widgets of all of its nodes.  Instances are expanded into the group's nodes
+// when prompts are generated, with ids made of the instance's id and the node's index.
+type GroupNodeDefinition struct {
+	Name     string                 `json:"-"`
+	Nodes    []*GraphNode           `json:"nodes"`
+	Links    []GroupNodeLink        `json:"links"`
+	External []GroupNodeExternal    `json:"external"`
+	Config   map[string]interface{} `json:"config,omitempty"`
+
+	inputs  []groupNodeSlot
+	outputs []groupNodeSlot
+	// widgets are the widgets of the group's nodes, found when node properties are created
+	widgets []groupNodeWidget
+}
+
+// GroupNodeLink is a link between two of a group's nodes
+type GroupNodeLink struct {
+	OriginIndex int
+	OriginSlot  int
+	TargetIndex int
+	TargetSlot  int
+	Type        string
+}
+
+// GroupNodeExternal is an output of a group's node that is linked outside of the group
+type GroupNodeExternal struct {
+	NodeIndex int
+	Slot      int
+	Type      string
+}
+
+// groupNodeSlot maps an input or output of an instance to one of a group's nodes
+type groupNodeSlot struct {
+	node int
+	slot int
+	name string
+}
+
+// groupNodeWidget is a widget of one of a group's nodes
+type groupNodeWidget struct {
+	node         int
+	name         string // the name of the widget on the group's node
+	groupName    string // the name of the widget on the instance
+	index        int    // the index in the instance's widget values, -1 when it is not on the instance
+	defIndex     int    // the index in the group node's own widget values
+	serializable bool
+}
+
+// groupLinkArray reads the numbers of a link saved as an array
+func groupLinkArray(b []byte, count int) ([]interface{}, []int, error) {
+	var tmp []interface{}
+	if err := json.Unmarshal(b, &tmp); err != nil {
+		return nil, nil, err
+	}
+	if len(tmp) < count {
+		return nil, nil, errors.New("wrong number of fields in JSON array")
+	}
+	retv := make([]int, count)
+	for i := range retv {
+		f, ok := tmp[i].(float64)
+		if !ok {
+			return nil, nil, errors.New("expected a number in JSON array")
+		}
+		retv[i] = int(f)
+	}
+	return tmp, retv, nil
+}
+
+// UnmarshalJSON reads [originIndex, originSlot, targetIndex, targetSlot, originID, type]
+func (l *GroupNodeLink) UnmarshalJSON(b []byte) error {
+	tmp, v, err := groupLinkArray(b, 4)
+	if err != nil {
+		return err
+	}
+	l.OriginIndex, l.OriginSlot, l.TargetIndex, l.TargetSlot = v[0], v[1], v[2], v[3]
+	if len(tmp) > 5 {
+		l.Type, _ = tmp[5].(string)
+	}
+	return nil
+}
+
+// UnmarshalJSON reads [nodeIndex, slot, type]
+func (e *GroupNodeExternal) UnmarshalJSON(b []byte) error {
+	tmp, v, err := groupLinkArray(b, 2)
+	if err != nil {
+		return err
+	}
+	e.NodeIndex, e.Slot = v[0], v[1]
+	if len(tmp) > 2 {
+		e.Type, _ = tmp[2].(string)
+	}
+	return nil
+}
+
+// groupNodeName returns the name of the group that a node type is an instance of
+func groupNodeName(nodeType string) (string, bool) {
+	for _, prefix := range groupNodePrefixes {
+		if strings.HasPrefix(nodeType, prefix) {
+			return strings.TrimPrefix(nodeType, prefix), true
+		}
+	}
+	return "", false
+}
+
+// readGroupNodes reads the group node definitions in the graph's extra, and marks their
+// instances.  The definitions stay in extra, they are saved as they were read.
+func (t *Graph) readGroupNodes() error {
+	t.GroupNodes = make(map[string]*GroupNodeDefinition)
+	raw, ok := t.Extra["groupNodes"]
+	if !ok || raw == nil {
+		return nil
+	}
+	if err := remarshal(raw, &t.GroupNodes); err != nil {
+		return err
+	}
+	for name, d := range t.GroupNodes {
+		d.Name = name
+		d.buildSlots()
+	}
+	for _, n := range t.Nodes {
+		if name, ok := groupNodeName(n.Type); ok {
+			n.GroupNodeDef = t.GroupNodes[name]
+		}
+	}
+	return nil
+}
+
+// internalLink returns the link within the group to an input of one of its nodes
+func (d *GroupNodeDefinition) internalLink(node int, slot int) *GroupNodeLink {
+	for i := range d.Links {
+		if d.Links[i].TargetIndex == node && d.Links[i].TargetSlot == slot {
+			return &d.Links[i]
+		}
+	}
+	return nil
+}
+
+// linkedInternally reports whether an output of one of the group's nodes is linked within it
+func (d *GroupNodeDefinition) linkedInternally(node int, slot int) bool {
+	for _, l := range d.Links {
+		if l.OriginIndex == node && l.OriginSlot == slot {
+			return true
+		}
+	}
+	return false
+}
+
+// isExternal reports whether an output of one of the group's nodes is linked outside of it
+func (d *GroupNodeDefinition) isExternal(node int, slot int) bool {
+	for _, e := range d.External {
+		if e.NodeIndex == node && e.Slot == slot {
+			return true
+		}
+	}
+	return false
+}
+
+// slotConfig returns the configuration of an input or output of one of the group's nodes,
+// its name on the instance and whether it is shown
+func (d *GroupNodeDefinition) slotConfig(node int, kind string, key string) (string, bool) {
+	nc, _ := d.Config[strconv.Itoa(node)].(map[string]interface{})
+	kc, _ := nc[kind].(map[string]interface{})
+	sc, _ := kc[key].(map[string]interface{})
+	name, _ := sc["name"].(string)
+	visible, ok := sc["visible"].(bool)
+	return name, !ok || visible
+}
+
+// groupInputName names an input or widget of the instance as the frontend does, prefixing
+// the title or type of the group's node when the name is already used
+func groupInputName(n *GraphNode, name string, seen map[string]int) string {
+	key := name
+	if (n.Type == "PrimitiveNode" && n.Title != "") || seen[name] != 0 {
+		prefix := n.Type + " "
+		if n.Title != "" {
+			prefix = n.Title + " "
+		}
+		key = prefix + name
+		if count, ok := seen[key]; ok {
+			name = prefix + strconv.Itoa(count) + " " + name
+		} else {
+			name = key
+		}
+	}
+	if seen[key] == 0 {
+		seen[key] = 1
+	}
+	seen[key]++
+	return name
+}
+
+// buildSlots maps the inputs and outputs of the group's instances to the group's nodes.
+// Inputs are those that are not linked within the group, outputs are those that are
+// linked outside of it, or not linked at all.
+func (d *GroupNodeDefinition) buildSlots() {
+	d.inputs = make([]groupNodeSlot, 0)
+	d.outputs = make([]groupNodeSlot, 0)
+	seen := make(map[string]int)
+	for i, n := range d.Nodes {
+		for slot, input := range n.Inputs {
+			if input.Widget != nil || d.internalLink(i, slot) != nil {
+				continue
+			}
+			name, visible := d.slotConfig(i, "input", input.Name)
+			if !visible {
+				continue
+			}
+			if name == "" {
+				name = input.Name
+			}
+			d.inputs = append(d.inputs, groupNodeSlot{node: i, slot: slot, name: groupInputName(n, name, seen)})
+		}
+		for slot, output := range n.Outputs {
+			if d.linkedInternally(i, slot) && !d.isExternal(i, slot) {
+				continue
+			}
+			if _, visible := d.slotConfig(i, "output", strconv.Itoa(slot)); !visible {
+				continue
+			}
+			d.outputs = append(d.outputs, groupNodeSlot{node: i, slot: slot, name: output.Name})
+		}
+	}
+}
+
+// buildWidgets finds the widgets of the group's nodes and those of them that are on its
+// instances, in the order of the instances' widget values.  Widgets that are linked within
+// the group, or hidden, are not on the instances.  The node types that are not known are
+// returned.
+func (d *GroupNodeDefinition) buildWidgets(node_objects *NodeObjects) *[]string {
+	var retv *[]string
+	d.widgets = make([]groupNodeWidget, 0)
+	seen := make(map[string]int)
+	index := 0
+	for i, n := range d.Nodes {
+		names := make([]string, 0)
+		serializable := make([]bool, 0)
+		if n.Type == "PrimitiveNode" {
+			// a primitive's value, and the control of its value if it has one
+			for j := range n.WidgetValuesArray() {
+				if j == 0 {
+					names = append(names, "value")
+				} else {
+					names = append(names, "control_after_generate")
+				}
+				serializable = append(serializable, false)
+			}
+		} else if nobject := node_objects.GetNodeObjectByName(n.Type); nobject != nil {
+			for _, p := range nobject.GetSettableProperties() {
+				names = append(names, p.Name())
+				serializable = append(serializable, p.Serializable())
+			}
+		} else if !n.IsVirtual() {
+			slog.Error("Could not get node object for", "node type", n.Type)
+			retv = mergeMissing(retv, &[]string{n.Type})
+			continue
+		}
+
+		for j, name := range names {
+			w := groupNodeWidget{node: i, name: name, index: -1, defIndex: j, serializable: serializable[j]}
+			cname, visible := d.slotConfig(i, "input", name)
+			if d.internalLinkTo(i, name) == nil && visible {
+				if cname == "" {
+					cname = name
+				}
+				w.groupName = groupInputName(n, cname, seen)
+				w.index = index
+				index++
+			}
+			d.widgets = append(d.widgets, w)
+		}
+	}
+	return retv
+}
+
+// internalLinkTo returns the link within the group to a named input of one of its nodes
+func (d *GroupNodeDefinition) internalLinkTo(node int, name string) *GroupNodeLink {
+	for slot, input := range d.Nodes[node].Inputs {
+		if input.Name == name {
+			return d.internalLink(node, slot)
+		}
+	}
+	return nil
+}
+
+// widget returns a widget of one of the group's nodes
+func (d *GroupNodeDefinition) widget(node int, name string) *groupNodeWidget {
+	for i := range d.widgets {
+		if d.widgets[i].node == node && d.widgets[i].name == name {
+			return &d.widgets[i]
+		}
+	}
+	return nil
+}
+
+// widgetValue returns the value of a widget of one of the group's nodes in an instance
+func (d *GroupNodeDefinition) widgetValue(instance *GraphNode, w *groupNodeWidget) interface{} {
+	if w.index >= 0 {
+		if p := instance.Properties[w.groupName]; p != nil {
+			return p.GetValue()
+		}
+		if arr := instance.WidgetValuesArray(); w.index < len(arr) {
+			return arr[w.index]
+		}
+	}
+	if arr := d.Nodes[w.node].WidgetValuesArray(); w.defIndex < len(arr) {
+		return arr[w.defIndex]
+	}
+	return nil
+}
+
+// createGroupNodeProperties gives a group node instance the properties of the widgets of
+// the group's nodes that are on the instance, named as they are on the instance
+func (t *Graph) createGroupNodeProperties(n *GraphNode, node_objects *NodeObjects) *[]string {
+	d := n.GroupNodeDef
+	retv := d.buildWidgets(node_objects)
+	if count := n.WidgetValueCount(); count != 0 && count != len(d.instanceWidgets()) {
+		slog.Warn("group node widget values do not match its definition", "node", n.ID, "group", d.Name)
+	}
+
+	for _, w := range d.instanceWidgets() {
+		nobject := node_objects.GetNodeObjectByName(d.Nodes[w.node].Type)
+		if nobject == nil {
+			continue
+		}
+		for _, p := range nobject.GetSettableProperties() {
+			if p.Name() != w.name {
+				continue
+			}
+			// the property is copied as any other, then moved to the instance's widget
+			scratch := &GraphNode{Properties: make(map[string]Property)}
+			pindex := w.index
+			t.ProcessSettableProperties(scratch, &[]Property{p}, &pindex)
+			if np := scratch.Properties[w.name]; np != nil {
+				np.SetTargetWidget(n, w.index)
+				n.Properties[w.groupName] = np
+			}
+		}
+	}
+	n.DisplayName = d.Name
+	return retv
+}
+
+// instanceWidgets returns the widgets that are on the group's instances
+func (d *GroupNodeDefinition) instanceWidgets() []groupNodeWidget {
+	retv := make([]groupNodeWidget, 0)
+	for _, w := range d.widgets {
+		if w.index >= 0 {
+			retv = append(retv, w)
+		}
+	}
+	return retv
+}
+
+// groupNodeID is the prompt id of one of the group's nodes in an instance
+func groupNodeID(s *subgraphScope, instance *GraphNode, node int) string {
+	return s.expandedID(instance.ID) + ":" + strconv.Itoa(node)
+}
+
+// expandGroupNode expands a group node instance into the group's nodes, leaving out
+// frontend only nodes and those that are muted or bypassed
+func (e *SubgraphExpander) expandGroupNode(s *subgraphScope, instance *GraphNode) {
+	d := instance.GroupNodeDef
+	for i, n := range d.Nodes {
+		// mode 2 is muted, 4 is bypassed
+		if n.IsVirtual() || n.Mode == 2 || n.Mode == 4 {
+			continue
+		}
+		expanded := &ExpandedNode{
+			OriginalID:   n.ID,
+			ExpandedID:   groupNodeID(s, instance, i),
+			Node:         n,
+			InstanceNode: instance,
+			InputMapping: make(map[int]interface{}),
+			Values:       make(map[string]interface{}),
+		}
+		for _, w := range d.widgets {
+			if w.node == i && w.serializable {
+				expanded.Values[w.name] = d.widgetValue(instance, &w)
+			}
+		}
+		for slot := range n.Inputs {
+			if v := e.resolveGroupInput(s, instance, i, slot, n.Inputs[slot].Type, 0); v != nil {
+				expanded.InputMapping[slot] = v
+			}
+		}
+		e.ExpandedNodes[expanded.ExpandedID] = expanded
+	}
+}
+
+// resolveGroupInput returns the value an input of one of a group's nodes is given, from
+// within the group or from the instance's input
+func (e *SubgraphExpander) resolveGroupInput(s *subgraphScope, instance *GraphNode, node int, slot int, inputType string, depth int) interface{} {
+	if depth > maxLinkResolveDepth {
+		return nil
+	}
+	d := instance.GroupNodeDef
+	if l := d.internalLink(node, slot); l != nil {
+		return e.resolveGroupOutput(s, instance, l.OriginIndex, l.OriginSlot, inputType, depth+1)
+	}
+
+	// an input of the instance
+	name := ""
+	input := d.Nodes[node].Inputs[slot]
+	if input.Widget != nil {
+		if w := d.widget(node, input.Name); w != nil && w.index >= 0 {
+			name = w.groupName
+		}
+	} else {
+		for _, gs := range d.inputs {
+			if gs.node == node && gs.slot == slot {
+				name = gs.name
+			}
+		}
+	}
+	if is := instance.GetInputWithName(name); name != "" && is != nil && is.Link != 0 {
+		if l := s.link(is.Link); l != nil {
+			return e.resolveLink(s, l, inputType, depth+1)
+		}
+	}
+	return nil
+}
+
+// resolveGroupOutput returns the value given by an output of one of a group's nodes,
+// following Reroutes and bypassed nodes, and taking the values of PrimitiveNodes
+func (e *SubgraphExpander) resolveGroupOutput(s *subgraphScope, instance *GraphNode, node int, slot int, inputType string, depth int) interface{} {
+	d := instance.GroupNodeDef
+	if node < 0 || node >= len(d.Nodes) {
+		return nil
+	}
+	n := d.Nodes[node]
+	switch {
+	case n.Mode == 2:
+		return nil
+	case n.Mode == 4:
+		indexes := []int{slot}
+		for i := range n.Inputs {
+			indexes = append(indexes, i)
+		}
+		for _, i := range indexes {
+			if i < len(n.Inputs) && n.Inputs[i].Type == inputType {
+				return e.resolveGroupInput(s, instance, node, i, inputType, depth)
+			}
+		}
+		return nil
+	case n.Type == "Reroute":
+		if len(n.Inputs) == 0 {
+			return nil
+		}
+		return e.resolveGroupInput(s, instance, node, 0, inputType, depth)
+	case n.Type == "PrimitiveNode":
+		if w := d.widget(node, "value"); w != nil {
+			return d.widgetValue(instance, w)
+		}
+		if arr := n.WidgetValuesArray(); len(arr) != 0 {
+			return arr[0]
+		}
+		return nil
+	case n.IsVirtual():
+		return nil
+	}
+	return []interface{}{groupNodeID(s, instance, node), slot}
+}
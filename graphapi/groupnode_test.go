@@ -0,0 +1,107 @@
+package graphapi
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestGroupNodePrompt tests expanding legacy group nodes into the group's nodes, with the
+// widget values of each instance.  The expected prompt is written by hand, see
+// testdata/README.md, TestFrontendGroupNodeGoldens compares with the frontend's prompts.
+func TestGroupNodePrompt(t *testing.T) {
+	nodeObjects := readObjectInfo(t, "../examples/testdata/subgraphs/object_info.json")
+	graph, missing, err := NewGraphFromJsonFile("../examples/testdata/groupnode.json", nodeObjects)
+	if err != nil {
+		t.Fatalf("Failed to read workflow: %v", err)
+	}
+	if missing != nil && len(*missing) > 0 {
+		t.Fatalf("Expected no missing node types, got %v", *missing)
+	}
+
+	d := graph.GroupNodes["Sampler"]
+	instance := graph.GetNodeById(4)
+	if d == nil || instance.GroupNodeDef != d || len(d.inputs) != 4 || len(d.outputs) != 1 {
+		t.Fatalf("Expected the Sampler group with 4 inputs and an output")
+	}
+	if d.inputs[3].name != "vae" || d.outputs[0].node != 2 {
+		t.Errorf("Unexpected slots %+v %+v", d.inputs, d.outputs)
+	}
+	if p := instance.GetPropertyWithName("Steps value"); p != nil {
+		t.Errorf("Expected the primitive's value not to be a property, got %v", p.GetValue())
+	}
+	if p := instance.GetPropertyWithName("seed"); p == nil || p.GetValue() != float64(1001) {
+		t.Fatalf("Expected the instance's seed property")
+	}
+
+	prompt, err := graph.GraphToPrompt("")
+	if err != nil {
+		t.Fatalf("Failed to generate prompt: %v", err)
+	}
+	comparePrompt(t, prompt, "../examples/testdata/groupnode_expected.json")
+
+	// setting an instance's property sets the value of the group's node, and is saved
+	if err := graph.Set("4.seed", 7); err != nil {
+		t.Fatalf("Failed to set seed: %v", err)
+	}
+	prompt, _ = graph.GraphToPrompt("")
+	if seed := prompt.Nodes["4:1"].Inputs["seed"]; seed != int64(7) {
+		t.Errorf("Expected seed 7, got %v", seed)
+	}
+	if seed := prompt.Nodes["6:1"].Inputs["seed"]; seed != float64(2002) {
+		t.Errorf("Expected the other instance to keep its seed, got %v", seed)
+	}
+	data, err := graph.GraphToJSON()
+	if err != nil {
+		t.Fatalf("Failed to serialize graph: %v", err)
+	}
+	var saved struct {
+		Nodes []struct {
+			ID           int           `json:"id"`
+			WidgetValues []interface{} `json:"widgets_values"`
+		} `json:"nodes"`
+		Extra map[string]interface{} `json:"extra"`
+	}
+	json.Unmarshal([]byte(data), &saved)
+	if saved.Extra["groupNodes"] == nil {
+		t.Errorf("Expected the group node definitions to be saved")
+	}
+	for _, n := range saved.Nodes {
+		if n.ID == 4 && n.WidgetValues[3] != float64(7) {
+			t.Errorf("Expected the saved seed to be 7, got %v", n.WidgetValues[3])
+		}
+	}
+}
+
+// TestFrontendGroupNodeGoldens tests the prompts of the frontend's exports in testdata/frontend
+// that have group nodes against the prompts the frontend queued for them
+func TestFrontendGroupNodeGoldens(t *testing.T) {
+	files := readFrontendExports(t)
+	withGroupNodes := make([]string, 0)
+	for _, apiPath := range files {
+		var workflow struct {
+			Extra struct {
+				GroupNodes map[string]interface{} `json:"groupNodes"`
+			} `json:"extra"`
+		}
+		data, _ := os.ReadFile(strings.TrimSuffix(apiPath, "_api.json") + ".json")
+		if json.Unmarshal(data, &workflow) == nil && len(workflow.Extra.GroupNodes) != 0 {
+			withGroupNodes = append(withGroupNodes, apiPath)
+		}
+	}
+	if len(withGroupNodes) == 0 {
+		t.Skip("No frontend exports with group nodes, see testdata/README.md")
+	}
+
+	nodeObjects := readObjectInfo(t, filepath.Join(frontendExportsDir, "object_info.json"))
+	for _, apiPath := range withGroupNodes {
+		t.Run(strings.TrimSuffix(filepath.Base(apiPath), "_api.json"), func(t *testing.T) {
+			graph := testFrontendExport(t, apiPath, nodeObjects)
+			if len(graph.GroupNodes) == 0 {
+				t.Errorf("Expected the workflow's group nodes to be read")
+			}
+		})
+	}
+}
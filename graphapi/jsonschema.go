@@ -0,0 +1,277 @@
+package graphapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// JSONSchemaVersion is the JSON Schema dialect of the documents generated by JSONSchema
+const JSONSchemaVersion = "https://json-schema.org/draft/2020-12/schema"
+
+// ErrUnknownParameter is returned by ApplyJSON for fields that are not in the schema
+var ErrUnknownParameter = errors.New("unknown parameter")
+
+// schemaEntry is a key and the property it sets
+type schemaEntry struct {
+	key  string
+	prop Property
+}
+
+// JSONSchema returns a JSON Schema document describing an object whose fields are
+// the keys of the simple API.  The default of each field is the default its node type
+// declares, and its example is the property's current value, which is what ApplyJSON
+// leaves in place when the field is omitted.
+func (s *SimpleAPI) JSONSchema() ([]byte, error) {
+	return jsonSchema(s.schemaEntries())
+}
+
+// ApplyJSON validates a JSON object against the simple API's schema, then sets every
+// property it names.  No property is changed if any field is invalid.
+func (s *SimpleAPI) ApplyJSON(doc []byte) error {
+	return applyJSON(s.schemaEntries(), doc)
+}
+
+// ValidateJSON checks a JSON object against the simple API's schema without setting
+// any property
+func (s *SimpleAPI) ValidateJSON(doc []byte) error {
+	_, _, err := validateJSON(s.schemaEntries(), doc)
+	return err
+}
+
+func (s *SimpleAPI) schemaEntries() []schemaEntry {
+	keys := make([]string, 0, len(s.Properties))
+	for k := range s.Properties {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	retv := make([]schemaEntry, 0, len(keys))
+	for _, k := range keys {
+		retv = append(retv, schemaEntry{key: k, prop: s.Properties[k]})
+	}
+	return retv
+}
+
+// JSONSchema returns a JSON Schema document describing an object whose fields are
+// the keys of the simple API, in input order.  Keys that are in conflict are left out.
+func (s *SimpleAPIV2) JSONSchema() ([]byte, error) {
+	return jsonSchema(s.schemaEntries())
+}
+
+// ApplyJSON validates a JSON object against the simple API's schema, then sets every
+// property it names.  No property is changed if any field is invalid.
+func (s *SimpleAPIV2) ApplyJSON(doc []byte) error {
+	return applyJSON(s.schemaEntries(), doc)
+}
+
+// ValidateJSON checks a JSON object against the simple API's schema without setting
+// any property
+func (s *SimpleAPIV2) ValidateJSON(doc []byte) error {
+	_, _, err := validateJSON(s.schemaEntries(), doc)
+	return err
+}
+
+func (s *SimpleAPIV2) schemaEntries() []schemaEntry {
+	retv := make([]schemaEntry, 0, len(s.Inputs))
+	for _, in := range s.Inputs {
+		if p, ok := s.Properties[in.Key]; ok && p == in.Property {
+			retv = append(retv, schemaEntry{key: in.Key, prop: in.Property})
+		}
+	}
+	return retv
+}
+
+func jsonSchema(entries []schemaEntry) ([]byte, error) {
+	properties := make(map[string]interface{})
+	for i, e := range entries {
+		ps := propertySchema(e.prop)
+		ps["title"] = e.key
+		// maps lose the order of the fields, keep it for form builders
+		ps["x-order"] = i
+		properties[e.key] = ps
+	}
+
+	schema := map[string]interface{}{
+		"$schema":              JSONSchemaVersion,
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+	return json.MarshalIndent(schema, "", "  ")
+}
+
+// propertySchema returns the schema of a single property's value
+func propertySchema(p Property) map[string]interface{} {
+	retv := make(map[string]interface{})
+	if p.Tooltip() != "" {
+		retv["description"] = p.Tooltip()
+	}
+
+	switch p.TypeString() {
+	case "INT":
+		ip, _ := p.ToIntProperty()
+		retv["type"] = "integer"
+		if ip.HasRange() {
+			retv["minimum"] = ip.Min
+			retv["maximum"] = ip.Max
+		}
+		// the step is how far the frontend's widget moves a value, the server accepts
+		// values that are not a multiple of it, so it is not a multipleOf
+		if ip.HasStep() {
+			retv["x-step"] = ip.Step
+		}
+	case "FLOAT":
+		fp, _ := p.ToFloatProperty()
+		retv["type"] = "number"
+		if fp.HasRange() {
+			retv["minimum"] = fp.Min
+			retv["maximum"] = fp.Max
+		}
+		if fp.HasStep() {
+			retv["x-step"] = fp.Step
+		}
+	case "STRING":
+		sp, _ := p.ToStringProperty()
+		retv["type"] = "string"
+		if sp.Multiline {
+			retv["x-multiline"] = true
+		}
+	case "BOOLEAN":
+		retv["type"] = "boolean"
+	case "COMBO":
+		cp, _ := p.ToComboProperty()
+		if cp.IsBool {
+			retv["type"] = "boolean"
+		} else {
+			retv["type"] = "string"
+			retv["enum"] = cp.Values
+		}
+	case "IMAGEUPLOAD":
+		// the name of a file that has been uploaded to the server
+		retv["type"] = "string"
+		retv["format"] = "binary"
+		retv["contentMediaType"] = "image/*"
+		return retv
+	}
+
+	// the value in the workflow, which is left in place when the field is omitted, is an example
+	if p.HasDefault() {
+		retv["default"] = p.GetDefault()
+	}
+	if v := p.GetValue(); v != nil {
+		retv["examples"] = []interface{}{v}
+	}
+	return retv
+}
+
+func applyJSON(entries []schemaEntry, doc []byte) error {
+	props, values, err := validateJSON(entries, doc)
+	if err != nil {
+		return err
+	}
+
+	for _, k := range sortedKeys(values) {
+		p := props[k]
+		if up, ok := p.ToImageUploadProperty(); ok {
+			up.SetFilename(values[k].(string))
+			continue
+		}
+		if err := p.SetValueStrict(values[k]); err != nil {
+			return fmt.Errorf("%s: %w", k, err)
+		}
+	}
+	return nil
+}
+
+// validateJSON decodes and validates a JSON object, returning the properties by key
+// and the decoded values
+func validateJSON(entries []schemaEntry, doc []byte) (map[string]Property, map[string]interface{}, error) {
+	var values map[string]interface{}
+	d := json.NewDecoder(bytes.NewReader(doc))
+	d.UseNumber()
+	if err := d.Decode(&values); err != nil {
+		return nil, nil, fmt.Errorf("request body must be a JSON object: %w", err)
+	}
+
+	props := make(map[string]Property, len(entries))
+	for _, e := range entries {
+		props[e.key] = e.prop
+	}
+
+	errs := make([]error, 0)
+	for _, k := range sortedKeys(values) {
+		p, ok := props[k]
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: %w", k, ErrUnknownParameter))
+			continue
+		}
+		if err := checkJSONType(p, values[k]); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", k, err))
+			continue
+		}
+		if p.TypeString() == "IMAGEUPLOAD" {
+			continue
+		}
+		if _, err := p.strictValue(values[k]); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", k, err))
+		}
+	}
+	if len(errs) != 0 {
+		return nil, nil, errors.Join(errs...)
+	}
+	return props, values, nil
+}
+
+func sortedKeys(values map[string]interface{}) []string {
+	retv := make([]string, 0, len(values))
+	for k := range values {
+		retv = append(retv, k)
+	}
+	sort.Strings(retv)
+	return retv
+}
+
+// checkJSONType checks a decoded JSON value has the type the property's schema declares
+func checkJSONType(p Property, v interface{}) error {
+	ok := false
+	switch p.TypeString() {
+	case "INT":
+		n, isNumber := v.(json.Number)
+		ok = isNumber && isInteger(n)
+	case "FLOAT":
+		_, ok = v.(json.Number)
+	case "BOOLEAN":
+		_, ok = v.(bool)
+	case "COMBO":
+		if cp, _ := p.ToComboProperty(); cp.IsBool {
+			_, ok = v.(bool)
+		} else {
+			_, ok = v.(string)
+		}
+	case "STRING", "IMAGEUPLOAD":
+		_, ok = v.(string)
+	}
+	if !ok {
+		return newPropertyError(p, v, ErrBadType)
+	}
+	return nil
+}
+
+// isInteger reports whether a JSON number is an integer, as JSON Schema's "integer"
+// type does, so 1.0 and 1e3 are integers and 1.5 is not.  Seeds may be larger than
+// an int64.
+func isInteger(n json.Number) bool {
+	if _, err := strconv.ParseInt(n.String(), 10, 64); err == nil {
+		return true
+	}
+	if _, err := strconv.ParseUint(n.String(), 10, 64); err == nil {
+		return true
+	}
+	f, err := n.Float64()
+	return err == nil && f == math.Trunc(f)
+}
@@ -0,0 +1,97 @@
+package graphapi
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func newJSONSchemaTestAPI(t *testing.T) (*Graph, *SimpleAPIV2) {
+	graph := newSelectorTestGraph(t)
+	sg := graph.GetNodeById(57).SubgraphDef
+	sg.Groups = append(sg.Groups, &Group{Title: "API", Bounding: []float64{-10000, -10000, 20000, 20000}})
+	api := graph.GetSimpleAPIV2(nil)
+	if api == nil {
+		t.Fatal("Expected a simple API")
+	}
+	return graph, api
+}
+
+// TestSimpleAPIJSONSchema tests the schema generated for each property type
+func TestSimpleAPIJSONSchema(t *testing.T) {
+	_, api := newJSONSchemaTestAPI(t)
+	data, err := api.JSONSchema()
+	if err != nil {
+		t.Fatalf("Failed to generate schema: %v", err)
+	}
+
+	var schema struct {
+		Type       string                            `json:"type"`
+		Properties map[string]map[string]interface{} `json:"properties"`
+	}
+	if err := json.Unmarshal(data, &schema); err != nil {
+		t.Fatalf("Failed to unmarshal schema: %v", err)
+	}
+	if schema.Type != "object" {
+		t.Errorf("Expected object schema, got %s", schema.Type)
+	}
+
+	seed := schema.Properties["KSampler.seed"]
+	if seed["type"] != "integer" || seed["minimum"] != float64(0) || seed["maximum"] != float64(1000000) {
+		t.Errorf("Unexpected seed schema: %v", seed)
+	}
+	cfg := schema.Properties["KSampler.cfg"]
+	// the default is the declared one, and the workflow's value is an example
+	if cfg["type"] != "number" || cfg["x-step"] != 0.1 || cfg["default"] != float64(8) || !reflect.DeepEqual(cfg["examples"], []interface{}{float64(6)}) {
+		t.Errorf("Unexpected cfg schema: %v", cfg)
+	}
+	control := schema.Properties["KSampler.control_after_generate"]
+	if control["type"] != "string" || len(control["enum"].([]interface{})) != 4 {
+		t.Errorf("Unexpected control_after_generate schema: %v", control)
+	}
+	prompt := schema.Properties["Prompt.value"]
+	if prompt["type"] != "string" || prompt["x-multiline"] != true {
+		t.Errorf("Unexpected prompt schema: %v", prompt)
+	}
+}
+
+// TestSimpleAPIApplyJSON tests that valid documents are applied and invalid ones are not
+func TestSimpleAPIApplyJSON(t *testing.T) {
+	graph, api := newJSONSchemaTestAPI(t)
+
+	err := api.ApplyJSON([]byte(`{"KSampler.seed": 42, "KSampler.cfg": 4.5, "Prompt.value": "a lighthouse"}`))
+	if err != nil {
+		t.Fatalf("Failed to apply JSON: %v", err)
+	}
+	if v := api.Properties["KSampler.seed"].GetValue(); v != int64(42) {
+		t.Errorf("Expected seed 42, got %v", v)
+	}
+	if v := api.Properties["KSampler.cfg"].GetValue(); v != 4.5 {
+		t.Errorf("Expected cfg 4.5, got %v", v)
+	}
+	if v := graph.GetNodeById(58).WidgetValuesArray()[0]; v != "a lighthouse" {
+		t.Errorf("Expected prompt to be set, got %v", v)
+	}
+
+	err = api.ApplyJSON([]byte(`{"KSampler.seed": 7, "KSampler.cfg": 500, "KSampler.steps": 10, "Prompt.value": 3}`))
+	for _, expected := range []error{ErrOutOfRange, ErrUnknownParameter, ErrBadType} {
+		if !errors.Is(err, expected) {
+			t.Errorf("Expected %v, got %v", expected, err)
+		}
+	}
+	if v := api.Properties["KSampler.seed"].GetValue(); v != int64(42) {
+		t.Errorf("Expected invalid document to leave seed unchanged, got %v", v)
+	}
+
+	// integers are not rounded
+	if err := api.ApplyJSON([]byte(`{"KSampler.seed": 1.5}`)); !errors.Is(err, ErrBadType) {
+		t.Errorf("Expected %v for a fractional seed, got %v", ErrBadType, err)
+	}
+	if err := api.ApplyJSON([]byte(`{"KSampler.seed": 1e3}`)); err != nil {
+		t.Errorf("Expected an integer in exponent form to be accepted, got %v", err)
+	}
+	if v := api.Properties["KSampler.seed"].GetValue(); v != int64(1000) {
+		t.Errorf("Expected seed 1000, got %v", v)
+	}
+}
@@ -12,9 +12,23 @@ type Link struct {
 	TargetID   int
 	TargetSlot int
 	Type       string
+	// ParentID is the native reroute closest to the link's target, 0 when it has none
+	ParentID int
 	// Internal flag to track serialization format
 	// true = object format (subgraph links), false = tuple format (top-level links)
 	isObjectFormat bool
+	raw            *rawJSON
+}
+
+// linkObject is the object format of a link
+type linkObject struct {
+	ID         int    `json:"id"`
+	OriginID   int    `json:"origin_id"`
+	OriginSlot int    `json:"origin_slot"`
+	TargetID   int    `json:"target_id"`
+	TargetSlot int    `json:"target_slot"`
+	Type       string `json:"type"`
+	ParentID   int    `json:"parentId,omitempty"`
 }
 
 func (l *Link) UnmarshalJSON(b []byte) error {
@@ -36,16 +50,9 @@ func (l *Link) UnmarshalJSON(b []byte) error {
 	}
 
 	// Try to unmarshal as object (subgraph format)
-	var obj struct {
-		ID         int    `json:"id"`
-		OriginID   int    `json:"origin_id"`
-		OriginSlot int    `json:"origin_slot"`
-		TargetID   int    `json:"target_id"`
-		TargetSlot int    `json:"target_slot"`
-		Type       string `json:"type"`
-	}
-
-	if err := json.Unmarshal(b, &obj); err != nil {
+	var obj linkObject
+	raw, err := unmarshalPreserving(b, &obj)
+	if err != nil {
 		return err
 	}
 
@@ -55,7 +62,9 @@ func (l *Link) UnmarshalJSON(b []byte) error {
 	l.TargetID = obj.TargetID
 	l.TargetSlot = obj.TargetSlot
 	l.Type = obj.Type
+	l.ParentID = obj.ParentID
 	l.isObjectFormat = true
+	l.raw = raw
 
 	return nil
 }
@@ -63,25 +72,19 @@ func (l *Link) UnmarshalJSON(b []byte) error {
 func (l *Link) MarshalJSON() ([]byte, error) {
 	// Use object format if it was deserialized from object format
 	if l.isObjectFormat {
-		obj := struct {
-			ID         int    `json:"id"`
-			OriginID   int    `json:"origin_id"`
-			OriginSlot int    `json:"origin_slot"`
-			TargetID   int    `json:"target_id"`
-			TargetSlot int    `json:"target_slot"`
-			Type       string `json:"type"`
-		}{
+		obj := linkObject{
 			ID:         l.ID,
 			OriginID:   l.OriginID,
 			OriginSlot: l.OriginSlot,
 			TargetID:   l.TargetID,
 			TargetSlot: l.TargetSlot,
 			Type:       l.Type,
+			ParentID:   l.ParentID,
 		}
-		return json.Marshal(obj)
+		return marshalPreserving(&obj, l.raw)
 	}
 
-	// Default to tuple format
+	// Default to tuple format, the graph saves the parent reroute in extra.linkExtensions
 	tmp := []interface{}{
 		l.ID,
 		l.OriginID,
@@ -1,6 +1,8 @@
 package graphapi
 
 import (
+	"errors"
+	"fmt"
 	"log/slog"
 )
 
@@ -33,6 +35,22 @@ type GraphNode struct {
 	// Subgraph-related fields
 	IsSubgraph   bool                 `json:"-"`
 	SubgraphDef  *SubgraphDefinition  `json:"-"`
+	// GroupNodeDef is the definition of a legacy group node instance
+	GroupNodeDef *GroupNodeDefinition `json:"-"`
+	raw          *rawJSON
+}
+
+func (n *GraphNode) UnmarshalJSON(b []byte) error {
+	type Alias GraphNode
+	raw, err := unmarshalPreserving(b, (*Alias)(n))
+	n.raw = raw
+	return err
+}
+
+// MarshalJSON writes the node with the fields it was read with, in their order
+func (n *GraphNode) MarshalJSON() ([]byte, error) {
+	type Alias GraphNode
+	return marshalPreserving((*Alias)(n), n.raw)
 }
 
 func (n *GraphNode) WidgetValuesArray() []interface{} {
@@ -90,14 +108,31 @@ func (n *GraphNode) IsVirtual() bool {
 	return false
 }
 
-// GetLinks returns a slice of Link Ids
+// GetLinks returns a slice of the Link Ids of all of the node's outputs.  Links to
+// Reroute nodes are followed to the nodes the Reroutes lead to.
 func (n *GraphNode) GetLinks() []int {
 	retv := make([]int, 0)
-	for _, l := range *n.Outputs[0].Links {
-		linkInfo := n.Graph.LinksByID[l]
+	for i := range n.Outputs {
+		retv = append(retv, n.GetOutputLinks(i)...)
+	}
+	return retv
+}
+
+// GetOutputLinks returns a slice of the Link Ids of an output, following links to
+// Reroute nodes.  Native reroutes need no following, their links lead to the target node.
+func (n *GraphNode) GetOutputLinks(slot int) []int {
+	retv := make([]int, 0)
+	if slot >= len(n.Outputs) || n.Outputs[slot].Links == nil {
+		return retv
+	}
+	for _, l := range *n.Outputs[slot].Links {
+		linkInfo := n.Graph.GetLinkById(l)
+		if linkInfo == nil {
+			continue
+		}
 		tn := n.Graph.GetNodeById(linkInfo.TargetID)
-		if tn.Type == "Rerout" {
-			retv = append(retv, tn.GetLinks()...)
+		if tn != nil && tn.Type == "Reroute" && tn != n {
+			retv = append(retv, tn.GetOutputLinks(0)...)
 		} else {
 			retv = append(retv, l)
 		}
@@ -111,14 +146,32 @@ func (n *GraphNode) GetPropertyWithName(name string) Property {
 		return retv
 	}
 
-	// check n.Properties for an aliased property
+	// check n.Properties for an aliased property, in widget order so that an alias
+	// shared by several properties always finds the same one
 	for _, p := range n.Properties {
-		if p.GetAlias() == name {
-			return p
+		if p.GetAlias() != name {
+			continue
+		}
+		if retv == nil || p.Index() < retv.Index() || (p.Index() == retv.Index() && p.Name() < retv.Name()) {
+			retv = p
 		}
 	}
+	return retv
+}
 
-	return nil
+// ResetToDefaults resets each of the node's properties that declares a default value
+func (n *GraphNode) ResetToDefaults() error {
+	errs := make([]error, 0)
+	for name, p := range n.Properties {
+		// skip properties that belong to other nodes (primitives) and frontend-only widgets
+		if !p.Settable() || !p.Serializable() || !p.HasDefault() || p.GetTargetNode() != n {
+			continue
+		}
+		if err := p.ResetToDefault(); err != nil {
+			errs = append(errs, fmt.Errorf("node %d property %s: %w", n.ID, name, err))
+		}
+	}
+	return errors.Join(errs...)
 }
 
 // GetPropertesByIndex returns a slice of Properties ordered by thier order in the node desciption
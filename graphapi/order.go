@@ -0,0 +1,247 @@
+package graphapi
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// CycleError is returned when the links between nodes form a cycle, which cannot be executed
+type CycleError struct {
+	Subgraph string // the name of the subgraph definition the cycle is in, "" for the graph
+	Nodes    []int  // the ids of the nodes on the cycle
+}
+
+func (e *CycleError) Error() string {
+	ids := make([]string, len(e.Nodes))
+	for i, id := range e.Nodes {
+		ids[i] = strconv.Itoa(id)
+	}
+	if e.Subgraph != "" {
+		return fmt.Sprintf("links form a cycle through nodes %s of subgraph %q", strings.Join(ids, ", "), e.Subgraph)
+	}
+	return fmt.Sprintf("links form a cycle through nodes %s", strings.Join(ids, ", "))
+}
+
+// RecomputeOrder sets the Order of the nodes from their links, so that each node comes
+// after the nodes linked to its inputs, and rebuilds NodesInExecutionOrder.  Reroutes
+// and PrimitiveNodes are ordered before the nodes they feed, and the nodes of each
+// subgraph definition are ordered within it.  Where the links allow, nodes keep the
+// order they had, and their Order is only changed when it does not follow the new
+// order.  If the links form a cycle, a *CycleError is returned and no order
+// is changed.
+func (t *Graph) RecomputeOrder() error {
+	order, cycle := topologicalOrder(t.Nodes, t.Links)
+	if cycle != nil {
+		return cycle
+	}
+	orders := make(map[*SubgraphDefinition][]*GraphNode)
+	if t.Definitions != nil {
+		for _, sg := range t.Definitions.Subgraphs {
+			sgOrder, cycle := topologicalOrder(sg.Nodes, sg.Links)
+			if cycle != nil {
+				cycle.Subgraph = sg.Name
+				return cycle
+			}
+			orders[sg] = sgOrder
+		}
+	}
+
+	renumber(order)
+	for _, sgOrder := range orders {
+		renumber(sgOrder)
+	}
+	t.NodesInExecutionOrder = order
+	return nil
+}
+
+// renumber sets the Order of nodes to their index, unless their Order already follows it
+func renumber(order []*GraphNode) {
+	for i := 1; i < len(order); i++ {
+		if order[i].Order <= order[i-1].Order {
+			for j, n := range order {
+				n.Order = j
+			}
+			return
+		}
+	}
+}
+
+// updateExecutionOrder recomputes the execution order after an edit.  If the links form
+// a cycle, the nodes are ordered by the Order they have.
+func (t *Graph) updateExecutionOrder() {
+	if t.order_deferred > 0 {
+		return
+	}
+	if err := t.RecomputeOrder(); err != nil {
+		slog.Warn("Could not recompute the execution order", "error", err)
+		t.NodesInExecutionOrder = make([]*GraphNode, len(t.Nodes))
+		copy(t.NodesInExecutionOrder, t.Nodes)
+		sort.Stable(ByGraphOrdinal(t.NodesInExecutionOrder))
+	}
+}
+
+// deferOrder stops edits from recomputing the execution order until the function it
+// returns is called, which recomputes it once.  Edits that add or remove many nodes and
+// links use it with defer t.deferOrder()().
+func (t *Graph) deferOrder() func() {
+	t.order_deferred++
+	return func() {
+		t.order_deferred--
+		t.updateExecutionOrder()
+	}
+}
+
+// topologicalOrder orders nodes so that the origin of each link comes before its target.
+// Of the nodes that are ready, the one with the lowest Order comes first.  Links to
+// nodes that are not in nodes, such as the input and output nodes of subgraphs, are
+// ignored.
+func topologicalOrder(nodes []*GraphNode, links []*Link) ([]*GraphNode, *CycleError) {
+	index := make(map[int]int, len(nodes))
+	for i, n := range nodes {
+		index[n.ID] = i
+	}
+	pending := make([]int, len(nodes))
+	targets := make([][]int, len(nodes))
+	for _, l := range links {
+		origin, ok := index[l.OriginID]
+		if !ok {
+			continue
+		}
+		target, ok := index[l.TargetID]
+		if !ok {
+			continue
+		}
+		pending[target]++
+		targets[origin] = append(targets[origin], target)
+	}
+
+	before := func(a, b int) bool {
+		if nodes[a].Order != nodes[b].Order {
+			return nodes[a].Order < nodes[b].Order
+		}
+		return a < b
+	}
+	ready := make([]int, 0)
+	push := func(i int) {
+		at := sort.Search(len(ready), func(j int) bool { return before(i, ready[j]) })
+		ready = append(ready, 0)
+		copy(ready[at+1:], ready[at:])
+		ready[at] = i
+	}
+	for i := range nodes {
+		if pending[i] == 0 {
+			push(i)
+		}
+	}
+
+	retv := make([]*GraphNode, 0, len(nodes))
+	for len(ready) > 0 {
+		i := ready[0]
+		ready = ready[1:]
+		retv = append(retv, nodes[i])
+		for _, target := range targets[i] {
+			pending[target]--
+			if pending[target] == 0 {
+				push(target)
+			}
+		}
+	}
+	if len(retv) == len(nodes) {
+		return retv, nil
+	}
+	return nil, &CycleError{Nodes: cycleNodes(nodes, targets, pending)}
+}
+
+// cycleNodes returns the ids of the nodes that are on cycles, the strongly connected
+// components of more than one node, or of a node linked to itself.  Only the nodes that
+// could not be ordered are searched.
+func cycleNodes(nodes []*GraphNode, targets [][]int, pending []int) []int {
+	next := 0
+	num := make(map[int]int)
+	low := make(map[int]int)
+	onStack := make(map[int]bool)
+	stack := make([]int, 0)
+	retv := make([]int, 0)
+
+	var visit func(i int)
+	visit = func(i int) {
+		num[i] = next
+		low[i] = next
+		next++
+		stack = append(stack, i)
+		onStack[i] = true
+		for _, j := range targets[i] {
+			if pending[j] == 0 {
+				continue
+			}
+			if _, seen := num[j]; !seen {
+				visit(j)
+				low[i] = min(low[i], low[j])
+			} else if onStack[j] {
+				low[i] = min(low[i], num[j])
+			}
+		}
+		if low[i] != num[i] {
+			return
+		}
+		component := make([]int, 0)
+		for {
+			j := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[j] = false
+			component = append(component, j)
+			if j == i {
+				break
+			}
+		}
+		if len(component) > 1 || slices.Contains(targets[i], i) {
+			for _, j := range component {
+				retv = append(retv, nodes[j].ID)
+			}
+		}
+	}
+	for i := range nodes {
+		if _, seen := num[i]; !seen && pending[i] > 0 {
+			visit(i)
+		}
+	}
+	sort.Ints(retv)
+	return retv
+}
+
+// linkPath returns the nodes on a path of links from one node to another, or nil.  The
+// links out of each node are followed once.
+func (t *Graph) linkPath(fromID int, toID int) []int {
+	seen := make(map[int]bool)
+	var path []int
+	var walk func(id int) bool
+	walk = func(id int) bool {
+		path = append(path, id)
+		if id == toID {
+			return true
+		}
+		if n := t.GetNodeById(id); n != nil && !seen[id] {
+			seen[id] = true
+			for _, out := range n.Outputs {
+				if out.Links == nil {
+					continue
+				}
+				for _, lid := range *out.Links {
+					if l := t.GetLinkById(lid); l != nil && walk(l.TargetID) {
+						return true
+					}
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		return false
+	}
+	if walk(fromID) {
+		return path
+	}
+	return nil
+}
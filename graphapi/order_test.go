@@ -0,0 +1,183 @@
+package graphapi
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// checkOrder tests that each link's origin comes before its target
+func checkOrder(t *testing.T, nodes []*GraphNode, links []*Link) {
+	order := make(map[int]int)
+	for _, n := range nodes {
+		order[n.ID] = n.Order
+	}
+	for _, l := range links {
+		origin, ok1 := order[l.OriginID]
+		target, ok2 := order[l.TargetID]
+		if ok1 && ok2 && origin >= target {
+			t.Errorf("Link %d from node %d (order %d) to node %d (order %d) goes backwards", l.ID, l.OriginID, origin, l.TargetID, target)
+		}
+	}
+}
+
+// TestRecomputeOrder tests ordering the nodes of a graph with stale orders
+func TestRecomputeOrder(t *testing.T) {
+	graph := readGraph(t, "../examples/testdata/reroutes.json")
+	saved := make(map[int]int)
+	for _, n := range graph.Nodes {
+		saved[n.ID] = n.Order
+	}
+	if err := graph.RecomputeOrder(); err != nil {
+		t.Fatalf("Failed to recompute order: %v", err)
+	}
+	for _, n := range graph.Nodes {
+		if n.Order != saved[n.ID] {
+			t.Errorf("Expected node %d to keep order %d, got %d", n.ID, saved[n.ID], n.Order)
+		}
+	}
+
+	for _, n := range graph.Nodes {
+		n.Order = 0
+	}
+	// the SaveImage node first, as if it had been added last
+	graph.GetNodeById(7).Order = -1
+	if err := graph.RecomputeOrder(); err != nil {
+		t.Fatalf("Failed to recompute order: %v", err)
+	}
+	checkOrder(t, graph.Nodes, graph.Links)
+	ids := make([]int, len(graph.NodesInExecutionOrder))
+	for i, n := range graph.NodesInExecutionOrder {
+		ids[i] = n.ID
+		if n.Order != i {
+			t.Errorf("Expected node %d to have order %d, got %d", n.ID, i, n.Order)
+		}
+	}
+	if !reflect.DeepEqual(ids, []int{1, 2, 3, 4, 5, 8, 6, 7}) {
+		t.Errorf("Unexpected execution order %v", ids)
+	}
+}
+
+// TestRecomputeOrderSubgraphs tests ordering the nodes within subgraph definitions
+func TestRecomputeOrderSubgraphs(t *testing.T) {
+	graph := readGraph(t, "../examples/testdata/subgraphs/nested.json")
+	for _, sg := range graph.Definitions.Subgraphs {
+		for i, n := range sg.Nodes {
+			n.Order = len(sg.Nodes) - i
+		}
+	}
+	if err := graph.RecomputeOrder(); err != nil {
+		t.Fatalf("Failed to recompute order: %v", err)
+	}
+	for _, sg := range graph.Definitions.Subgraphs {
+		checkOrder(t, sg.Nodes, sg.Links)
+	}
+
+	sg := graph.Definitions.Subgraphs[1]
+	var l *Link
+	for _, sl := range sg.Links {
+		if sl.OriginID > 0 && sl.TargetID > 0 {
+			l = sl
+			break
+		}
+	}
+	sg.Links = append(sg.Links, &Link{ID: 999, OriginID: l.TargetID, TargetID: l.OriginID})
+	var cycle *CycleError
+	if err := graph.RecomputeOrder(); !errors.As(err, &cycle) || cycle.Subgraph != sg.Name {
+		t.Errorf("Expected a cycle in %s, got %v", sg.Name, err)
+	}
+}
+
+// TestRecomputeOrderCycle tests that the nodes on a cycle are reported
+func TestRecomputeOrderCycle(t *testing.T) {
+	graph := readGraph(t, "../examples/testdata/reroutes.json")
+
+	// a link that would form a cycle is not added
+	_, err := graph.AddLink(6, 0, 5, 3)
+	var cycle *CycleError
+	if !errors.As(err, &cycle) || !reflect.DeepEqual(cycle.Nodes, []int{5, 6}) {
+		t.Fatalf("Expected a cycle through nodes 5 and 6, got %v", err)
+	}
+	if graph.GetNodeById(5).Inputs[3].Link != 7 {
+		t.Errorf("Expected the latent link to remain")
+	}
+
+	// the nodes after the cycle are not reported
+	graph.Links = append(graph.Links, &Link{ID: 12, OriginID: 6, TargetID: 5, TargetSlot: 3, Type: "LATENT"})
+	order := graph.GetNodeById(7).Order
+	err = graph.RecomputeOrder()
+	if !errors.As(err, &cycle) || !reflect.DeepEqual(cycle.Nodes, []int{5, 6}) {
+		t.Errorf("Expected a cycle through nodes 5 and 6, got %v", err)
+	}
+	if err.Error() != "links form a cycle through nodes 5, 6" || graph.GetNodeById(7).Order != order {
+		t.Errorf("Expected the order to be unchanged, got %v", err)
+	}
+}
+
+// TestEditsRecomputeOrder tests that adding nodes and links orders the nodes
+func TestEditsRecomputeOrder(t *testing.T) {
+	graph := readGraph(t, "../examples/testdata/reroutes.json")
+	invert := &GraphNode{
+		Type:    "ImageInvert",
+		Inputs:  []Slot{{Name: "image", Type: "IMAGE"}},
+		Outputs: []Slot{{Name: "IMAGE", Type: "IMAGE"}},
+	}
+	if err := graph.AddNode(invert); err != nil {
+		t.Fatalf("Failed to add node: %v", err)
+	}
+	if _, err := graph.AddLink(6, 0, invert.ID, 0); err != nil {
+		t.Fatalf("Failed to add link: %v", err)
+	}
+	if _, err := graph.AddLink(invert.ID, 0, 7, 0); err != nil {
+		t.Fatalf("Failed to add link: %v", err)
+	}
+	checkOrder(t, graph.Nodes, graph.Links)
+	last := graph.NodesInExecutionOrder[len(graph.NodesInExecutionOrder)-2:]
+	if last[0] != invert || last[1].ID != 7 {
+		t.Errorf("Expected the new node before SaveImage, got %d and %d", last[0].ID, last[1].ID)
+	}
+
+	if err := graph.RemoveNode(invert.ID); err != nil {
+		t.Fatalf("Failed to remove node: %v", err)
+	}
+	if len(graph.NodesInExecutionOrder) != len(graph.Nodes) {
+		t.Errorf("Expected the removed node to leave the execution order")
+	}
+}
+
+// TestDeferOrder tests that a graph built link by link is ordered once, and that cycles are
+// still found while the order is deferred
+func TestDeferOrder(t *testing.T) {
+	graph := &Graph{}
+	const count = 500
+	done := graph.deferOrder()
+	for i := 0; i < count; i++ {
+		n := &GraphNode{
+			Type:    "ImageInvert",
+			Inputs:  []Slot{{Name: "image", Type: "IMAGE"}},
+			Outputs: []Slot{{Name: "IMAGE", Type: "IMAGE"}},
+		}
+		if err := graph.AddNode(n); err != nil {
+			t.Fatalf("Failed to add node: %v", err)
+		}
+	}
+	// each node feeds the one before it
+	for id := count; id > 1; id-- {
+		if _, err := graph.AddLink(id, 0, id-1, 0); err != nil {
+			t.Fatalf("Failed to add link: %v", err)
+		}
+	}
+	var cycle *CycleError
+	if _, err := graph.AddLink(1, 0, count, 0); !errors.As(err, &cycle) || len(cycle.Nodes) != count {
+		t.Errorf("Expected a cycle through every node, got %v", err)
+	}
+	if len(graph.NodesInExecutionOrder) != 0 {
+		t.Errorf("Expected the order not to be computed while deferred")
+	}
+
+	done()
+	checkOrder(t, graph.Nodes, graph.Links)
+	if len(graph.NodesInExecutionOrder) != count || graph.NodesInExecutionOrder[0].ID != count {
+		t.Errorf("Expected node %d to run first", count)
+	}
+}
@@ -0,0 +1,211 @@
+package graphapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// rawJSON keeps the JSON object a struct was read from, so that it can be written again
+// with the keys the struct does not know, in their original order, and with the values
+// that did not change written as they were read.
+type rawJSON struct {
+	keys   []string
+	values map[string][]byte
+}
+
+// readRawJSON reads the keys and compacted values of a JSON object, or returns nil when
+// b is not an object
+func readRawJSON(b []byte) *rawJSON {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	if t, err := dec.Token(); err != nil || t != json.Delim('{') {
+		return nil
+	}
+	retv := &rawJSON{values: make(map[string][]byte)}
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return nil
+		}
+		key, ok := t.(string)
+		if !ok {
+			return nil
+		}
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return nil
+		}
+		var buf bytes.Buffer
+		if err := json.Compact(&buf, value); err != nil {
+			return nil
+		}
+		if _, ok := retv.values[key]; !ok {
+			retv.keys = append(retv.keys, key)
+		}
+		retv.values[key] = buf.Bytes()
+	}
+	return retv
+}
+
+// merge writes the JSON object b, as marshaled from a struct with the given fields, in
+// the order of the object that was read.  Values that are equal to those read are
+// written as they were read, and keys that the struct does not have are written again.
+// Known keys whose values became empty are written as empty values, and keys that were not
+// read are added after the others, unless their values are empty.
+func (r *rawJSON) merge(b []byte, known map[string]bool) ([]byte, error) {
+	if r == nil {
+		return b, nil
+	}
+	current := readRawJSON(b)
+	if current == nil {
+		return b, nil
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	write := func(key string, value []byte) {
+		if buf.Len() > 1 {
+			buf.WriteByte(',')
+		}
+		k, _ := marshalJSON(key)
+		buf.Write(k)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	for _, key := range r.keys {
+		old := r.values[key]
+		if value, ok := current.values[key]; ok {
+			if sameJSON(old, value) {
+				write(key, old)
+			} else {
+				write(key, value)
+			}
+		} else if !known[key] || emptyJSON(old) {
+			// keys the struct does not have, and empty values that it leaves out
+			write(key, old)
+		} else {
+			// values that became empty are left out by the struct, and are written as
+			// the empty value of their kind, as the frontend's schema allows them
+			write(key, emptyOf(old))
+		}
+	}
+	for _, key := range current.keys {
+		if _, ok := r.values[key]; ok || emptyJSON(current.values[key]) {
+			continue
+		}
+		write(key, current.values[key])
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// without returns a copy of the object without the given keys, for fields that are
+// no longer written
+func (r *rawJSON) without(keys ...string) *rawJSON {
+	if r == nil {
+		return nil
+	}
+	retv := &rawJSON{values: make(map[string][]byte, len(r.values))}
+	for _, key := range r.keys {
+		if !slices.Contains(keys, key) {
+			retv.keys = append(retv.keys, key)
+			retv.values[key] = r.values[key]
+		}
+	}
+	return retv
+}
+
+// sameJSON reports whether two JSON values are equal, whatever their key order and
+// number formatting
+func sameJSON(a []byte, b []byte) bool {
+	if bytes.Equal(a, b) {
+		return true
+	}
+	var av, bv interface{}
+	if json.Unmarshal(a, &av) != nil || json.Unmarshal(b, &bv) != nil {
+		return false
+	}
+	return reflect.DeepEqual(av, bv)
+}
+
+func emptyJSON(v []byte) bool {
+	switch string(v) {
+	case "null", `""`, "0", "false", "[]", "{}":
+		return true
+	}
+	return false
+}
+
+// emptyOf returns the empty value of the same kind as v.  Numbers, such as the link
+// of an input that is no longer linked, are null, as the frontend writes them.
+func emptyOf(v []byte) []byte {
+	switch v[0] {
+	case '[':
+		return []byte("[]")
+	case '{':
+		return []byte("{}")
+	case '"':
+		return []byte(`""`)
+	case 't', 'f':
+		return []byte("false")
+	}
+	return []byte("null")
+}
+
+// marshalJSON marshals v without escaping <, > and &, as the frontend saves workflows
+func marshalJSON(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// unmarshalPreserving unmarshals b into the struct that v points to, and returns the
+// object it was read from
+func unmarshalPreserving(b []byte, v interface{}) (*rawJSON, error) {
+	if err := json.Unmarshal(b, v); err != nil {
+		return nil, err
+	}
+	return readRawJSON(b), nil
+}
+
+// marshalPreserving marshals the struct that v points to, keeping what was read into raw
+func marshalPreserving(v interface{}, raw *rawJSON) ([]byte, error) {
+	b, err := marshalJSON(v)
+	if err != nil {
+		return nil, err
+	}
+	return raw.merge(b, jsonFields(reflect.TypeOf(v).Elem()))
+}
+
+var jsonFieldCache sync.Map
+
+// jsonFields returns the JSON keys of a struct's fields
+func jsonFields(t reflect.Type) map[string]bool {
+	if v, ok := jsonFieldCache.Load(t); ok {
+		return v.(map[string]bool)
+	}
+	retv := make(map[string]bool)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		retv[name] = true
+	}
+	jsonFieldCache.Store(t, retv)
+	return retv
+}
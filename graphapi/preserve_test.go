@@ -0,0 +1,151 @@
+package graphapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func compactJSON(t *testing.T, data []byte) []byte {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, data); err != nil {
+		t.Fatalf("Failed to compact JSON: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// TestLosslessRoundtrip tests that every workflow in testdata saves as it was read,
+// apart from whitespace
+func TestLosslessRoundtrip(t *testing.T) {
+	nodeObjects := readObjectInfo(t, "../examples/testdata/subgraphs/object_info.json")
+
+	files, _ := filepath.Glob("../examples/testdata/*.json")
+	subgraphs, _ := filepath.Glob("../examples/testdata/subgraphs/*.json")
+	for _, path := range append(files, subgraphs...) {
+		if strings.HasSuffix(path, "_api.json") || strings.HasSuffix(path, "_expected.json") || strings.HasSuffix(path, "object_info.json") {
+			continue
+		}
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			source, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("Failed to read workflow: %v", err)
+			}
+			graph, _, _ := NewGraphFromJsonString(string(source), nodeObjects)
+			if graph == nil {
+				t.Fatalf("Failed to unmarshal workflow")
+			}
+			// generating a prompt does not change the workflow
+			graph.GraphToPrompt("")
+
+			saved, err := graph.GraphToJSON()
+			if err != nil {
+				t.Fatalf("Failed to save workflow: %v", err)
+			}
+			want := compactJSON(t, source)
+			got := compactJSON(t, []byte(saved))
+			if !bytes.Equal(want, got) {
+				i := 0
+				for i < len(want) && i < len(got) && want[i] == got[i] {
+					i++
+				}
+				start := i - 80
+				if start < 0 {
+					start = 0
+				}
+				t.Errorf("Saved workflow differs at byte %d:\nwant ...%s\ngot  ...%s",
+					i, want[start:min(len(want), i+80)], got[start:min(len(got), i+80)])
+			}
+		})
+	}
+}
+
+// TestRoundtripUnknownFields tests that changing a workflow keeps the fields the graph
+// does not know, and writes the changed values
+func TestRoundtripUnknownFields(t *testing.T) {
+	source := `{"id":"a","revision":0,"last_node_id":2,"last_link_id":1,` +
+		`"nodes":[{"id":1,"type":"EmptyLatentImage","pos":[0,0],"size":{"0":315,"1":106},"flags":{"pinned":true},"order":0,"mode":0,` +
+		`"outputs":[{"name":"LATENT","localized_name":"LATENT","label":"latent","type":"LATENT","links":[1],"slot_index":0}],` +
+		`"properties":{"Node name for S&R":"EmptyLatentImage","cnr_id":"comfy-core"},"widgets_values":[512,512,1.0],"future":{"x":1e3}},` +
+		`{"id":2,"type":"Sink","pos":[400,0],"size":[200,50],"flags":{},"order":1,"mode":0,` +
+		`"inputs":[{"name":"latent","type":"LATENT","link":1}],"properties":{}}],` +
+		`"links":[[1,1,0,2,0,"LATENT"]],"groups":[{"id":3,"title":"A","bounding":[0,0,10,10],"color":"#3f789e","font_size":24,"flags":{}}],` +
+		`"config":{"links_ontop":false},"extra":{"ds":{"scale":1.1,"offset":[0,0]},"frontendVersion":"1.28.6"},"version":0.4}`
+
+	var graph Graph
+	if err := json.Unmarshal([]byte(source), &graph); err != nil {
+		t.Fatalf("Failed to unmarshal graph: %v", err)
+	}
+	saved, _ := graph.GraphToJSON()
+	if saved != source {
+		t.Fatalf("Expected the graph to save as it was read:\n%s\n%s", source, saved)
+	}
+
+	n := graph.GetNodeById(1)
+	n.WidgetValuesArray()[0] = float64(768)
+	n.Size.Width = 400
+	graph.Groups[0].Title = "B"
+	graph.RemoveLink(1)
+	saved, _ = graph.GraphToJSON()
+
+	want := strings.NewReplacer(
+		`"size":{"0":315,"1":106}`, `"size":[400,106]`,
+		`"widgets_values":[512,512,1.0]`, `"widgets_values":[768,512,1]`,
+		`"links":[1],`, `"links":[],`,
+		`"title":"A"`, `"title":"B"`,
+		`"link":1}`, `"link":null}`,
+		`"links":[[1,1,0,2,0,"LATENT"]]`, `"links":[]`,
+	).Replace(source)
+	if saved != want {
+		t.Errorf("Unexpected changes:\nwant %s\ngot  %s", want, saved)
+	}
+}
+
+// TestUnpackAllSubgraphsSaves tests that unpacking every subgraph saves the emptied
+// definitions as the frontend's schema allows, not as null
+func TestUnpackAllSubgraphsSaves(t *testing.T) {
+	graph := newSelectorTestGraph(t)
+	if _, err := graph.UnpackSubgraph(graph.GetNodeById(57)); err != nil {
+		t.Fatalf("Failed to unpack subgraph: %v", err)
+	}
+	saved, err := graph.GraphToJSON()
+	if err != nil {
+		t.Fatalf("Failed to save workflow: %v", err)
+	}
+
+	var workflow struct {
+		Definitions *struct {
+			Subgraphs []interface{} `json:"subgraphs"`
+		} `json:"definitions"`
+	}
+	if err := json.Unmarshal([]byte(saved), &workflow); err != nil {
+		t.Fatalf("Failed to read saved workflow: %v", err)
+	}
+	if workflow.Definitions != nil && (workflow.Definitions.Subgraphs == nil || len(workflow.Definitions.Subgraphs) != 0) {
+		t.Errorf("Expected no subgraph definitions, got %v", workflow.Definitions.Subgraphs)
+	}
+
+	// the only nulls the frontend writes are the links of unlinked inputs
+	var check func(key string, v interface{})
+	check = func(key string, v interface{}) {
+		switch v := v.(type) {
+		case nil:
+			if key != "link" {
+				t.Errorf("Expected %q not to be null", key)
+			}
+		case map[string]interface{}:
+			for k, e := range v {
+				check(k, e)
+			}
+		case []interface{}:
+			for _, e := range v {
+				check(key, e)
+			}
+		}
+	}
+	var all interface{}
+	json.Unmarshal([]byte(saved), &all)
+	check("", all)
+}
@@ -6,6 +6,13 @@ type Prompt struct {
 	Nodes     map[string]PromptNode `json:"prompt"`
 	ExtraData PromptExtraData       `json:"extra_data"`
 	PID       string                `json:"pid"`
+	// Seeds holds the values of controlled (seed) inputs as they were serialized,
+	// keyed by prompt node ID and input name.  Only populated when the graph's
+	// ValueControl is enabled.
+	Seeds map[string]map[string]int64 `json:"-"`
+	// ExpandedText holds the text of dynamic prompt inputs after their choices
+	// and wildcards were expanded, keyed by prompt node ID and input name
+	ExpandedText map[string]map[string]string `json:"-"`
 }
 
 type PromptNode struct {
@@ -16,6 +23,12 @@ type PromptNode struct {
 	//					     [1] is float64 (int) of slot index
 	Inputs    map[string]interface{} `json:"inputs"`
 	ClassType string                 `json:"class_type"`
+	Meta      *PromptNodeMeta        `json:"_meta,omitempty"`
+}
+
+// PromptNodeMeta is information about a prompt node that is ignored by ComfyUI
+type PromptNodeMeta struct {
+	Title string `json:"title,omitempty"`
 }
 
 type PromptExtraData struct {
@@ -26,5 +39,5 @@ type PromptExtraData struct {
 // It is added to generated PNG files such that the information needed to
 // recreate the image is available.
 type PromptWorkflow struct {
-	Workflow *Graph `json:"workflow"`
+	Workflow *Graph `json:"workflow,omitempty"`
 }
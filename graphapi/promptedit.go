@@ -0,0 +1,238 @@
+package graphapi
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// EditablePrompt is an API format prompt whose node inputs can be changed, e.g. the
+// prompt of an image that was generated through the API and holds no workflow.
+// Values are checked against the node objects the way SetValueStrict checks them.
+type EditablePrompt struct {
+	Prompt      *Prompt
+	NodeObjects *NodeObjects
+}
+
+// NewEditablePrompt creates an editable prompt from prompt nodes.  The node types
+// that are not in node_objects are returned with an error.
+func NewEditablePrompt(nodes map[string]PromptNode, node_objects *NodeObjects) (*EditablePrompt, *[]string, error) {
+	missing := make([]string, 0)
+	for _, id := range promptNodeIDs(nodes) {
+		pn := nodes[id]
+		if node_objects.GetNodeObjectByName(pn.ClassType) == nil {
+			if !containsString(&missing, pn.ClassType) {
+				missing = append(missing, pn.ClassType)
+			}
+			continue
+		}
+		if pn.Inputs == nil {
+			pn.Inputs = make(map[string]interface{})
+			nodes[id] = pn
+		}
+		for name, v := range pn.Inputs {
+			if origin, _, ok := promptInputLink(v); ok {
+				if _, ok := nodes[origin]; !ok {
+					return nil, nil, fmt.Errorf("node %s input %s is linked to missing node %s", id, name, origin)
+				}
+			}
+		}
+	}
+	if len(missing) != 0 {
+		return nil, &missing, errors.New("missing node types")
+	}
+
+	retv := &EditablePrompt{
+		Prompt:      &Prompt{Nodes: nodes},
+		NodeObjects: node_objects,
+	}
+	return retv, nil, nil
+}
+
+// NewEditablePromptFromReader creates an editable prompt from an API format prompt read
+// from an io.Reader.  The data is either the map of prompt nodes, or a Prompt that holds them.
+func NewEditablePromptFromReader(r io.Reader, node_objects *NodeObjects) (*EditablePrompt, *[]string, error) {
+	nodes, err := readPromptNodes(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	return NewEditablePrompt(nodes, node_objects)
+}
+
+// NodeIDs returns the IDs of the prompt's nodes, numeric IDs first in numeric order
+func (e *EditablePrompt) NodeIDs() []string {
+	return promptNodeIDs(e.Prompt.Nodes)
+}
+
+// Get returns the value of a node input addressed by path.  A path is a node selector
+// followed by a '.' and the input's name.  The node selector is one of:
+//
+//	3 or 57:8    a prompt node id
+//	Title        a node's title, or its class type when no node has that title
+//	Title#3      a node with the given title or class type, and id
+//	@title:Name  a node's title only
+//	@type:Name   a node's class type only
+//
+// Titles are those in the prompt's _meta information.  A '.', '#' or '\' that is
+// part of a title or input name is escaped with a '\', see EscapePath.
+func (e *EditablePrompt) Get(path string) (interface{}, error) {
+	id, name, err := e.resolvePath(path)
+	if err != nil {
+		return nil, err
+	}
+	v, ok := e.Prompt.Nodes[id].Inputs[name]
+	if !ok {
+		return nil, &PathError{Path: path, Selector: name, Candidates: e.inputNames(id), Err: ErrPathNotFound}
+	}
+	return v, nil
+}
+
+// Set sets the value of a node input addressed by path.  See Get for the path syntax.
+func (e *EditablePrompt) Set(path string, value interface{}) error {
+	id, name, err := e.resolvePath(path)
+	if err != nil {
+		return err
+	}
+	return e.SetInput(id, name, value)
+}
+
+// SetInput sets the value of an input of the node with the given id.  The input must
+// be a widget input of the node's type, and the value must be valid for it.  Setting
+// a linked input replaces the link with the value.
+func (e *EditablePrompt) SetInput(id string, name string, value interface{}) error {
+	pn, ok := e.Prompt.Nodes[id]
+	if !ok {
+		return fmt.Errorf("prompt has no node %s", id)
+	}
+	prop, err := e.inputProperty(pn.ClassType, name)
+	if err != nil {
+		return fmt.Errorf("node %s: %w", id, err)
+	}
+	val, err := prop.strictValue(value)
+	if err != nil {
+		return fmt.Errorf("node %s: %w", id, err)
+	}
+	pn.Inputs[name] = val
+	return nil
+}
+
+// Validate checks that every widget input of the prompt has a valid value, and that
+// every required input is set or linked
+func (e *EditablePrompt) Validate() error {
+	for _, id := range e.NodeIDs() {
+		pn := e.Prompt.Nodes[id]
+		nobject := e.NodeObjects.GetNodeObjectByName(pn.ClassType)
+		if nobject == nil {
+			return fmt.Errorf("node %s: unknown node type %s", id, pn.ClassType)
+		}
+		if nobject.Input != nil {
+			for _, name := range nobject.Input.OrderedRequired {
+				if _, ok := pn.Inputs[name]; !ok {
+					return fmt.Errorf("node %s (%s): required input %s is missing", id, pn.ClassType, name)
+				}
+			}
+		}
+		names := make([]string, 0, len(pn.Inputs))
+		for name := range pn.Inputs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			v := pn.Inputs[name]
+			if _, _, ok := promptInputLink(v); ok {
+				continue
+			}
+			p, ok := nobject.InputPropertiesByID[name]
+			if !ok || !(*p).Settable() {
+				continue
+			}
+			if _, err := (*p).strictValue(v); err != nil {
+				return fmt.Errorf("node %s: %w", id, err)
+			}
+		}
+	}
+	return nil
+}
+
+// inputProperty returns the property that describes a widget input of a node type
+func (e *EditablePrompt) inputProperty(classType string, name string) (Property, error) {
+	nobject := e.NodeObjects.GetNodeObjectByName(classType)
+	if nobject == nil {
+		return nil, fmt.Errorf("unknown node type %s", classType)
+	}
+	p, ok := nobject.InputPropertiesByID[name]
+	if !ok || !(*p).Settable() || !(*p).Serializable() {
+		names := make([]string, 0)
+		for _, p := range nobject.GetSettableProperties() {
+			if p.Serializable() {
+				names = append(names, p.Name())
+			}
+		}
+		return nil, fmt.Errorf("%s has no input %s that can be set, available: %s", classType, name, strings.Join(names, ", "))
+	}
+	return *p, nil
+}
+
+// inputNames returns the names of a node's inputs
+func (e *EditablePrompt) inputNames(id string) []string {
+	retv := make([]string, 0)
+	for name := range e.Prompt.Nodes[id].Inputs {
+		retv = append(retv, name)
+	}
+	sort.Strings(retv)
+	return retv
+}
+
+func (e *EditablePrompt) resolvePath(path string) (string, string, error) {
+	dot := lastUnescaped(path, '.')
+	if dot <= 0 || dot == len(path)-1 {
+		return "", "", &PathError{Path: path, Selector: path, Err: ErrPathSyntax}
+	}
+	selector := path[:dot]
+	name := unescapePath(path[dot+1:])
+	ids := e.NodeIDs()
+
+	if _, ok := e.Prompt.Nodes[selector]; ok {
+		return selector, name, nil
+	}
+
+	matches := e.matchSelector(ids, selector)
+	switch len(matches) {
+	case 0:
+		return "", "", &PathError{Path: path, Selector: selector, Candidates: e.nodeLabels(ids), Err: ErrPathNotFound}
+	case 1:
+		return matches[0], name, nil
+	}
+	return "", "", &PathError{Path: path, Selector: selector, Candidates: e.nodeLabels(matches), Err: ErrPathAmbiguous}
+}
+
+// matchSelector returns the ids of the nodes matching a node selector
+func (e *EditablePrompt) matchSelector(ids []string, selector string) []string {
+	indexes := parseNodeSelector(selector).match(len(ids), func(i int) (string, string, string) {
+		return ids[i], e.nodeTitle(ids[i]), e.Prompt.Nodes[ids[i]].ClassType
+	})
+	retv := make([]string, len(indexes))
+	for i, index := range indexes {
+		retv[i] = ids[index]
+	}
+	return retv
+}
+
+// nodeTitle returns the title of a prompt node, or its class type when it has none
+func (e *EditablePrompt) nodeTitle(id string) string {
+	pn := e.Prompt.Nodes[id]
+	if pn.Meta != nil && pn.Meta.Title != "" {
+		return pn.Meta.Title
+	}
+	return pn.ClassType
+}
+
+func (e *EditablePrompt) nodeLabels(ids []string) []string {
+	retv := make([]string, len(ids))
+	for i, id := range ids {
+		retv[i] = fmt.Sprintf("%s#%s", EscapePath(e.nodeTitle(id)), id)
+	}
+	return retv
+}
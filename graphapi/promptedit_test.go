@@ -0,0 +1,106 @@
+package graphapi
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const editablePromptTest = `{"prompt": {
+	"4": {"class_type": "CheckpointLoader", "inputs": {"ckpt_name": "b.safetensors"}},
+	"3": {"class_type": "KSampler", "inputs": {"model": ["4", 0], "seed": 42, "cfg": 6.5}, "_meta": {"title": "Sampler"}},
+	"5": {"class_type": "KSampler", "inputs": {"model": ["4", 0], "seed": 7, "cfg": 8}},
+	"9": {"class_type": "SaveLatent", "inputs": {"samples": ["3", 0]}}
+}}`
+
+// TestEditablePrompt tests changing the inputs of a prompt by id, title and class type
+func TestEditablePrompt(t *testing.T) {
+	ep, missing, err := NewEditablePromptFromReader(strings.NewReader(editablePromptTest), newPromptGraphTestNodeObjects())
+	if err != nil {
+		t.Fatalf("Failed to read prompt: %v %v", err, missing)
+	}
+	if err := ep.Validate(); err != nil {
+		t.Fatalf("Expected the prompt to be valid: %v", err)
+	}
+
+	for path, value := range map[string]interface{}{
+		"Sampler.seed":               100,
+		"5.cfg":                      4.5,
+		"KSampler#5.seed":            200,
+		"CheckpointLoader.ckpt_name": "a.safetensors",
+	} {
+		if err := ep.Set(path, value); err != nil {
+			t.Fatalf("Failed to set %s: %v", path, err)
+		}
+	}
+	if v := ep.Prompt.Nodes["3"].Inputs["seed"]; v != int64(100) {
+		t.Errorf("Expected seed 100, got %v", v)
+	}
+	if v, _ := ep.Get("@type:KSampler#5.seed"); v != int64(200) {
+		t.Errorf("Expected seed 200, got %v", v)
+	}
+	if v, _ := ep.Get("4.ckpt_name"); v != "a.safetensors" {
+		t.Errorf("Expected the checkpoint to be set, got %v", v)
+	}
+
+	cases := []struct {
+		path  string
+		value interface{}
+		err   error
+		text  string
+	}{
+		{"@type:KSampler.seed", 1, ErrPathAmbiguous, "Sampler#3, KSampler#5"},
+		{"Missing.seed", 1, ErrPathNotFound, "SaveLatent#9"},
+		{"3.cfg", 1000, ErrOutOfRange, "out of range"},
+		{"4.ckpt_name", "c.safetensors", ErrNotInCombo, "not one of"},
+		{"3.model", "x", nil, "no input model"},
+	}
+	for _, c := range cases {
+		err := ep.Set(c.path, c.value)
+		if err == nil || (c.err != nil && !errors.Is(err, c.err)) || !strings.Contains(err.Error(), c.text) {
+			t.Errorf("%s: expected an error mentioning %q, got %v", c.path, c.text, err)
+		}
+	}
+
+	// an invalid value that was read is reported
+	ep.Prompt.Nodes["5"].Inputs["seed"] = float64(-1)
+	if err := ep.Validate(); !errors.Is(err, ErrOutOfRange) {
+		t.Errorf("Expected the invalid seed to be reported, got %v", err)
+	}
+	delete(ep.Prompt.Nodes["9"].Inputs, "samples")
+	ep.Prompt.Nodes["5"].Inputs["seed"] = float64(1)
+	if err := ep.Validate(); err == nil || !strings.Contains(err.Error(), "samples") {
+		t.Errorf("Expected the missing input to be reported, got %v", err)
+	}
+
+	if _, missing, err := NewEditablePromptFromReader(strings.NewReader(`{"1": {"class_type": "Unknown", "inputs": {}}}`), newPromptGraphTestNodeObjects()); err == nil || len(*missing) != 1 {
+		t.Errorf("Expected the unknown node type to be missing, got %v", err)
+	}
+
+	// node types without inputs are valid
+	nodeObjects := newPromptGraphTestNodeObjects()
+	nodeObjects.Objects["Timestamp"] = &NodeObject{Name: "Timestamp"}
+	ep, _, err = NewEditablePromptFromReader(strings.NewReader(`{"1": {"class_type": "Timestamp"}}`), nodeObjects)
+	if err != nil {
+		t.Fatalf("Failed to read prompt: %v", err)
+	}
+	if err := ep.Validate(); err != nil {
+		t.Errorf("Expected a node without inputs to be valid, got %v", err)
+	}
+}
+
+// TestParseNodeSelector tests the node selectors shared by graph and prompt paths
+func TestParseNodeSelector(t *testing.T) {
+	for segment, want := range map[string]nodeSelector{
+		"KSampler":        {name: "KSampler"},
+		"Sampler#3":       {name: "Sampler", id: "3"},
+		"#57:8":           {id: "57:8"},
+		"@title:Seed#2":   {name: "Seed", id: "2", byTitle: true},
+		"@type:KSampler":  {name: "KSampler", byType: true},
+		"Take #1 or #two": {name: "Take #1 or #two"},
+	} {
+		if got := parseNodeSelector(segment); got != want {
+			t.Errorf("%s: expected %+v, got %+v", segment, want, got)
+		}
+	}
+}
@@ -0,0 +1,322 @@
+package graphapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+)
+
+// layout of the nodes of a graph created from a prompt
+const (
+	promptNodeWidth     = 315
+	promptNodeSpacingX  = 400
+	promptNodeSpacingY  = 40
+	promptNodeSlotSize  = 26
+	promptNodeTitleSize = 46
+)
+
+// NewGraphFromPrompt creates a workflow from the nodes of an API format prompt.  The
+// widgets and slots of each node are laid out from its NodeObject, so every class type
+// of the prompt must be known.  Nodes are arranged in columns by their depth in the graph.
+//
+// Prompt node IDs that are not integers, such as those of expanded subgraphs, are given
+// new IDs.
+//
+// Returns:
+//   - The graph
+//   - A pointer to an array of strings containing any missing node types
+func NewGraphFromPrompt(nodes map[string]PromptNode, node_objects *NodeObjects) (*Graph, *[]string, error) {
+	ids := promptNodeIDs(nodes)
+
+	// find the missing types before building anything
+	missing := make([]string, 0)
+	for _, pid := range ids {
+		ct := nodes[pid].ClassType
+		if node_objects.GetNodeObjectByName(ct) == nil && !containsString(&missing, ct) {
+			missing = append(missing, ct)
+		}
+	}
+	if len(missing) != 0 {
+		return nil, &missing, errors.New("missing node types")
+	}
+
+	graph := &Graph{
+		Nodes:         make([]*GraphNode, 0, len(nodes)),
+		Links:         make([]*Link, 0),
+		Groups:        make([]*Group, 0),
+		NodesByID:     make(map[int]*GraphNode),
+		LinksByID:     make(map[int]*Link),
+		SubgraphsByID: make(map[string]*SubgraphDefinition),
+		Version:       0.4,
+	}
+
+	// assign graph IDs
+	nodeIDs := make(map[string]int, len(ids))
+	next := 0
+	for _, pid := range ids {
+		if id, err := strconv.Atoi(pid); err == nil && id > 0 {
+			nodeIDs[pid] = id
+			if id > next {
+				next = id
+			}
+		}
+	}
+	for _, pid := range ids {
+		if _, ok := nodeIDs[pid]; !ok {
+			next++
+			nodeIDs[pid] = next
+		}
+	}
+
+	// the order is computed once the nodes are linked and laid out
+	done := graph.deferOrder()
+	for _, pid := range ids {
+		n := newNodeFromPromptNode(nodeIDs[pid], nodes[pid], node_objects.GetNodeObjectByName(nodes[pid].ClassType))
+		if err := graph.AddNode(n); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// connect the links
+	for _, pid := range ids {
+		target := graph.GetNodeById(nodeIDs[pid])
+		for i, slot := range target.Inputs {
+			origin, originSlot, ok := promptInputLink(nodes[pid].Inputs[slot.Name])
+			if !ok {
+				continue
+			}
+			originID, ok := nodeIDs[origin]
+			if !ok {
+				return nil, nil, fmt.Errorf("node %s input %s: node %s does not exist", pid, slot.Name, origin)
+			}
+			if _, err := graph.AddLink(originID, originSlot, target.ID, i); err != nil {
+				return nil, nil, fmt.Errorf("node %s input %s: %w", pid, slot.Name, err)
+			}
+		}
+	}
+
+	layoutPromptGraph(graph)
+	done()
+
+	if m := graph.CreateNodeProperties(node_objects); m != nil && len(*m) != 0 {
+		return graph, m, errors.New("missing node types")
+	}
+	return graph, nil, nil
+}
+
+// NewGraphFromPromptReader creates a workflow from an API format prompt read from an
+// io.Reader.  The data is either the map of prompt nodes, or a Prompt that holds them.
+func NewGraphFromPromptReader(r io.Reader, node_objects *NodeObjects) (*Graph, *[]string, error) {
+	nodes, err := readPromptNodes(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	return NewGraphFromPrompt(nodes, node_objects)
+}
+
+// readPromptNodes reads either a map of prompt nodes, or a Prompt that holds them
+func readPromptNodes(r io.Reader) (map[string]PromptNode, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var wrapped struct {
+		Nodes map[string]PromptNode `json:"prompt"`
+	}
+	if err := json.Unmarshal(data, &wrapped); err == nil && wrapped.Nodes != nil {
+		return wrapped.Nodes, nil
+	}
+
+	nodes := make(map[string]PromptNode)
+	if err := json.Unmarshal(data, &nodes); err != nil {
+		return nil, err
+	}
+	return nodes, nil
+}
+
+// promptNodeIDs returns the IDs of the prompt nodes, numeric IDs first in numeric order
+func promptNodeIDs(nodes map[string]PromptNode) []string {
+	retv := make([]string, 0, len(nodes))
+	for id := range nodes {
+		retv = append(retv, id)
+	}
+	sort.Slice(retv, func(i, j int) bool {
+		a, aerr := strconv.Atoi(retv[i])
+		b, berr := strconv.Atoi(retv[j])
+		switch {
+		case aerr == nil && berr == nil:
+			return a < b
+		case aerr == nil:
+			return true
+		case berr == nil:
+			return false
+		}
+		return retv[i] < retv[j]
+	})
+	return retv
+}
+
+// promptInputLink returns the origin node and slot of a linked prompt input
+func promptInputLink(v interface{}) (string, int, bool) {
+	l, ok := v.([]interface{})
+	if !ok || len(l) != 2 {
+		return "", 0, false
+	}
+	var origin string
+	switch o := l[0].(type) {
+	case string:
+		origin = o
+	case float64:
+		origin = strconv.Itoa(int(o))
+	default:
+		return "", 0, false
+	}
+	switch s := l[1].(type) {
+	case float64:
+		return origin, int(s), true
+	case int:
+		return origin, s, true
+	}
+	return "", 0, false
+}
+
+// newNodeFromPromptNode creates a node with the slots and widget values of a prompt node
+func newNodeFromPromptNode(id int, pn PromptNode, nobject *NodeObject) *GraphNode {
+	n := &GraphNode{
+		ID:                 id,
+		Type:               pn.ClassType,
+		InternalProperties: &map[string]interface{}{"Node name for S&R": pn.ClassType},
+		Inputs:             make([]Slot, 0),
+		Outputs:            make([]Slot, 0),
+	}
+	if pn.Meta != nil && pn.Meta.Title != "" && pn.Meta.Title != nobject.DisplayName {
+		n.Title = pn.Meta.Title
+	}
+
+	widgets := make([]interface{}, 0)
+	for _, pp := range nobject.InputProperties {
+		p := *pp
+		name := p.Name()
+		v, hasValue := pn.Inputs[name]
+		_, _, linked := promptInputLink(v)
+
+		if !p.Settable() {
+			// a connection
+			n.Inputs = append(n.Inputs, Slot{Name: name, Type: p.TypeString()})
+			continue
+		}
+
+		if name == "control_after_generate" && !hasValue {
+			// the value in the prompt was the one used, keep it
+			widgets = append(widgets, "fixed")
+			continue
+		}
+
+		switch {
+		case linked:
+			// a widget that was converted to an input
+			wname := name
+			n.Inputs = append(n.Inputs, Slot{Name: name, Type: p.TypeString(), Widget: &Widget{Name: &wname}})
+			widgets = append(widgets, promptWidgetDefault(p))
+		case hasValue:
+			widgets = append(widgets, v)
+		default:
+			widgets = append(widgets, promptWidgetDefault(p))
+		}
+	}
+	if nobject.Name == "LoadImage" || nobject.Name == "LoadImageMask" {
+		// the value of the "choose file to upload" widget
+		widgets = append(widgets, "image")
+	}
+	n.WidgetValues = widgets
+
+	if nobject.Output != nil {
+		var names []interface{}
+		if nobject.OutputName != nil {
+			names, _ = (*nobject.OutputName).([]interface{})
+		}
+		for i, o := range *nobject.Output {
+			otype, ok := o.(string)
+			if !ok {
+				// a list of values
+				otype = "COMBO"
+			}
+			oname := otype
+			if i < len(names) {
+				if s, ok := names[i].(string); ok {
+					oname = s
+				}
+			}
+			index := i
+			n.Outputs = append(n.Outputs, Slot{Name: oname, Type: otype, Links: &[]int{}, SlotIndex: &index})
+		}
+	}
+
+	rows := len(n.Inputs)
+	if len(n.Outputs) > rows {
+		rows = len(n.Outputs)
+	}
+	n.Size = Size{Width: promptNodeWidth, Height: float64(promptNodeTitleSize + promptNodeSlotSize*(rows+len(widgets)))}
+	return n
+}
+
+// promptWidgetDefault returns the value of a widget that has no value in the prompt
+func promptWidgetDefault(p Property) interface{} {
+	if p.HasDefault() {
+		return p.GetDefault()
+	}
+	if cp, ok := p.ToComboProperty(); ok && len(cp.Values) != 0 {
+		return cp.Values[0]
+	}
+	return nil
+}
+
+// layoutPromptGraph orders the nodes of a graph by their dependencies, and positions
+// them in columns by their depth
+func layoutPromptGraph(graph *Graph) {
+	depth := make(map[int]int, len(graph.Nodes))
+	visiting := make(map[int]bool)
+	var depthOf func(n *GraphNode) int
+	depthOf = func(n *GraphNode) int {
+		if d, ok := depth[n.ID]; ok {
+			return d
+		}
+		if visiting[n.ID] {
+			// a cycle, the prompt is invalid but the graph can still be shown
+			return 0
+		}
+		visiting[n.ID] = true
+		d := 0
+		for i := range n.Inputs {
+			if parent := n.GetNodeForInput(i); parent != nil {
+				if pd := depthOf(parent) + 1; pd > d {
+					d = pd
+				}
+			}
+		}
+		visiting[n.ID] = false
+		depth[n.ID] = d
+		return d
+	}
+	for _, n := range graph.Nodes {
+		depthOf(n)
+	}
+
+	ordered := make([]*GraphNode, len(graph.Nodes))
+	copy(ordered, graph.Nodes)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return depth[ordered[i].ID] < depth[ordered[j].ID]
+	})
+
+	columnY := make(map[int]float64)
+	for i, n := range ordered {
+		d := depth[n.ID]
+		n.Order = i
+		n.Position = []interface{}{float64(d * promptNodeSpacingX), columnY[d]}
+		columnY[d] += n.Size.Height + promptNodeSpacingY
+	}
+}
@@ -0,0 +1,103 @@
+package graphapi
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func newPromptGraphTestNodeObjects() *NodeObjects {
+	var ckptData interface{} = []interface{}{[]interface{}{"a.safetensors", "b.safetensors"}}
+	var modelData interface{} = []interface{}{"MODEL"}
+	var seedData interface{} = []interface{}{"INT", map[string]interface{}{"default": float64(0), "min": float64(0), "max": float64(1000000)}}
+	var cfgData interface{} = []interface{}{"FLOAT", map[string]interface{}{"default": float64(8), "min": float64(0), "max": float64(100), "step": 0.1}}
+	var latentData interface{} = []interface{}{"LATENT"}
+	var modelOut []interface{} = []interface{}{"MODEL"}
+	var modelName interface{} = []interface{}{"MODEL"}
+	var latentOut []interface{} = []interface{}{"LATENT"}
+	var latentName interface{} = []interface{}{"LATENT"}
+	nodeObjects := &NodeObjects{
+		Objects: map[string]*NodeObject{
+			"CheckpointLoader": {
+				Name:        "CheckpointLoader",
+				DisplayName: "Load Checkpoint",
+				Input: &NodeObjectInput{
+					Required:        map[string]*interface{}{"ckpt_name": &ckptData},
+					OrderedRequired: []string{"ckpt_name"},
+				},
+				Output:     &modelOut,
+				OutputName: &modelName,
+			},
+			"KSampler": {
+				Name:        "KSampler",
+				DisplayName: "KSampler",
+				Input: &NodeObjectInput{
+					Required:        map[string]*interface{}{"model": &modelData, "seed": &seedData, "cfg": &cfgData},
+					OrderedRequired: []string{"model", "seed", "cfg"},
+				},
+				Output:     &latentOut,
+				OutputName: &latentName,
+			},
+			"SaveLatent": {
+				Name:        "SaveLatent",
+				DisplayName: "Save Latent",
+				Input: &NodeObjectInput{
+					Required:        map[string]*interface{}{"samples": &latentData},
+					OrderedRequired: []string{"samples"},
+				},
+				OutputNode: true,
+			},
+		},
+	}
+	nodeObjects.PopulateInputProperties()
+	return nodeObjects
+}
+
+// TestNewGraphFromPrompt tests converting an API prompt to a workflow and back
+func TestNewGraphFromPrompt(t *testing.T) {
+	nodeObjects := newPromptGraphTestNodeObjects()
+	prompt := `{
+		"4": {"class_type": "CheckpointLoader", "inputs": {"ckpt_name": "b.safetensors"}},
+		"3": {"class_type": "KSampler", "inputs": {"model": ["4", 0], "seed": 42, "cfg": 6.5}, "_meta": {"title": "Sampler"}},
+		"9": {"class_type": "SaveLatent", "inputs": {"samples": ["3", 0]}}
+	}`
+
+	graph, missing, err := NewGraphFromPromptReader(strings.NewReader(prompt), nodeObjects)
+	if err != nil {
+		t.Fatalf("Failed to create graph: %v %v", err, missing)
+	}
+	if len(graph.Nodes) != 3 || len(graph.Links) != 2 {
+		t.Fatalf("Expected 3 nodes and 2 links, got %d and %d", len(graph.Nodes), len(graph.Links))
+	}
+	if graph.GetNodeById(3).Title != "Sampler" {
+		t.Errorf("Expected the title from _meta, got %q", graph.GetNodeById(3).Title)
+	}
+	if order := graph.NodesInExecutionOrder; order[0].ID != 4 || order[2].ID != 9 {
+		t.Errorf("Expected nodes ordered by their dependencies")
+	}
+
+	p, err := graph.GraphToPrompt("")
+	if err != nil {
+		t.Fatalf("Failed to generate prompt: %v", err)
+	}
+	ks := p.Nodes["3"]
+	if fmt.Sprint(ks.Inputs["seed"]) != "42" || fmt.Sprint(ks.Inputs["cfg"]) != "6.5" {
+		t.Errorf("Expected widget values to survive, got %v", ks.Inputs)
+	}
+	if !reflect.DeepEqual(ks.Inputs["model"], []interface{}{"4", 0}) {
+		t.Errorf("Expected model to be linked, got %v", ks.Inputs["model"])
+	}
+	if p.Nodes["4"].Inputs["ckpt_name"] != "b.safetensors" {
+		t.Errorf("Expected ckpt_name, got %v", p.Nodes["4"].Inputs["ckpt_name"])
+	}
+}
+
+// TestNewGraphFromPromptMissingTypes tests that unknown class types are reported
+func TestNewGraphFromPromptMissingTypes(t *testing.T) {
+	nodes := map[string]PromptNode{"1": {ClassType: "Unknown", Inputs: map[string]interface{}{}}}
+	_, missing, err := NewGraphFromPrompt(nodes, newPromptGraphTestNodeObjects())
+	if err == nil || missing == nil || (*missing)[0] != "Unknown" {
+		t.Fatalf("Expected missing node types, got %v %v", err, missing)
+	}
+}
@@ -29,6 +29,7 @@ type Property interface {
 	GetTargetNode() *GraphNode
 	GetValue() interface{}
 	SetValue(v interface{}) error
+	SetValueStrict(v interface{}) error
 	Serializable() bool
 	SetSerializable(bool)
 	AttachSecondaryProperty(p Property)
@@ -37,6 +38,11 @@ type Property interface {
 	TargetIndex() int
 	SetAlias(string)
 	GetAlias() string
+	Tooltip() string
+	HasDefault() bool
+	GetDefault() interface{}
+	IsDefault() bool
+	ResetToDefault() error
 
 	UpdateParent(parent Property)
 	ToIntProperty() (*IntProperty, bool)
@@ -48,8 +54,10 @@ type Property interface {
 	ToImageUploadProperty() (*ImageUploadProperty, bool)
 	ToUnknownProperty() (*UnknownProperty, bool)
 	valueFromString(value string) interface{}
+	strictValue(v interface{}) (interface{}, error)
 
 	SetDirectValue(v *interface{})
+	base() *BaseProperty
 }
 
 type BaseProperty struct {
@@ -64,6 +72,9 @@ type BaseProperty struct {
 	index              int
 	direct_value       *interface{}
 	alias              string
+	tooltip            string
+	default_value      interface{}
+	has_default        bool
 }
 
 func (b *BaseProperty) SetDirectValue(v *interface{}) {
@@ -71,6 +82,10 @@ func (b *BaseProperty) SetDirectValue(v *interface{}) {
 	b.serializable = false
 }
 
+func (b *BaseProperty) base() *BaseProperty {
+	return b
+}
+
 func (b *BaseProperty) UpdateParent(parent Property) {
 	b.parent = parent
 }
@@ -154,9 +169,18 @@ func (b *BaseProperty) SetValue(v interface{}) error {
 
 	val := b.parent.valueFromString(vs)
 	if val == nil {
-		return errors.New("could not get converted type")
+		if combo, ok := b.parent.(*ComboProperty); ok && !combo.IsBool {
+			return newPropertyError(b.parent, v, ErrNotInCombo)
+		}
+		return newPropertyError(b.parent, v, ErrBadType)
 	}
 
+	return b.setConvertedValue(val)
+}
+
+// setConvertedValue writes a value that has been converted to the property's native
+// type to the target widget, and to any secondary properties
+func (b *BaseProperty) setConvertedValue(val interface{}) error {
 	if b.direct_value != nil {
 		*b.direct_value = val
 		return nil
@@ -253,6 +277,52 @@ func (b *BaseProperty) GetAlias() string {
 	return b.alias
 }
 
+// Tooltip returns the tooltip declared in the input spec
+func (b *BaseProperty) Tooltip() string {
+	return b.tooltip
+}
+
+// HasDefault returns true if the input spec declares a default value.  COMBO
+// properties always have a default, their first value when none is declared.
+func (b *BaseProperty) HasDefault() bool {
+	return b.has_default
+}
+
+// GetDefault returns the default value from the input spec, or nil when the spec does
+// not declare one
+func (b *BaseProperty) GetDefault() interface{} {
+	return b.default_value
+}
+
+// IsDefault returns true if the property's current value equals its default
+func (b *BaseProperty) IsDefault() bool {
+	if b.default_value == nil {
+		return false
+	}
+	v := b.GetValue()
+	if d, ok := v.(*interface{}); ok && d != nil {
+		v = *d
+	}
+	return valuesEqual(v, b.default_value)
+}
+
+// ResetToDefault sets the property to its default value
+func (b *BaseProperty) ResetToDefault() error {
+	if b.default_value == nil {
+		return fmt.Errorf("property %s has no default value", b.name)
+	}
+	return b.SetValue(b.default_value)
+}
+
+// parseSpecConfig reads the options common to all input specs
+func (b *BaseProperty) parseSpecConfig(d map[string]interface{}) {
+	if val, ok := d["tooltip"]; ok {
+		if s, ok := val.(string); ok {
+			b.tooltip = s
+		}
+	}
+}
+
 type BoolProperty struct {
 	BaseProperty
 	Default  bool
@@ -277,8 +347,15 @@ func newBoolProperty(input_name string, optional bool, data interface{}, index i
 		}
 
 		if val, ok := d["default"]; ok {
-			c.Default = val.(bool)
+			if b, ok := val.(bool); ok {
+				c.Default = b
+				c.has_default = true
+			}
 		}
+		c.parseSpecConfig(d)
+	}
+	if c.has_default {
+		c.default_value = c.Default
 	}
 
 	var retv Property = c
@@ -310,8 +387,11 @@ type IntProperty struct {
 	Min      int64 // optional
 	Max      int64 // optional
 	Step     int64 // optional
+	Round    int64 // optional, values are rounded to a multiple of Round in strict mode
 	hasStep  bool
 	hasRange bool
+	// the "control_after_generate" widget that follows this INT's widget, if any
+	control Property
 }
 
 func newIntProperty(input_name string, optional bool, data interface{}, index int) *Property {
@@ -327,6 +407,20 @@ func newIntProperty(input_name string, optional bool, data interface{}, index in
 	c.parent = Property(c)
 
 	if d, ok := data.(map[string]interface{}); ok {
+		// default?
+		if val, ok := d["default"]; ok {
+			if floatVal, ok := toFloat64(val); ok {
+				if floatVal >= float64(math.MaxInt64) {
+					c.Default = math.MaxInt64
+				} else if floatVal < float64(math.MinInt64) {
+					c.Default = math.MinInt64
+				} else {
+					c.Default = int64(floatVal)
+				}
+				c.has_default = true
+			}
+		}
+
 		// min?
 		if val, ok := d["min"]; ok {
 			floatVal := val.(float64)
@@ -367,10 +461,21 @@ func newIntProperty(input_name string, optional bool, data interface{}, index in
 			c.hasStep = true
 		}
 
+		// round?
+		if val, ok := d["round"]; ok {
+			if f, ok := toFloat64(val); ok && f >= 1 {
+				c.Round = int64(f)
+			}
+		}
+
 		if c.hasRange && c.Min > c.Max {
 			c.Min = 0
 			c.Max = math.MaxInt64
 		}
+		c.parseSpecConfig(d)
+	}
+	if c.has_default {
+		c.default_value = c.Default
 	}
 
 	var retv Property = c
@@ -416,6 +521,7 @@ type FloatProperty struct {
 	Min      float64
 	Max      float64
 	Step     float64
+	Round    float64 // values are rounded to a multiple of Round in strict mode, 0 disables rounding
 	hasStep  bool
 	hasRange bool
 }
@@ -433,6 +539,14 @@ func newFloatProperty(input_name string, optional bool, data interface{}, index
 	c.parent = c
 
 	if d, ok := data.(map[string]interface{}); ok {
+		// default?
+		if val, ok := d["default"]; ok {
+			if f, ok := toFloat64(val); ok {
+				c.Default = f
+				c.has_default = true
+			}
+		}
+
 		// min?
 		if val, ok := d["min"]; ok {
 			c.Min = val.(float64)
@@ -450,6 +564,20 @@ func newFloatProperty(input_name string, optional bool, data interface{}, index
 			c.Step = val.(float64)
 			c.hasStep = true
 		}
+
+		// round? like the frontend, this defaults to the precision of the step
+		c.Round = floatRoundFromStep(c.Step, c.hasStep)
+		if val, ok := d["round"]; ok {
+			if f, ok := toFloat64(val); ok {
+				c.Round = f
+			} else if b, ok := val.(bool); ok && !b {
+				c.Round = 0
+			}
+		}
+		c.parseSpecConfig(d)
+	}
+	if c.has_default {
+		c.default_value = c.Default
 	}
 
 	var retv Property = c
@@ -487,8 +615,9 @@ func (p *FloatProperty) valueFromString(value string) interface{} {
 
 type StringProperty struct {
 	BaseProperty
-	Default   string
-	Multiline bool
+	Default        string
+	Multiline      bool
+	DynamicPrompts bool // expand {a|b} choices and __wildcards__ when serialized
 }
 
 func newStringProperty(input_name string, optional bool, data interface{}, index int) *Property {
@@ -504,6 +633,7 @@ func newStringProperty(input_name string, optional bool, data interface{}, index
 		if val, ok := d["default"]; ok {
 			if s, ok := val.(string); ok {
 				c.Default = s
+				c.has_default = true
 			}
 		}
 
@@ -511,6 +641,17 @@ func newStringProperty(input_name string, optional bool, data interface{}, index
 		if val, ok := d["multiline"]; ok {
 			c.Multiline = val.(bool)
 		}
+
+		// dynamic prompts?
+		if val, ok := d["dynamicPrompts"]; ok {
+			if b, ok := val.(bool); ok {
+				c.DynamicPrompts = b
+			}
+		}
+		c.parseSpecConfig(d)
+	}
+	if c.has_default {
+		c.default_value = c.Default
 	}
 
 	var retv Property = c
@@ -665,8 +806,9 @@ func (p *CascadingProperty) GetGroupByName(name string) *CascadeGroup {
 
 type ComboProperty struct {
 	BaseProperty
-	Values []string
-	IsBool bool
+	Values  []string
+	IsBool  bool
+	Default string
 }
 
 func newComboProperty(input_name string, optional bool, input []interface{}, index int) *Property {
@@ -688,15 +830,16 @@ func newComboProperty(input_name string, optional bool, input []interface{}, ind
 			// 'f' format, -1 precision (auto-detect necessary digits), 64-bit
 			strVal := strconv.FormatFloat(f, 'f', -1, 64)
 			c.Values = append(c.Values, strVal)
-		} else if _, ok := v.(map[string]interface{}); ok {
-			// Ignore config dictionaries (e.g. {"default": "foo"})
-			// until we want to parse default values from them
+		} else if d, ok := v.(map[string]interface{}); ok {
+			// config dictionaries (e.g. {"default": "foo"}) are not values
+			c.parseComboConfig(d)
 			continue
 		} else {
 			// Use slog.Warn instead of Debug so you see it
 			slog.Warn(fmt.Sprintf("Ignored non-standard combo entry type: %T", v))
 		}
 	}
+	c.setImpliedDefault()
 	var retv Property = c
 	return &retv
 }
@@ -753,12 +896,48 @@ func newComboPropertyFromConfig(input_name string, optional bool, config interfa
 				}
 			}
 		}
+		c.parseComboConfig(configMap)
 	}
+	c.setImpliedDefault()
 
 	var retv Property = c
 	return &retv
 }
 
+// parseComboConfig reads the default and tooltip from a combo's config dictionary
+func (p *ComboProperty) parseComboConfig(d map[string]interface{}) {
+	if val, ok := d["default"]; ok {
+		switch v := val.(type) {
+		case string:
+			p.Default = v
+			p.has_default = true
+		case bool:
+			p.Default = strconv.FormatBool(v)
+			p.has_default = true
+		case float64:
+			p.Default = strconv.FormatFloat(v, 'f', -1, 64)
+			p.has_default = true
+		}
+	}
+	p.parseSpecConfig(d)
+}
+
+// setImpliedDefault uses the first value as the default when none is declared,
+// as the frontend does
+func (p *ComboProperty) setImpliedDefault() {
+	if !p.has_default && len(p.Values) > 0 {
+		p.Default = p.Values[0]
+		p.has_default = true
+	}
+	if p.has_default {
+		if p.IsBool {
+			p.default_value = strings.ToLower(p.Default) == "true"
+		} else {
+			p.default_value = p.Default
+		}
+	}
+}
+
 func (p *ComboProperty) TypeString() string {
 	return "COMBO"
 }
@@ -897,7 +1076,16 @@ func NewPropertyFromInput(input_name string, optional bool, input *interface{},
 		// the first item is either an array of strings (a combo), or the property type
 		if ptype, ok := slice[0].([]interface{}); ok {
 			if !isCascadingProperty(ptype) {
-				return newComboProperty(input_name, optional, ptype, index)
+				np := newComboProperty(input_name, optional, ptype, index)
+				// the config dictionary follows the list of values, e.g. [["a", "b"], {"default": "b"}]
+				if len(slice) > 1 {
+					if d, ok := slice[1].(map[string]interface{}); ok {
+						c := (*np).(*ComboProperty)
+						c.parseComboConfig(d)
+						c.setImpliedDefault()
+					}
+				}
+				return np
 			} else {
 				return newCascadeProperty(input_name, optional, ptype, index)
 			}
@@ -0,0 +1,134 @@
+package graphapi
+
+import (
+	"errors"
+	"testing"
+)
+
+func newTestProperty(t *testing.T, spec interface{}) Property {
+	p := NewPropertyFromInput("test", false, &spec, 0)
+	if p == nil {
+		t.Fatalf("Failed to create property from %v", spec)
+	}
+	return *p
+}
+
+// TestPropertyDefaults tests that declared and implied defaults are parsed
+func TestPropertyDefaults(t *testing.T) {
+	cases := []struct {
+		spec        interface{}
+		hasDefault  bool
+		defaultVal  interface{}
+		tooltip     string
+		description string
+	}{
+		{[]interface{}{"INT", map[string]interface{}{"default": float64(20), "min": float64(1), "max": float64(100), "tooltip": "steps"}}, true, int64(20), "steps", "int"},
+		{[]interface{}{"FLOAT", map[string]interface{}{"default": 7.5}}, true, 7.5, "", "float"},
+		{[]interface{}{"STRING", map[string]interface{}{"multiline": true}}, false, nil, "", "string without default"},
+		{[]interface{}{"BOOLEAN", map[string]interface{}{"default": true}}, true, true, "", "boolean"},
+		{[]interface{}{[]interface{}{"euler", "ddim"}, map[string]interface{}{"default": "ddim", "tooltip": "sampler"}}, true, "ddim", "sampler", "legacy combo"},
+		{[]interface{}{[]interface{}{"euler", "ddim"}}, true, "euler", "", "legacy combo without default"},
+		{[]interface{}{"COMBO", map[string]interface{}{"options": []interface{}{"a", "b"}, "default": "b"}}, true, "b", "", "combo"},
+	}
+
+	for _, c := range cases {
+		p := newTestProperty(t, c.spec)
+		if p.HasDefault() != c.hasDefault {
+			t.Errorf("%s: expected HasDefault %v", c.description, c.hasDefault)
+		}
+		if p.GetDefault() != c.defaultVal {
+			t.Errorf("%s: expected default %v, got %v", c.description, c.defaultVal, p.GetDefault())
+		}
+		if p.Tooltip() != c.tooltip {
+			t.Errorf("%s: expected tooltip %q, got %q", c.description, c.tooltip, p.Tooltip())
+		}
+	}
+
+	// a zero value is not the default of a property that declares none
+	p := newTestProperty(t, []interface{}{"INT", map[string]interface{}{"min": float64(0)}})
+	var zero interface{} = int64(0)
+	p.SetDirectValue(&zero)
+	if p.IsDefault() {
+		t.Errorf("Expected a property without a default not to be at its default")
+	}
+	if err := p.ResetToDefault(); err == nil {
+		t.Errorf("Expected an error resetting a property without a default")
+	}
+}
+
+// TestResetAllToDefaults tests resetting the widget values of a graph
+func TestResetAllToDefaults(t *testing.T) {
+	graph := newValueControlTestGraph(t, "increment")
+	node := graph.GetNodeById(1)
+	seed := node.GetPropertyWithName("noise_seed")
+
+	if seed.IsDefault() {
+		t.Error("Expected seed of 10 not to be the default")
+	}
+	if err := graph.ResetAllToDefaults(); err != nil {
+		t.Fatalf("Failed to reset: %v", err)
+	}
+	if !seed.IsDefault() {
+		t.Errorf("Expected seed to be reset to default, got %v", seed.GetValue())
+	}
+	// frontend-only widgets are left alone
+	if v := node.WidgetValuesArray()[1]; v != "increment" {
+		t.Errorf("Expected control_after_generate to be left alone, got %v", v)
+	}
+}
+
+// TestSetValueStrict tests strict validation and snapping of property values
+func TestSetValueStrict(t *testing.T) {
+	cases := []struct {
+		spec        interface{}
+		value       interface{}
+		expected    interface{}
+		err         error
+		description string
+	}{
+		{[]interface{}{"INT", map[string]interface{}{"min": float64(0), "max": float64(100)}}, float64(42), int64(42), nil, "int"},
+		{[]interface{}{"INT", map[string]interface{}{"min": float64(0), "max": float64(100)}}, float64(101), nil, ErrOutOfRange, "int out of range"},
+		{[]interface{}{"INT", map[string]interface{}{"min": float64(0), "max": float64(100)}}, "fifty", nil, ErrBadType, "int bad type"},
+		{[]interface{}{"INT", map[string]interface{}{"min": float64(64), "max": float64(2048), "step": float64(8)}}, float64(515), int64(512), nil, "int snapped to step"},
+		{[]interface{}{"FLOAT", map[string]interface{}{"min": float64(0), "max": float64(10), "step": 0.01}}, 7.456, 7.46, nil, "float rounded to step"},
+		{[]interface{}{"FLOAT", map[string]interface{}{"min": float64(0), "max": float64(1), "round": false}}, 0.123456, 0.123456, nil, "float without rounding"},
+		{[]interface{}{"FLOAT", map[string]interface{}{"min": float64(0), "max": float64(1)}}, float64(2), nil, ErrOutOfRange, "float out of range"},
+		{[]interface{}{"STRING", map[string]interface{}{}}, float64(3), nil, ErrBadType, "string bad type"},
+		{[]interface{}{"BOOLEAN", map[string]interface{}{}}, "true", true, nil, "boolean from string"},
+		{[]interface{}{[]interface{}{"euler", "ddim"}}, "ddim", "ddim", nil, "combo"},
+		{[]interface{}{[]interface{}{"euler", "ddim"}}, "dpm", nil, ErrNotInCombo, "combo not in values"},
+	}
+
+	for _, c := range cases {
+		p := newTestProperty(t, c.spec)
+		values := []interface{}{nil}
+		node := &GraphNode{WidgetValues: values}
+		p.SetTargetWidget(node, 0)
+
+		err := p.SetValueStrict(c.value)
+		if c.err != nil {
+			var propErr *PropertyError
+			if !errors.Is(err, c.err) || !errors.As(err, &propErr) {
+				t.Errorf("%s: expected %v, got %v", c.description, c.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", c.description, err)
+			continue
+		}
+		if v := p.GetValue(); v != c.expected {
+			t.Errorf("%s: expected %v (%T), got %v (%T)", c.description, c.expected, c.expected, v, v)
+		}
+	}
+
+	// lenient setting still clamps
+	p := newTestProperty(t, []interface{}{"INT", map[string]interface{}{"min": float64(0), "max": float64(100)}})
+	p.SetTargetWidget(&GraphNode{WidgetValues: []interface{}{nil}}, 0)
+	if err := p.SetValue(float64(500)); err != nil {
+		t.Errorf("Expected lenient SetValue to succeed, got %v", err)
+	}
+	if v := p.GetValue(); v != int64(100) {
+		t.Errorf("Expected lenient SetValue to clamp to 100, got %v", v)
+	}
+}
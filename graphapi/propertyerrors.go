@@ -0,0 +1,246 @@
+package graphapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// errors returned when setting property values.  These are wrapped in a
+// *PropertyError, use errors.Is to test for them.
+var (
+	ErrOutOfRange = errors.New("value out of range")
+	ErrNotInCombo = errors.New("value is not one of the combo's values")
+	ErrBadType    = errors.New("value has the wrong type")
+)
+
+// PropertyError describes a value that could not be set on a property, along
+// with the range or choices that are allowed
+type PropertyError struct {
+	Property string
+	Type     string
+	Value    interface{}
+	Min      interface{} // for ErrOutOfRange
+	Max      interface{} // for ErrOutOfRange
+	Choices  []string    // for ErrNotInCombo
+	Err      error
+}
+
+func newPropertyError(p Property, v interface{}, err error) *PropertyError {
+	return &PropertyError{Property: p.Name(), Type: p.TypeString(), Value: v, Err: err}
+}
+
+func (e *PropertyError) Error() string {
+	switch e.Err {
+	case ErrOutOfRange:
+		return fmt.Sprintf("property %s: %v is out of range [%v, %v]", e.Property, e.Value, e.Min, e.Max)
+	case ErrNotInCombo:
+		return fmt.Sprintf("property %s: %q is not one of [%s]", e.Property, fmt.Sprint(e.Value), strings.Join(e.Choices, ", "))
+	}
+	return fmt.Sprintf("property %s: %v (%T) cannot be set on a %s property", e.Property, e.Value, e.Value, e.Type)
+}
+
+func (e *PropertyError) Unwrap() error {
+	return e.Err
+}
+
+// SetValueStrict sets the property's value without any lenient conversion.
+// Values that are out of range or not one of a combo's values are rejected with
+// a *PropertyError rather than being clamped, and numeric values are snapped to
+// the property's step and rounding the way the frontend widgets do.
+func (b *BaseProperty) SetValueStrict(v interface{}) error {
+	val, err := b.parent.strictValue(v)
+	if err != nil {
+		return err
+	}
+	return b.setConvertedValue(val)
+}
+
+// strictNumber converts numeric values, and strings holding numbers, to a float64
+func strictNumber(v interface{}) (float64, bool) {
+	if f, ok := toFloat64(v); ok {
+		return f, true
+	}
+	if s, ok := v.(string); ok {
+		f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func (p *IntProperty) strictValue(v interface{}) (interface{}, error) {
+	var iv int64
+	switch val := v.(type) {
+	case int64:
+		iv = val
+	case int:
+		iv = int64(val)
+	case json.Number:
+		i, err := val.Int64()
+		if err != nil {
+			f, ferr := val.Float64()
+			if ferr != nil {
+				return nil, newPropertyError(p, v, ErrBadType)
+			}
+			iv = int64(math.Round(f))
+		} else {
+			iv = i
+		}
+	default:
+		f, ok := strictNumber(v)
+		if !ok || math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil, newPropertyError(p, v, ErrBadType)
+		}
+		if f >= float64(math.MaxInt64) || f < float64(math.MinInt64) {
+			return nil, p.rangeError(v)
+		}
+		iv = int64(math.Round(f))
+	}
+
+	if p.hasRange && (iv < p.Min || iv > p.Max) {
+		return nil, p.rangeError(v)
+	}
+
+	// snap to the rounding, or to the step from the minimum
+	if p.Round > 1 {
+		iv = int64(math.Round(float64(iv)/float64(p.Round))) * p.Round
+	} else if p.hasStep && p.Step > 1 {
+		base := int64(0)
+		if p.hasRange {
+			base = p.Min
+		}
+		iv = base + int64(math.Round(float64(iv-base)/float64(p.Step)))*p.Step
+	}
+	if p.hasRange {
+		if iv > p.Max {
+			iv = p.Max
+		}
+		if iv < p.Min {
+			iv = p.Min
+		}
+	}
+	return iv, nil
+}
+
+func (p *IntProperty) rangeError(v interface{}) *PropertyError {
+	e := newPropertyError(p, v, ErrOutOfRange)
+	e.Min = p.Min
+	e.Max = p.Max
+	return e
+}
+
+func (p *FloatProperty) strictValue(v interface{}) (interface{}, error) {
+	f, ok := strictNumber(v)
+	if !ok || math.IsNaN(f) || math.IsInf(f, 0) {
+		return nil, newPropertyError(p, v, ErrBadType)
+	}
+
+	if p.hasRange && (f < p.Min || f > p.Max) {
+		e := newPropertyError(p, v, ErrOutOfRange)
+		e.Min = p.Min
+		e.Max = p.Max
+		return nil, e
+	}
+
+	if p.Round > 0 {
+		f = math.Round((f+math.SmallestNonzeroFloat64)/p.Round) * p.Round
+		// remove the noise left over from the division, e.g. 0.30000000000000004
+		if precision := roundPrecision(p.Round); precision >= 0 {
+			f, _ = strconv.ParseFloat(strconv.FormatFloat(f, 'f', precision, 64), 64)
+		}
+		if p.hasRange {
+			f = math.Min(f, p.Max)
+			f = math.Max(f, p.Min)
+		}
+	}
+	return f, nil
+}
+
+// floatRoundFromStep returns the rounding the frontend uses for a FLOAT widget
+// that does not declare one: the precision of its step, which defaults to 0.5
+func floatRoundFromStep(step float64, hasStep bool) float64 {
+	if !hasStep || step <= 0 {
+		step = 0.5
+	}
+	precision := math.Max(-math.Floor(math.Log10(step)), 0)
+	return math.Round(1000000*math.Pow(0.1, precision)) / 1000000
+}
+
+// roundPrecision returns the number of decimal places in the rounding value
+func roundPrecision(round float64) int {
+	s := strconv.FormatFloat(round, 'f', -1, 64)
+	if i := strings.IndexByte(s, '.'); i != -1 {
+		return len(s) - i - 1
+	}
+	return 0
+}
+
+func (p *StringProperty) strictValue(v interface{}) (interface{}, error) {
+	s, ok := v.(string)
+	if !ok {
+		return nil, newPropertyError(p, v, ErrBadType)
+	}
+	return s, nil
+}
+
+func (p *BoolProperty) strictValue(v interface{}) (interface{}, error) {
+	switch val := v.(type) {
+	case bool:
+		return val, nil
+	case string:
+		if b, err := strconv.ParseBool(val); err == nil {
+			return b, nil
+		}
+	}
+	return nil, newPropertyError(p, v, ErrBadType)
+}
+
+func (p *ComboProperty) strictValue(v interface{}) (interface{}, error) {
+	if p.IsBool {
+		switch val := v.(type) {
+		case bool:
+			return val, nil
+		case string:
+			if b, err := strconv.ParseBool(val); err == nil {
+				return b, nil
+			}
+		}
+		return nil, newPropertyError(p, v, ErrBadType)
+	}
+
+	var s string
+	switch val := v.(type) {
+	case string:
+		s = val
+	case float64:
+		s = strconv.FormatFloat(val, 'f', -1, 64)
+	case int, int64, json.Number:
+		s = fmt.Sprint(val)
+	default:
+		return nil, newPropertyError(p, v, ErrBadType)
+	}
+
+	for _, c := range p.Values {
+		if c == s {
+			return s, nil
+		}
+	}
+	e := newPropertyError(p, v, ErrNotInCombo)
+	e.Choices = p.Values
+	return nil, e
+}
+
+func (p *CascadingProperty) strictValue(v interface{}) (interface{}, error) {
+	return nil, newPropertyError(p, v, ErrBadType)
+}
+
+func (p *ImageUploadProperty) strictValue(v interface{}) (interface{}, error) {
+	return nil, newPropertyError(p, v, ErrBadType)
+}
+
+func (p *UnknownProperty) strictValue(v interface{}) (interface{}, error) {
+	return nil, newPropertyError(p, v, ErrBadType)
+}
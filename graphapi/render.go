@@ -0,0 +1,580 @@
+package graphapi
+
+import (
+	"fmt"
+	"html"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// link colors of the frontend's default palette
+var linkColors = map[string]string{
+	"CLIP":         "#FFD500",
+	"CLIP_VISION":  "#A8DADC",
+	"CONDITIONING": "#FFA931",
+	"CONTROL_NET":  "#00D78D",
+	"IMAGE":        "#64B5F6",
+	"LATENT":       "#FF9CF9",
+	"MASK":         "#81C784",
+	"MODEL":        "#B39DDB",
+	"VAE":          "#FF6E6E",
+	"INT":          "#29699C",
+	"FLOAT":        "#AEA04F",
+	"STRING":       "#77AE4F",
+}
+
+const (
+	defaultLinkColor  = "#9A9"
+	defaultGroupColor = "#3f789e"
+	defaultNodeColor  = "#353535"
+	defaultTitleColor = "#222"
+	svgTitleHeight    = 30
+	svgSlotHeight     = 20
+	svgMargin         = 40
+)
+
+func linkColor(linkType string) string {
+	if c, ok := linkColors[linkType]; ok {
+		return c
+	}
+	return defaultLinkColor
+}
+
+// renderView is the part of a graph, or of a subgraph definition, that is drawn
+type renderView struct {
+	nodes    []*GraphNode
+	links    []*Link
+	groups   []*Group
+	reroutes []*Reroute
+	chain    func(l *Link) []*Reroute
+	subgraph *SubgraphDefinition // the definition drawn, for its input and output nodes
+}
+
+func (t *Graph) renderView() *renderView {
+	return &renderView{nodes: t.Nodes, links: t.Links, groups: t.Groups, reroutes: t.Reroutes, chain: t.GetLinkReroutes}
+}
+
+func (sg *SubgraphDefinition) renderView() *renderView {
+	return &renderView{nodes: sg.Nodes, links: sg.Links, groups: sg.Groups, reroutes: sg.Reroutes, chain: sg.GetLinkReroutes, subgraph: sg}
+}
+
+// renderIONode is the input or output node of a subgraph definition in DOT and Mermaid
+type renderIONode struct {
+	id    int
+	label string
+}
+
+// ioNodes returns the input and output nodes of the subgraph definition that have ports,
+// labeled with the names of their ports
+func (v *renderView) ioNodes() []renderIONode {
+	retv := make([]renderIONode, 0, 2)
+	for _, io := range []struct {
+		id    int
+		label string
+		ports []SubgraphPort
+	}{
+		{subgraphInputNodeID, "Inputs", v.subgraph.Inputs},
+		{subgraphOutputNodeID, "Outputs", v.subgraph.Outputs},
+	} {
+		if len(io.ports) == 0 {
+			continue
+		}
+		label := io.label
+		for _, port := range io.ports {
+			label += "\n" + port.Name
+		}
+		retv = append(retv, renderIONode{id: io.id, label: label})
+	}
+	return retv
+}
+
+// nodeKind returns the second line of a node's label in DOT and Mermaid, or ""
+func nodeKind(n *GraphNode) string {
+	if n.IsSubgraph && n.SubgraphDef != nil {
+		if nodeTitle(n) != n.SubgraphDef.Name {
+			return "subgraph " + n.SubgraphDef.Name
+		}
+		return "subgraph"
+	}
+	if label := nodeTitle(n); label != n.Type {
+		return n.Type
+	}
+	return ""
+}
+
+// nodeGroups returns the group each node is drawn in, the smallest that holds the centre
+// of the node, or nil
+func (v *renderView) nodeGroups() map[*GraphNode]*Group {
+	retv := make(map[*GraphNode]*Group)
+	for _, n := range v.nodes {
+		x, y, ok := nodePosition(n)
+		if !ok {
+			continue
+		}
+		cx := x + n.Size.Width/2
+		cy := y + n.Size.Height/2
+		for _, g := range v.groups {
+			if len(g.Bounding) != 4 {
+				continue
+			}
+			b := g.Bounding
+			if cx < b[0] || cx > b[0]+b[2] || cy < b[1] || cy > b[1]+b[3] {
+				continue
+			}
+			if current, ok := retv[n]; !ok || b[2]*b[3] < current.Bounding[2]*current.Bounding[3] {
+				retv[n] = g
+			}
+		}
+	}
+	return retv
+}
+
+// renderNodeID returns the id of a node in DOT and Mermaid, where the input and output
+// nodes of a subgraph definition are "inputs" and "outputs"
+func renderNodeID(id int) string {
+	switch id {
+	case subgraphInputNodeID:
+		return "inputs"
+	case subgraphOutputNodeID:
+		return "outputs"
+	}
+	return fmt.Sprintf("n%d", id)
+}
+
+func dotQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return `"` + strings.ReplaceAll(s, "\n", `\n`) + `"`
+}
+
+// ToDOT returns the graph in Graphviz's DOT language.  Groups are clusters, links are
+// labeled with their types, muted nodes are dashed and bypassed nodes are purple.
+// Subgraph instances are single nodes.
+func (t *Graph) ToDOT() string {
+	return t.renderView().toDOT("workflow")
+}
+
+// ToDOT returns the subgraph definition in Graphviz's DOT language, as Graph.ToDOT does,
+// with its input and output nodes
+func (sg *SubgraphDefinition) ToDOT() string {
+	return sg.renderView().toDOT(dotQuote(sg.Name))
+}
+
+func (v *renderView) toDOT(name string) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "digraph %s {\n", name)
+	sb.WriteString("\trankdir=LR;\n")
+	sb.WriteString("\tnode [shape=box, style=rounded];\n")
+
+	writeNode := func(indent string, n *GraphNode) {
+		label := nodeTitle(n)
+		if kind := nodeKind(n); kind != "" {
+			label += "\n" + kind
+		}
+		attrs := []string{"label=" + dotQuote(label)}
+		if n.IsSubgraph {
+			attrs = append(attrs, "shape=box3d")
+		}
+		switch n.Mode {
+		case 2:
+			attrs = append(attrs, `style="rounded,dashed"`, `fontcolor="#808080"`, `color="#808080"`)
+		case 4:
+			attrs = append(attrs, `style="rounded,filled"`, `fillcolor="#E6B3E6"`)
+		}
+		fmt.Fprintf(&sb, "%sn%d [%s];\n", indent, n.ID, strings.Join(attrs, ", "))
+	}
+
+	groups := v.nodeGroups()
+	for i, g := range v.groups {
+		color := g.Color
+		if color == "" {
+			color = defaultGroupColor
+		}
+		fmt.Fprintf(&sb, "\tsubgraph cluster_%d {\n", i)
+		fmt.Fprintf(&sb, "\t\tlabel=%s;\n\t\tcolor=%s;\n", dotQuote(g.Title), dotQuote(color))
+		for _, n := range v.nodes {
+			if groups[n] == g {
+				writeNode("\t\t", n)
+			}
+		}
+		sb.WriteString("\t}\n")
+	}
+	for _, n := range v.nodes {
+		if groups[n] == nil {
+			writeNode("\t", n)
+		}
+	}
+	if v.subgraph != nil {
+		for _, io := range v.ioNodes() {
+			fmt.Fprintf(&sb, "\t%s [label=%s, style=\"rounded,dashed\", color=\"#6B8FD6\"];\n", renderNodeID(io.id), dotQuote(io.label))
+		}
+	}
+	for _, l := range v.links {
+		fmt.Fprintf(&sb, "\t%s -> %s [label=%s, color=%s];\n", renderNodeID(l.OriginID), renderNodeID(l.TargetID), dotQuote(l.Type), dotQuote(linkColor(l.Type)))
+	}
+	sb.WriteString("}\n")
+	return sb.String()
+}
+
+func mermaidQuote(s string) string {
+	s = strings.ReplaceAll(s, `"`, "#quot;")
+	return `"` + strings.ReplaceAll(s, "\n", "<br/>") + `"`
+}
+
+// ToMermaid returns the graph as a Mermaid flowchart.  Groups are subgraphs of the
+// flowchart, links are labeled with their types, and muted and bypassed nodes have the
+// classes "muted" and "bypassed".  Subgraph instances are single nodes.
+func (t *Graph) ToMermaid() string {
+	return t.renderView().toMermaid()
+}
+
+// ToMermaid returns the subgraph definition as a Mermaid flowchart, as Graph.ToMermaid
+// does, with its input and output nodes
+func (sg *SubgraphDefinition) ToMermaid() string {
+	return sg.renderView().toMermaid()
+}
+
+func (v *renderView) toMermaid() string {
+	var sb strings.Builder
+	sb.WriteString("flowchart LR\n")
+
+	writeNode := func(indent string, n *GraphNode) {
+		label := nodeTitle(n)
+		if kind := nodeKind(n); kind != "" {
+			label += "\n" + kind
+		}
+		if n.IsSubgraph {
+			fmt.Fprintf(&sb, "%sn%d[[%s]]\n", indent, n.ID, mermaidQuote(label))
+		} else {
+			fmt.Fprintf(&sb, "%sn%d[%s]\n", indent, n.ID, mermaidQuote(label))
+		}
+	}
+
+	groups := v.nodeGroups()
+	for i, g := range v.groups {
+		fmt.Fprintf(&sb, "\tsubgraph g%d[%s]\n", i, mermaidQuote(g.Title))
+		for _, n := range v.nodes {
+			if groups[n] == g {
+				writeNode("\t\t", n)
+			}
+		}
+		sb.WriteString("\tend\n")
+	}
+	for _, n := range v.nodes {
+		if groups[n] == nil {
+			writeNode("\t", n)
+		}
+	}
+	if v.subgraph != nil {
+		for _, io := range v.ioNodes() {
+			fmt.Fprintf(&sb, "\t%s([%s])\n", renderNodeID(io.id), mermaidQuote(io.label))
+		}
+	}
+	for _, l := range v.links {
+		fmt.Fprintf(&sb, "\t%s -->|%s| %s\n", renderNodeID(l.OriginID), mermaidQuote(l.Type), renderNodeID(l.TargetID))
+	}
+
+	var muted, bypassed []string
+	for _, n := range v.nodes {
+		switch n.Mode {
+		case 2:
+			muted = append(muted, fmt.Sprintf("n%d", n.ID))
+		case 4:
+			bypassed = append(bypassed, fmt.Sprintf("n%d", n.ID))
+		}
+	}
+	if len(muted) > 0 {
+		sb.WriteString("\tclassDef muted stroke-dasharray: 5 5, opacity: 0.5\n")
+		fmt.Fprintf(&sb, "\tclass %s muted\n", strings.Join(muted, ","))
+	}
+	if len(bypassed) > 0 {
+		sb.WriteString("\tclassDef bypassed fill: #E6B3E6\n")
+		fmt.Fprintf(&sb, "\tclass %s bypassed\n", strings.Join(bypassed, ","))
+	}
+	return sb.String()
+}
+
+// SVGOptions changes how RenderSVG draws a graph
+type SVGOptions struct {
+	// Subgraphs draws each subgraph definition below the graph, subgraph instances are
+	// always drawn as single nodes
+	Subgraphs bool
+}
+
+// RenderSVG draws the graph as a standalone SVG image, with its nodes at their positions
+// and sizes, its groups, and its links colored by type through their reroutes
+func (t *Graph) RenderSVG(options *SVGOptions) string {
+	panels := []*svgPanel{t.renderView().draw("")}
+	if options != nil && options.Subgraphs && t.Definitions != nil {
+		for _, sg := range t.Definitions.Subgraphs {
+			panels = append(panels, sg.renderView().draw("Subgraph: "+sg.Name))
+		}
+	}
+	return writeSVG(panels)
+}
+
+// RenderSVG draws the subgraph definition as a standalone SVG image, with its input and
+// output nodes
+func (sg *SubgraphDefinition) RenderSVG() string {
+	return writeSVG([]*svgPanel{sg.renderView().draw("")})
+}
+
+// svgPanel is a drawn view, with the bounds of what was drawn
+type svgPanel struct {
+	content                strings.Builder
+	minX, minY, maxX, maxY float64
+}
+
+func (p *svgPanel) extend(x, y, w, h float64) {
+	p.minX = math.Min(p.minX, x)
+	p.minY = math.Min(p.minY, y)
+	p.maxX = math.Max(p.maxX, x+w)
+	p.maxY = math.Max(p.maxY, y+h)
+}
+
+func num(v float64) string {
+	return strconv.FormatFloat(math.Round(v*100)/100, 'f', -1, 64)
+}
+
+func svgText(s string) string {
+	return html.EscapeString(s)
+}
+
+// writeSVG stacks the panels in one image
+func writeSVG(panels []*svgPanel) string {
+	width := 0.0
+	height := 0.0
+	for _, p := range panels {
+		width = math.Max(width, p.maxX-p.minX+2*svgMargin)
+		height += p.maxY - p.minY + 2*svgMargin
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, `<svg xmlns="http://www.w3.org/2000/svg" width="%s" height="%s" viewBox="0 0 %s %s" font-family="sans-serif">`+"\n",
+		num(width), num(height), num(width), num(height))
+	fmt.Fprintf(&sb, `<rect width="100%%" height="100%%" fill="#202020"/>`+"\n")
+	y := 0.0
+	for _, p := range panels {
+		fmt.Fprintf(&sb, `<g transform="translate(%s %s)">`+"\n", num(svgMargin-p.minX), num(y+svgMargin-p.minY))
+		sb.WriteString(p.content.String())
+		sb.WriteString("</g>\n")
+		y += p.maxY - p.minY + 2*svgMargin
+	}
+	sb.WriteString("</svg>\n")
+	return sb.String()
+}
+
+// draw draws the view, under a heading when one is given
+func (v *renderView) draw(heading string) *svgPanel {
+	p := &svgPanel{minX: math.Inf(1), minY: math.Inf(1), maxX: math.Inf(-1), maxY: math.Inf(-1)}
+	var body strings.Builder
+	w := &body
+
+	for _, g := range v.groups {
+		if len(g.Bounding) != 4 {
+			continue
+		}
+		b := g.Bounding
+		color := g.Color
+		if color == "" {
+			color = defaultGroupColor
+		}
+		p.extend(b[0], b[1], b[2], b[3])
+		fmt.Fprintf(w, `<g class="group"><rect x="%s" y="%s" width="%s" height="%s" fill="%s" fill-opacity="0.25" stroke="%s"/>`,
+			num(b[0]), num(b[1]), num(b[2]), num(b[3]), color, color)
+		fmt.Fprintf(w, `<text x="%s" y="%s" font-size="24" fill="#ccc">%s</text></g>`+"\n", num(b[0]+10), num(b[1]+26), svgText(g.Title))
+	}
+
+	// the points links are drawn from and to
+	outputs := make(map[[2]int][2]float64)
+	inputs := make(map[[2]int][2]float64)
+	var nodes strings.Builder
+	for _, n := range v.nodes {
+		v.drawNode(&nodes, p, n, inputs, outputs)
+	}
+	if v.subgraph != nil {
+		v.drawPorts(&nodes, p, v.subgraph.InputNode, v.subgraph.Inputs, outputs, true)
+		v.drawPorts(&nodes, p, v.subgraph.OutputNode, v.subgraph.Outputs, inputs, false)
+	}
+
+	for _, l := range v.links {
+		from, ok := outputs[[2]int{l.OriginID, l.OriginSlot}]
+		if !ok {
+			continue
+		}
+		to, ok := inputs[[2]int{l.TargetID, l.TargetSlot}]
+		if !ok {
+			continue
+		}
+		points := [][2]float64{from}
+		for _, r := range v.chain(l) {
+			if len(r.Pos) == 2 {
+				points = append(points, [2]float64{r.Pos[0], r.Pos[1]})
+			}
+		}
+		points = append(points, to)
+
+		var d strings.Builder
+		fmt.Fprintf(&d, "M%s %s", num(from[0]), num(from[1]))
+		for i := 1; i < len(points); i++ {
+			a, b := points[i-1], points[i]
+			dist := math.Max(math.Hypot(b[0]-a[0], b[1]-a[1])*0.25, 20)
+			fmt.Fprintf(&d, " C%s %s %s %s %s %s", num(a[0]+dist), num(a[1]), num(b[0]-dist), num(b[1]), num(b[0]), num(b[1]))
+		}
+		fmt.Fprintf(w, `<path class="link" d="%s" fill="none" stroke="%s" stroke-width="3"><title>%s</title></path>`+"\n",
+			d.String(), linkColor(l.Type), svgText(l.Type))
+	}
+	for _, r := range v.reroutes {
+		if len(r.Pos) != 2 {
+			continue
+		}
+		p.extend(r.Pos[0]-5, r.Pos[1]-5, 10, 10)
+		fmt.Fprintf(w, `<circle class="reroute" cx="%s" cy="%s" r="5" fill="#ccc"/>`+"\n", num(r.Pos[0]), num(r.Pos[1]))
+	}
+	w.WriteString(nodes.String())
+
+	if math.IsInf(p.minX, 1) {
+		p.minX, p.minY, p.maxX, p.maxY = 0, 0, 0, 0
+	}
+	if heading != "" {
+		p.minY -= 50
+		fmt.Fprintf(&p.content, `<text x="%s" y="%s" font-size="28" fill="#fff">%s</text>`+"\n", num(p.minX), num(p.minY+30), svgText(heading))
+	}
+	p.content.WriteString(body.String())
+	return p
+}
+
+// drawNode draws a node with its title above its position, as the frontend does, and
+// records where its slots are.  Collapsed nodes are drawn as their title.
+func (v *renderView) drawNode(w *strings.Builder, p *svgPanel, n *GraphNode, inputs, outputs map[[2]int][2]float64) {
+	x, y, ok := nodePosition(n)
+	if !ok {
+		return
+	}
+	title := nodeTitle(n)
+	width, height := n.Size.Width, n.Size.Height
+	collapsed := false
+	if n.Flags != nil {
+		if flags, ok := (*n.Flags).(map[string]interface{}); ok {
+			collapsed, _ = flags["collapsed"].(bool)
+		}
+	}
+	if collapsed {
+		width, height = math.Max(80, float64(len(title))*8+40), 0
+	}
+	p.extend(x, y-svgTitleHeight, width, height+svgTitleHeight)
+
+	class := "node"
+	attrs := ""
+	switch n.Mode {
+	case 2:
+		class += " muted"
+		attrs = ` opacity="0.4"`
+	case 4:
+		class += " bypassed"
+	}
+	if n.IsSubgraph {
+		class += " subgraph"
+	}
+	bg := n.BGColor
+	if bg == "" {
+		bg = defaultNodeColor
+	}
+	color := n.Color
+	if color == "" {
+		color = defaultTitleColor
+	}
+
+	fmt.Fprintf(w, `<g class="%s" data-node="%d"%s>`, class, n.ID, attrs)
+	fmt.Fprintf(w, `<title>%s</title>`, svgText(fmt.Sprintf("#%d %s", n.ID, n.Type)))
+	fmt.Fprintf(w, `<rect x="%s" y="%s" width="%s" height="%s" rx="8" fill="%s" stroke="#000"/>`,
+		num(x), num(y-svgTitleHeight), num(width), num(height+svgTitleHeight), bg)
+	fmt.Fprintf(w, `<rect x="%s" y="%s" width="%s" height="%s" rx="8" fill="%s"/>`,
+		num(x), num(y-svgTitleHeight), num(width), num(svgTitleHeight), color)
+	if n.IsSubgraph {
+		// a second border marks the instance of a subgraph, drawn as a single node
+		fmt.Fprintf(w, `<rect x="%s" y="%s" width="%s" height="%s" rx="10" fill="none" stroke="#6B8FD6" stroke-width="2"/>`,
+			num(x-3), num(y-svgTitleHeight-3), num(width+6), num(height+svgTitleHeight+6))
+	}
+	if n.Mode == 4 {
+		fmt.Fprintf(w, `<rect x="%s" y="%s" width="%s" height="%s" rx="8" fill="#FF00FF" fill-opacity="0.25"/>`,
+			num(x), num(y-svgTitleHeight), num(width), num(height+svgTitleHeight))
+	}
+	fmt.Fprintf(w, `<text x="%s" y="%s" font-size="14" fill="#ddd">%s</text>`, num(x+10), num(y-10), svgText(title))
+
+	// widget inputs are drawn below the other slots, where the widgets are
+	row := 0
+	for i, s := range n.Inputs {
+		if s.Widget == nil {
+			v.drawSlot(w, n, i, s, row, x, y, width, collapsed, inputs, true)
+			row++
+		}
+	}
+	row = max(row, len(n.Outputs))
+	for i, s := range n.Inputs {
+		if s.Widget != nil {
+			v.drawSlot(w, n, i, s, row, x, y, width, collapsed, inputs, true)
+			row++
+		}
+	}
+	for i, s := range n.Outputs {
+		v.drawSlot(w, n, i, s, i, x, y, width, collapsed, outputs, false)
+	}
+	w.WriteString("</g>\n")
+}
+
+func (v *renderView) drawSlot(w *strings.Builder, n *GraphNode, index int, s Slot, row int, x, y, width float64, collapsed bool, points map[[2]int][2]float64, input bool) {
+	px := x + svgSlotHeight/2
+	if !input {
+		px = x + width - svgSlotHeight/2
+	}
+	py := y + (float64(row)+0.7)*svgSlotHeight
+	if collapsed {
+		py = y - svgTitleHeight/2
+		if input {
+			px = x
+		} else {
+			px = x + width
+		}
+	}
+	points[[2]int{n.ID, index}] = [2]float64{px, py}
+	if collapsed || (input && s.Widget != nil && s.Link == 0) {
+		return
+	}
+	fmt.Fprintf(w, `<circle cx="%s" cy="%s" r="4" fill="%s"/>`, num(px), num(py), linkColor(s.Type))
+	if input {
+		fmt.Fprintf(w, `<text x="%s" y="%s" font-size="12" fill="#aaa">%s</text>`, num(px+8), num(py+4), svgText(s.Name))
+	} else {
+		fmt.Fprintf(w, `<text x="%s" y="%s" font-size="12" fill="#aaa" text-anchor="end">%s</text>`, num(px-8), num(py+4), svgText(s.Name))
+	}
+}
+
+// drawPorts draws the input or output node of a subgraph, and records where its ports are
+func (v *renderView) drawPorts(w *strings.Builder, p *svgPanel, io SubgraphIONode, ports []SubgraphPort, points map[[2]int][2]float64, input bool) {
+	if len(io.Bounding) != 4 {
+		return
+	}
+	b := io.Bounding
+	p.extend(b[0], b[1], b[2], b[3])
+	fmt.Fprintf(w, `<g class="subgraph-io"><rect x="%s" y="%s" width="%s" height="%s" rx="8" fill="none" stroke="#6B8FD6" stroke-dasharray="6 4"/>`,
+		num(b[0]), num(b[1]), num(b[2]), num(b[3]))
+	for i, port := range ports {
+		var px, py float64
+		if len(port.Pos) == 2 {
+			px, py = port.Pos[0], port.Pos[1]
+		} else if input {
+			px, py = b[0]+b[2]-svgSlotHeight/2, b[1]+(float64(i)+1)*svgSlotHeight
+		} else {
+			px, py = b[0]+svgSlotHeight/2, b[1]+(float64(i)+1)*svgSlotHeight
+		}
+		points[[2]int{io.ID, i}] = [2]float64{px, py}
+		fmt.Fprintf(w, `<circle cx="%s" cy="%s" r="4" fill="%s"/>`, num(px), num(py), linkColor(port.Type))
+		if input {
+			fmt.Fprintf(w, `<text x="%s" y="%s" font-size="12" fill="#aaa" text-anchor="end">%s</text>`, num(px-8), num(py+4), svgText(port.Name))
+		} else {
+			fmt.Fprintf(w, `<text x="%s" y="%s" font-size="12" fill="#aaa">%s</text>`, num(px+8), num(py+4), svgText(port.Name))
+		}
+	}
+	w.WriteString("</g>\n")
+}
@@ -0,0 +1,162 @@
+package graphapi
+
+import (
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+)
+
+// checkSVG tests that an image is well formed, and returns the number of elements with each class
+func checkSVG(t *testing.T, svg string) map[string]int {
+	retv := make(map[string]int)
+	dec := xml.NewDecoder(strings.NewReader(svg))
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Malformed SVG: %v", err)
+		}
+		if e, ok := tok.(xml.StartElement); ok {
+			for _, a := range e.Attr {
+				if a.Name.Local == "class" {
+					for _, c := range strings.Fields(a.Value) {
+						retv[c]++
+					}
+				}
+			}
+		}
+	}
+	return retv
+}
+
+// TestToDOTAndMermaid tests the DOT and Mermaid of a graph with muted and bypassed subgraphs
+func TestToDOTAndMermaid(t *testing.T) {
+	graph := readGraph(t, "../examples/testdata/subgraphs/mute-bypass.json")
+
+	dot := graph.ToDOT()
+	for _, want := range []string{
+		"digraph workflow {",
+		`n10 [label="Refine\nsubgraph", shape=box3d];`,
+		`n13 [label="Invert\nsubgraph", shape=box3d, style="rounded,filled", fillcolor="#E6B3E6"];`,
+		`n14 [label="Invert\nsubgraph", shape=box3d, style="rounded,dashed"`,
+		`n1 -> n10 [label="MODEL", color="#B39DDB"];`,
+	} {
+		if !strings.Contains(dot, want) {
+			t.Errorf("Expected %s in DOT:\n%s", want, dot)
+		}
+	}
+
+	mermaid := graph.ToMermaid()
+	for _, want := range []string{
+		"flowchart LR",
+		`n10[["Refine<br/>subgraph"]]`,
+		`n11 -->|"IMAGE"| n13`,
+		"class n14 muted",
+		"class n13 bypassed",
+	} {
+		if !strings.Contains(mermaid, want) {
+			t.Errorf("Expected %s in Mermaid:\n%s", want, mermaid)
+		}
+	}
+
+	// the nodes of subgraphs are not drawn in their instances
+	if strings.Contains(dot, "KSampler") || strings.Contains(mermaid, "KSampler") {
+		t.Errorf("Expected subgraph instances to be single nodes")
+	}
+}
+
+// TestSubgraphToDOTAndMermaid tests the DOT and Mermaid of a subgraph definition, with
+// its input and output nodes
+func TestSubgraphToDOTAndMermaid(t *testing.T) {
+	graph := readGraph(t, "../examples/testdata/subgraphs/mute-bypass.json")
+	sg := graph.Definitions.Subgraphs[0]
+
+	dot := sg.ToDOT()
+	for _, want := range []string{
+		`digraph "Refine" {`,
+		`inputs [label="Inputs\nmodel\npositive\nnegative\nlatent_image"`,
+		`outputs [label="Outputs\nLATENT"`,
+		`inputs -> n1 [label="MODEL", color="#B39DDB"];`,
+		`n2 -> outputs [label="LATENT", color="#FF9CF9"];`,
+		`n3 [label="KSampler", style="rounded,dashed"`,
+	} {
+		if !strings.Contains(dot, want) {
+			t.Errorf("Expected %s in DOT:\n%s", want, dot)
+		}
+	}
+	if strings.Contains(dot, "n-") {
+		t.Errorf("Expected the input and output nodes to have valid ids:\n%s", dot)
+	}
+
+	mermaid := sg.ToMermaid()
+	for _, want := range []string{
+		`inputs(["Inputs<br/>model<br/>positive<br/>negative<br/>latent_image"])`,
+		`n2 -->|"LATENT"| outputs`,
+		"class n3 muted",
+		"class n1 bypassed",
+	} {
+		if !strings.Contains(mermaid, want) {
+			t.Errorf("Expected %s in Mermaid:\n%s", want, mermaid)
+		}
+	}
+}
+
+// TestToDOTGroups tests that nodes within groups are drawn in clusters
+func TestToDOTGroups(t *testing.T) {
+	graph := readGraph(t, "../examples/testdata/wanvideo.json")
+	dot := graph.ToDOT()
+	cluster := dot[strings.Index(dot, "subgraph cluster_0"):]
+	cluster = cluster[:strings.Index(cluster, "\t}\n")]
+	if !strings.Contains(cluster, `label="Models";`) || strings.Count(cluster, "[label=") == 0 {
+		t.Errorf("Expected the nodes of the Models group in a cluster:\n%s", cluster)
+	}
+	if mermaid := graph.ToMermaid(); !strings.Contains(mermaid, `subgraph g0["Models"]`) {
+		t.Errorf("Expected the Models group in Mermaid")
+	}
+}
+
+// TestRenderSVG tests drawing graphs, their subgraphs and reroutes
+func TestRenderSVG(t *testing.T) {
+	graph := readGraph(t, "../examples/testdata/subgraphs/mute-bypass.json")
+
+	classes := checkSVG(t, graph.RenderSVG(nil))
+	if classes["node"] != len(graph.Nodes) || classes["subgraph"] != 3 || classes["muted"] != 1 || classes["bypassed"] != 1 {
+		t.Errorf("Expected %d nodes, 3 subgraph instances, one muted and one bypassed, got %v", len(graph.Nodes), classes)
+	}
+	if classes["link"] != len(graph.Links) {
+		t.Errorf("Expected %d links, got %d", len(graph.Links), classes["link"])
+	}
+
+	// each definition is drawn below the graph, with its input and output nodes
+	classes = checkSVG(t, graph.RenderSVG(&SVGOptions{Subgraphs: true}))
+	nodes, links := len(graph.Nodes), len(graph.Links)
+	for _, sg := range graph.Definitions.Subgraphs {
+		nodes += len(sg.Nodes)
+		links += len(sg.Links)
+	}
+	if classes["node"] != nodes || classes["link"] != links || classes["subgraph-io"] != 4 {
+		t.Errorf("Expected %d nodes, %d links and 4 input and output nodes, got %v", nodes, links, classes)
+	}
+	svg := graph.Definitions.Subgraphs[0].RenderSVG()
+	if classes := checkSVG(t, svg); classes["node"] != len(graph.Definitions.Subgraphs[0].Nodes) || !strings.Contains(svg, ">latent_image<") {
+		t.Errorf("Expected the Refine subgraph with its ports, got %v", classes)
+	}
+
+	// links are drawn through their reroutes
+	graph = readGraph(t, "../examples/testdata/reroutes.json")
+	svg = graph.RenderSVG(nil)
+	if classes := checkSVG(t, svg); classes["reroute"] != 4 {
+		t.Errorf("Expected 4 reroutes, got %v", classes)
+	}
+	if !strings.Contains(svg, " 400 50 C") || !strings.Contains(svg, " 900 50 C") {
+		t.Errorf("Expected link 1 to pass through reroutes 1 and 2")
+	}
+
+	graph = readGraph(t, "../examples/testdata/wanvideo.json")
+	if classes := checkSVG(t, graph.RenderSVG(nil)); classes["group"] != 1 {
+		t.Errorf("Expected the Models group, got %v", classes)
+	}
+}
@@ -0,0 +1,196 @@
+package graphapi
+
+import "encoding/json"
+
+// Reroute is a point that links are drawn through.  Newer frontends save reroutes in
+// the graph's extra.reroutes, or a subgraph's reroutes, instead of adding Reroute nodes.
+// A link's ParentID is the reroute closest to its target, and each reroute's ParentID
+// is the next one towards the link's origin.  Reroutes do not change what links
+// connect, a link always goes from the output of one node to the input of another.
+type Reroute struct {
+	ID       int              `json:"id"`
+	ParentID int              `json:"parentId,omitempty"`
+	Pos      []float64        `json:"pos"`
+	LinkIds  []int            `json:"linkIds"`
+	Floating *RerouteFloating `json:"floating,omitempty"`
+	raw      *rawJSON
+}
+
+func (r *Reroute) UnmarshalJSON(b []byte) error {
+	type Alias Reroute
+	raw, err := unmarshalPreserving(b, (*Alias)(r))
+	r.raw = raw
+	return err
+}
+
+func (r *Reroute) MarshalJSON() ([]byte, error) {
+	type Alias Reroute
+	return marshalPreserving((*Alias)(r), r.raw)
+}
+
+// RerouteFloating marks a reroute that is only connected on one side, by floating links
+type RerouteFloating struct {
+	SlotType string `json:"slotType"` // "input" or "output", the side that is connected
+}
+
+// linkExtension gives the parent reroute of a link saved in tuple format
+type linkExtension struct {
+	ID       int `json:"id"`
+	ParentID int `json:"parentId"`
+}
+
+// GetRerouteById returns a native reroute of the graph
+func (t *Graph) GetRerouteById(id int) *Reroute {
+	return t.ReroutesByID[id]
+}
+
+// GetRerouteById returns a native reroute from within the subgraph
+func (sg *SubgraphDefinition) GetRerouteById(id int) *Reroute {
+	return sg.ReroutesByID[id]
+}
+
+// GetLinkReroutes returns the reroutes a link passes through, from its origin to its target
+func (t *Graph) GetLinkReroutes(l *Link) []*Reroute {
+	return rerouteChain(l.ParentID, t.GetRerouteById)
+}
+
+// GetLinkReroutes returns the reroutes a link within the subgraph passes through, from
+// its origin to its target
+func (sg *SubgraphDefinition) GetLinkReroutes(l *Link) []*Reroute {
+	return rerouteChain(l.ParentID, sg.GetRerouteById)
+}
+
+// rerouteChain follows reroutes from a link's parent towards its origin, and returns
+// them in the order the link passes through them
+func rerouteChain(parentID int, get func(int) *Reroute) []*Reroute {
+	retv := make([]*Reroute, 0)
+	seen := make(map[int]bool)
+	for id := parentID; id != 0 && !seen[id]; {
+		seen[id] = true
+		r := get(id)
+		if r == nil {
+			break
+		}
+		retv = append([]*Reroute{r}, retv...)
+		id = r.ParentID
+	}
+	return retv
+}
+
+// readReroutes takes the reroutes and the link parents out of the graph's extra
+func (t *Graph) readReroutes() error {
+	t.ReroutesByID = make(map[int]*Reroute)
+	if t.Extra == nil {
+		return nil
+	}
+	if raw, ok := t.Extra["reroutes"]; ok {
+		if err := remarshal(raw, &t.Reroutes); err != nil {
+			return err
+		}
+		delete(t.Extra, "reroutes")
+	}
+	for _, r := range t.Reroutes {
+		t.ReroutesByID[r.ID] = r
+	}
+	if raw, ok := t.Extra["linkExtensions"]; ok {
+		var exts []linkExtension
+		if err := remarshal(raw, &exts); err != nil {
+			return err
+		}
+		for _, e := range exts {
+			if l := t.GetLinkById(e.ID); l != nil {
+				l.ParentID = e.ParentID
+			}
+		}
+		delete(t.Extra, "linkExtensions")
+	}
+	return nil
+}
+
+// serializedExtra returns the graph's extra with its reroutes, and the parents of its
+// links, which tuple format links cannot hold
+func (t *Graph) serializedExtra() map[string]interface{} {
+	if len(t.Reroutes) == 0 {
+		return t.Extra
+	}
+	retv := make(map[string]interface{}, len(t.Extra)+2)
+	for k, v := range t.Extra {
+		retv[k] = v
+	}
+	exts := make([]linkExtension, 0)
+	for _, l := range t.Links {
+		if l.ParentID != 0 {
+			exts = append(exts, linkExtension{ID: l.ID, ParentID: l.ParentID})
+		}
+	}
+	retv["reroutes"] = t.Reroutes
+	retv["linkExtensions"] = exts
+	return retv
+}
+
+// detachReroutes takes a link out of the reroutes it passes through.  Reroutes that are
+// left without links are removed, as the frontend does.
+func (t *Graph) detachReroutes(l *Link) {
+	chain := t.GetLinkReroutes(l)
+	l.ParentID = 0
+	if len(chain) == 0 {
+		return
+	}
+
+	// reroutes that floating links pass through are kept
+	floating := make(map[*Reroute]bool)
+	for _, fl := range t.FloatingLinks {
+		for _, r := range t.GetLinkReroutes(fl) {
+			floating[r] = true
+		}
+	}
+	for _, r := range chain {
+		ids := r.LinkIds[:0]
+		for _, id := range r.LinkIds {
+			if id != l.ID {
+				ids = append(ids, id)
+			}
+		}
+		r.LinkIds = ids
+		if len(r.LinkIds) == 0 && r.Floating == nil && !floating[r] {
+			t.removeReroute(r)
+		}
+	}
+}
+
+func (t *Graph) removeReroute(r *Reroute) {
+	for i, gr := range t.Reroutes {
+		if gr == r {
+			t.Reroutes = append(t.Reroutes[:i], t.Reroutes[i+1:]...)
+			break
+		}
+	}
+	delete(t.ReroutesByID, r.ID)
+}
+
+// remarshal converts a decoded JSON value to the type of v
+func remarshal(raw interface{}, v interface{}) error {
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func copyReroutes(reroutes []*Reroute) []*Reroute {
+	if reroutes == nil {
+		return nil
+	}
+	retv := make([]*Reroute, len(reroutes))
+	for i, r := range reroutes {
+		nr := *r
+		nr.Pos = copyFloats(r.Pos)
+		nr.LinkIds = append([]int(nil), r.LinkIds...)
+		if r.Floating != nil {
+			f := *r.Floating
+			nr.Floating = &f
+		}
+		retv[i] = &nr
+	}
+	return retv
+}
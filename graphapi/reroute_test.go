@@ -0,0 +1,121 @@
+package graphapi
+
+import (
+	"encoding/json"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func newRerouteTestGraph(t *testing.T) *Graph {
+	data, err := os.ReadFile("../examples/testdata/reroutes.json")
+	if err != nil {
+		t.Fatalf("Failed to read test file: %v", err)
+	}
+	var graph Graph
+	if err := json.Unmarshal(data, &graph); err != nil {
+		t.Fatalf("Failed to unmarshal graph: %v", err)
+	}
+	return &graph
+}
+
+func rerouteIDs(reroutes []*Reroute) []int {
+	retv := make([]int, len(reroutes))
+	for i, r := range reroutes {
+		retv[i] = r.ID
+	}
+	return retv
+}
+
+// TestNativeReroutes tests reading native reroutes and the links through them
+func TestNativeReroutes(t *testing.T) {
+	graph := newRerouteTestGraph(t)
+
+	if len(graph.Reroutes) != 4 || graph.GetRerouteById(4).Floating == nil {
+		t.Fatalf("Expected 4 reroutes, one floating, got %d", len(graph.Reroutes))
+	}
+	if ids := rerouteIDs(graph.GetLinkReroutes(graph.GetLinkById(1))); !reflect.DeepEqual(ids, []int{1, 2}) {
+		t.Errorf("Expected link 1 to pass through reroutes 1 and 2, got %v", ids)
+	}
+	if ids := rerouteIDs(graph.GetLinkReroutes(graph.GetLinkById(8))); len(ids) != 0 {
+		t.Errorf("Expected link 8 to have no reroutes, got %v", ids)
+	}
+	if len(graph.FloatingLinks) != 1 || graph.FloatingLinks[0].ParentID != 4 || graph.GetLinkById(11) != nil {
+		t.Errorf("Expected floating link 11 apart from the links, got %v", graph.FloatingLinks)
+	}
+	if _, ok := graph.Extra["reroutes"]; ok || graph.Extra["frontendVersion"] != "1.28.6" {
+		t.Errorf("Expected the reroutes to be taken out of extra, got %v", graph.Extra)
+	}
+
+	// the Reroute node is followed, the native reroutes are not in the way
+	if links := graph.GetNodeById(1).GetLinks(); !reflect.DeepEqual(links, []int{1, 2, 3, 9}) {
+		t.Errorf("Expected links 1, 2, 3 and 9, got %v", links)
+	}
+	if links := graph.GetNodeById(7).GetLinks(); len(links) != 0 {
+		t.Errorf("Expected no links from SaveImage, got %v", links)
+	}
+	p, err := graph.GraphToPrompt("")
+	if err != nil {
+		t.Fatalf("Failed to generate prompt: %v", err)
+	}
+	if model := p.Nodes["5"].Inputs["model"]; !reflect.DeepEqual(model, []interface{}{"1", 0}) {
+		t.Errorf("Expected the sampler's model from the checkpoint, got %v", model)
+	}
+	if vae := p.Nodes["6"].Inputs["vae"]; !reflect.DeepEqual(vae, []interface{}{"1", 2}) {
+		t.Errorf("Expected the decoder's vae from the checkpoint, got %v", vae)
+	}
+	if _, ok := p.Nodes["8"]; ok {
+		t.Errorf("Expected no Reroute node in the prompt")
+	}
+}
+
+// TestNativeReroutesRoundtrip tests that saving a graph keeps its reroutes
+func TestNativeReroutesRoundtrip(t *testing.T) {
+	graph := newRerouteTestGraph(t)
+	data, err := json.Marshal(graph)
+	if err != nil {
+		t.Fatalf("Failed to marshal graph: %v", err)
+	}
+
+	var original, saved map[string]interface{}
+	source, _ := os.ReadFile("../examples/testdata/reroutes.json")
+	json.Unmarshal(source, &original)
+	json.Unmarshal(data, &saved)
+	for _, key := range []string{"links", "floatingLinks", "extra"} {
+		if !reflect.DeepEqual(original[key], saved[key]) {
+			t.Errorf("%s changed:\n%v\n%v", key, original[key], saved[key])
+		}
+	}
+
+	clone := graph.Clone()
+	clone.GetRerouteById(1).Pos[0] = 0
+	if graph.GetRerouteById(1).Pos[0] != 400 || len(clone.Reroutes) != 4 {
+		t.Errorf("Expected the clone to have its own reroutes")
+	}
+}
+
+// TestRemoveLinkReroutes tests that removing links removes the reroutes left without links
+func TestRemoveLinkReroutes(t *testing.T) {
+	graph := newRerouteTestGraph(t)
+
+	graph.RemoveLink(2)
+	if r := graph.GetRerouteById(3); r == nil || !reflect.DeepEqual(r.LinkIds, []int{3}) {
+		t.Fatalf("Expected reroute 3 to keep link 3, got %v", r)
+	}
+	graph.RemoveLink(3)
+	graph.RemoveLink(1)
+	if ids := rerouteIDs(graph.Reroutes); !reflect.DeepEqual(ids, []int{4}) {
+		t.Errorf("Expected only the floating reroute to remain, got %v", ids)
+	}
+
+	data, _ := graph.GraphToJSON()
+	var saved struct {
+		Extra struct {
+			LinkExtensions []linkExtension `json:"linkExtensions"`
+		} `json:"extra"`
+	}
+	json.Unmarshal([]byte(data), &saved)
+	if len(saved.Extra.LinkExtensions) != 0 {
+		t.Errorf("Expected no link extensions, got %v", saved.Extra.LinkExtensions)
+	}
+}
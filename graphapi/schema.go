@@ -0,0 +1,121 @@
+package graphapi
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Workflow schema versions.  Version 0.4 is LiteGraph's layout, with last_node_id and
+// last_link_id, links as [id, origin_id, origin_slot, target_id, target_slot, type]
+// tuples, and native reroutes in extra.  Version 1 keeps the last ids in a state
+// object, saves links as objects, and has its reroutes at the top level.
+const (
+	SchemaVersion04 float32 = 0.4
+	SchemaVersion1  float32 = 1
+)
+
+// graphV1 is the layout of a graph in schema version 1
+type graphV1 struct {
+	Version       float32                `json:"version"`
+	State         *SubgraphState         `json:"state"`
+	Groups        []*Group               `json:"groups"`
+	Nodes         []*GraphNode           `json:"nodes"`
+	Links         []*Link                `json:"links"`
+	FloatingLinks []*Link                `json:"floatingLinks,omitempty"`
+	Reroutes      []*Reroute             `json:"reroutes,omitempty"`
+	Extra         map[string]interface{} `json:"extra,omitempty"`
+	Definitions   *GraphDefinitions      `json:"definitions,omitempty"`
+}
+
+// SchemaVersion returns the schema version the graph was read with, and is saved with
+func (t *Graph) SchemaVersion() float32 {
+	if t.Version >= SchemaVersion1 || t.State != nil {
+		return SchemaVersion1
+	}
+	return SchemaVersion04
+}
+
+// ConvertSchema changes the schema version the graph is saved with, to SchemaVersion04
+// or SchemaVersion1.  Nodes, subgraphs and the fields the graph does not know are kept.
+func (t *Graph) ConvertSchema(version float32) error {
+	if version != SchemaVersion04 && version != SchemaVersion1 {
+		return fmt.Errorf("unknown workflow schema version %v", version)
+	}
+	if version == t.SchemaVersion() {
+		return nil
+	}
+
+	object := version == SchemaVersion1
+	for _, l := range t.Links {
+		l.isObjectFormat = object
+	}
+	if object {
+		// the frontend refers to groups by id in this version
+		last := 0
+		for _, g := range t.Groups {
+			last = max(last, g.ID)
+		}
+		for _, g := range t.Groups {
+			if g.ID == 0 {
+				last++
+				g.ID = last
+			}
+		}
+		t.State = t.serializedState()
+		t.raw = t.raw.without("last_node_id", "last_link_id")
+	} else {
+		t.State = nil
+		t.raw = t.raw.without("state", "reroutes")
+	}
+	t.Version = version
+	return nil
+}
+
+// readSchemaV1 reads the parts of a schema version 1 graph that are laid out differently
+func (t *Graph) readSchemaV1(b []byte) error {
+	var v1 struct {
+		Reroutes []*Reroute `json:"reroutes"`
+	}
+	if err := json.Unmarshal(b, &v1); err != nil {
+		return err
+	}
+	t.Reroutes = v1.Reroutes
+	if t.State != nil {
+		t.LastNodeID = t.State.LastNodeId
+		t.LastLinkID = t.State.LastLinkId
+	}
+	return nil
+}
+
+// serializedState returns the graph's state, with the last ids of the graph
+func (t *Graph) serializedState() *SubgraphState {
+	retv := &SubgraphState{}
+	if t.State != nil {
+		*retv = *t.State
+	}
+	retv.LastNodeId = t.LastNodeID
+	retv.LastLinkId = t.LastLinkID
+	for _, g := range t.Groups {
+		retv.LastGroupId = max(retv.LastGroupId, g.ID)
+	}
+	for _, r := range t.Reroutes {
+		retv.LastRerouteId = max(retv.LastRerouteId, r.ID)
+	}
+	return retv
+}
+
+// marshalSchemaV1 writes the graph in the layout of schema version 1
+func (t *Graph) marshalSchemaV1() ([]byte, error) {
+	v1 := graphV1{
+		Version:       SchemaVersion1,
+		State:         t.serializedState(),
+		Groups:        t.Groups,
+		Nodes:         t.Nodes,
+		Links:         t.Links,
+		FloatingLinks: t.FloatingLinks,
+		Reroutes:      t.Reroutes,
+		Extra:         t.Extra,
+		Definitions:   t.Definitions,
+	}
+	return marshalPreserving(&v1, t.raw)
+}
@@ -0,0 +1,117 @@
+package graphapi
+
+import (
+	"encoding/json"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func readGraph(t *testing.T, path string) *Graph {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read test file: %v", err)
+	}
+	var graph Graph
+	if err := json.Unmarshal(data, &graph); err != nil {
+		t.Fatalf("Failed to unmarshal graph: %v", err)
+	}
+	return &graph
+}
+
+// compareSavedGraph compares a saved graph with a workflow file, whatever the order of their keys
+func compareSavedGraph(t *testing.T, graph *Graph, path string) {
+	saved, err := graph.GraphToJSON()
+	if err != nil {
+		t.Fatalf("Failed to save graph: %v", err)
+	}
+	source, _ := os.ReadFile(path)
+	var want, got map[string]interface{}
+	json.Unmarshal(source, &want)
+	json.Unmarshal([]byte(saved), &got)
+	for key := range want {
+		if !reflect.DeepEqual(want[key], got[key]) {
+			t.Errorf("%s differs from %s:\nwant %v\ngot  %v", key, path, want[key], got[key])
+		}
+	}
+	for key := range got {
+		if _, ok := want[key]; !ok {
+			t.Errorf("Unexpected %s: %v", key, got[key])
+		}
+	}
+}
+
+// TestSchemaV1 tests reading a schema version 1 workflow
+func TestSchemaV1(t *testing.T) {
+	v1 := readGraph(t, "../examples/testdata/schema-v1.json")
+	v04 := readGraph(t, "../examples/testdata/reroutes.json")
+
+	if v1.SchemaVersion() != SchemaVersion1 || v04.SchemaVersion() != SchemaVersion04 {
+		t.Fatalf("Expected schema versions 1 and 0.4, got %v and %v", v1.SchemaVersion(), v04.SchemaVersion())
+	}
+	if v1.LastNodeID != 8 || v1.LastLinkID != 11 {
+		t.Errorf("Expected the last ids from the state, got %d and %d", v1.LastNodeID, v1.LastLinkID)
+	}
+	if ids := rerouteIDs(v1.GetLinkReroutes(v1.GetLinkById(1))); !reflect.DeepEqual(ids, []int{1, 2}) {
+		t.Errorf("Expected link 1 to pass through reroutes 1 and 2, got %v", ids)
+	}
+	if len(v1.FloatingLinks) != 1 || v1.GetRerouteById(4).Floating == nil {
+		t.Errorf("Expected the floating link and reroute")
+	}
+
+	p1, err := v1.GraphToPrompt("")
+	if err != nil {
+		t.Fatalf("Failed to generate prompt: %v", err)
+	}
+	p04, _ := v04.GraphToPrompt("")
+	if !reflect.DeepEqual(p1.Nodes, p04.Nodes) {
+		t.Errorf("Expected the same prompt for both versions:\n%v\n%v", p1.Nodes, p04.Nodes)
+	}
+
+	// links added to the graph are saved as objects
+	v1.RemoveLink(10)
+	l, err := v1.AddLink(6, 0, 7, 0)
+	if err != nil {
+		t.Fatalf("Failed to add link: %v", err)
+	}
+	data, _ := json.Marshal(l)
+	if string(data) != `{"id":12,"origin_id":6,"origin_slot":0,"target_id":7,"target_slot":0,"type":"IMAGE"}` {
+		t.Errorf("Expected an object link, got %s", data)
+	}
+	saved, _ := v1.GraphToJSON()
+	var state struct {
+		State SubgraphState `json:"state"`
+	}
+	json.Unmarshal([]byte(saved), &state)
+	if state.State.LastLinkId != 12 || state.State.LastRerouteId != 4 {
+		t.Errorf("Expected the state to have the new link, got %+v", state.State)
+	}
+}
+
+// TestConvertSchema tests converting workflows between the schema versions
+func TestConvertSchema(t *testing.T) {
+	graph := readGraph(t, "../examples/testdata/reroutes.json")
+	if err := graph.ConvertSchema(SchemaVersion1); err != nil {
+		t.Fatalf("Failed to convert to version 1: %v", err)
+	}
+	compareSavedGraph(t, graph, "../examples/testdata/schema-v1.json")
+	if err := graph.ConvertSchema(SchemaVersion04); err != nil {
+		t.Fatalf("Failed to convert to version 0.4: %v", err)
+	}
+	compareSavedGraph(t, graph, "../examples/testdata/reroutes.json")
+
+	graph = readGraph(t, "../examples/testdata/schema-v1.json")
+	graph.ConvertSchema(SchemaVersion04)
+	compareSavedGraph(t, graph, "../examples/testdata/reroutes.json")
+
+	if err := graph.ConvertSchema(2); err == nil {
+		t.Errorf("Expected an error for an unknown version")
+	}
+
+	// groups are given ids
+	graph.Groups = []*Group{{ID: 3, Title: "a"}, {Title: "b"}}
+	graph.ConvertSchema(SchemaVersion1)
+	if graph.Groups[1].ID != 4 || graph.State.LastGroupId != 4 {
+		t.Errorf("Expected the new group to have id 4, got %d", graph.Groups[1].ID)
+	}
+}
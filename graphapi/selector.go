@@ -0,0 +1,360 @@
+package graphapi
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// errors returned when resolving property paths.  These are wrapped in a
+// *PathError, use errors.Is to test for them.
+var (
+	ErrPathNotFound  = errors.New("no match")
+	ErrPathAmbiguous = errors.New("ambiguous match")
+	ErrPathSyntax    = errors.New("invalid path")
+	ErrNotSubgraph   = errors.New("node is not a subgraph")
+)
+
+// PathError describes a property path that could not be resolved.  Candidates
+// holds the matches of an ambiguous selector, or the available choices when
+// nothing matched.
+type PathError struct {
+	Path       string
+	Selector   string
+	Candidates []string
+	Err        error
+}
+
+func (e *PathError) Error() string {
+	switch e.Err {
+	case ErrPathAmbiguous:
+		return fmt.Sprintf("path %q: %q is ambiguous, it matches %s", e.Path, e.Selector, strings.Join(e.Candidates, ", "))
+	case ErrPathNotFound:
+		if len(e.Candidates) != 0 {
+			return fmt.Sprintf("path %q: nothing matches %q, available: %s", e.Path, e.Selector, strings.Join(e.Candidates, ", "))
+		}
+		return fmt.Sprintf("path %q: nothing matches %q", e.Path, e.Selector)
+	}
+	return fmt.Sprintf("path %q: %v at %q", e.Path, e.Err, e.Selector)
+}
+
+func (e *PathError) Unwrap() error {
+	return e.Err
+}
+
+// Get returns the property addressed by path.  A path is a node selector followed
+// by a '.' and the property's name or alias.  The node selector is made of
+// '/'-separated segments, each of which is one of:
+//
+//	Title       a node's title, or its type when no node has that title
+//	Title#3     a node with the given title or type, and id
+//	#3 or 3     a node id
+//	57:8        a node id within the subgraph of node 57
+//	@group:Name restricts the following segment to nodes in the group
+//	@title:Name a node's title only
+//	@type:Name  a node's type only
+//
+// A segment that follows a subgraph node is resolved within that node's subgraph
+// definition, e.g. "Text to Image/KSampler.seed".  Note that the nodes of a
+// subgraph definition are shared by every instance of that subgraph.
+//
+// A '.', '/', '#' or '\' that is part of a title, group or property name is escaped
+// with a '\', e.g. "v1\.5 Loader.ckpt_name", see EscapePath.  A name that is not
+// the name of a property is looked up as an alias, and when several properties
+// have that alias the first in widget order is returned.
+func (t *Graph) Get(path string) (Property, error) {
+	_, prop, err := t.resolvePath(path)
+	return prop, err
+}
+
+// Set sets the value of the property addressed by path.  See Get for the path syntax.
+func (t *Graph) Set(path string, value interface{}) error {
+	_, prop, err := t.resolvePath(path)
+	if err != nil {
+		return err
+	}
+	return prop.SetValue(value)
+}
+
+// GetNode returns the node addressed by a node selector.  See Get for the syntax.
+func (t *Graph) GetNode(selector string) (*GraphNode, error) {
+	return t.resolveNode(selector, selector)
+}
+
+// selectorScope is a set of nodes a selector segment is resolved within
+type selectorScope struct {
+	nodes  []*GraphNode
+	groups []*Group
+}
+
+func (t *Graph) resolvePath(path string) (*GraphNode, Property, error) {
+	dot := lastUnescaped(path, '.')
+	if dot <= 0 || dot == len(path)-1 {
+		return nil, nil, &PathError{Path: path, Selector: path, Err: ErrPathSyntax}
+	}
+
+	node, err := t.resolveNode(path[:dot], path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	name := unescapePath(path[dot+1:])
+	prop := node.GetPropertyWithName(name)
+	if prop == nil {
+		names := make([]string, 0, len(node.Properties))
+		for _, p := range node.GetPropertiesByIndex() {
+			if p.Settable() {
+				names = append(names, p.Name())
+			}
+		}
+		return nil, nil, &PathError{Path: path, Selector: name, Candidates: names, Err: ErrPathNotFound}
+	}
+	return node, prop, nil
+}
+
+func (t *Graph) resolveNode(selector string, path string) (*GraphNode, error) {
+	scope := selectorScope{nodes: t.Nodes, groups: t.Groups}
+	candidates := scope.nodes
+	segments := splitUnescaped(selector, '/')
+
+	var node *GraphNode
+	for i, segment := range segments {
+		if node != nil {
+			// the previous segment must be a subgraph instance to descend into
+			if !node.IsSubgraph || node.SubgraphDef == nil {
+				return nil, &PathError{Path: path, Selector: segments[i-1], Err: ErrNotSubgraph}
+			}
+			scope = selectorScope{nodes: node.SubgraphDef.Nodes, groups: node.SubgraphDef.Groups}
+			candidates = scope.nodes
+			node = nil
+		}
+
+		if strings.HasPrefix(segment, "@group:") {
+			group, err := scope.findGroup(unescapePath(strings.TrimPrefix(segment, "@group:")), path, segment)
+			if err != nil {
+				return nil, err
+			}
+			inGroup := make([]*GraphNode, 0)
+			for _, n := range candidates {
+				if group.IntersectsOrContains(n) {
+					inGroup = append(inGroup, n)
+				}
+			}
+			candidates = inGroup
+			if i == len(segments)-1 {
+				return nil, &PathError{Path: path, Selector: segment, Err: ErrPathSyntax}
+			}
+			continue
+		}
+
+		// compound ids descend through nested subgraphs, as in expanded prompt ids
+		if ids, ok := parseCompoundID(segment); ok {
+			for j, id := range ids {
+				if j != 0 {
+					if !node.IsSubgraph || node.SubgraphDef == nil {
+						return nil, &PathError{Path: path, Selector: segment, Err: ErrNotSubgraph}
+					}
+					candidates = node.SubgraphDef.Nodes
+				}
+				node = findNodeWithID(candidates, id)
+				if node == nil {
+					return nil, &PathError{Path: path, Selector: segment, Candidates: nodeLabels(candidates), Err: ErrPathNotFound}
+				}
+			}
+			continue
+		}
+
+		matches := matchSelector(candidates, segment)
+		switch len(matches) {
+		case 0:
+			return nil, &PathError{Path: path, Selector: segment, Candidates: nodeLabels(candidates), Err: ErrPathNotFound}
+		case 1:
+			node = matches[0]
+		default:
+			return nil, &PathError{Path: path, Selector: segment, Candidates: nodeLabels(matches), Err: ErrPathAmbiguous}
+		}
+	}
+
+	if node == nil {
+		return nil, &PathError{Path: path, Selector: selector, Err: ErrPathSyntax}
+	}
+	return node, nil
+}
+
+func (s selectorScope) findGroup(title string, path string, segment string) (*Group, error) {
+	matches := make([]*Group, 0)
+	for _, g := range s.groups {
+		if g.Title == title {
+			matches = append(matches, g)
+		}
+	}
+	if len(matches) > 1 {
+		return nil, &PathError{Path: path, Selector: segment, Candidates: []string{fmt.Sprintf("%d groups", len(matches))}, Err: ErrPathAmbiguous}
+	}
+	if len(matches) == 0 {
+		titles := make([]string, 0, len(s.groups))
+		for _, g := range s.groups {
+			titles = append(titles, "@group:"+g.Title)
+		}
+		return nil, &PathError{Path: path, Selector: segment, Candidates: titles, Err: ErrPathNotFound}
+	}
+	return matches[0], nil
+}
+
+// nodeSelector is a node selector such as "Title#3" or "@type:KSampler", as it is used
+// in both graph and prompt paths
+type nodeSelector struct {
+	name    string // the title or type, "" when the selector is only an id
+	id      string // the id after '#', "" to match any id
+	byTitle bool   // only match titles
+	byType  bool   // only match types
+}
+
+// parseNodeSelector parses a single selector segment.  A '#' is followed by an id when
+// what follows it is a node id, or a compound id.
+func parseNodeSelector(segment string) nodeSelector {
+	retv := nodeSelector{name: segment}
+	if hash := lastUnescaped(segment, '#'); hash != -1 {
+		if _, ok := parseCompoundID(segment[hash+1:]); ok {
+			retv.name = segment[:hash]
+			retv.id = segment[hash+1:]
+		}
+	}
+	retv.byTitle = strings.HasPrefix(retv.name, "@title:")
+	retv.byType = strings.HasPrefix(retv.name, "@type:")
+	retv.name = unescapePath(strings.TrimPrefix(strings.TrimPrefix(retv.name, "@title:"), "@type:"))
+	return retv
+}
+
+// EscapePath escapes the characters of a title, group or property name that
+// separate the parts of a path, so that it can be used in one
+func EscapePath(name string) string {
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		switch name[i] {
+		case '\\', '.', '/', '#':
+			b.WriteByte('\\')
+		}
+		b.WriteByte(name[i])
+	}
+	return b.String()
+}
+
+// unescapePath removes the '\' before escaped characters
+func unescapePath(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// lastUnescaped returns the index of the last c in s that is not escaped, or -1
+func lastUnescaped(s string, c byte) int {
+	for i := len(s) - 1; i >= 0; i-- {
+		if s[i] == c && !isEscaped(s, i) {
+			return i
+		}
+	}
+	return -1
+}
+
+// match returns the indexes of the nodes that match the selector, of count nodes whose
+// id, title and type are returned by node.  Titles are matched first, and types when
+// no title matches.
+func (s nodeSelector) match(count int, node func(i int) (id string, title string, typ string)) []int {
+	retv := make([]int, 0)
+	if s.name == "" {
+		for i := 0; i < count; i++ {
+			if id, _, _ := node(i); id == s.id {
+				return append(retv, i)
+			}
+		}
+		return retv
+	}
+	if !s.byType {
+		for i := 0; i < count; i++ {
+			if id, title, _ := node(i); title == s.name && (s.id == "" || id == s.id) {
+				retv = append(retv, i)
+			}
+		}
+	}
+	// fall back to matching the node type when no title matches
+	if len(retv) == 0 && !s.byTitle {
+		for i := 0; i < count; i++ {
+			if id, _, typ := node(i); typ == s.name && (s.id == "" || id == s.id) {
+				retv = append(retv, i)
+			}
+		}
+	}
+	return retv
+}
+
+// matchSelector returns the nodes matching a single selector segment
+func matchSelector(nodes []*GraphNode, segment string) []*GraphNode {
+	indexes := parseNodeSelector(segment).match(len(nodes), func(i int) (string, string, string) {
+		return strconv.Itoa(nodes[i].ID), nodeTitle(nodes[i]), nodes[i].Type
+	})
+	retv := make([]*GraphNode, len(indexes))
+	for i, index := range indexes {
+		retv[i] = nodes[index]
+	}
+	return retv
+}
+
+// parseCompoundID parses selectors such as "3" and "57:8"
+func parseCompoundID(segment string) ([]int, bool) {
+	parts := strings.Split(segment, ":")
+	retv := make([]int, 0, len(parts))
+	for _, p := range parts {
+		id, err := strconv.Atoi(p)
+		if err != nil {
+			return nil, false
+		}
+		retv = append(retv, id)
+	}
+	return retv, true
+}
+
+func findNodeWithID(nodes []*GraphNode, id int) *GraphNode {
+	for _, n := range nodes {
+		if n.ID == id {
+			return n
+		}
+	}
+	return nil
+}
+
+// nodeTitle returns the title the frontend displays for a node
+func nodeTitle(n *GraphNode) string {
+	if n.Title != "" {
+		return n.Title
+	}
+	if n.DisplayName != "" {
+		return n.DisplayName
+	}
+	if n.IsSubgraph && n.SubgraphDef != nil {
+		return n.SubgraphDef.Name
+	}
+	return n.Type
+}
+
+// nodeLabel returns a selector that unambiguously addresses the node
+func nodeLabel(n *GraphNode) string {
+	return fmt.Sprintf("%s#%d", EscapePath(nodeTitle(n)), n.ID)
+}
+
+func nodeLabels(nodes []*GraphNode) []string {
+	retv := make([]string, len(nodes))
+	for i, n := range nodes {
+		retv[i] = nodeLabel(n)
+	}
+	return retv
+}
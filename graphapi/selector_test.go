@@ -0,0 +1,144 @@
+package graphapi
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+func newSelectorTestGraph(t testing.TB) *Graph {
+	data, err := os.ReadFile("../examples/testdata/zimage-subgraph.json")
+	if err != nil {
+		t.Fatalf("Failed to read test file: %v", err)
+	}
+
+	var seedData interface{} = []interface{}{"INT", map[string]interface{}{"default": float64(0), "min": float64(0), "max": float64(1000000)}}
+	var cfgData interface{} = []interface{}{"FLOAT", map[string]interface{}{"default": float64(8), "min": float64(0), "max": float64(100), "step": 0.1}}
+	var stringData interface{} = []interface{}{"STRING", map[string]interface{}{"multiline": true}}
+	nodeObjects := &NodeObjects{
+		Objects: map[string]*NodeObject{
+			"KSampler": {
+				Name:        "KSampler",
+				DisplayName: "KSampler",
+				Input: &NodeObjectInput{
+					Required:        map[string]*interface{}{"seed": &seedData, "cfg": &cfgData},
+					OrderedRequired: []string{"seed", "cfg"},
+				},
+			},
+			"PrimitiveStringMultiline": {
+				Name:        "PrimitiveStringMultiline",
+				DisplayName: "String (Multiline)",
+				Input: &NodeObjectInput{
+					Required:        map[string]*interface{}{"value": &stringData},
+					OrderedRequired: []string{"value"},
+				},
+			},
+		},
+	}
+	nodeObjects.PopulateInputProperties()
+
+	// only the node types under test are known
+	graph, _, err := NewGraphFromJsonString(string(data), nodeObjects)
+	if graph == nil {
+		t.Fatalf("Failed to create graph: %v", err)
+	}
+	graph.Groups = append(graph.Groups, &Group{Title: "API", Bounding: []float64{-10000, -10000, 20000, 20000}})
+	return graph
+}
+
+// TestPathSelectors tests resolving properties by title, id, group and subgraph path
+func TestPathSelectors(t *testing.T) {
+	graph := newSelectorTestGraph(t)
+
+	for _, path := range []string{
+		"57:3.seed",
+		"57/KSampler.seed",
+		"Text to Image (Z-Image-Turbo)/KSampler#3.seed",
+		"#57/@type:KSampler.seed",
+	} {
+		if err := graph.Set(path, 42); err != nil {
+			t.Fatalf("Failed to set %s: %v", path, err)
+		}
+		p, err := graph.Get(path)
+		if err != nil {
+			t.Fatalf("Failed to get %s: %v", path, err)
+		}
+		if v := p.GetValue(); v != int64(42) {
+			t.Errorf("%s: expected 42, got %v", path, v)
+		}
+		graph.Set(path, 0)
+	}
+
+	if err := graph.Set("@group:API/Prompt.value", "a lighthouse"); err != nil {
+		t.Fatalf("Failed to set prompt: %v", err)
+	}
+	if v := graph.GetNodeById(58).WidgetValuesArray()[0]; v != "a lighthouse" {
+		t.Errorf("Expected prompt to be set, got %v", v)
+	}
+}
+
+// TestPathSelectorEscapes tests addressing nodes whose titles contain the path's
+// separators, and aliases shared by several properties
+func TestPathSelectorEscapes(t *testing.T) {
+	graph := newSelectorTestGraph(t)
+	graph.GetNodeById(58).Title = `v1.5/prompt #2 \ a`
+
+	for _, path := range []string{
+		EscapePath(graph.GetNodeById(58).Title) + ".value",
+		`v1\.5\/prompt \#2 \\ a#58.value`,
+		`@group:API/@title:v1\.5\/prompt \#2 \\ a.value`,
+	} {
+		if err := graph.Set(path, "escaped"); err != nil {
+			t.Fatalf("Failed to set %s: %v", path, err)
+		}
+		if v := graph.GetNodeById(58).WidgetValuesArray()[0]; v != "escaped" {
+			t.Errorf("%s: expected the prompt to be set, got %v", path, v)
+		}
+		graph.GetNodeById(58).WidgetValuesArray()[0] = ""
+	}
+	if _, err := graph.Get("v1.5/prompt #2 \\ a.value"); err == nil {
+		t.Errorf("Expected an unescaped title not to resolve")
+	}
+
+	// the first property in widget order has an alias shared with a later one
+	sampler := graph.GetNodeById(57).SubgraphDef.GetNodeById(3)
+	sampler.GetPropertyWithName("seed").SetAlias("shared")
+	sampler.GetPropertyWithName("cfg").SetAlias("shared")
+	for i := 0; i < 20; i++ {
+		if p, err := graph.Get("57:3.shared"); err != nil || p.Name() != "seed" {
+			t.Fatalf("Expected the shared alias to find seed, got %v, %v", p, err)
+		}
+	}
+}
+
+// TestPathSelectorErrors tests that unresolvable paths report what they could match
+func TestPathSelectorErrors(t *testing.T) {
+	graph := newSelectorTestGraph(t)
+	// a second prompt node makes the title ambiguous
+	graph.AddNode(&GraphNode{Type: "PrimitiveStringMultiline", Title: "Prompt"})
+
+	cases := []struct {
+		path     string
+		err      error
+		contains string
+	}{
+		{"Prompt.value", ErrPathAmbiguous, "Prompt#58"},
+		{"Missing.value", ErrPathNotFound, "Prompt#58"},
+		{"57:3.steps", ErrPathNotFound, "cfg"},
+		{"58:3.seed", ErrNotSubgraph, ""},
+		{"@group:Other/Prompt.value", ErrPathNotFound, "@group:API"},
+		{"Prompt", ErrPathSyntax, ""},
+	}
+	for _, c := range cases {
+		_, err := graph.Get(c.path)
+		var pathErr *PathError
+		if !errors.Is(err, c.err) || !errors.As(err, &pathErr) {
+			t.Errorf("%s: expected %v, got %v", c.path, c.err, err)
+			continue
+		}
+		if !strings.Contains(err.Error(), c.contains) {
+			t.Errorf("%s: expected error to mention %q, got %q", c.path, c.contains, err)
+		}
+	}
+}
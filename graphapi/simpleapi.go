@@ -1,5 +1,11 @@
 package graphapi
 
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
 type SimpleAPI struct {
 	Properties  map[string]Property
 	OutputNodes []*GraphNode
@@ -53,3 +59,168 @@ func (t *Graph) GetSimpleAPI(title *string) *SimpleAPI {
 
 	return retv
 }
+
+// SimpleAPIInput is a property exposed by SimpleAPIV2
+type SimpleAPIInput struct {
+	Key      string // "Title.input", using the property's alias when it has one
+	Path     string // a path that addresses the property with Graph.Get and Graph.Set
+	Node     *GraphNode
+	Property Property
+}
+
+// SimpleAPIOutput is an output node exposed by SimpleAPIV2
+type SimpleAPIOutput struct {
+	Key  string // the node's title
+	Path string // a selector that addresses the node with Graph.GetNode
+	Node *GraphNode
+	// Types are the types of the node's outputs.  Terminal nodes, such as SaveImage,
+	// have no outputs and list the types of their inputs instead.
+	Types []string
+}
+
+// SimpleAPIConflict lists the properties that share a key
+type SimpleAPIConflict struct {
+	Key   string
+	Paths []string
+}
+
+// SimpleAPIV2 exposes every settable property of the nodes in an API group
+type SimpleAPIV2 struct {
+	// Inputs holds all exposed properties, in node and property order
+	Inputs []*SimpleAPIInput
+	// Properties maps keys to properties.  Keys that are in conflict are left out,
+	// use the Path of the conflicting Inputs to address them.
+	Properties map[string]Property
+	Outputs    []*SimpleAPIOutput
+	Conflicts  []SimpleAPIConflict
+}
+
+// GetSimpleAPIV2 returns the properties of the nodes within the group with the given
+// title, keyed by "Title.input".  Subgraph definitions may have their own group with
+// the same title, the nodes in it are included for every instance of the subgraph.
+// When title is nil, the default "API" group will be used.  Returns nil when the graph
+// has no such group.
+func (t *Graph) GetSimpleAPIV2(title *string) *SimpleAPIV2 {
+	if title == nil {
+		defaultAPI := "API"
+		title = &defaultAPI
+	}
+	retv := &SimpleAPIV2{
+		Inputs:     make([]*SimpleAPIInput, 0),
+		Properties: make(map[string]Property),
+		Outputs:    make([]*SimpleAPIOutput, 0),
+		Conflicts:  make([]SimpleAPIConflict, 0),
+	}
+
+	found := retv.collect(t.Nodes, t.Groups, *title, "", map[string]bool{})
+	if !found {
+		return nil
+	}
+
+	// report the keys that are used more than once
+	paths := make(map[string][]string)
+	keys := make([]string, 0)
+	for _, in := range retv.Inputs {
+		if _, exists := paths[in.Key]; !exists {
+			keys = append(keys, in.Key)
+		}
+		paths[in.Key] = append(paths[in.Key], in.Path)
+	}
+	for _, key := range keys {
+		if len(paths[key]) > 1 {
+			retv.Conflicts = append(retv.Conflicts, SimpleAPIConflict{Key: key, Paths: paths[key]})
+		}
+	}
+	for _, in := range retv.Inputs {
+		if len(paths[in.Key]) == 1 {
+			retv.Properties[in.Key] = in.Property
+		}
+	}
+	return retv
+}
+
+// collect adds the nodes in the titled group of one graph or subgraph definition, then
+// descends into the definitions of its subgraph instances
+func (s *SimpleAPIV2) collect(nodes []*GraphNode, groups []*Group, title string, prefix string, visiting map[string]bool) bool {
+	found := false
+	for _, g := range groups {
+		if g.Title != title {
+			continue
+		}
+		found = true
+
+		inGroup := make([]*GraphNode, 0)
+		for _, n := range nodes {
+			if g.IntersectsOrContains(n) {
+				inGroup = append(inGroup, n)
+			}
+		}
+		sort.Stable(ByGraphOrdinal(inGroup))
+
+		for _, n := range inGroup {
+			s.addNode(n, prefix)
+		}
+	}
+
+	for _, n := range nodes {
+		if !n.IsSubgraph || n.SubgraphDef == nil || visiting[n.SubgraphDef.ID] {
+			continue
+		}
+		visiting[n.SubgraphDef.ID] = true
+		if s.collect(n.SubgraphDef.Nodes, n.SubgraphDef.Groups, title, fmt.Sprintf("%s%d:", prefix, n.ID), visiting) {
+			found = true
+		}
+		delete(visiting, n.SubgraphDef.ID)
+	}
+	return found
+}
+
+func (s *SimpleAPIV2) addNode(n *GraphNode, prefix string) {
+	nodePath := fmt.Sprintf("%s%d", prefix, n.ID)
+	title := nodeTitle(n)
+
+	if n.IsOutput {
+		out := &SimpleAPIOutput{Key: title, Path: nodePath, Node: n, Types: make([]string, 0)}
+		for _, slot := range n.Outputs {
+			out.Types = append(out.Types, slot.Type)
+		}
+		if len(n.Outputs) == 0 {
+			for _, slot := range n.Inputs {
+				// inputs that are converted widgets are values, not data
+				if slot.Widget == nil {
+					out.Types = append(out.Types, slot.Type)
+				}
+			}
+		}
+		s.Outputs = append(s.Outputs, out)
+	}
+
+	for _, p := range n.GetPropertiesByIndex() {
+		// image uploaders are not settable, but are exposed by their alias
+		if !p.Settable() && p.TypeString() != "IMAGEUPLOAD" {
+			continue
+		}
+		name := p.Name()
+		if p.GetAlias() != "" {
+			name = p.GetAlias()
+		}
+		s.Inputs = append(s.Inputs, &SimpleAPIInput{
+			Key:      title + "." + name,
+			Path:     nodePath + "." + p.Name(),
+			Node:     n,
+			Property: p,
+		})
+	}
+}
+
+// ConflictError returns an error describing the conflicting keys, or nil when there are none
+func (s *SimpleAPIV2) ConflictError() error {
+	if len(s.Conflicts) == 0 {
+		return nil
+	}
+	msgs := make([]string, 0, len(s.Conflicts))
+	for _, c := range s.Conflicts {
+		msgs = append(msgs, fmt.Sprintf("%s is used by %s", c.Key, strings.Join(c.Paths, ", ")))
+	}
+	return fmt.Errorf("duplicate simple API keys: %s", strings.Join(msgs, "; "))
+}
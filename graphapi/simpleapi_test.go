@@ -0,0 +1,82 @@
+package graphapi
+
+import (
+	"testing"
+)
+
+// TestSimpleAPIV2 tests that every property of the API group nodes is exposed,
+// including those of nodes in a subgraph's own API group
+func TestSimpleAPIV2(t *testing.T) {
+	graph := newSelectorTestGraph(t)
+	graph.GetNodeById(9).IsOutput = true
+	sg := graph.GetNodeById(57).SubgraphDef
+	sg.Groups = append(sg.Groups, &Group{Title: "API", Bounding: []float64{-10000, -10000, 20000, 20000}})
+
+	api := graph.GetSimpleAPIV2(nil)
+	if api == nil {
+		t.Fatal("Expected a simple API")
+	}
+	for key, path := range map[string]string{
+		"Prompt.value":                        "58.value",
+		"KSampler.seed":                       "57:3.seed",
+		"KSampler.cfg":                        "57:3.cfg",
+		"Text to Image (Z-Image-Turbo).width": "57.width",
+	} {
+		p, ok := api.Properties[key]
+		if !ok {
+			t.Errorf("Expected key %s", key)
+			continue
+		}
+		expected, err := graph.Get(path)
+		if err != nil {
+			t.Fatalf("Failed to get %s: %v", path, err)
+		}
+		if p != expected {
+			t.Errorf("Expected %s to be the property at %s", key, path)
+		}
+	}
+
+	// properties are in node order, then property order
+	var seedIndex, cfgIndex int
+	for i, in := range api.Inputs {
+		switch in.Key {
+		case "KSampler.seed":
+			seedIndex = i
+		case "KSampler.cfg":
+			cfgIndex = i
+		}
+	}
+	if seedIndex > cfgIndex {
+		t.Errorf("Expected seed before cfg")
+	}
+
+	if len(api.Outputs) != 1 || api.Outputs[0].Path != "9" || len(api.Outputs[0].Types) != 1 || api.Outputs[0].Types[0] != "IMAGE" {
+		t.Errorf("Expected SaveImage output of type IMAGE, got %+v", api.Outputs)
+	}
+	if err := api.ConflictError(); err != nil {
+		t.Errorf("Expected no conflicts, got %v", err)
+	}
+}
+
+// TestSimpleAPIV2Conflicts tests that duplicate keys are reported rather than overwritten
+func TestSimpleAPIV2Conflicts(t *testing.T) {
+	graph := newSelectorTestGraph(t)
+	prompt := graph.GetNodeById(58)
+	duplicate := &GraphNode{Type: prompt.Type, Title: "Prompt", Position: prompt.Position, Size: prompt.Size, WidgetValues: []interface{}{"other"}}
+	graph.AddNode(duplicate)
+	duplicate.Properties = map[string]Property{}
+	np := newStringProperty("value", false, nil, 0)
+	(*np).SetTargetWidget(duplicate, 0)
+	duplicate.Properties["value"] = *np
+
+	api := graph.GetSimpleAPIV2(nil)
+	if _, ok := api.Properties["Prompt.value"]; ok {
+		t.Error("Expected conflicting key to be left out of Properties")
+	}
+	if len(api.Conflicts) != 1 || len(api.Conflicts[0].Paths) != 2 {
+		t.Fatalf("Expected one conflict between two properties, got %+v", api.Conflicts)
+	}
+	if api.ConflictError() == nil {
+		t.Error("Expected a conflict error")
+	}
+}
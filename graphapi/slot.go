@@ -14,4 +14,19 @@ type Slot struct {
 	Shape      *int       `json:"shape,omitempty"`
 	SlotIndex  *int       `json:"slot_index,omitempty"` // Index of the Slot in relation to other Slots
 	Property   Property   `json:"-"`                    // non-null for inputs that are exported widgets
+	raw        *rawJSON
+}
+
+func (s *Slot) UnmarshalJSON(b []byte) error {
+	type Alias Slot
+	raw, err := unmarshalPreserving(b, (*Alias)(s))
+	s.raw = raw
+	return err
+}
+
+// MarshalJSON writes the slot with the fields it was read with, such as "label" and
+// "localized_name"
+func (s *Slot) MarshalJSON() ([]byte, error) {
+	type Alias Slot
+	return marshalPreserving((*Alias)(s), s.raw)
 }
@@ -23,26 +23,34 @@ type SubgraphDefinition struct {
 	Nodes      []*GraphNode           `json:"nodes"`
 	Groups     []*Group               `json:"groups"`
 	Links      []*Link                `json:"links"`
-	Extra      map[string]interface{} `json:"extra,omitempty"`
+	// Native reroutes, and links connected to a reroute on only one side
+	Reroutes      []*Reroute             `json:"reroutes,omitempty"`
+	FloatingLinks []*Link                `json:"floatingLinks,omitempty"`
+	Extra         map[string]interface{} `json:"extra,omitempty"`
 
 	// Runtime maps (populated after unmarshal)
-	NodesByID map[int]*GraphNode `json:"-"`
-	LinksByID map[int]*Link      `json:"-"`
+	NodesByID    map[int]*GraphNode `json:"-"`
+	LinksByID    map[int]*Link      `json:"-"`
+	ReroutesByID map[int]*Reroute   `json:"-"`
 
 	// Reference back to parent graph for subgraph lookups
 	ParentGraph *Graph `json:"-"`
+	raw         *rawJSON
 }
 
+// SubgraphState holds the last ids used within a subgraph, or within a graph of schema version 1
 type SubgraphState struct {
 	LastGroupId   int `json:"lastGroupId"`
 	LastNodeId    int `json:"lastNodeId"`
 	LastLinkId    int `json:"lastLinkId"`
 	LastRerouteId int `json:"lastRerouteId"`
+	raw           *rawJSON
 }
 
 type SubgraphIONode struct {
 	ID       int       `json:"id"`
 	Bounding []float64 `json:"bounding"`
+	raw      *rawJSON
 }
 
 type SubgraphPort struct {
@@ -52,17 +60,80 @@ type SubgraphPort struct {
 	LinkIds       []int     `json:"linkIds"`
 	Pos           []float64 `json:"pos"`
 	LocalizedName string    `json:"localized_name,omitempty"`
+	raw           *rawJSON
 }
 
 // GraphDefinitions holds the definitions section of a workflow
 type GraphDefinitions struct {
 	Subgraphs []*SubgraphDefinition `json:"subgraphs,omitempty"`
+	raw       *rawJSON
+}
+
+func (sg *SubgraphDefinition) UnmarshalJSON(b []byte) error {
+	type Alias SubgraphDefinition
+	raw, err := unmarshalPreserving(b, (*Alias)(sg))
+	sg.raw = raw
+	return err
+}
+
+func (sg *SubgraphDefinition) MarshalJSON() ([]byte, error) {
+	type Alias SubgraphDefinition
+	return marshalPreserving((*Alias)(sg), sg.raw)
+}
+
+func (s *SubgraphState) UnmarshalJSON(b []byte) error {
+	type Alias SubgraphState
+	raw, err := unmarshalPreserving(b, (*Alias)(s))
+	s.raw = raw
+	return err
+}
+
+func (s *SubgraphState) MarshalJSON() ([]byte, error) {
+	type Alias SubgraphState
+	return marshalPreserving((*Alias)(s), s.raw)
+}
+
+func (n *SubgraphIONode) UnmarshalJSON(b []byte) error {
+	type Alias SubgraphIONode
+	raw, err := unmarshalPreserving(b, (*Alias)(n))
+	n.raw = raw
+	return err
+}
+
+func (n *SubgraphIONode) MarshalJSON() ([]byte, error) {
+	type Alias SubgraphIONode
+	return marshalPreserving((*Alias)(n), n.raw)
+}
+
+func (p *SubgraphPort) UnmarshalJSON(b []byte) error {
+	type Alias SubgraphPort
+	raw, err := unmarshalPreserving(b, (*Alias)(p))
+	p.raw = raw
+	return err
+}
+
+func (p *SubgraphPort) MarshalJSON() ([]byte, error) {
+	type Alias SubgraphPort
+	return marshalPreserving((*Alias)(p), p.raw)
+}
+
+func (d *GraphDefinitions) UnmarshalJSON(b []byte) error {
+	type Alias GraphDefinitions
+	raw, err := unmarshalPreserving(b, (*Alias)(d))
+	d.raw = raw
+	return err
+}
+
+func (d *GraphDefinitions) MarshalJSON() ([]byte, error) {
+	type Alias GraphDefinitions
+	return marshalPreserving((*Alias)(d), d.raw)
 }
 
 // BuildInternalMaps populates the runtime lookup maps for a subgraph
 func (sg *SubgraphDefinition) BuildInternalMaps() {
 	sg.NodesByID = make(map[int]*GraphNode)
 	sg.LinksByID = make(map[int]*Link)
+	sg.ReroutesByID = make(map[int]*Reroute)
 
 	for _, node := range sg.Nodes {
 		sg.NodesByID[node.ID] = node
@@ -71,6 +142,10 @@ func (sg *SubgraphDefinition) BuildInternalMaps() {
 	for _, link := range sg.Links {
 		sg.LinksByID[link.ID] = link
 	}
+
+	for _, r := range sg.Reroutes {
+		sg.ReroutesByID[r.ID] = r
+	}
 }
 
 // GetNodeById returns a node from within the subgraph
@@ -136,25 +211,137 @@ func (sg *SubgraphDefinition) GetSubgraphForNode(node *GraphNode) *SubgraphDefin
 	return sg.ParentGraph.SubgraphsByID[node.Type]
 }
 
+// proxyWidget is an entry of a subgraph instance's "proxyWidgets" property
+type proxyWidget struct {
+	NodeID string // "-1" for the widgets of the subgraph's inputs, or the id of an internal node
+	Name   string
+}
+
+// proxyWidgets returns the widgets promoted to a subgraph instance by newer frontends,
+// or nil when the instance has no "proxyWidgets" property
+func proxyWidgets(n *GraphNode) []proxyWidget {
+	if n.InternalProperties == nil {
+		return nil
+	}
+	pwArray, ok := (*n.InternalProperties)["proxyWidgets"].([]interface{})
+	if !ok {
+		return nil
+	}
+	retv := make([]proxyWidget, 0, len(pwArray))
+	for _, entry := range pwArray {
+		entryArray, ok := entry.([]interface{})
+		if !ok || len(entryArray) < 2 {
+			continue
+		}
+		var pw proxyWidget
+		switch v := entryArray[0].(type) {
+		case string:
+			pw.NodeID = v
+		case float64:
+			pw.NodeID = fmt.Sprintf("%.0f", v)
+		}
+		if pw.NodeID == "-10" {
+			pw.NodeID = "-1"
+		}
+		pw.Name, _ = entryArray[1].(string)
+		retv = append(retv, pw)
+	}
+	return retv
+}
+
+// promotedWidgetIndex returns the index in a subgraph instance's widget values of the
+// widget of the subgraph input with the given name, or -1 when the input has no widget.
+// Newer frontends list the instance's widgets in "proxyWidgets", where the widgets of the
+// subgraph's inputs have the node id "-1" and are the only ones with a value on the
+// instance, the widgets of internal nodes keep their values on those nodes.  Older
+// frontends give a value to each input that leads to a widget, in the order of the inputs.
+func promotedWidgetIndex(n *GraphNode, sg *SubgraphDefinition, name string) int {
+	if pws := proxyWidgets(n); pws != nil {
+		index := 0
+		for _, pw := range pws {
+			if pw.NodeID != "-1" {
+				continue
+			}
+			if pw.Name == name {
+				return index
+			}
+			index++
+		}
+		return -1
+	}
+
+	index := 0
+	for i, input := range sg.Inputs {
+		if !sg.inputHasWidget(i) {
+			continue
+		}
+		if input.Name == name {
+			return index
+		}
+		index++
+	}
+	return -1
+}
+
+// inputHasWidget reports whether a subgraph input is linked to a widget of an internal node
+func (sg *SubgraphDefinition) inputHasWidget(slot int) bool {
+	for _, link := range sg.Links {
+		if link.OriginID != sg.InputNode.ID || link.OriginSlot != slot {
+			continue
+		}
+		target := sg.GetNodeById(link.TargetID)
+		if target != nil && link.TargetSlot < len(target.Inputs) && target.Inputs[link.TargetSlot].Widget != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// instanceWidgetValue extracts the value of a subgraph input's widget from a subgraph
+// instance node, or nil when the input has no widget
+func instanceWidgetValue(node *GraphNode, sg *SubgraphDefinition, name string) interface{} {
+	// First, try to get value from properties if they exist
+	if node.Properties != nil && len(node.Properties) > 0 {
+		prop := node.GetPropertyWithName(name)
+		if prop != nil {
+			return prop.GetValue()
+		}
+	}
+
+	// Fall back to raw widget values
+	if m := node.WidgetValuesMap(); m != nil {
+		return m[name]
+	}
+	arr := node.WidgetValuesArray()
+	if i := promotedWidgetIndex(node, sg, name); i >= 0 && i < len(arr) {
+		return arr[i]
+	}
+	return nil
+}
+
 // ExpandedNode represents a node after subgraph expansion with remapped IDs
 type ExpandedNode struct {
 	OriginalID    int
-	ExpandedID    string              // Compound ID like "57:30" for subgraph internals, or "9" for top-level
+	ExpandedID    string              // Compound ID like "57:30" for subgraph internals, "57:12:30" for nested subgraphs, or "9" for top-level
 	Node          *GraphNode
 	SubgraphDef   *SubgraphDefinition // If this node is from a subgraph
 	InstanceNode  *GraphNode          // The subgraph instance node in parent
-	InputMapping  map[int]interface{} // Maps input slot -> external value or [nodeID, slot]
+	InputMapping  map[int]interface{} // Maps input slot -> value or [expandedNodeID (string), slot]
+	Values        map[string]interface{} // Widget values of nodes without properties, e.g. within group nodes
 	OutputMapping map[int][]int       // Maps output slot -> [expandedNodeID, slot]
 }
 
-// SubgraphExpander handles recursive expansion of subgraphs for prompt generation
+// SubgraphExpander handles recursive expansion of subgraphs for prompt generation.
+// Nodes inside subgraph instances are given the ids of the instances they are in,
+// joined by ':' with their own id.  Links are resolved through subgraph inputs and
+// outputs, Reroutes, PrimitiveNodes and bypassed nodes the way the frontend does it.
 type SubgraphExpander struct {
 	Graph            *Graph
 	ExpandedNodes    map[string]*ExpandedNode // Keyed by string ID (compound for subgraphs)
 	NextID           int
 	OutputResolution map[string][]interface{} // Maps "instanceID:slot" -> [expandedNodeID (string), slot (int)]
 
-	// Track ID mappings per subgraph instance: instanceNodeID -> (internalID -> compound string expandedID)
+	// Track ID mappings per top-level subgraph instance: instanceNodeID -> (internalID -> compound string expandedID)
 	InstanceIDMaps map[int]map[int]string
 }
 
@@ -169,296 +356,218 @@ func NewSubgraphExpander(g *Graph) *SubgraphExpander {
 	}
 }
 
-// ExpandAll expands all nodes, recursively handling subgraphs
-func (e *SubgraphExpander) ExpandAll() error {
-	for _, node := range e.Graph.NodesInExecutionOrder {
-		if node.IsVirtual() || node.Mode == 2 {
-			continue
-		}
+// subgraphScope is the top-level graph, or a subgraph instance within it
+type subgraphScope struct {
+	graph    *Graph
+	sg       *SubgraphDefinition // nil for the top-level graph
+	instance *GraphNode
+	prefix   string // prepended to the ids of the scope's nodes, e.g. "57:12:"
+	parent   *subgraphScope
+}
 
-		if node.IsSubgraph {
-			if err := e.expandSubgraphNode(node, nil, nil); err != nil {
-				return err
-			}
-		} else {
-			// Regular node - just assign an expanded ID (same as original, as string)
-			nodeIDStr := strconv.Itoa(node.ID)
-			e.ExpandedNodes[nodeIDStr] = &ExpandedNode{
-				OriginalID: node.ID,
-				ExpandedID: nodeIDStr,
-				Node:       node,
-			}
-		}
+func (s *subgraphScope) node(id int) *GraphNode {
+	if s.sg == nil {
+		return s.graph.GetNodeById(id)
 	}
-	return nil
+	return s.sg.GetNodeById(id)
 }
 
-// expandSubgraphNode recursively expands a subgraph instance
-func (e *SubgraphExpander) expandSubgraphNode(
-	instanceNode *GraphNode,
-	parentSubgraph *SubgraphDefinition,
-	parentInputMapping map[int]interface{},
-) error {
-	sg := instanceNode.SubgraphDef
-	if sg == nil {
-		return fmt.Errorf("node %d has no subgraph definition", instanceNode.ID)
+func (s *subgraphScope) link(id int) *Link {
+	if s.sg == nil {
+		return s.graph.GetLinkById(id)
 	}
+	return s.sg.GetLinkById(id)
+}
+
+func (s *subgraphScope) expandedID(id int) string {
+	return s.prefix + strconv.Itoa(id)
+}
 
-	// Create ID mapping for this subgraph instance
-	// Use compound IDs like "57:30" for internal nodes
-	idMap := make(map[int]string)
-	for _, internalNode := range sg.Nodes {
-		// Create compound ID: "instanceID:internalID"
-		compoundID := fmt.Sprintf("%d:%d", instanceNode.ID, internalNode.ID)
-		idMap[internalNode.ID] = compoundID
+// child returns the scope of a subgraph instance in this scope
+func (s *subgraphScope) child(instance *GraphNode, sg *SubgraphDefinition) (*subgraphScope, error) {
+	for p := s; p != nil; p = p.parent {
+		if p.sg == sg {
+			return nil, fmt.Errorf("subgraph %s contains an instance of itself", sg.Name)
+		}
+	}
+	if sg.NodesByID == nil {
+		sg.BuildInternalMaps()
 	}
+	return &subgraphScope{
+		graph:    s.graph,
+		sg:       sg,
+		instance: instance,
+		prefix:   s.expandedID(instance.ID) + ":",
+		parent:   s,
+	}, nil
+}
 
-	// Store the ID map for this instance
-	e.InstanceIDMaps[instanceNode.ID] = idMap
+// subgraphFor returns the definition of a subgraph instance node, or nil
+func (e *SubgraphExpander) subgraphFor(n *GraphNode) *SubgraphDefinition {
+	if sg, ok := e.Graph.SubgraphsByID[n.Type]; ok {
+		return sg
+	}
+	return n.SubgraphDef
+}
 
-	// Build input mapping for this subgraph instance
-	inputMapping := e.buildInputMapping(instanceNode, sg, parentSubgraph, parentInputMapping)
+// ExpandAll expands all nodes, recursively handling subgraphs
+func (e *SubgraphExpander) ExpandAll() error {
+	root := &subgraphScope{graph: e.Graph}
+	return e.expandScope(root, e.Graph.NodesInExecutionOrder)
+}
 
-	// Process each internal node
-	for _, internalNode := range sg.Nodes {
-		// Skip virtual nodes - they shouldn't be in the prompt
-		if internalNode.IsVirtual() {
+// expandScope expands the nodes of a scope.  Frontend only nodes, and muted and
+// bypassed nodes are left out, as is everything within muted or bypassed instances.
+func (e *SubgraphExpander) expandScope(s *subgraphScope, nodes []*GraphNode) error {
+	for _, node := range nodes {
+		// mode 2 is muted, 4 is bypassed
+		if node.IsVirtual() || node.Mode == 2 || node.Mode == 4 {
 			continue
 		}
 
-		// Skip muted nodes
-		if internalNode.Mode == 2 {
+		if node.GroupNodeDef != nil {
+			e.expandGroupNode(s, node)
 			continue
 		}
 
-		expandedID := idMap[internalNode.ID]
-
-		// Check if this internal node is itself a subgraph
-		nestedSg := sg.GetSubgraphForNode(internalNode)
-		if nestedSg != nil {
-			internalNode.SubgraphDef = nestedSg
-			internalNode.IsSubgraph = true
-
-			nestedInputMapping := e.buildNestedInputMapping(internalNode, sg, idMap, inputMapping)
-
-			if err := e.expandSubgraphNode(internalNode, sg, nestedInputMapping); err != nil {
+		if sg := e.subgraphFor(node); sg != nil {
+			inner, err := s.child(node, sg)
+			if err != nil {
 				return err
 			}
-		} else {
-			// Regular node inside subgraph
-			expanded := &ExpandedNode{
-				OriginalID:   internalNode.ID,
-				ExpandedID:   expandedID,
-				Node:         internalNode,
-				SubgraphDef:  sg,
-				InstanceNode: instanceNode,
-				InputMapping: make(map[int]interface{}),
-			}
-
-			// Process all inputs for this node
-			for i, slot := range internalNode.Inputs {
-				if slot.Link == 0 {
-					continue
+			if s.sg == nil {
+				e.InstanceIDMaps[node.ID] = make(map[int]string, len(sg.Nodes))
+				for _, n := range sg.Nodes {
+					e.InstanceIDMaps[node.ID][n.ID] = inner.expandedID(n.ID)
 				}
-				link := sg.GetLinkById(slot.Link)
-				if link == nil {
-					continue
-				}
-
-				if link.OriginID == sg.InputNode.ID {
-					// Connected to subgraph input - use input mapping
-					if val, ok := inputMapping[link.OriginSlot]; ok {
-						expanded.InputMapping[i] = val
-					}
-				} else {
-					// Internal link - check if origin is a nested subgraph
-					originNode := sg.GetNodeById(link.OriginID)
-					if originNode != nil && originNode.IsSubgraph {
-						// Resolve through nested subgraph's output
-						key := fmt.Sprintf("%d:%d", originNode.ID, link.OriginSlot)
-						if resolved, ok := e.OutputResolution[key]; ok {
-							// resolved is now the string node ID
-							expanded.InputMapping[i] = []interface{}{resolved, link.OriginSlot}
-						}
-					} else {
-						// Regular internal link - remap to expanded IDs (now string compound IDs)
-						expanded.InputMapping[i] = []interface{}{idMap[link.OriginID], link.OriginSlot}
+			}
+			if err := e.expandScope(inner, sg.Nodes); err != nil {
+				return err
+			}
+			for slot := range sg.Outputs {
+				if link := sg.GetLinkToOutput(slot); link != nil {
+					if ref, ok := e.resolveLink(inner, link, sg.Outputs[slot].Type, 0).([]interface{}); ok {
+						e.OutputResolution[s.expandedID(node.ID)+":"+strconv.Itoa(slot)] = ref
 					}
 				}
 			}
-
-			e.ExpandedNodes[expandedID] = expanded
+			continue
 		}
-	}
-
-	// Register output mappings for this subgraph instance
-	for outputSlot := range sg.Outputs {
-		link := sg.GetLinkToOutput(outputSlot)
-		if link != nil {
-			key := fmt.Sprintf("%d:%d", instanceNode.ID, outputSlot)
 
-			originNode := sg.GetNodeById(link.OriginID)
-			if originNode != nil && originNode.IsSubgraph {
-				// Origin is a nested subgraph
-				nestedKey := fmt.Sprintf("%d:%d", originNode.ID, link.OriginSlot)
-				if resolved, ok := e.OutputResolution[nestedKey]; ok {
-					e.OutputResolution[key] = resolved
-				}
-			} else {
-				e.OutputResolution[key] = []interface{}{idMap[link.OriginID], link.OriginSlot}
+		expanded := &ExpandedNode{
+			OriginalID:   node.ID,
+			ExpandedID:   s.expandedID(node.ID),
+			Node:         node,
+			SubgraphDef:  s.sg,
+			InstanceNode: s.instance,
+			InputMapping: make(map[int]interface{}),
+		}
+		for i, slot := range node.Inputs {
+			link := s.link(slot.Link)
+			if link == nil {
+				continue
+			}
+			if v := e.resolveLink(s, link, slot.Type, 0); v != nil {
+				expanded.InputMapping[i] = v
 			}
 		}
+		e.ExpandedNodes[expanded.ExpandedID] = expanded
 	}
-
 	return nil
 }
 
-// buildInputMapping creates the input value mapping for a subgraph instance
-func (e *SubgraphExpander) buildInputMapping(
-	instanceNode *GraphNode,
-	sg *SubgraphDefinition,
-	parentSubgraph *SubgraphDefinition,
-	parentInputMapping map[int]interface{},
-) map[int]interface{} {
-	mapping := make(map[int]interface{})
+// the number of Reroutes, bypassed nodes and subgraph boundaries a link is followed
+// through before it is taken to be a cycle
+const maxLinkResolveDepth = 1000
 
-	for i, input := range sg.Inputs {
-		// Find the corresponding input slot on the instance node by NAME, not by index
-		// This is critical because the slot ordering may differ between the subgraph definition
-		// and the instance node (e.g., text at slot 2 internally but slot 6 externally)
-		instanceSlot := instanceNode.GetInputWithName(input.Name)
-
-		var externalLink *Link
-		if instanceSlot != nil && instanceSlot.Link != 0 {
-			// Found a slot with this name that has a connection
-			if parentSubgraph != nil {
-				externalLink = parentSubgraph.GetLinkById(instanceSlot.Link)
-			} else {
-				externalLink = e.Graph.GetLinkById(instanceSlot.Link)
-			}
-		}
+// resolveLink returns the input value that a link gives the node it leads to, either
+// the [expandedNodeID, slot] of the node output it comes from, or the value of a
+// PrimitiveNode or a promoted widget.  nil is returned when the link gives no value,
+// e.g. when it comes from a muted node, and the input is left out of the prompt.
+func (e *SubgraphExpander) resolveLink(s *subgraphScope, link *Link, inputType string, depth int) interface{} {
+	if depth > maxLinkResolveDepth {
+		return nil
+	}
+	depth++
 
-		if externalLink != nil {
-			if parentSubgraph != nil && externalLink.OriginID == parentSubgraph.InputNode.ID {
-				// Linked to parent subgraph's input - cascade from parent mapping
-				if val, ok := parentInputMapping[externalLink.OriginSlot]; ok {
-					mapping[i] = val
-				}
-			} else {
-				// Linked to another node - resolve the actual node
-				mapping[i] = e.resolveExternalLink(externalLink, parentSubgraph)
-			}
-		} else {
-			// No external link - use widget value from instance node
-			if instanceNode.WidgetValues != nil {
-				mapping[i] = e.getWidgetValue(instanceNode, input.Name)
+	// a subgraph input, the value of the instance's input
+	if s.sg != nil && link.OriginID == s.sg.InputNode.ID {
+		if link.OriginSlot >= len(s.sg.Inputs) {
+			return nil
+		}
+		name := s.sg.Inputs[link.OriginSlot].Name
+		slot := s.instance.GetInputWithName(name)
+		if slot != nil && slot.Link != 0 {
+			if l := s.parent.link(slot.Link); l != nil {
+				return e.resolveLink(s.parent, l, inputType, depth)
 			}
+			return nil
 		}
+		return instanceWidgetValue(s.instance, s.sg, name)
 	}
 
-	return mapping
-}
-
-// buildNestedInputMapping creates input mapping for a nested subgraph
-func (e *SubgraphExpander) buildNestedInputMapping(
-	nestedNode *GraphNode,
-	parentSg *SubgraphDefinition,
-	parentIdMap map[int]string,
-	parentInputMapping map[int]interface{},
-) map[int]interface{} {
-	nestedSg := nestedNode.SubgraphDef
-	mapping := make(map[int]interface{})
-
-	for i := range nestedSg.Inputs {
-		// Find the link to this input in the parent subgraph
-		for _, slot := range nestedNode.Inputs {
-			if slot.Link == 0 {
-				continue
-			}
-			link := parentSg.GetLinkById(slot.Link)
-			if link == nil || link.TargetSlot != i {
-				continue
-			}
-
-			if link.OriginID == parentSg.InputNode.ID {
-				// Connected to parent's input - cascade
-				if val, ok := parentInputMapping[link.OriginSlot]; ok {
-					mapping[i] = val
+	origin := s.node(link.OriginID)
+	if origin == nil || origin.Mode == 2 {
+		return nil
+	}
+	switch {
+	case origin.Mode == 4:
+		// a bypassed node passes on the input with the type of the output, preferring
+		// the input in the same slot
+		indexes := []int{link.OriginSlot}
+		for i := range origin.Inputs {
+			indexes = append(indexes, i)
+		}
+		for _, i := range indexes {
+			if i < len(origin.Inputs) && origin.Inputs[i].Type == inputType {
+				if l := s.link(origin.Inputs[i].Link); l != nil {
+					return e.resolveLink(s, l, inputType, depth)
 				}
-			} else {
-				// Connected to sibling node in parent - parentIdMap now returns string IDs
-				mapping[i] = []interface{}{parentIdMap[link.OriginID], link.OriginSlot}
+				return nil
 			}
-			break
 		}
-	}
-
-	return mapping
-}
-
-// resolveExternalLink resolves a link to its expanded node reference
-func (e *SubgraphExpander) resolveExternalLink(link *Link, parentSubgraph *SubgraphDefinition) interface{} {
-	var originNode *GraphNode
-
-	if parentSubgraph != nil {
-		originNode = parentSubgraph.GetNodeById(link.OriginID)
-	} else {
-		originNode = e.Graph.GetNodeById(link.OriginID)
-	}
-
-	if originNode != nil && originNode.IsSubgraph {
-		// Origin is a subgraph - need to resolve to actual output
-		key := fmt.Sprintf("%d:%d", link.OriginID, link.OriginSlot)
-		if resolved, ok := e.OutputResolution[key]; ok {
-			return resolved
+		return nil
+	case origin.Type == "Reroute":
+		if len(origin.Inputs) != 0 {
+			if l := s.link(origin.Inputs[0].Link); l != nil {
+				return e.resolveLink(s, l, inputType, depth)
+			}
+		}
+		return nil
+	case origin.Type == "PrimitiveNode":
+		// the frontend applies the primitive's value to the widgets it is linked to
+		if p, ok := origin.Properties["value"]; ok {
+			return p.GetValue()
 		}
+		if arr := origin.WidgetValuesArray(); len(arr) != 0 {
+			return arr[0]
+		}
+		return nil
+	case origin.IsVirtual():
+		return nil
 	}
 
-	// Regular node - use original ID (will be same as expanded for top-level nodes)
-	return []int{link.OriginID, link.OriginSlot}
-}
-
-// getWidgetValue extracts a widget value from a node using the widget name
-func (e *SubgraphExpander) getWidgetValue(node *GraphNode, name string) interface{} {
-	// First, try to get value from properties if they exist
-	if node.Properties != nil && len(node.Properties) > 0 {
-		prop := node.GetPropertyWithName(name)
-		if prop != nil {
-			return prop.GetValue()
+	if d := origin.GroupNodeDef; d != nil {
+		// the output of a group node, from the group's node
+		if link.OriginSlot >= len(d.outputs) {
+			return nil
 		}
+		out := d.outputs[link.OriginSlot]
+		return e.resolveGroupOutput(s, origin, out.node, out.slot, inputType, depth)
 	}
 
-	// Fall back to raw widget values
-	if node.IsWidgetValueMap() {
-		m := node.WidgetValuesMap()
-		if val, ok := m[name]; ok {
-			return val
+	if sg := e.subgraphFor(origin); sg != nil {
+		// the output of a nested subgraph, follow it to the node within
+		inner, err := s.child(origin, sg)
+		if err != nil {
+			return nil
 		}
-	} else if node.IsWidgetValueArray() {
-		// For array widget values, we need to find the correct index using proxyWidgets
-		// proxyWidgets is an array like [["-1", "width"], ["-1", "height"], ["3", "some_param"], ...]
-		// where each entry maps to the corresponding index in widget_values
-		if node.InternalProperties != nil {
-			if proxyWidgetsRaw, ok := (*node.InternalProperties)["proxyWidgets"]; ok {
-				if proxyWidgets, ok := proxyWidgetsRaw.([]interface{}); ok {
-					arr := node.WidgetValuesArray()
-					// Find the index where proxyWidgets[i] is ["-1", name]
-					for i, entryRaw := range proxyWidgets {
-						if entry, ok := entryRaw.([]interface{}); ok && len(entry) >= 2 {
-							nodeID, ok1 := entry[0].(string)
-							widgetName, ok2 := entry[1].(string)
-							if ok1 && ok2 && nodeID == "-1" && widgetName == name {
-								if i < len(arr) {
-									return arr[i]
-								}
-							}
-						}
-					}
-				}
-			}
+		if l := sg.GetLinkToOutput(link.OriginSlot); l != nil {
+			return e.resolveLink(inner, l, inputType, depth)
 		}
+		return nil
 	}
-	return nil
+	return []interface{}{s.expandedID(origin.ID), link.OriginSlot}
 }
 
 // ToPromptNodes converts all expanded nodes to prompt format
@@ -473,84 +582,22 @@ func (e *SubgraphExpander) ToPromptNodes() map[string]PromptNode {
 			Inputs:    make(map[string]interface{}),
 		}
 
-		// Add widget values from properties if available, otherwise use raw widget_values
-		if node.Properties != nil && len(node.Properties) > 0 {
-			// Properties have been created via CreateNodeProperties
-			for k, prop := range node.Properties {
-				if prop.Serializable() {
-					pn.Inputs[k] = prop.GetValue()
-				}
+		// Add widget values from properties if available.  Properties not created are
+		// typical when GraphToPrompt is called without CreateNodeProperties
+		for k, prop := range node.Properties {
+			if prop.Serializable() {
+				pn.Inputs[k] = prop.GetValue()
 			}
-		} else {
-			// Properties not created - use raw widget_values
-			// This is typical when GraphToPrompt is called without CreateNodeProperties
-			// Widget values will be added via input mapping or can be extracted from WidgetValues if needed
 		}
 
-		// Handle inputs - either from subgraph mapping or direct links
-		if expanded.SubgraphDef != nil {
-			// Node from inside a subgraph
-			for i, slot := range node.Inputs {
-				if val, ok := expanded.InputMapping[i]; ok {
-					switch v := val.(type) {
-					case []int:
-						// Link reference [nodeID, slot]
-						linfo := make([]interface{}, 2)
-						linfo[0] = strconv.Itoa(v[0])
-						linfo[1] = v[1]
-						pn.Inputs[slot.Name] = linfo
-					default:
-						// Direct value - this overrides widget value
-						pn.Inputs[slot.Name] = val
-					}
-				} else if slot.Link != 0 {
-					// Internal link not from subgraph input
-					link := expanded.SubgraphDef.GetLinkById(slot.Link)
-					if link != nil && link.OriginID != expanded.SubgraphDef.InputNode.ID {
-						// Need to find the expanded ID for the origin node
-						originExpandedID := e.findExpandedID(expanded.SubgraphDef, expanded.InstanceNode, link.OriginID)
-						if originExpandedID != "" {
-							linfo := make([]interface{}, 2)
-							linfo[0] = originExpandedID // Already a string
-							linfo[1] = link.OriginSlot
-							pn.Inputs[slot.Name] = linfo
-						}
-					}
-				}
-			}
-		} else {
-			// Top-level node - process links normally
-			for _, slot := range node.Inputs {
-				if slot.Link == 0 {
-					continue
-				}
-				link := e.Graph.GetLinkById(slot.Link)
-				if link == nil {
-					continue
-				}
-
-				originNode := e.Graph.GetNodeById(link.OriginID)
-				var resolvedIDStr string
-				var resolvedSlot int
-
-				if originNode != nil && originNode.IsSubgraph {
-					key := fmt.Sprintf("%d:%d", link.OriginID, link.OriginSlot)
-					if resolved, ok := e.OutputResolution[key]; ok {
-						// resolved is []interface{}{nodeIDString, slot}
-						resolvedIDStr = resolved[0].(string)
-						resolvedSlot = resolved[1].(int)
-					} else {
-						continue
-					}
-				} else {
-					resolvedIDStr = strconv.Itoa(link.OriginID)
-					resolvedSlot = link.OriginSlot
-				}
+		for k, v := range expanded.Values {
+			pn.Inputs[k] = v
+		}
 
-				linfo := make([]interface{}, 2)
-				linfo[0] = resolvedIDStr
-				linfo[1] = resolvedSlot
-				pn.Inputs[slot.Name] = linfo
+		// linked inputs, and values from promoted widgets and primitives, override widget values
+		for i, slot := range node.Inputs {
+			if val, ok := expanded.InputMapping[i]; ok {
+				pn.Inputs[slot.Name] = val
 			}
 		}
 
@@ -559,16 +606,3 @@ func (e *SubgraphExpander) ToPromptNodes() map[string]PromptNode {
 
 	return result
 }
-
-// findExpandedID finds the expanded ID for an internal node within a subgraph instance
-func (e *SubgraphExpander) findExpandedID(sg *SubgraphDefinition, instanceNode *GraphNode, internalNodeID int) string {
-	// Look through expanded nodes to find one that matches
-	for expandedID, expanded := range e.ExpandedNodes {
-		if expanded.SubgraphDef == sg &&
-			expanded.InstanceNode == instanceNode &&
-			expanded.OriginalID == internalNodeID {
-			return expandedID
-		}
-	}
-	return ""
-}
@@ -0,0 +1,510 @@
+package graphapi
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+
+	"github.com/google/uuid"
+)
+
+// the ids and geometry the frontend gives the input and output nodes of a subgraph
+const (
+	subgraphInputNodeID  = -10
+	subgraphOutputNodeID = -20
+	subgraphIONodeWidth  = 120
+	subgraphIOSlotHeight = 20
+	subgraphIONodeGap    = 80
+	subgraphNodeWidth    = 200
+)
+
+// ConvertToSubgraph moves nodes into a new subgraph definition and replaces them with an
+// instance of it.  Links between the nodes move into the definition.  Links that cross
+// into or out of the nodes become the definition's input and output ports, with one
+// port for each output slot they come from.  The instance node is returned.
+func (t *Graph) ConvertToSubgraph(nodeIDs []int, name string) (*GraphNode, error) {
+	if len(nodeIDs) == 0 {
+		return nil, errors.New("no nodes to convert to a subgraph")
+	}
+	selected := make(map[int]bool, len(nodeIDs))
+	for _, id := range nodeIDs {
+		if t.GetNodeById(id) == nil {
+			return nil, fmt.Errorf("node %d does not exist", id)
+		}
+		selected[id] = true
+	}
+	defer t.deferOrder()()
+
+	// keep the nodes in the order of the graph
+	nodes := make([]*GraphNode, 0, len(selected))
+	for _, n := range t.Nodes {
+		if selected[n.ID] {
+			nodes = append(nodes, n)
+		}
+	}
+
+	sg := &SubgraphDefinition{
+		ID:          uuid.NewString(),
+		Version:     1,
+		Config:      make(map[string]interface{}),
+		Name:        name,
+		InputNode:   SubgraphIONode{ID: subgraphInputNodeID},
+		OutputNode:  SubgraphIONode{ID: subgraphOutputNodeID},
+		Inputs:      make([]SubgraphPort, 0),
+		Outputs:     make([]SubgraphPort, 0),
+		Widgets:     make([]interface{}, 0),
+		Nodes:       nodes,
+		Groups:      make([]*Group, 0),
+		Links:       make([]*Link, 0),
+		Extra:       make(map[string]interface{}),
+		ParentGraph: t,
+	}
+	var flags interface{} = map[string]interface{}{}
+	instance := &GraphNode{
+		ID:                 t.LastNodeID + 1,
+		Type:               sg.ID,
+		Flags:              &flags,
+		Order:              nodes[0].Order,
+		InternalProperties: &map[string]interface{}{},
+		WidgetValues:       make([]interface{}, 0),
+		Inputs:             make([]Slot, 0),
+		Outputs:            make([]Slot, 0),
+	}
+	hasProperties := false
+	for _, n := range nodes {
+		if n.Order < instance.Order {
+			instance.Order = n.Order
+		}
+		hasProperties = hasProperties || n.Properties != nil
+	}
+
+	// groups that hold only the converted nodes go with them
+	for _, g := range t.Groups {
+		members := t.GetNodesInGroup(g)
+		inside := len(members) != 0
+		for _, n := range members {
+			inside = inside && selected[n.ID]
+		}
+		if inside {
+			sg.Groups = append(sg.Groups, g)
+		}
+	}
+
+	moved := make(map[int]bool)
+	// links into the nodes are moved into the definition, and start at the input node
+	inputPorts := make(map[[2]int]int)
+	inputOrigins := make([][2]int, 0)
+	for _, n := range nodes {
+		for i := range n.Inputs {
+			l := t.GetLinkById(n.Inputs[i].Link)
+			if l == nil {
+				continue
+			}
+			moved[l.ID] = true
+			// the graph's reroutes are not part of the subgraph
+			t.detachReroutes(l)
+			if !selected[l.OriginID] {
+				key := [2]int{l.OriginID, l.OriginSlot}
+				port, ok := inputPorts[key]
+				if !ok {
+					port = len(sg.Inputs)
+					inputPorts[key] = port
+					inputOrigins = append(inputOrigins, key)
+					pname := uniquePortName(sg.Inputs, n.Inputs[i].Name)
+					sg.Inputs = append(sg.Inputs, SubgraphPort{ID: uuid.NewString(), Name: pname, Type: l.Type, LinkIds: []int{}})
+					slot := Slot{Name: pname, Type: l.Type}
+					if n.Inputs[i].Widget != nil {
+						slot.Widget = &Widget{Name: &pname}
+					}
+					instance.Inputs = append(instance.Inputs, slot)
+				}
+				if origin := t.GetNodeById(l.OriginID); origin != nil {
+					removeSlotLink(origin, l.OriginSlot, l.ID)
+				}
+				l.OriginID = sg.InputNode.ID
+				l.OriginSlot = port
+				sg.Inputs[port].LinkIds = append(sg.Inputs[port].LinkIds, l.ID)
+			}
+			l.isObjectFormat = true
+			sg.Links = append(sg.Links, l)
+		}
+	}
+
+	// links out of the nodes start at the instance, and the nodes are linked to the output node
+	outputPorts := make(map[[2]int]int)
+	for _, n := range nodes {
+		for i := range n.Outputs {
+			if n.Outputs[i].Links == nil {
+				continue
+			}
+			for _, id := range append([]int(nil), *n.Outputs[i].Links...) {
+				l := t.GetLinkById(id)
+				if l == nil || selected[l.TargetID] {
+					continue
+				}
+				key := [2]int{n.ID, i}
+				port, ok := outputPorts[key]
+				if !ok {
+					port = len(sg.Outputs)
+					outputPorts[key] = port
+					internal := &Link{
+						ID:             t.LastLinkID + 1,
+						OriginID:       n.ID,
+						OriginSlot:     i,
+						TargetID:       sg.OutputNode.ID,
+						TargetSlot:     port,
+						Type:           l.Type,
+						isObjectFormat: true,
+					}
+					t.LastLinkID = internal.ID
+					sg.Links = append(sg.Links, internal)
+					*n.Outputs[i].Links = append(*n.Outputs[i].Links, internal.ID)
+
+					pname := uniquePortName(sg.Outputs, n.Outputs[i].Name)
+					sg.Outputs = append(sg.Outputs, SubgraphPort{ID: uuid.NewString(), Name: pname, Type: l.Type, LinkIds: []int{internal.ID}})
+					instance.Outputs = append(instance.Outputs, Slot{Name: pname, Type: l.Type, Links: &[]int{}})
+				}
+				removeSlotLink(n, i, l.ID)
+				l.OriginID = instance.ID
+				l.OriginSlot = port
+				*instance.Outputs[port].Links = append(*instance.Outputs[port].Links, l.ID)
+			}
+		}
+	}
+
+	for _, l := range sg.Links {
+		if l.ID > sg.State.LastLinkId {
+			sg.State.LastLinkId = l.ID
+		}
+	}
+	for _, n := range nodes {
+		if n.ID > sg.State.LastNodeId {
+			sg.State.LastNodeId = n.ID
+		}
+	}
+	layoutSubgraph(sg, instance)
+
+	// take the nodes, links and groups out of the graph
+	t.Nodes = removeNodes(t.Nodes, selected)
+	for _, n := range nodes {
+		delete(t.NodesByID, n.ID)
+		n.Graph = nil
+	}
+	links := make([]*Link, 0, len(t.Links))
+	for _, l := range t.Links {
+		if moved[l.ID] {
+			delete(t.LinksByID, l.ID)
+			continue
+		}
+		links = append(links, l)
+	}
+	t.Links = links
+	for _, g := range sg.Groups {
+		for i, tg := range t.Groups {
+			if tg == g {
+				t.Groups = append(t.Groups[:i], t.Groups[i+1:]...)
+				break
+			}
+		}
+	}
+
+	if t.Definitions == nil {
+		t.Definitions = &GraphDefinitions{}
+	}
+	t.Definitions.Subgraphs = append(t.Definitions.Subgraphs, sg)
+	if t.SubgraphsByID == nil {
+		t.SubgraphsByID = make(map[string]*SubgraphDefinition)
+	}
+	t.SubgraphsByID[sg.ID] = sg
+	sg.BuildInternalMaps()
+
+	if err := t.AddNode(instance); err != nil {
+		return nil, err
+	}
+	for port, origin := range inputOrigins {
+		if _, err := t.AddLink(origin[0], origin[1], instance.ID, port); err != nil {
+			return nil, err
+		}
+	}
+	if hasProperties {
+		pindex := 0
+		instance.Properties = make(map[string]Property)
+		t.createSubgraphProperties(instance, &pindex)
+	}
+	return instance, nil
+}
+
+// UnpackSubgraph replaces a subgraph instance with copies of the nodes and links of its
+// definition.  The copies are given new ids, the links of the instance are connected to
+// them, and the values of its unconnected inputs are set on the nodes they lead to.  The
+// definition is removed when it has no other instances.  The copied nodes are returned.
+func (t *Graph) UnpackSubgraph(instance *GraphNode) ([]*GraphNode, error) {
+	if instance == nil || t.GetNodeById(instance.ID) != instance {
+		return nil, errors.New("node is not part of the graph")
+	}
+	sg := instance.SubgraphDef
+	if !instance.IsSubgraph || sg == nil {
+		return nil, fmt.Errorf("node %d is not a subgraph instance", instance.ID)
+	}
+	if sg.NodesByID == nil {
+		sg.BuildInternalMaps()
+	}
+	for _, l := range sg.Links {
+		if l.OriginID != sg.InputNode.ID && sg.GetNodeById(l.OriginID) == nil {
+			return nil, fmt.Errorf("subgraph link %d comes from missing node %d", l.ID, l.OriginID)
+		}
+		if l.TargetID != sg.OutputNode.ID && sg.GetNodeById(l.TargetID) == nil {
+			return nil, fmt.Errorf("subgraph link %d leads to missing node %d", l.ID, l.TargetID)
+		}
+	}
+	defer t.deferOrder()()
+
+	// what the instance's ports are connected to, or the values of its inputs
+	type endpoint struct {
+		node int
+		slot int
+	}
+	inputs := make([]*endpoint, len(sg.Inputs))
+	values := make([]interface{}, len(sg.Inputs))
+	for i, port := range sg.Inputs {
+		if slot := instance.GetInputWithName(port.Name); slot != nil {
+			if l := t.GetLinkById(slot.Link); l != nil {
+				inputs[i] = &endpoint{l.OriginID, l.OriginSlot}
+				continue
+			}
+		}
+		values[i] = instanceWidgetValue(instance, sg, port.Name)
+	}
+	outputs := make([][]endpoint, len(sg.Outputs))
+	for i := range sg.Outputs {
+		if i >= len(instance.Outputs) || instance.Outputs[i].Links == nil {
+			continue
+		}
+		for _, id := range *instance.Outputs[i].Links {
+			if l := t.GetLinkById(id); l != nil {
+				outputs[i] = append(outputs[i], endpoint{l.TargetID, l.TargetSlot})
+			}
+		}
+	}
+
+	// copy the nodes and their properties, the definitions are shared with the copies
+	c := newGraphCloner()
+	for _, d := range t.SubgraphsByID {
+		c.subgraphs[d] = d
+	}
+	nodes := c.copyNodes(sg.Nodes)
+	c.bindNodes(sg.Nodes, t)
+	sort.SliceStable(nodes, func(i, j int) bool { return nodes[i].Order < nodes[j].Order })
+
+	// the nodes keep their layout, at the instance's position
+	dx, dy := 0.0, 0.0
+	if x, y, ok := nodePosition(instance); ok {
+		if minX, minY, _, _, ok := nodeBounds(sg.Nodes); ok {
+			dx, dy = x-minX, y-minY
+		}
+	}
+
+	if err := t.RemoveNode(instance.ID); err != nil {
+		return nil, err
+	}
+	ids := make(map[int]int, len(nodes))
+	for _, n := range nodes {
+		ids[n.ID] = t.LastNodeID + 1
+		n.ID = ids[n.ID]
+		n.Order = instance.Order
+		for i := range n.Inputs {
+			n.Inputs[i].Link = 0
+		}
+		for i := range n.Outputs {
+			if n.Outputs[i].Links != nil {
+				n.Outputs[i].Links = &[]int{}
+			}
+		}
+		if x, y, ok := nodePosition(n); ok {
+			n.Position = []interface{}{x + dx, y + dy}
+		}
+		if err := t.AddNode(n); err != nil {
+			return nil, err
+		}
+	}
+	for _, g := range copyGroups(sg.Groups) {
+		if len(g.Bounding) == 4 {
+			g.Bounding[0] += dx
+			g.Bounding[1] += dy
+		}
+		t.Groups = append(t.Groups, g)
+	}
+
+	for _, l := range sg.Links {
+		var err error
+		switch {
+		case l.OriginID == sg.InputNode.ID:
+			if l.OriginSlot >= len(inputs) {
+				continue
+			}
+			if in := inputs[l.OriginSlot]; in != nil {
+				_, err = t.AddLink(in.node, in.slot, ids[l.TargetID], l.TargetSlot)
+			} else if values[l.OriginSlot] != nil {
+				err = setUnpackedInput(t.GetNodeById(ids[l.TargetID]), l.TargetSlot, values[l.OriginSlot])
+			}
+		case l.TargetID == sg.OutputNode.ID:
+			if l.TargetSlot >= len(outputs) {
+				continue
+			}
+			for _, out := range outputs[l.TargetSlot] {
+				if _, err = t.AddLink(ids[l.OriginID], l.OriginSlot, out.node, out.slot); err != nil {
+					break
+				}
+			}
+		default:
+			_, err = t.AddLink(ids[l.OriginID], l.OriginSlot, ids[l.TargetID], l.TargetSlot)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	t.removeUnusedSubgraph(sg)
+	return nodes, nil
+}
+
+// setUnpackedInput sets the value a subgraph instance gave an input of one of its nodes
+func setUnpackedInput(n *GraphNode, slot int, value interface{}) error {
+	if slot >= len(n.Inputs) {
+		return fmt.Errorf("node %d has no input slot %d", n.ID, slot)
+	}
+	name := n.Inputs[slot].Name
+	if w := n.Inputs[slot].Widget; w != nil && w.Name != nil {
+		name = *w.Name
+	}
+	p := n.GetPropertyWithName(name)
+	if p == nil {
+		slog.Warn("Cannot set the value of an unpacked subgraph input", "node", n.ID, "input", name)
+		return nil
+	}
+	if err := p.SetValue(value); err != nil {
+		return fmt.Errorf("node %d input %s: %w", n.ID, name, err)
+	}
+	return nil
+}
+
+// removeUnusedSubgraph removes a subgraph definition that has no instances
+func (t *Graph) removeUnusedSubgraph(sg *SubgraphDefinition) {
+	for _, n := range t.Nodes {
+		if n.Type == sg.ID {
+			return
+		}
+	}
+	if t.Definitions == nil {
+		return
+	}
+	for _, d := range t.Definitions.Subgraphs {
+		for _, n := range d.Nodes {
+			if n.Type == sg.ID {
+				return
+			}
+		}
+	}
+	for i, d := range t.Definitions.Subgraphs {
+		if d == sg {
+			t.Definitions.Subgraphs = append(t.Definitions.Subgraphs[:i], t.Definitions.Subgraphs[i+1:]...)
+			break
+		}
+	}
+	delete(t.SubgraphsByID, sg.ID)
+}
+
+// layoutSubgraph places the input and output nodes of a subgraph on either side of its
+// nodes, and its instance where the nodes were
+func layoutSubgraph(sg *SubgraphDefinition, instance *GraphNode) {
+	minX, minY, maxX, _, _ := nodeBounds(sg.Nodes)
+
+	height := func(ports int) float64 {
+		return float64((ports + 2) * subgraphIOSlotHeight)
+	}
+	sg.InputNode.Bounding = []float64{minX - subgraphIONodeGap - subgraphIONodeWidth, minY, subgraphIONodeWidth, height(len(sg.Inputs))}
+	sg.OutputNode.Bounding = []float64{maxX + subgraphIONodeGap, minY, subgraphIONodeWidth, height(len(sg.Outputs))}
+	for i := range sg.Inputs {
+		b := sg.InputNode.Bounding
+		sg.Inputs[i].Pos = []float64{b[0] + b[2] - subgraphIOSlotHeight, b[1] + float64((i+1)*subgraphIOSlotHeight)}
+	}
+	for i := range sg.Outputs {
+		b := sg.OutputNode.Bounding
+		sg.Outputs[i].Pos = []float64{b[0] + subgraphIOSlotHeight, b[1] + float64((i+1)*subgraphIOSlotHeight)}
+	}
+
+	rows := len(instance.Inputs)
+	if len(instance.Outputs) > rows {
+		rows = len(instance.Outputs)
+	}
+	instance.Position = []interface{}{minX, minY}
+	instance.Size = Size{Width: subgraphNodeWidth, Height: height(rows)}
+}
+
+// nodeBounds returns the box around the nodes that have a position
+func nodeBounds(nodes []*GraphNode) (float64, float64, float64, float64, bool) {
+	var minX, minY, maxX, maxY float64
+	found := false
+	for _, n := range nodes {
+		x, y, ok := nodePosition(n)
+		if !ok {
+			continue
+		}
+		if !found || x < minX {
+			minX = x
+		}
+		if !found || y < minY {
+			minY = y
+		}
+		if !found || x+n.Size.Width > maxX {
+			maxX = x + n.Size.Width
+		}
+		if !found || y+n.Size.Height > maxY {
+			maxY = y + n.Size.Height
+		}
+		found = true
+	}
+	return minX, minY, maxX, maxY, found
+}
+
+// uniquePortName returns name, numbered when a port already has it
+func uniquePortName(ports []SubgraphPort, name string) string {
+	taken := func(s string) bool {
+		for _, p := range ports {
+			if p.Name == s {
+				return true
+			}
+		}
+		return false
+	}
+	retv := name
+	for i := 1; taken(retv); i++ {
+		retv = fmt.Sprintf("%s_%d", name, i)
+	}
+	return retv
+}
+
+// removeSlotLink removes a link id from an output slot of a node
+func removeSlotLink(n *GraphNode, slot int, id int) {
+	if slot >= len(n.Outputs) || n.Outputs[slot].Links == nil {
+		return
+	}
+	links := n.Outputs[slot].Links
+	for i, lid := range *links {
+		if lid == id {
+			*links = append((*links)[:i], (*links)[i+1:]...)
+			return
+		}
+	}
+}
+
+func removeNodes(nodes []*GraphNode, ids map[int]bool) []*GraphNode {
+	retv := make([]*GraphNode, 0, len(nodes))
+	for _, n := range nodes {
+		if !ids[n.ID] {
+			retv = append(retv, n)
+		}
+	}
+	return retv
+}
@@ -0,0 +1,240 @@
+package graphapi
+
+import (
+	"encoding/json"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const subgraphEditTestPrompt = `{
+	"4": {"class_type": "CheckpointLoader", "inputs": {"ckpt_name": "b.safetensors"}},
+	"3": {"class_type": "KSampler", "inputs": {"model": ["4", 0], "seed": 42, "cfg": 6.5}, "_meta": {"title": "Sampler"}},
+	"5": {"class_type": "KSampler", "inputs": {"model": ["4", 0], "seed": 7, "cfg": 8}},
+	"9": {"class_type": "SaveLatent", "inputs": {"samples": ["3", 0]}}
+}`
+
+// promptNodesJSON returns the prompt's nodes as JSON, with node ids renamed
+func promptNodesJSON(t *testing.T, p Prompt, ids map[string]string) string {
+	nodes := make(map[string]PromptNode, len(p.Nodes))
+	for id, pn := range p.Nodes {
+		for name, v := range pn.Inputs {
+			if origin, slot, ok := promptInputLink(v); ok {
+				if nid, ok := ids[origin]; ok {
+					pn.Inputs[name] = []interface{}{nid, slot}
+				}
+			}
+		}
+		if nid, ok := ids[id]; ok {
+			id = nid
+		}
+		nodes[id] = pn
+	}
+	data, err := json.Marshal(nodes)
+	if err != nil {
+		t.Fatalf("Failed to marshal prompt: %v", err)
+	}
+	return string(data)
+}
+
+// TestConvertToSubgraph tests that converting nodes to a subgraph, reading it back and
+// unpacking it again leaves the prompt unchanged
+func TestConvertToSubgraph(t *testing.T) {
+	nodeObjects := newPromptGraphTestNodeObjects()
+	graph, missing, err := NewGraphFromPromptReader(strings.NewReader(subgraphEditTestPrompt), nodeObjects)
+	if err != nil {
+		t.Fatalf("Failed to create graph: %v %v", err, missing)
+	}
+	original, _ := graph.GraphToPrompt("")
+	want := promptNodesJSON(t, original, nil)
+
+	instance, err := graph.ConvertToSubgraph([]int{3, 5}, "Samplers")
+	if err != nil {
+		t.Fatalf("Failed to convert to subgraph: %v", err)
+	}
+	sg := instance.SubgraphDef
+	if instance.ID != 10 || sg == nil || sg.Name != "Samplers" || len(graph.Nodes) != 3 {
+		t.Fatalf("Unexpected instance %d of %v, %d nodes", instance.ID, sg, len(graph.Nodes))
+	}
+	// both samplers share the checkpoint's model, only the first is used outside
+	if len(sg.Inputs) != 1 || sg.Inputs[0].Name != "model" || len(sg.Inputs[0].LinkIds) != 2 {
+		t.Errorf("Expected one model input, got %+v", sg.Inputs)
+	}
+	if len(sg.Outputs) != 1 || sg.Outputs[0].Type != "LATENT" || len(sg.Links) != 3 {
+		t.Errorf("Expected one latent output and 3 links, got %+v %d", sg.Outputs, len(sg.Links))
+	}
+
+	converted, err := graph.GraphToPrompt("")
+	if err != nil {
+		t.Fatalf("Failed to generate prompt: %v", err)
+	}
+	if got := promptNodesJSON(t, converted, map[string]string{"10:3": "3", "10:5": "5"}); got != want {
+		t.Errorf("Converting changed the prompt:\n%s\n%s", want, got)
+	}
+
+	// the frontend's format
+	data, err := graph.GraphToJSON()
+	if err != nil {
+		t.Fatalf("Failed to serialize graph: %v", err)
+	}
+	if !strings.Contains(data, `"origin_id":-10`) || !strings.Contains(data, `[3,10,0,9,0,"LATENT"]`) {
+		t.Errorf("Unexpected links in %s", data)
+	}
+	reloaded, missing, err := NewGraphFromJsonString(data, nodeObjects)
+	if err != nil {
+		t.Fatalf("Failed to read graph: %v %v", err, missing)
+	}
+	p, err := reloaded.GraphToPrompt("")
+	if err != nil {
+		t.Fatalf("Failed to generate prompt: %v", err)
+	}
+	if got := promptNodesJSON(t, p, map[string]string{"10:3": "3", "10:5": "5"}); got != want {
+		t.Errorf("Reading the subgraph changed the prompt:\n%s\n%s", want, got)
+	}
+
+	nodes, err := reloaded.UnpackSubgraph(reloaded.GetNodeById(10))
+	if err != nil {
+		t.Fatalf("Failed to unpack subgraph: %v", err)
+	}
+	if len(nodes) != 2 || nodes[0].ID != 11 || nodes[1].ID != 12 || len(reloaded.Definitions.Subgraphs) != 0 {
+		t.Fatalf("Expected nodes 11 and 12 and no definitions, got %d nodes", len(nodes))
+	}
+	if nodes[0].Title != "Sampler" {
+		t.Errorf("Expected the copy of the sampler first, got %q", nodes[0].Title)
+	}
+	p, _ = reloaded.GraphToPrompt("")
+	if got := promptNodesJSON(t, p, map[string]string{"11": "3", "12": "5"}); got != want {
+		t.Errorf("Unpacking changed the prompt:\n%s\n%s", want, got)
+	}
+	data, _ = reloaded.GraphToJSON()
+	if _, _, err := NewGraphFromJsonString(data, nodeObjects); err != nil {
+		t.Errorf("Failed to read the unpacked graph: %v", err)
+	}
+
+	if _, err := graph.ConvertToSubgraph([]int{3}, "Missing"); err == nil {
+		t.Errorf("Expected converting a missing node to fail")
+	}
+	if _, err := graph.UnpackSubgraph(graph.GetNodeById(4)); err == nil {
+		t.Errorf("Expected unpacking a node that is not a subgraph to fail")
+	}
+}
+
+// TestUnpackSubgraphPromotedWidgets tests that the values of an instance's promoted
+// widgets are set on the unpacked nodes
+func TestUnpackSubgraphPromotedWidgets(t *testing.T) {
+	graph := newSelectorTestGraph(t)
+	if err := graph.Set("57.seed", 123); err != nil {
+		t.Fatalf("Failed to set seed: %v", err)
+	}
+	sg := graph.GetNodeById(57).SubgraphDef
+
+	nodes, err := graph.UnpackSubgraph(graph.GetNodeById(57))
+	if err != nil {
+		t.Fatalf("Failed to unpack subgraph: %v", err)
+	}
+	if len(nodes) != len(sg.Nodes) || graph.GetNodeById(57) != nil || len(graph.SubgraphsByID) != 0 {
+		t.Fatalf("Expected the instance to be replaced by %d nodes", len(sg.Nodes))
+	}
+	if len(graph.Groups) != 1+len(sg.Groups) {
+		t.Errorf("Expected the subgraph's groups, got %d groups", len(graph.Groups))
+	}
+
+	samplers := graph.GetNodesWithType("KSampler")
+	if len(samplers) != 1 || samplers[0].GetPropertyWithName("seed").GetValue() != int64(123) {
+		t.Fatalf("Expected the sampler to have the instance's seed")
+	}
+	// the definition is not changed
+	if sg.GetNodeById(3).GetPropertyWithName("seed").GetValue() == int64(123) {
+		t.Errorf("Expected the definition's sampler to keep its seed")
+	}
+
+	// the prompt and the image are connected to the unpacked nodes
+	save := graph.GetNodeById(9)
+	decode := save.GetNodeForInput(0)
+	if decode == nil || decode.Type != "VAEDecode" {
+		t.Errorf("Expected SaveImage to be linked to VAEDecode, got %v", decode)
+	}
+	if outputs := *graph.GetNodeById(58).Outputs[0].Links; len(outputs) != 1 {
+		t.Errorf("Expected the prompt to be linked once, got %v", outputs)
+	} else if target := graph.GetNodeById(graph.GetLinkById(outputs[0]).TargetID); target.Type != "CLIPTextEncode" {
+		t.Errorf("Expected the prompt to be linked to CLIPTextEncode, got %s", target.Type)
+	}
+
+	data, _ := graph.GraphToJSON()
+	var result map[string]interface{}
+	if err := json.Unmarshal([]byte(data), &result); err != nil {
+		t.Fatalf("Failed to parse the unpacked graph: %v", err)
+	}
+	for _, l := range result["links"].([]interface{}) {
+		if _, ok := l.([]interface{}); !ok {
+			t.Errorf("Expected links in tuple format, got %v", l)
+		}
+	}
+}
+
+// TestConvertToSubgraphRoundtrip tests that a subgraph converted from a subgraph's
+// unpacked nodes keeps the original's structure
+func TestConvertToSubgraphRoundtrip(t *testing.T) {
+	data, err := os.ReadFile("../examples/testdata/zimage-subgraph.json")
+	if err != nil {
+		t.Fatalf("Failed to read test file: %v", err)
+	}
+	var graph Graph
+	if err := json.Unmarshal(data, &graph); err != nil {
+		t.Fatalf("Failed to unmarshal graph: %v", err)
+	}
+	sg := graph.SubgraphsByID["f2fdebf6-dfaf-43b6-9eb2-7f70613cfdc1"]
+	before, _ := graph.GraphToPrompt("")
+
+	nodes, err := graph.UnpackSubgraph(graph.GetNodeById(57))
+	if err != nil {
+		t.Fatalf("Failed to unpack subgraph: %v", err)
+	}
+	ids := make([]int, len(nodes))
+	for i, n := range nodes {
+		ids[i] = n.ID
+	}
+	instance, err := graph.ConvertToSubgraph(ids, sg.Name)
+	if err != nil {
+		t.Fatalf("Failed to convert to subgraph: %v", err)
+	}
+	nsg := instance.SubgraphDef
+	// only the linked text input remains, the promoted widgets were unpacked
+	if len(nsg.Nodes) != len(sg.Nodes) || len(nsg.Links) != len(sg.Links)-3 {
+		t.Errorf("Expected %d nodes and %d links, got %d and %d", len(sg.Nodes), len(sg.Links)-3, len(nsg.Nodes), len(nsg.Links))
+	}
+	if len(nsg.Inputs) != 1 || nsg.Inputs[0].Name != "text" || instance.Inputs[0].Widget == nil {
+		t.Errorf("Expected the text input, got %+v", nsg.Inputs)
+	}
+
+	out, err := json.Marshal(&graph)
+	if err != nil {
+		t.Fatalf("Failed to marshal graph: %v", err)
+	}
+	var reloaded Graph
+	if err := json.Unmarshal(out, &reloaded); err != nil {
+		t.Fatalf("Failed to unmarshal graph: %v", err)
+	}
+	rsg := reloaded.Definitions.Subgraphs[0]
+	for i, link := range rsg.Links {
+		// the reloaded link keeps the object it was read from
+		got := *link
+		got.raw = nil
+		if !link.isObjectFormat || !reflect.DeepEqual(got, *nsg.Links[i]) {
+			t.Errorf("Subgraph link %d did not round-trip: %+v %+v", i, got, *nsg.Links[i])
+		}
+	}
+	if !reloaded.GetNodeById(instance.ID).IsSubgraph || rsg.InputNode.ID != -10 || rsg.OutputNode.ID != -20 {
+		t.Errorf("Expected the instance of the converted subgraph")
+	}
+
+	// without properties the promoted values are not set, the prompt keeps its shape
+	after, err := reloaded.GraphToPrompt("")
+	if err != nil {
+		t.Fatalf("Failed to generate prompt: %v", err)
+	}
+	if len(after.Nodes) != len(before.Nodes) {
+		t.Errorf("Expected %d prompt nodes, got %d", len(before.Nodes), len(after.Nodes))
+	}
+}
@@ -0,0 +1,266 @@
+package graphapi
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// PromptTemplate is a prompt compiled from a graph, with named parameters that are
+// filled in when it is rendered.  Rendering does not walk the graph or expand its
+// subgraphs, and a template is never changed once compiled, so it can be rendered
+// from many goroutines at once.
+//
+// Value control is not applied to a template, controlled values (seeds) that should
+// change have to be parameters.  Text flagged with dynamicPrompts is expanded each
+// time the template is rendered, using the shared math/rand source.
+type PromptTemplate struct {
+	workflow    *Graph
+	nodes       map[string]PromptNode
+	params      map[string]*templateParam
+	names       []string
+	dynamic     []templateSlot
+	wildcardDir string
+}
+
+// templateSlot is an input of a prompt node
+type templateSlot struct {
+	node  string
+	input string
+}
+
+// templateParam is a property of the compiled graph, and the inputs it is serialized to
+type templateParam struct {
+	prop  Property
+	value interface{}
+	slots []templateSlot
+}
+
+// templateMarker takes the place of a parameter's value while the graph is compiled
+type templateMarker struct {
+	name string
+}
+
+// Compile creates a template of the prompt the graph generates.  Each parameter is
+// the path of a property, see Get for the syntax, and is also the parameter's name.
+// A parameter that is not serialized to the prompt, e.g. a property of a muted node,
+// is an error.
+func (t *Graph) Compile(params ...string) (*PromptTemplate, error) {
+	// the parameters are marked in a copy of the graph, to find where they end up in the prompt
+	probe := t.Clone()
+	retv := &PromptTemplate{
+		workflow:    t.Clone(),
+		params:      make(map[string]*templateParam),
+		names:       make([]string, 0, len(params)),
+		wildcardDir: t.WildcardDir,
+	}
+
+	markers := make(map[*templateMarker]*templateParam)
+	names := make(map[Property]string)
+	for _, name := range params {
+		if _, ok := retv.params[name]; ok {
+			return nil, fmt.Errorf("parameter %q is given more than once", name)
+		}
+		prop, err := probe.Get(name)
+		if err != nil {
+			return nil, err
+		}
+		if other, ok := names[prop]; ok {
+			return nil, fmt.Errorf("parameters %q and %q are the same property", other, name)
+		}
+		switch prop.(type) {
+		case *CascadingProperty, *ImageUploadProperty, *UnknownProperty:
+			return nil, fmt.Errorf("parameter %q: a %s property cannot be a parameter", name, prop.TypeString())
+		}
+		names[prop] = name
+
+		param := &templateParam{prop: prop, value: prop.GetValue()}
+		marker := &templateMarker{name: name}
+		if err := setMarker(prop, marker); err != nil {
+			return nil, fmt.Errorf("parameter %q: %w", name, err)
+		}
+		markers[marker] = param
+		retv.params[name] = param
+		retv.names = append(retv.names, name)
+	}
+
+	p := Prompt{Nodes: make(map[string]PromptNode)}
+	promptIDs, err := probe.serializePromptNodes(&p)
+	if err != nil {
+		return nil, err
+	}
+	for id, pn := range p.Nodes {
+		for input, v := range pn.Inputs {
+			if marker, ok := v.(*templateMarker); ok {
+				param := markers[marker]
+				param.slots = append(param.slots, templateSlot{node: id, input: input})
+				pn.Inputs[input] = param.value
+			}
+		}
+	}
+	for _, name := range retv.names {
+		if len(retv.params[name].slots) == 0 {
+			return nil, fmt.Errorf("parameter %q is not part of the prompt", name)
+		}
+	}
+	retv.nodes = p.Nodes
+
+	// the inputs with dynamic prompts, in the order expandDynamicPrompts visits them
+	for node, ids := range promptIDs {
+		for name, prop := range node.Properties {
+			sp, ok := prop.ToStringProperty()
+			if !ok || !sp.DynamicPrompts || !sp.Serializable() {
+				continue
+			}
+			for _, id := range ids {
+				if _, ok := p.Nodes[id]; ok {
+					retv.dynamic = append(retv.dynamic, templateSlot{node: id, input: name})
+				}
+			}
+		}
+	}
+	sort.Slice(retv.dynamic, func(i, j int) bool {
+		a, b := retv.dynamic[i], retv.dynamic[j]
+		if a.node != b.node {
+			return a.node < b.node
+		}
+		return a.input < b.input
+	})
+	return retv, nil
+}
+
+// setMarker writes a value to the widget of a property and its secondaries, without
+// converting it
+func setMarker(p Property, marker *templateMarker) error {
+	b := p.base()
+	if b.direct_value != nil {
+		*b.direct_value = marker
+		return nil
+	}
+	if b.target_node == nil {
+		return errors.New("property has no target node")
+	}
+	if b.target_node.IsWidgetValueArray() {
+		arr := b.target_node.WidgetValuesArray()
+		if b.target_value_index < 0 || b.target_value_index >= len(arr) {
+			return errors.New("property has no widget value")
+		}
+		arr[b.target_value_index] = marker
+	} else {
+		b.target_node.WidgetValuesMap()[b.name] = marker
+	}
+	for _, s := range b.secondaries {
+		if err := setMarker(s, marker); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Params returns the names of the template's parameters, in the order they were compiled
+func (pt *PromptTemplate) Params() []string {
+	return append([]string(nil), pt.names...)
+}
+
+// Workflow returns the graph the template was compiled from, as it was when compiled.
+// It must not be changed.
+func (pt *PromptTemplate) Workflow() *Graph {
+	return pt.workflow
+}
+
+// Render returns a new prompt with the given parameter values.  Values are checked
+// the way SetValueStrict checks them, and parameters that are not given keep the
+// value they had when the template was compiled.
+//
+// The workflow embedded in the prompt's extra data is the one returned by Workflow,
+// shared by every render, so its widgets show the values from when the template was
+// compiled, not the rendered ones.  Use RenderWithWorkflow when the workflow saved
+// with the outputs has to match the prompt.
+func (pt *PromptTemplate) Render(clientID string, params map[string]interface{}) (Prompt, error) {
+	p := Prompt{
+		ClientID: clientID,
+		Nodes:    make(map[string]PromptNode, len(pt.nodes)),
+	}
+	for name := range params {
+		if _, ok := pt.params[name]; !ok {
+			return p, fmt.Errorf("template has no parameter %q", name)
+		}
+	}
+
+	for id, pn := range pt.nodes {
+		inputs := make(map[string]interface{}, len(pn.Inputs))
+		for k, v := range pn.Inputs {
+			if link, ok := v.([]interface{}); ok {
+				v = append([]interface{}(nil), link...)
+			}
+			inputs[k] = v
+		}
+		p.Nodes[id] = PromptNode{ClassType: pn.ClassType, Inputs: inputs, Meta: pn.Meta}
+	}
+
+	for _, name := range pt.names {
+		v, ok := params[name]
+		if !ok {
+			continue
+		}
+		param := pt.params[name]
+		val, err := param.prop.strictValue(v)
+		if err != nil {
+			return p, fmt.Errorf("parameter %q: %w", name, err)
+		}
+		for _, s := range param.slots {
+			p.Nodes[s.node].Inputs[s.input] = val
+		}
+	}
+
+	var expander *DynamicPromptExpander
+	for _, s := range pt.dynamic {
+		text, ok := p.Nodes[s.node].Inputs[s.input].(string)
+		if !ok {
+			// linked inputs are not expanded
+			continue
+		}
+		if expander == nil {
+			expander = NewDynamicPromptExpander(pt.wildcardDir, nil)
+		}
+		expanded, err := expander.Expand(text)
+		if err != nil {
+			return p, fmt.Errorf("node %s input %s: %w", s.node, s.input, err)
+		}
+		p.Nodes[s.node].Inputs[s.input] = expanded
+		if p.ExpandedText == nil {
+			p.ExpandedText = make(map[string]map[string]string)
+		}
+		if p.ExpandedText[s.node] == nil {
+			p.ExpandedText[s.node] = make(map[string]string)
+		}
+		p.ExpandedText[s.node][s.input] = expanded
+	}
+
+	p.ExtraData.PngInfo.Workflow = pt.workflow
+	return p, nil
+}
+
+// RenderWithWorkflow is Render, but the embedded workflow is a copy of the compiled
+// workflow with the parameter values set, so it matches the prompt.  Text expanded
+// from dynamic prompts is kept unexpanded in the workflow, as it is by GraphToPrompt.
+// Copying the workflow makes it much slower than Render.
+func (pt *PromptTemplate) RenderWithWorkflow(clientID string, params map[string]interface{}) (Prompt, error) {
+	p, err := pt.Render(clientID, params)
+	if err != nil {
+		return p, err
+	}
+
+	workflow := pt.workflow.Clone()
+	for _, name := range pt.names {
+		v, ok := params[name]
+		if !ok {
+			continue
+		}
+		if err := workflow.Set(name, v); err != nil {
+			return p, fmt.Errorf("parameter %q: %w", name, err)
+		}
+	}
+	p.ExtraData.PngInfo.Workflow = workflow
+	return p, nil
+}
@@ -0,0 +1,209 @@
+package graphapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// TestCompileMatchesGraphToPrompt tests that rendering without parameters gives the
+// prompt the graph generates
+func TestCompileMatchesGraphToPrompt(t *testing.T) {
+	graph := newSelectorTestGraph(t)
+	tmpl, err := graph.Compile("57:3.cfg", "Prompt.value")
+	if err != nil {
+		t.Fatalf("Failed to compile: %v", err)
+	}
+
+	want, err := graph.GraphToPrompt("client")
+	if err != nil {
+		t.Fatalf("Failed to generate prompt: %v", err)
+	}
+	got, err := tmpl.Render("client", nil)
+	if err != nil {
+		t.Fatalf("Failed to render: %v", err)
+	}
+	wantJSON, _ := json.Marshal(want.Nodes)
+	gotJSON, _ := json.Marshal(got.Nodes)
+	if string(wantJSON) != string(gotJSON) {
+		t.Errorf("Rendered prompt differs:\n%s\n%s", wantJSON, gotJSON)
+	}
+	if got.ClientID != "client" || got.ExtraData.PngInfo.Workflow != tmpl.Workflow() {
+		t.Errorf("Expected the client ID and workflow to be set")
+	}
+	wantJSON, _ = json.Marshal(graph)
+	gotJSON, _ = json.Marshal(got.ExtraData.PngInfo.Workflow)
+	if string(wantJSON) != string(gotJSON) {
+		t.Errorf("Embedded workflow differs from the compiled graph")
+	}
+}
+
+// TestRenderWithWorkflow tests that the embedded workflow has the rendered values,
+// and generates the rendered prompt
+func TestRenderWithWorkflow(t *testing.T) {
+	graph := newSelectorTestGraph(t)
+	tmpl, err := graph.Compile("57:3.cfg", "Prompt.value")
+	if err != nil {
+		t.Fatalf("Failed to compile: %v", err)
+	}
+	params := map[string]interface{}{"57:3.cfg": 4.5, "Prompt.value": "a lighthouse"}
+
+	// Render embeds the workflow as compiled
+	p, err := tmpl.Render("", params)
+	if err != nil {
+		t.Fatalf("Failed to render: %v", err)
+	}
+	if v, _ := p.ExtraData.PngInfo.Workflow.Get("57:3.cfg"); v.GetValue() == 4.5 {
+		t.Errorf("Expected Render to embed the compiled values")
+	}
+
+	p, err = tmpl.RenderWithWorkflow("", params)
+	if err != nil {
+		t.Fatalf("Failed to render: %v", err)
+	}
+	workflow := p.ExtraData.PngInfo.Workflow
+	if workflow == tmpl.Workflow() {
+		t.Fatalf("Expected a copy of the workflow")
+	}
+	for name, want := range params {
+		if v, _ := workflow.Get(name); v.GetValue() != want {
+			t.Errorf("Expected %s to be %v in the workflow, got %v", name, want, v.GetValue())
+		}
+	}
+	if v, _ := tmpl.Workflow().Get("57:3.cfg"); v.GetValue() == 4.5 {
+		t.Errorf("Expected the template's workflow to be unchanged")
+	}
+
+	want, err := workflow.GraphToPrompt("")
+	if err != nil {
+		t.Fatalf("Failed to generate prompt: %v", err)
+	}
+	wantJSON, _ := json.Marshal(want.Nodes)
+	gotJSON, _ := json.Marshal(p.Nodes)
+	if string(wantJSON) != string(gotJSON) {
+		t.Errorf("Embedded workflow generates a different prompt:\n%s\n%s", wantJSON, gotJSON)
+	}
+}
+
+// TestRenderParameters tests filling parameters, including primitives and subgraph nodes
+func TestRenderParameters(t *testing.T) {
+	tmpl, err := newCloneTestGraph(t).Compile("Seed.value")
+	if err != nil {
+		t.Fatalf("Failed to compile: %v", err)
+	}
+	p, err := tmpl.Render("", map[string]interface{}{"Seed.value": 42})
+	if err != nil {
+		t.Fatalf("Failed to render: %v", err)
+	}
+	for _, id := range []string{"3", "4"} {
+		if v := p.Nodes[id].Inputs["seed"]; fmt.Sprint(v) != "42" {
+			t.Errorf("Expected the primitive to set node %s, got %v", id, v)
+		}
+	}
+
+	graph := newSelectorTestGraph(t)
+	tmpl, err = graph.Compile("57:3.cfg", "Prompt.value")
+	if err != nil {
+		t.Fatalf("Failed to compile: %v", err)
+	}
+	p, err = tmpl.Render("", map[string]interface{}{"57:3.cfg": 4.5, "Prompt.value": "a lighthouse"})
+	if err != nil {
+		t.Fatalf("Failed to render: %v", err)
+	}
+	if v := p.Nodes["57:3"].Inputs["cfg"]; v != 4.5 {
+		t.Errorf("Expected cfg 4.5, got %v", v)
+	}
+	if v := p.Nodes["58"].Inputs["value"]; v != "a lighthouse" {
+		t.Errorf("Expected the prompt text, got %v", v)
+	}
+
+	// the template and graph are unchanged by rendering
+	again, _ := tmpl.Render("", nil)
+	if v := again.Nodes["57:3"].Inputs["cfg"]; v == 4.5 {
+		t.Errorf("Expected rendering to leave the template unchanged")
+	}
+	if p, _ := graph.Get("57:3.cfg"); p.GetValue() == 4.5 {
+		t.Errorf("Expected rendering to leave the graph unchanged")
+	}
+
+	if _, err := tmpl.Render("", map[string]interface{}{"57:3.cfg": 1000}); err == nil || !strings.Contains(err.Error(), "out of range") {
+		t.Errorf("Expected an out of range error, got %v", err)
+	}
+	if _, err := tmpl.Render("", map[string]interface{}{"57:3.seed": 1}); err == nil {
+		t.Errorf("Expected an unknown parameter to be rejected")
+	}
+	if _, err := graph.Compile("57:3.cfg", "57/KSampler.cfg"); err == nil {
+		t.Errorf("Expected parameters of the same property to be rejected")
+	}
+}
+
+// TestRenderConcurrently tests rendering a template from many goroutines
+func TestRenderConcurrently(t *testing.T) {
+	tmpl, err := newCloneTestGraph(t).Compile("Seed.value")
+	if err != nil {
+		t.Fatalf("Failed to compile: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			p, err := tmpl.Render("", map[string]interface{}{"Seed.value": i})
+			if err != nil {
+				t.Errorf("Failed to render: %v", err)
+				return
+			}
+			if v := p.Nodes["4"].Inputs["seed"]; fmt.Sprint(v) != fmt.Sprint(i) {
+				t.Errorf("Expected seed %d, got %v", i, v)
+			}
+			if _, err := json.Marshal(p); err != nil {
+				t.Errorf("Failed to serialize: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func BenchmarkGraphToPrompt(b *testing.B) {
+	graph := newSelectorTestGraph(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := graph.Set("57:3.cfg", float64(i%100)); err != nil {
+			b.Fatal(err)
+		}
+		if _, err := graph.GraphToPrompt(""); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkPromptTemplateRender(b *testing.B) {
+	tmpl, err := newSelectorTestGraph(b).Compile("57:3.cfg")
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := tmpl.Render("", map[string]interface{}{"57:3.cfg": float64(i % 100)}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkPromptTemplateRenderParallel(b *testing.B) {
+	tmpl, err := newSelectorTestGraph(b).Compile("57:3.cfg")
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := tmpl.Render("", map[string]interface{}{"57:3.cfg": 4.5}); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
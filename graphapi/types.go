@@ -43,9 +43,12 @@ func (p *Pos) MarshalJSON() ([]byte, error) {
 type Size struct {
 	Width  float64
 	Height float64
+	// the size as it was read, written again while it is unchanged
+	raw []byte
 }
 
 func (s *Size) UnmarshalJSON(b []byte) error {
+	s.raw = append([]byte(nil), b...)
 	// First try to unmarshal as array
 	var tmpArr []interface{}
 	if err := json.Unmarshal(b, &tmpArr); err == nil && len(tmpArr) == 2 {
@@ -103,8 +106,14 @@ func (s *Size) UnmarshalJSON(b []byte) error {
 // }
 
 // it seems the json code can have either an array of values, or a dictionary of values
-// when marshaling, we'll always output as an array.
+// when marshaling, we'll output as an array unless the size is unchanged.
 func (s *Size) MarshalJSON() ([]byte, error) {
+	if s.raw != nil {
+		var read Size
+		if err := read.UnmarshalJSON(s.raw); err == nil && read.Width == s.Width && read.Height == s.Height {
+			return s.raw, nil
+		}
+	}
 	tmp := []float64{s.Width, s.Height}
 	return json.Marshal(tmp)
 }
@@ -0,0 +1,236 @@
+package graphapi
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+)
+
+// ValueControlMode selects when, if ever, the "control_after_generate" widgets
+// of a graph are applied while generating a prompt.
+type ValueControlMode int
+
+const (
+	// ValueControlDisabled leaves seed values untouched (the default)
+	ValueControlDisabled ValueControlMode = iota
+	// ValueControlAfterGenerate serializes the current value, then applies the
+	// control mode so the next prompt gets a new value.  This is the default
+	// behaviour of the ComfyUI frontend.
+	ValueControlAfterGenerate
+	// ValueControlBeforeGenerate applies the control mode before serializing,
+	// except for the very first prompt generated from the graph.  This matches
+	// the frontend's "control_before_generate" setting.
+	ValueControlBeforeGenerate
+)
+
+// the value control modes that can be set in a "control_after_generate" COMBO
+const (
+	ValueControlFixed     = "fixed"
+	ValueControlIncrement = "increment"
+	ValueControlDecrement = "decrement"
+	ValueControlRandomize = "randomize"
+)
+
+// the frontend limits controlled values to +/- 2^50 so they survive a round trip
+// through a javascript number
+const valueControlLimit int64 = 1125899906842624
+
+// controlledValue pairs an INT property with its "control_after_generate" COMBO
+type controlledValue struct {
+	node    *GraphNode
+	target  *IntProperty
+	control Property
+}
+
+// GetControlledValues returns the INT properties of the node that have an
+// associated "control_after_generate" widget, keyed by property name.
+func (n *GraphNode) GetControlledValues() map[string]*IntProperty {
+	retv := make(map[string]*IntProperty)
+	for _, cv := range n.controlledValues() {
+		retv[cv.target.Name()] = cv.target
+	}
+	return retv
+}
+
+// controlledValues returns the node's controlled values in widget order, so that
+// randomized values are drawn in the same order each time
+func (n *GraphNode) controlledValues() []controlledValue {
+	retv := make([]controlledValue, 0)
+	if n.Properties == nil {
+		return retv
+	}
+
+	// the control widget is always added directly after the INT it controls, and is
+	// paired with it when the properties are created
+	for _, p := range n.Properties {
+		ip, ok := p.ToIntProperty()
+		if !ok {
+			continue
+		}
+		control := ip.control
+		if control == nil {
+			if c, ok := n.Properties["control_after_generate"]; ok && ip.Index() == c.Index()-1 {
+				control = c
+			}
+		}
+		if control == nil {
+			continue
+		}
+
+		// values driven by a link are not ours to change
+		slot := n.GetInputWithName(ip.Name())
+		if slot != nil && slot.Link != 0 {
+			continue
+		}
+		retv = append(retv, controlledValue{node: n, target: ip, control: control})
+	}
+	sort.Slice(retv, func(i, j int) bool {
+		return retv[i].target.Index() < retv[j].target.Index()
+	})
+	return retv
+}
+
+// collectControlledValues gathers all controlled values from the top-level
+// nodes and the nodes within subgraph definitions
+func (t *Graph) collectControlledValues() []controlledValue {
+	retv := make([]controlledValue, 0)
+	for _, n := range t.Nodes {
+		if n.Mode == 2 {
+			continue
+		}
+		retv = append(retv, n.controlledValues()...)
+	}
+	if t.Definitions != nil {
+		for _, sg := range t.Definitions.Subgraphs {
+			for _, n := range sg.Nodes {
+				if n.Mode == 2 {
+					continue
+				}
+				retv = append(retv, n.controlledValues()...)
+			}
+		}
+	}
+	return retv
+}
+
+// ApplyValueControl applies each node's "control_after_generate" mode to the
+// value it controls, as the ComfyUI frontend does when a prompt is queued.
+// Values are kept within the range of the INT property.
+func (t *Graph) ApplyValueControl() error {
+	for _, cv := range t.collectControlledValues() {
+		if err := t.applyControlledValue(cv); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *Graph) applyControlledValue(cv controlledValue) error {
+	mode, _ := cv.control.GetValue().(string)
+	if mode == "" || mode == ValueControlFixed {
+		return nil
+	}
+
+	p := cv.target
+	min := p.Min
+	max := p.Max
+	if max > valueControlLimit {
+		max = valueControlLimit
+	}
+	if min < -valueControlLimit {
+		min = -valueControlLimit
+	}
+	step := p.Step
+	if !p.HasStep() || step <= 0 {
+		step = 1
+	}
+
+	v, ok := toInt64(p.GetValue())
+	if !ok {
+		v = p.Default
+	}
+
+	switch mode {
+	case ValueControlIncrement:
+		v += step
+	case ValueControlDecrement:
+		v -= step
+	case ValueControlRandomize:
+		r := (max - min) / step
+		if r > 0 {
+			v = t.randomInt63n(r)*step + min
+		} else {
+			v = min
+		}
+	default:
+		return nil
+	}
+
+	if v < min {
+		v = min
+	}
+	if v > max {
+		v = max
+	}
+	return p.SetValue(v)
+}
+
+func (t *Graph) randomInt63n(n int64) int64 {
+	if t.Random != nil {
+		return t.Random.Int63n(n)
+	}
+	return rand.Int63n(n)
+}
+
+func (t *Graph) randomIntn(n int) int {
+	if t.Random != nil {
+		return t.Random.Intn(n)
+	}
+	return rand.Intn(n)
+}
+
+// recordControlledValues stores the values of the controlled properties, as they
+// were serialized, into the prompt's Seeds map
+func recordControlledValues(p *Prompt, values []controlledValue, promptIDs map[*GraphNode][]string) {
+	for _, cv := range values {
+		v, ok := toInt64(cv.target.GetValue())
+		if !ok {
+			continue
+		}
+		for _, id := range promptIDs[cv.node] {
+			if _, ok := p.Nodes[id]; !ok {
+				continue
+			}
+			if p.Seeds == nil {
+				p.Seeds = make(map[string]map[string]int64)
+			}
+			if p.Seeds[id] == nil {
+				p.Seeds[id] = make(map[string]int64)
+			}
+			p.Seeds[id][cv.target.Name()] = v
+		}
+	}
+}
+
+func toInt64(v interface{}) (int64, bool) {
+	switch val := v.(type) {
+	case int64:
+		return val, true
+	case int:
+		return int64(val), true
+	case int32:
+		return int64(val), true
+	case float64:
+		if val >= float64(math.MaxInt64) {
+			return math.MaxInt64, true
+		}
+		return int64(val), true
+	case float32:
+		return int64(val), true
+	case string:
+		i, err := strconv.ParseInt(val, 10, 64)
+		return i, err == nil
+	}
+	return 0, false
+}
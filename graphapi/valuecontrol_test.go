@@ -0,0 +1,176 @@
+package graphapi
+
+import (
+	"encoding/json"
+	"math/rand"
+	"testing"
+)
+
+func newValueControlTestGraph(t *testing.T, control string) *Graph {
+	input := `{
+		"nodes": [
+			{
+				"id": 1,
+				"type": "RandomNoise",
+				"pos": [0, 0],
+				"size": [300, 100],
+				"flags": {},
+				"order": 0,
+				"mode": 0,
+				"inputs": [],
+				"outputs": [],
+				"properties": {},
+				"widgets_values": [10, "` + control + `"]
+			}
+		],
+		"links": [],
+		"groups": [],
+		"last_node_id": 1,
+		"last_link_id": 0,
+		"version": 0.4
+	}`
+
+	var graph Graph
+	if err := json.Unmarshal([]byte(input), &graph); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+
+	var seedData interface{} = []interface{}{"INT", map[string]interface{}{"default": float64(0), "min": float64(0), "max": float64(20)}}
+	nodeObjects := &NodeObjects{
+		Objects: map[string]*NodeObject{
+			"RandomNoise": {
+				Name: "RandomNoise",
+				Input: &NodeObjectInput{
+					Required:        map[string]*interface{}{"noise_seed": &seedData},
+					OrderedRequired: []string{"noise_seed"},
+				},
+			},
+		},
+	}
+	nodeObjects.PopulateInputProperties()
+	graph.CreateNodeProperties(nodeObjects)
+	return &graph
+}
+
+// TestValueControlAfterGenerate verifies seeds are serialized, recorded, then changed
+func TestValueControlAfterGenerate(t *testing.T) {
+	graph := newValueControlTestGraph(t, "increment")
+	graph.ValueControl = ValueControlAfterGenerate
+
+	for _, expected := range []int64{10, 11, 12} {
+		prompt, err := graph.GraphToPrompt("test")
+		if err != nil {
+			t.Fatalf("Failed to generate prompt: %v", err)
+		}
+		v, _ := toInt64(prompt.Nodes["1"].Inputs["noise_seed"])
+		if v != expected {
+			t.Errorf("Expected serialized seed %d, got %d", expected, v)
+		}
+		if prompt.Seeds["1"]["noise_seed"] != expected {
+			t.Errorf("Expected recorded seed %d, got %v", expected, prompt.Seeds["1"])
+		}
+	}
+}
+
+// TestValueControlBeforeGenerate verifies the first generation is left untouched
+func TestValueControlBeforeGenerate(t *testing.T) {
+	graph := newValueControlTestGraph(t, "decrement")
+	graph.ValueControl = ValueControlBeforeGenerate
+
+	for _, expected := range []int64{10, 9, 8} {
+		prompt, err := graph.GraphToPrompt("test")
+		if err != nil {
+			t.Fatalf("Failed to generate prompt: %v", err)
+		}
+		if prompt.Seeds["1"]["noise_seed"] != expected {
+			t.Errorf("Expected recorded seed %d, got %v", expected, prompt.Seeds["1"])
+		}
+	}
+}
+
+// TestValueControlRandomizeRange verifies randomized values stay in range
+func TestValueControlRandomizeRange(t *testing.T) {
+	graph := newValueControlTestGraph(t, "randomize")
+	graph.ValueControl = ValueControlAfterGenerate
+	graph.Random = rand.New(rand.NewSource(1))
+
+	for i := 0; i < 50; i++ {
+		prompt, err := graph.GraphToPrompt("test")
+		if err != nil {
+			t.Fatalf("Failed to generate prompt: %v", err)
+		}
+		v := prompt.Seeds["1"]["noise_seed"]
+		if v < 0 || v > 20 {
+			t.Fatalf("Randomized seed %d out of range", v)
+		}
+	}
+}
+
+// TestValueControlDisabled verifies the default leaves values alone
+func TestValueControlDisabled(t *testing.T) {
+	graph := newValueControlTestGraph(t, "increment")
+	for i := 0; i < 2; i++ {
+		prompt, err := graph.GraphToPrompt("test")
+		if err != nil {
+			t.Fatalf("Failed to generate prompt: %v", err)
+		}
+		if prompt.Seeds != nil {
+			t.Error("Expected no recorded seeds when value control is disabled")
+		}
+		v, _ := toInt64(prompt.Nodes["1"].Inputs["noise_seed"])
+		if v != 10 {
+			t.Errorf("Expected seed to remain 10, got %d", v)
+		}
+	}
+}
+
+// TestValueControlTwoSeeds verifies each controlled INT of a node follows its own
+// control widget
+func TestValueControlTwoSeeds(t *testing.T) {
+	input := `{
+		"nodes": [
+			{"id": 1, "type": "TwoSeeds", "pos": [0, 0], "size": [300, 100], "flags": {}, "order": 0, "mode": 0,
+			 "inputs": [], "outputs": [], "properties": {}, "widgets_values": [10, "increment", 5, "fixed"]}
+		],
+		"links": [],
+		"groups": [],
+		"last_node_id": 1,
+		"last_link_id": 0,
+		"version": 0.4
+	}`
+	var graph Graph
+	if err := json.Unmarshal([]byte(input), &graph); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	var seedData interface{} = []interface{}{"INT", map[string]interface{}{"default": float64(0), "min": float64(0), "max": float64(20)}}
+	nodeObjects := &NodeObjects{
+		Objects: map[string]*NodeObject{
+			"TwoSeeds": {
+				Name: "TwoSeeds",
+				Input: &NodeObjectInput{
+					Required:        map[string]*interface{}{"seed": &seedData, "noise_seed": &seedData},
+					OrderedRequired: []string{"seed", "noise_seed"},
+				},
+			},
+		},
+	}
+	nodeObjects.PopulateInputProperties()
+	graph.CreateNodeProperties(nodeObjects)
+	graph.ValueControl = ValueControlAfterGenerate
+
+	if n := len(graph.GetNodeById(1).GetControlledValues()); n != 2 {
+		t.Fatalf("Expected 2 controlled values, got %d", n)
+	}
+	// a copy, made before the values change, pairs its own widgets
+	for _, g := range []*Graph{&graph, graph.Clone()} {
+		for _, expected := range []int64{10, 11, 12} {
+			prompt, err := g.GraphToPrompt("test")
+			if err != nil {
+				t.Fatalf("Failed to generate prompt: %v", err)
+			}
+			if prompt.Seeds["1"]["seed"] != expected || prompt.Seeds["1"]["noise_seed"] != 5 {
+				t.Errorf("Expected seed %d and a fixed noise_seed 5, got %v", expected, prompt.Seeds["1"])
+			}
+		}
+	}
+}
@@ -4,4 +4,17 @@ package graphapi
 type Widget struct {
 	Name   *string      `json:"name"`
 	Config *interface{} `json:"config"`
+	raw    *rawJSON
+}
+
+func (w *Widget) UnmarshalJSON(b []byte) error {
+	type Alias Widget
+	raw, err := unmarshalPreserving(b, (*Alias)(w))
+	w.raw = raw
+	return err
+}
+
+func (w *Widget) MarshalJSON() ([]byte, error) {
+	type Alias Widget
+	return marshalPreserving((*Alias)(w), w.raw)
 }
@@ -3,6 +3,9 @@ package graphapi
 import (
 	"encoding/json"
 	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -1105,3 +1108,164 @@ func compareField(t *testing.T, name string, expected, actual interface{}) {
 		t.Errorf("%s mismatch: expected %v, got %v", name, expected, actual)
 	}
 }
+
+// readObjectInfo reads node types saved from the server's object_info
+func readObjectInfo(t *testing.T, path string) *NodeObjects {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read object info: %v", err)
+	}
+	nodeObjects := &NodeObjects{}
+	if err := json.Unmarshal(data, &nodeObjects.Objects); err != nil {
+		t.Fatalf("Failed to unmarshal object info: %v", err)
+	}
+	nodeObjects.PopulateInputProperties()
+	return nodeObjects
+}
+
+// comparePrompt compares a prompt's nodes with those of a prompt in API format
+func comparePrompt(t *testing.T, prompt Prompt, apiPath string) {
+	var want map[string]PromptNode
+	data, err := os.ReadFile(apiPath)
+	if err != nil {
+		t.Fatalf("Failed to read prompt: %v", err)
+	}
+	if err := json.Unmarshal(data, &want); err != nil {
+		t.Fatalf("Failed to unmarshal prompt: %v", err)
+	}
+	for id := range prompt.Nodes {
+		if _, ok := want[id]; !ok {
+			t.Errorf("Unexpected node %s %s", id, prompt.Nodes[id].ClassType)
+		}
+	}
+	for id, wn := range want {
+		gn, ok := prompt.Nodes[id]
+		if !ok {
+			t.Errorf("Missing node %s %s", id, wn.ClassType)
+			continue
+		}
+		// compare through JSON, as the values read are all float64
+		var got, expected interface{}
+		gdata, _ := json.Marshal(gn.Inputs)
+		wdata, _ := json.Marshal(wn.Inputs)
+		json.Unmarshal(gdata, &got)
+		json.Unmarshal(wdata, &expected)
+		if gn.ClassType != wn.ClassType || !reflect.DeepEqual(got, expected) {
+			t.Errorf("Node %s:\nwant %s %s\ngot  %s %s", id, wn.ClassType, wdata, gn.ClassType, gdata)
+		}
+	}
+}
+
+// TestSubgraphExpectedPrompts tests the prompts of the workflows in testdata/subgraphs
+// against the prompts in <name>_expected.json.  These are written by hand from the
+// frontend's rules rather than exported from it, see testdata/README.md, so they catch
+// changes to the prompts but cannot show that they agree with the frontend.
+// TestFrontendGoldens does that.
+func TestSubgraphExpectedPrompts(t *testing.T) {
+	nodeObjects := readObjectInfo(t, "../examples/testdata/subgraphs/object_info.json")
+
+	files, err := filepath.Glob("../examples/testdata/subgraphs/*_expected.json")
+	if err != nil || len(files) == 0 {
+		t.Fatalf("No expected prompts found: %v", err)
+	}
+	for _, apiPath := range files {
+		name := strings.TrimSuffix(filepath.Base(apiPath), "_expected.json")
+		t.Run(name, func(t *testing.T) {
+			graph, missing, err := NewGraphFromJsonFile(strings.TrimSuffix(apiPath, "_expected.json")+".json", nodeObjects)
+			if err != nil {
+				t.Fatalf("Failed to read workflow: %v", err)
+			}
+			if missing != nil && len(*missing) > 0 {
+				t.Fatalf("Missing node types: %v", *missing)
+			}
+			prompt, err := graph.GraphToPrompt("")
+			if err != nil {
+				t.Fatalf("Failed to generate prompt: %v", err)
+			}
+			comparePrompt(t, prompt, apiPath)
+		})
+	}
+}
+
+// frontendExportsDir holds workflows saved by the ComfyUI frontend, the prompts it
+// queued for them, and the object_info of the server, see testdata/README.md
+const frontendExportsDir = "../examples/testdata/frontend"
+
+// readFrontendExports returns the paths of the frontend's prompts in testdata/frontend,
+// after checking that they and their workflows were written by the frontend
+func readFrontendExports(t *testing.T) []string {
+	files, _ := filepath.Glob(filepath.Join(frontendExportsDir, "*_api.json"))
+	if len(files) == 0 {
+		t.Skipf("No frontend exports in %s, see testdata/README.md", frontendExportsDir)
+	}
+	for _, apiPath := range files {
+		var workflow struct {
+			Extra map[string]interface{} `json:"extra"`
+		}
+		data, err := os.ReadFile(strings.TrimSuffix(apiPath, "_api.json") + ".json")
+		if err != nil || json.Unmarshal(data, &workflow) != nil || workflow.Extra["frontendVersion"] == nil {
+			t.Fatalf("%s: expected a workflow saved by the frontend, with extra.frontendVersion", apiPath)
+		}
+		var prompt map[string]PromptNode
+		data, err = os.ReadFile(apiPath)
+		if err != nil || json.Unmarshal(data, &prompt) != nil || len(prompt) == 0 {
+			t.Fatalf("%s: expected a prompt exported by the frontend", apiPath)
+		}
+		for id, pn := range prompt {
+			if pn.Meta == nil || pn.Meta.Title == "" {
+				t.Fatalf("%s: node %s has no _meta title, which the frontend writes", apiPath, id)
+			}
+		}
+	}
+	return files
+}
+
+// TestFrontendGoldens tests the prompts of workflows saved by the ComfyUI frontend
+// against the prompts the frontend queued for them
+func TestFrontendGoldens(t *testing.T) {
+	files := readFrontendExports(t)
+	nodeObjects := readObjectInfo(t, filepath.Join(frontendExportsDir, "object_info.json"))
+	for _, apiPath := range files {
+		t.Run(strings.TrimSuffix(filepath.Base(apiPath), "_api.json"), func(t *testing.T) {
+			testFrontendExport(t, apiPath, nodeObjects)
+		})
+	}
+}
+
+// testFrontendExport compares the prompt of a workflow saved by the frontend with the
+// prompt the frontend queued for it, and returns the workflow's graph
+func testFrontendExport(t *testing.T, apiPath string, nodeObjects *NodeObjects) *Graph {
+	graph, missing, err := NewGraphFromJsonFile(strings.TrimSuffix(apiPath, "_api.json")+".json", nodeObjects)
+	if err != nil {
+		t.Fatalf("Failed to read workflow: %v", err)
+	}
+	if missing != nil && len(*missing) > 0 {
+		t.Fatalf("Missing node types: %v", *missing)
+	}
+	prompt, err := graph.GraphToPrompt("")
+	if err != nil {
+		t.Fatalf("Failed to generate prompt: %v", err)
+	}
+	comparePrompt(t, prompt, apiPath)
+	return graph
+}
+
+// TestSubgraphContainingItself tests that a subgraph that contains an instance of itself
+// is an error rather than endless recursion
+func TestSubgraphContainingItself(t *testing.T) {
+	data, err := os.ReadFile("../examples/testdata/subgraphs/legacy-widgets.json")
+	if err != nil {
+		t.Fatalf("Failed to read test file: %v", err)
+	}
+	var graph Graph
+	if err := json.Unmarshal(data, &graph); err != nil {
+		t.Fatalf("Failed to unmarshal graph: %v", err)
+	}
+	sg := graph.Definitions.Subgraphs[0]
+	sg.Nodes[0].Type = sg.ID
+	sg.BuildInternalMaps()
+
+	if _, err := graph.GraphToPrompt(""); err == nil || !strings.Contains(err.Error(), "itself") {
+		t.Errorf("Expected an error for the recursive subgraph, got %v", err)
+	}
+}
@@ -0,0 +1,98 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/richinsley/comfy2go/graphapi"
+)
+
+// readInput reads a request's parameters as a JSON object, and any files to upload.
+// Requests are either a JSON object, or multipart form data whose fields are named
+// by the parameter keys and whose files are for the image upload parameters.
+func (s *Server) readInput(r *http.Request, ep *endpoint) ([]byte, []upload, error) {
+	mediatype, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil && r.ContentLength != 0 {
+		return nil, nil, fmt.Errorf("invalid content type: %w", err)
+	}
+
+	switch mediatype {
+	case "", "application/json":
+		data, err := io.ReadAll(http.MaxBytesReader(nil, r.Body, s.MaxUploadSize))
+		if err != nil {
+			return nil, nil, err
+		}
+		return data, nil, nil
+	case "multipart/form-data":
+		return s.readMultipart(r, ep)
+	}
+	return nil, nil, fmt.Errorf("unsupported content type %s", mediatype)
+}
+
+func (s *Server) readMultipart(r *http.Request, ep *endpoint) ([]byte, []upload, error) {
+	if err := r.ParseMultipartForm(s.MaxUploadSize); err != nil {
+		return nil, nil, err
+	}
+
+	params := make(map[string]interface{})
+	for key, values := range r.MultipartForm.Value {
+		p, ok := ep.api.Properties[key]
+		if !ok {
+			return nil, nil, fmt.Errorf("%s: %w", key, graphapi.ErrUnknownParameter)
+		}
+		v, err := formValue(p, values[len(values)-1])
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", key, err)
+		}
+		params[key] = v
+	}
+
+	uploads := make([]upload, 0)
+	for key, files := range r.MultipartForm.File {
+		p, ok := ep.api.Properties[key]
+		if !ok || p.TypeString() != "IMAGEUPLOAD" {
+			return nil, nil, fmt.Errorf("%s is not an image upload parameter", key)
+		}
+		fh := files[len(files)-1]
+		f, err := fh.Open()
+		if err != nil {
+			return nil, nil, err
+		}
+		data, err := io.ReadAll(f)
+		f.Close()
+		if err != nil {
+			return nil, nil, err
+		}
+		uploads = append(uploads, upload{key: key, filename: fh.Filename, data: data})
+	}
+
+	if len(params) == 0 {
+		return nil, uploads, nil
+	}
+	data, err := json.Marshal(params)
+	return data, uploads, err
+}
+
+// formValue converts a form field to the JSON type of the property
+func formValue(p graphapi.Property, value string) (interface{}, error) {
+	switch p.TypeString() {
+	case "INT", "FLOAT":
+		if _, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err != nil {
+			return nil, errors.New("not a number")
+		}
+		return json.Number(strings.TrimSpace(value)), nil
+	case "BOOLEAN":
+		return strconv.ParseBool(value)
+	case "COMBO":
+		if cp, _ := p.ToComboProperty(); cp.IsBool {
+			return strconv.ParseBool(value)
+		}
+	}
+	return value, nil
+}
@@ -0,0 +1,313 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/richinsley/comfy2go/client"
+	"github.com/richinsley/comfy2go/graphapi"
+)
+
+type JobStatus string
+
+const (
+	JobQueued    JobStatus = "queued"
+	JobRunning   JobStatus = "running"
+	JobCompleted JobStatus = "completed"
+	JobFailed    JobStatus = "failed"
+)
+
+// Progress is the progress of the node that is currently executing
+type Progress struct {
+	NodeID string `json:"node_id"`
+	Title  string `json:"title"`
+	Value  int    `json:"value"`
+	Max    int    `json:"max"`
+}
+
+// Output is a file or text produced by an output node
+type Output struct {
+	NodeID    string `json:"node_id"`
+	Kind      string `json:"kind"` // the output's key, e.g. "images"
+	Filename  string `json:"filename,omitempty"`
+	Subfolder string `json:"subfolder,omitempty"`
+	Type      string `json:"type,omitempty"`
+	Text      string `json:"text,omitempty"`
+	URL       string `json:"url,omitempty"`
+}
+
+// JobError describes why a job failed.  NodeID is set when a node raised an exception.
+type JobError struct {
+	Message   string   `json:"message"`
+	NodeID    string   `json:"node_id,omitempty"`
+	NodeType  string   `json:"node_type,omitempty"`
+	Traceback []string `json:"traceback,omitempty"`
+}
+
+// Event is sent to the subscribers of a job as it runs
+type Event struct {
+	Type string      `json:"type"` // status, executing, progress, output
+	Data interface{} `json:"data"`
+}
+
+// upload is a file received with a request, uploaded when the job runs
+type upload struct {
+	key      string
+	filename string
+	data     []byte
+}
+
+// Job is a single run of a workflow
+type Job struct {
+	ID       string     `json:"id"`
+	Workflow string     `json:"workflow"`
+	Status   JobStatus  `json:"status"`
+	PromptID string     `json:"prompt_id,omitempty"`
+	Progress *Progress  `json:"progress,omitempty"`
+	Outputs  []Output   `json:"outputs"`
+	Error    *JobError  `json:"error,omitempty"`
+	Created  time.Time  `json:"created"`
+	Finished *time.Time `json:"finished,omitempty"`
+
+	mu          sync.Mutex
+	endpoint    *endpoint
+	params      []byte
+	uploads     []upload
+	client      *client.ComfyClient
+	subscribers []chan Event
+	done        chan struct{}
+}
+
+func newJob(id string, ep *endpoint, params []byte, uploads []upload) *Job {
+	return &Job{
+		ID:       id,
+		Workflow: ep.name,
+		Status:   JobQueued,
+		Outputs:  make([]Output, 0),
+		Created:  time.Now(),
+		endpoint: ep,
+		params:   params,
+		uploads:  uploads,
+		done:     make(chan struct{}),
+	}
+}
+
+// Done returns a channel that is closed when the job has completed or failed
+func (j *Job) Done() <-chan struct{} {
+	return j.done
+}
+
+// State returns a copy of the job's current state.  The fields of a running job
+// change as it runs, read them from a copy.
+func (j *Job) State() *Job {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	retv := &Job{
+		ID:       j.ID,
+		Workflow: j.Workflow,
+		Status:   j.Status,
+		PromptID: j.PromptID,
+		Outputs:  append([]Output(nil), j.Outputs...),
+		Error:    j.Error,
+		Created:  j.Created,
+		Finished: j.Finished,
+	}
+	if j.Progress != nil {
+		p := *j.Progress
+		retv.Progress = &p
+	}
+	return retv
+}
+
+// subscribe returns a channel that receives the job's events.  The channel is
+// closed when the job finishes.
+func (j *Job) subscribe() chan Event {
+	ch := make(chan Event, 64)
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	select {
+	case <-j.done:
+		close(ch)
+	default:
+		j.subscribers = append(j.subscribers, ch)
+	}
+	return ch
+}
+
+func (j *Job) unsubscribe(ch chan Event) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for i, s := range j.subscribers {
+		if s == ch {
+			j.subscribers = append(j.subscribers[:i], j.subscribers[i+1:]...)
+			close(ch)
+			return
+		}
+	}
+}
+
+// publish sends an event to the subscribers.  j.mu must be held.  Slow subscribers
+// miss events rather than stalling the job.
+func (j *Job) publish(e Event) {
+	for _, ch := range j.subscribers {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+func (j *Job) setStatus(status JobStatus) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.Status = status
+	j.publish(Event{Type: "status", Data: status})
+}
+
+func (j *Job) finish(jerr *JobError) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	now := time.Now()
+	j.Finished = &now
+	j.Progress = nil
+	if jerr != nil {
+		j.Status = JobFailed
+		j.Error = jerr
+	} else {
+		j.Status = JobCompleted
+	}
+	j.publish(Event{Type: "status", Data: j.Status})
+	for _, ch := range j.subscribers {
+		close(ch)
+	}
+	j.subscribers = nil
+	close(j.done)
+}
+
+// uploadName returns the name a file received by a job is uploaded as, the job's ID
+// followed by the base of the file's name without characters other than letters,
+// digits, '.', '-' and '_'
+func uploadName(jobID string, filename string) string {
+	base := path.Base(strings.ReplaceAll(filename, "\\", "/"))
+	base = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+			return r
+		}
+		return '_'
+	}, base)
+	base = strings.TrimLeft(base, ".")
+	if base == "" {
+		base = "upload"
+	}
+	return jobID + "-" + base
+}
+
+// run executes the job on a client, blocking until it finishes
+func (j *Job) run(c *client.ComfyClient) {
+	j.mu.Lock()
+	j.client = c
+	j.mu.Unlock()
+	j.setStatus(JobRunning)
+
+	graph, api, err := j.endpoint.newGraph(c)
+	if err != nil {
+		j.finish(&JobError{Message: err.Error()})
+		return
+	}
+
+	for _, u := range j.uploads {
+		var target *graphapi.ImageUploadProperty
+		if p, ok := api.Properties[u.key]; ok {
+			target, _ = p.ToImageUploadProperty()
+		}
+		if target == nil {
+			j.finish(&JobError{Message: fmt.Sprintf("%s is not an image upload", u.key)})
+			return
+		}
+		// each job's uploads have their own names, so that jobs cannot overwrite the inputs
+		// of others, or files that are already in the input folder
+		if _, err := c.UploadFileFromReader(bytes.NewReader(u.data), uploadName(j.ID, u.filename), false, client.InputImageType, "", target); err != nil {
+			j.finish(&JobError{Message: fmt.Sprintf("uploading %s: %v", u.filename, err)})
+			return
+		}
+	}
+
+	if len(j.params) != 0 {
+		if err := api.ApplyJSON(j.params); err != nil {
+			j.finish(&JobError{Message: err.Error()})
+			return
+		}
+	}
+
+	item, err := c.QueuePromptStrict(graph)
+	if err != nil {
+		j.finish(&JobError{Message: err.Error()})
+		return
+	}
+	j.mu.Lock()
+	j.PromptID = item.PromptID
+	j.mu.Unlock()
+
+	var jerr *JobError
+	err = item.ProcessMessages(&client.MessageHandlers{
+		OnExecuting: func(msg *client.PromptMessageExecuting) {
+			j.mu.Lock()
+			defer j.mu.Unlock()
+			j.Progress = &Progress{NodeID: msg.NodeID, Title: msg.Title}
+			j.publish(Event{Type: "executing", Data: *j.Progress})
+		},
+		OnProgress: func(msg *client.PromptMessageProgress) {
+			j.mu.Lock()
+			defer j.mu.Unlock()
+			if j.Progress == nil {
+				j.Progress = &Progress{}
+			}
+			j.Progress.Value = msg.Value
+			j.Progress.Max = msg.Max
+			j.publish(Event{Type: "progress", Data: *j.Progress})
+		},
+		OnData: func(msg *client.PromptMessageData) {
+			j.mu.Lock()
+			defer j.mu.Unlock()
+			for kind, outputs := range msg.Data {
+				for _, o := range outputs {
+					out := Output{
+						NodeID:    msg.NodeID,
+						Kind:      kind,
+						Filename:  o.Filename,
+						Subfolder: o.Subfolder,
+						Type:      o.Type,
+						Text:      o.Text,
+					}
+					if o.Filename != "" {
+						out.URL = fmt.Sprintf("/jobs/%s/outputs/%d", j.ID, len(j.Outputs))
+					}
+					j.Outputs = append(j.Outputs, out)
+					j.publish(Event{Type: "output", Data: out})
+				}
+			}
+		},
+		OnError: func(e *client.PromptMessageStoppedException) {
+			jerr = &JobError{
+				Message:   e.ExceptionMessage,
+				NodeID:    e.NodeID,
+				NodeType:  e.NodeType,
+				Traceback: e.Traceback,
+			}
+		},
+	})
+	item.Close()
+	if err != nil && jerr == nil {
+		jerr = &JobError{Message: err.Error()}
+	}
+	if jerr != nil {
+		slog.Warn("job failed", "job", j.ID, "workflow", j.Workflow, "error", jerr.Message)
+	}
+	j.finish(jerr)
+}
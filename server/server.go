@@ -0,0 +1,451 @@
+// Package server mounts workflows as HTTP endpoints.  Each endpoint exposes the
+// properties of a workflow's simple API, runs the workflow on a ComfyClient and
+// returns its outputs, either synchronously or as a job that can be polled or
+// streamed with server-sent events.
+//
+//	GET  /workflows                  list the mounted workflows
+//	GET  /workflows/{name}           the JSON Schema of a workflow's parameters
+//	POST /workflows/{name}           run a workflow, add ?async=true to return a job
+//	GET  /jobs/{id}                  a job's status and outputs
+//	GET  /jobs/{id}/events           a job's progress as server-sent events
+//	GET  /jobs/{id}/outputs/{index}  the content of an output file
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/richinsley/comfy2go/client"
+	"github.com/richinsley/comfy2go/graphapi"
+)
+
+// ErrServerClosed is returned by Submit after the server was closed
+var ErrServerClosed = errors.New("server closed")
+
+// Server runs jobs for its endpoints on a pool of clients.  A ComfyClient does not
+// separate the messages of prompts queued concurrently, so each client runs one job
+// at a time.
+type Server struct {
+	// APIGroup is the title of the group whose nodes are exposed, "API" when empty
+	APIGroup string
+	// JobTTL is how long finished jobs are kept for polling
+	JobTTL time.Duration
+	// MaxUploadSize limits the size of multipart request bodies
+	MaxUploadSize int64
+
+	clients   []*client.ComfyClient
+	endpoints map[string]*endpoint
+	jobs      map[string]*Job
+	queue     chan *Job
+	mu        sync.Mutex
+	startOnce sync.Once
+	stopOnce  sync.Once
+	stop      chan struct{}
+	closed    bool
+}
+
+// endpoint is a mounted workflow
+type endpoint struct {
+	name     string
+	workflow string
+	group    string
+	// template is used to describe and validate parameters, jobs run on a fresh graph
+	template *graphapi.Graph
+	api      *graphapi.SimpleAPIV2
+	schema   json.RawMessage
+}
+
+// NewServer creates a server that runs jobs on the given clients
+func NewServer(clients ...*client.ComfyClient) *Server {
+	return &Server{
+		JobTTL:        time.Hour,
+		MaxUploadSize: 64 << 20,
+		clients:       clients,
+		endpoints:     make(map[string]*endpoint),
+		jobs:          make(map[string]*Job),
+		queue:         make(chan *Job, 1024),
+		stop:          make(chan struct{}),
+	}
+}
+
+// AddWorkflow mounts a workflow's JSON under the given name
+func (s *Server) AddWorkflow(name string, workflow string) error {
+	if len(s.clients) == 0 {
+		return errors.New("server has no clients")
+	}
+	if name == "" || strings.Contains(name, "/") {
+		return fmt.Errorf("invalid workflow name %q", name)
+	}
+
+	ep := &endpoint{name: name, workflow: workflow, group: s.APIGroup}
+	if ep.group == "" {
+		ep.group = "API"
+	}
+	graph, api, err := ep.newGraph(s.clients[0])
+	if err != nil {
+		return fmt.Errorf("workflow %s: %w", name, err)
+	}
+	if err := api.ConflictError(); err != nil {
+		slog.Warn("workflow has conflicting parameters", "workflow", name, "error", err)
+	}
+	schema, err := api.JSONSchema()
+	if err != nil {
+		return err
+	}
+	ep.template = graph
+	ep.api = api
+	ep.schema = schema
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.endpoints[name]; exists {
+		return fmt.Errorf("workflow %s is already mounted", name)
+	}
+	s.endpoints[name] = ep
+	return nil
+}
+
+// AddWorkflowFile mounts a workflow JSON file under the given name
+func (s *Server) AddWorkflowFile(name string, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return s.AddWorkflow(name, string(data))
+}
+
+// newGraph creates a graph from the endpoint's workflow, and its simple API
+func (ep *endpoint) newGraph(c *client.ComfyClient) (*graphapi.Graph, *graphapi.SimpleAPIV2, error) {
+	graph, missing, err := c.NewGraphFromJsonString(ep.workflow)
+	if err != nil {
+		if missing != nil && len(*missing) != 0 {
+			return nil, nil, fmt.Errorf("%w: %s", err, strings.Join(*missing, ", "))
+		}
+		return nil, nil, err
+	}
+	api := graph.GetSimpleAPIV2(&ep.group)
+	if api == nil {
+		return nil, nil, fmt.Errorf("workflow has no %q group", ep.group)
+	}
+	return graph, api, nil
+}
+
+// Start starts a worker for each client.  It is called by Handler and ListenAndServe.
+func (s *Server) Start() {
+	s.startOnce.Do(func() {
+		for _, c := range s.clients {
+			go s.worker(c)
+		}
+	})
+}
+
+// Close stops the workers once their current jobs finish, and fails the jobs that
+// have not started.  Jobs submitted after Close fail with ErrServerClosed.  It can be
+// called more than once.
+func (s *Server) Close() {
+	s.stopOnce.Do(func() {
+		s.mu.Lock()
+		s.closed = true
+		s.mu.Unlock()
+		close(s.stop)
+		s.failQueued()
+	})
+}
+
+// failQueued fails the jobs that are waiting for a worker
+func (s *Server) failQueued() {
+	for {
+		select {
+		case job := <-s.queue:
+			job.finish(&JobError{Message: ErrServerClosed.Error()})
+		default:
+			return
+		}
+	}
+}
+
+func (s *Server) worker(c *client.ComfyClient) {
+	for {
+		select {
+		case <-s.stop:
+			return
+		case job := <-s.queue:
+			job.run(c)
+		}
+	}
+}
+
+// Submit queues a run of a mounted workflow with a JSON object of parameters
+func (s *Server) Submit(name string, params []byte) (*Job, error) {
+	s.mu.Lock()
+	ep, ok := s.endpoints[name]
+	s.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("no workflow named %s", name)
+	}
+	if len(params) != 0 {
+		if err := ep.api.ValidateJSON(params); err != nil {
+			return nil, err
+		}
+	}
+	return s.submit(ep, params, nil)
+}
+
+func (s *Server) submit(ep *endpoint, params []byte, uploads []upload) (*Job, error) {
+	s.Start()
+	job := newJob(uuid.New().String(), ep, params, uploads)
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil, ErrServerClosed
+	}
+	s.removeExpiredJobs()
+	s.jobs[job.ID] = job
+	s.mu.Unlock()
+
+	s.queue <- job
+	// a job queued while the server closed is not run by a worker
+	select {
+	case <-s.stop:
+		s.failQueued()
+	default:
+	}
+	return job, nil
+}
+
+// removeExpiredJobs forgets jobs that finished more than JobTTL ago.  s.mu must be held.
+func (s *Server) removeExpiredJobs() {
+	for id, j := range s.jobs {
+		select {
+		case <-j.done:
+			if f := j.State().Finished; f != nil && time.Since(*f) > s.JobTTL {
+				delete(s.jobs, id)
+			}
+		default:
+		}
+	}
+}
+
+// GetJob returns a job by its ID
+func (s *Server) GetJob(id string) *Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.jobs[id]
+}
+
+// Handler returns the server's HTTP handler
+func (s *Server) Handler() http.Handler {
+	s.Start()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/workflows", s.handleWorkflows)
+	mux.HandleFunc("/workflows/", s.handleWorkflow)
+	mux.HandleFunc("/jobs/", s.handleJob)
+	return mux
+}
+
+// ListenAndServe serves the endpoints on the given address
+func (s *Server) ListenAndServe(addr string) error {
+	return http.ListenAndServe(addr, s.Handler())
+}
+
+func (s *Server) handleWorkflows(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+	s.mu.Lock()
+	names := make([]string, 0, len(s.endpoints))
+	for name := range s.endpoints {
+		names = append(names, name)
+	}
+	s.mu.Unlock()
+	sort.Strings(names)
+	writeJSON(w, http.StatusOK, map[string]interface{}{"workflows": names})
+}
+
+func (s *Server) handleWorkflow(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/workflows/")
+	s.mu.Lock()
+	ep, ok := s.endpoints[name]
+	s.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no workflow named %s", name))
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"name":    ep.name,
+			"schema":  ep.schema,
+			"outputs": describeOutputs(ep.api),
+		})
+	case http.MethodPost:
+		s.handleRun(w, r, ep)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+	}
+}
+
+func describeOutputs(api *graphapi.SimpleAPIV2) []map[string]interface{} {
+	retv := make([]map[string]interface{}, 0, len(api.Outputs))
+	for _, o := range api.Outputs {
+		retv = append(retv, map[string]interface{}{"name": o.Key, "node": o.Path, "types": o.Types})
+	}
+	return retv
+}
+
+func (s *Server) handleRun(w http.ResponseWriter, r *http.Request, ep *endpoint) {
+	params, uploads, err := s.readInput(r, ep)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if len(params) != 0 {
+		if err := ep.api.ValidateJSON(params); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	job, err := s.submit(ep, params, uploads)
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+	if async, _ := strconv.ParseBool(r.URL.Query().Get("async")); async {
+		w.Header().Set("Location", "/jobs/"+job.ID)
+		writeJSON(w, http.StatusAccepted, map[string]interface{}{
+			"id":         job.ID,
+			"status_url": "/jobs/" + job.ID,
+			"events_url": "/jobs/" + job.ID + "/events",
+		})
+		return
+	}
+
+	select {
+	case <-job.Done():
+	case <-r.Context().Done():
+		// the job keeps running and can still be polled
+		return
+	}
+	writeJobResult(w, job.State())
+}
+
+func writeJobResult(w http.ResponseWriter, job *Job) {
+	status := http.StatusOK
+	if job.Status == JobFailed {
+		status = http.StatusInternalServerError
+	}
+	writeJSON(w, status, job)
+}
+
+func (s *Server) handleJob(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/jobs/"), "/")
+	job := s.GetJob(parts[0])
+	if job == nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no job with id %s", parts[0]))
+		return
+	}
+
+	switch {
+	case len(parts) == 1:
+		writeJSON(w, http.StatusOK, job.State())
+	case len(parts) == 2 && parts[1] == "events":
+		s.handleEvents(w, r, job)
+	case len(parts) == 3 && parts[1] == "outputs":
+		s.handleOutput(w, job, parts[2])
+	default:
+		writeError(w, http.StatusNotFound, fmt.Errorf("not found: %s", r.URL.Path))
+	}
+}
+
+// handleEvents streams a job's events until it finishes, ending with its final state
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request, job *Job) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, errors.New("streaming is not supported"))
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	events := job.subscribe()
+	defer job.unsubscribe(events)
+
+	writeEvent(w, Event{Type: "status", Data: job.State().Status})
+	flusher.Flush()
+	for {
+		select {
+		case e, ok := <-events:
+			if !ok {
+				writeEvent(w, Event{Type: "done", Data: job.State()})
+				flusher.Flush()
+				return
+			}
+			writeEvent(w, e)
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, e Event) {
+	data, err := json.Marshal(e.Data)
+	if err != nil {
+		slog.Error("error marshalling event", "error", err)
+		return
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, data)
+}
+
+func (s *Server) handleOutput(w http.ResponseWriter, job *Job, index string) {
+	i, err := strconv.Atoi(index)
+	snap := job.State()
+	if err != nil || i < 0 || i >= len(snap.Outputs) || snap.Outputs[i].Filename == "" {
+		writeError(w, http.StatusNotFound, fmt.Errorf("job %s has no output %s", job.ID, index))
+		return
+	}
+	job.mu.Lock()
+	c := job.client
+	job.mu.Unlock()
+
+	o := snap.Outputs[i]
+	data, err := c.GetImage(client.DataOutput{Filename: o.Filename, Subfolder: o.Subfolder, Type: o.Type})
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+	w.Header().Set("Content-Type", http.DetectContentType(*data))
+	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=%q", o.Filename))
+	w.Write(*data)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("error writing response", "error", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]interface{}{"error": err.Error()})
+}
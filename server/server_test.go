@@ -0,0 +1,364 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/richinsley/comfy2go/client"
+)
+
+const testObjectInfo = `{
+	"EmptyLatentImage": {
+		"input": {"required": {
+			"width": ["INT", {"default": 512, "min": 16, "max": 4096, "step": 8}],
+			"height": ["INT", {"default": 512, "min": 16, "max": 4096, "step": 8}]
+		}},
+		"output": ["LATENT"], "name": "EmptyLatentImage", "display_name": "Empty Latent Image"
+	},
+	"LoadImage": {
+		"input": {"required": {"image": [["example.png"], {"image_upload": true}]}},
+		"output": ["IMAGE", "MASK"], "name": "LoadImage", "display_name": "Load Image"
+	},
+	"SaveImage": {
+		"input": {"required": {"images": ["IMAGE"], "filename_prefix": ["STRING", {"default": "ComfyUI"}]}},
+		"output": [], "name": "SaveImage", "display_name": "Save Image", "output_node": true
+	}
+}`
+
+const testWorkflow = `{
+	"nodes": [
+		{"id": 1, "type": "EmptyLatentImage", "title": "Size", "pos": [0, 0], "size": [300, 100], "order": 0, "mode": 0,
+		 "outputs": [{"name": "LATENT", "type": "LATENT", "links": []}], "properties": {}, "widgets_values": [512, 512]},
+		{"id": 2, "type": "LoadImage", "title": "Input", "pos": [0, 200], "size": [300, 100], "order": 1, "mode": 0,
+		 "outputs": [{"name": "IMAGE", "type": "IMAGE", "links": [1]}, {"name": "MASK", "type": "MASK", "links": []}], "properties": {}, "widgets_values": ["example.png", "image"]},
+		{"id": 3, "type": "SaveImage", "pos": [400, 200], "size": [300, 100], "order": 2, "mode": 0,
+		 "inputs": [{"name": "images", "type": "IMAGE", "link": 1}], "properties": {}, "widgets_values": ["ComfyUI"]}
+	],
+	"links": [[1, 2, 0, 3, 0, "IMAGE"]],
+	"groups": [{"title": "API", "bounding": [-50, -50, 1000, 600], "color": "#3f789e"}],
+	"last_node_id": 3,
+	"last_link_id": 1,
+	"version": 0.4
+}`
+
+// fakeComfy is a ComfyUI server that runs every prompt successfully, or fails it
+// at node 3 when fail is set
+type fakeComfy struct {
+	*httptest.Server
+	fail     bool
+	mu       sync.Mutex
+	prompts  []map[string]interface{}
+	uploads  []string
+	promptCh chan string
+}
+
+func newFakeComfy(t *testing.T) *fakeComfy {
+	f := &fakeComfy{promptCh: make(chan string, 1)}
+	upgrader := websocket.Upgrader{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/object_info", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, testObjectInfo)
+	})
+	mux.HandleFunc("/upload/image", func(w http.ResponseWriter, r *http.Request) {
+		_, fh, err := r.FormFile("image")
+		if err != nil {
+			t.Errorf("Bad upload: %v", err)
+			return
+		}
+		f.mu.Lock()
+		f.uploads = append(f.uploads, fh.Filename)
+		f.mu.Unlock()
+		fmt.Fprintf(w, `{"name": %q, "subfolder": "", "type": "input"}`, fh.Filename)
+	})
+	mux.HandleFunc("/prompt", func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		f.mu.Lock()
+		f.prompts = append(f.prompts, body)
+		id := fmt.Sprintf("prompt-%d", len(f.prompts))
+		f.mu.Unlock()
+		fmt.Fprintf(w, `{"prompt_id": %q, "number": 1, "node_errors": {}}`, id)
+		f.promptCh <- id
+	})
+	mux.HandleFunc("/view", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "image:"+r.URL.Query().Get("filename"))
+	})
+	mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		id := <-f.promptCh
+		send := func(msg string) { conn.WriteMessage(websocket.TextMessage, []byte(msg)) }
+		send(fmt.Sprintf(`{"type": "execution_start", "data": {"prompt_id": %q}}`, id))
+		send(fmt.Sprintf(`{"type": "executing", "data": {"node": "3", "prompt_id": %q}}`, id))
+		send(`{"type": "progress", "data": {"value": 1, "max": 2}}`)
+		if f.fail {
+			send(fmt.Sprintf(`{"type": "execution_error", "data": {"prompt_id": %q, "node_id": "3", "node_type": "SaveImage", "exception_message": "out of memory", "exception_type": "RuntimeError", "traceback": []}}`, id))
+		} else {
+			send(fmt.Sprintf(`{"type": "executed", "data": {"node": "3", "output": {"images": [{"filename": "out.png", "subfolder": "", "type": "output"}]}, "prompt_id": %q}}`, id))
+			send(fmt.Sprintf(`{"type": "executing", "data": {"node": null, "prompt_id": %q}}`, id))
+		}
+		// wait for the client to hang up
+		conn.ReadMessage()
+	})
+	f.Server = httptest.NewServer(mux)
+	t.Cleanup(f.Close)
+	return f
+}
+
+func newTestServer(t *testing.T, fake *fakeComfy) *httptest.Server {
+	addr := strings.TrimPrefix(fake.URL, "http://")
+	host, portStr, _ := strings.Cut(addr, ":")
+	port, _ := strconv.Atoi(portStr)
+	c := client.NewComfyClient(host, port, nil)
+	if err := c.Init(); err != nil {
+		t.Fatalf("Failed to initialize client: %v", err)
+	}
+
+	srv := NewServer(c)
+	if err := srv.AddWorkflow("latent", testWorkflow); err != nil {
+		t.Fatalf("Failed to add workflow: %v", err)
+	}
+	ts := httptest.NewServer(srv.Handler())
+	t.Cleanup(func() {
+		ts.Close()
+		srv.Close()
+	})
+	return ts
+}
+
+// TestWorkflowSchema tests listing workflows and describing their parameters
+func TestWorkflowSchema(t *testing.T) {
+	ts := newTestServer(t, newFakeComfy(t))
+
+	resp, err := http.Get(ts.URL + "/workflows/latent")
+	if err != nil {
+		t.Fatalf("Failed to get workflow: %v", err)
+	}
+	defer resp.Body.Close()
+	var desc struct {
+		Schema struct {
+			Properties map[string]map[string]interface{} `json:"properties"`
+		} `json:"schema"`
+		Outputs []struct {
+			Name  string   `json:"name"`
+			Types []string `json:"types"`
+		} `json:"outputs"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&desc); err != nil {
+		t.Fatalf("Failed to decode description: %v", err)
+	}
+	if _, ok := desc.Schema.Properties["Size.width"]; !ok {
+		t.Errorf("Expected Size.width parameter, got %v", desc.Schema.Properties)
+	}
+	if upload := desc.Schema.Properties["Input.file"]; upload["format"] != "binary" {
+		t.Errorf("Expected Input.file to be a binary upload, got %v", upload)
+	}
+	if len(desc.Outputs) != 1 || desc.Outputs[0].Types[0] != "IMAGE" {
+		t.Errorf("Expected an IMAGE output, got %+v", desc.Outputs)
+	}
+
+	resp, err = http.Post(ts.URL+"/workflows/latent", "application/json", strings.NewReader(`{"Size.width": 1}`))
+	if err != nil {
+		t.Fatalf("Failed to post: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected out of range width to be rejected, got %d", resp.StatusCode)
+	}
+}
+
+// TestRunSynchronous tests running a workflow and waiting for its outputs
+func TestRunSynchronous(t *testing.T) {
+	fake := newFakeComfy(t)
+	ts := newTestServer(t, fake)
+
+	resp, err := http.Post(ts.URL+"/workflows/latent", "application/json", strings.NewReader(`{"Size.width": 1024}`))
+	if err != nil {
+		t.Fatalf("Failed to post: %v", err)
+	}
+	defer resp.Body.Close()
+	var job Job
+	json.NewDecoder(resp.Body).Decode(&job)
+	if resp.StatusCode != http.StatusOK || job.Status != JobCompleted {
+		t.Fatalf("Expected completed job, got %d %+v", resp.StatusCode, &job)
+	}
+	if len(job.Outputs) != 1 || job.Outputs[0].Filename != "out.png" {
+		t.Fatalf("Expected out.png output, got %+v", job.Outputs)
+	}
+
+	prompt := fake.prompts[0]["prompt"].(map[string]interface{})
+	width := prompt["1"].(map[string]interface{})["inputs"].(map[string]interface{})["width"]
+	if width != float64(1024) {
+		t.Errorf("Expected width 1024 to be queued, got %v", width)
+	}
+
+	out, err := http.Get(ts.URL + job.Outputs[0].URL)
+	if err != nil {
+		t.Fatalf("Failed to get output: %v", err)
+	}
+	data, _ := io.ReadAll(out.Body)
+	out.Body.Close()
+	if string(data) != "image:out.png" {
+		t.Errorf("Expected output content, got %q", data)
+	}
+}
+
+// TestRunMultipartAsync tests uploading an image, then streaming the job's events
+func TestRunMultipartAsync(t *testing.T) {
+	fake := newFakeComfy(t)
+	ts := newTestServer(t, fake)
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("Size.height", "768")
+	fw, _ := mw.CreateFormFile("Input.file", "cat.png")
+	fw.Write([]byte("png data"))
+	mw.Close()
+
+	resp, err := http.Post(ts.URL+"/workflows/latent?async=true", mw.FormDataContentType(), &body)
+	if err != nil {
+		t.Fatalf("Failed to post: %v", err)
+	}
+	var accepted struct {
+		ID        string `json:"id"`
+		EventsURL string `json:"events_url"`
+	}
+	json.NewDecoder(resp.Body).Decode(&accepted)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("Expected 202, got %d", resp.StatusCode)
+	}
+
+	events, err := http.Get(ts.URL + accepted.EventsURL)
+	if err != nil {
+		t.Fatalf("Failed to get events: %v", err)
+	}
+	defer events.Body.Close()
+	var last string
+	scanner := bufio.NewScanner(events.Body)
+	for scanner.Scan() {
+		if strings.HasPrefix(scanner.Text(), "event: ") {
+			last = strings.TrimPrefix(scanner.Text(), "event: ")
+		}
+	}
+	if last != "done" {
+		t.Errorf("Expected the stream to end with a done event, got %q", last)
+	}
+
+	resp, err = http.Get(ts.URL + "/jobs/" + accepted.ID)
+	if err != nil {
+		t.Fatalf("Failed to get job: %v", err)
+	}
+	var job Job
+	json.NewDecoder(resp.Body).Decode(&job)
+	resp.Body.Close()
+	if job.Status != JobCompleted {
+		t.Errorf("Expected completed job, got %+v", &job)
+	}
+	name := accepted.ID + "-cat.png"
+	if len(fake.uploads) != 1 || fake.uploads[0] != name {
+		t.Errorf("Expected %s to be uploaded, got %v", name, fake.uploads)
+	}
+	inputs := fake.prompts[0]["prompt"].(map[string]interface{})["2"].(map[string]interface{})["inputs"].(map[string]interface{})
+	if inputs["image"] != name {
+		t.Errorf("Expected the upload to be queued, got %v", inputs["image"])
+	}
+}
+
+// TestRunNodeError tests that a node's exception is reported
+func TestRunNodeError(t *testing.T) {
+	fake := newFakeComfy(t)
+	fake.fail = true
+	ts := newTestServer(t, fake)
+
+	resp, err := http.Post(ts.URL+"/workflows/latent", "application/json", nil)
+	if err != nil {
+		t.Fatalf("Failed to post: %v", err)
+	}
+	defer resp.Body.Close()
+	var job Job
+	json.NewDecoder(resp.Body).Decode(&job)
+	if resp.StatusCode != http.StatusInternalServerError || job.Error == nil || job.Error.NodeID != "3" {
+		t.Errorf("Expected a failure at node 3, got %d %+v", resp.StatusCode, job.Error)
+	}
+}
+
+// TestUploadName tests that uploads are named by their job, without the client's path
+func TestUploadName(t *testing.T) {
+	for filename, want := range map[string]string{
+		"cat.png":             "job-cat.png",
+		"../../models/x.ckpt": "job-x.ckpt",
+		`C:\images\dog 1.png`: "job-dog_1.png",
+		"..":                  "job-upload",
+		".hidden":             "job-hidden",
+	} {
+		if got := uploadName("job", filename); got != want {
+			t.Errorf("Expected %s for %q, got %s", want, filename, got)
+		}
+	}
+}
+
+// TestCloseTwice tests that a server can be closed more than once
+func TestCloseTwice(t *testing.T) {
+	s := NewServer()
+	s.Close()
+	s.Close()
+}
+
+// TestClosedServer tests that jobs waiting for a worker fail when the server is
+// closed, and that no jobs are accepted after it
+func TestClosedServer(t *testing.T) {
+	fake := newFakeComfy(t)
+	host, portStr, _ := strings.Cut(strings.TrimPrefix(fake.URL, "http://"), ":")
+	port, _ := strconv.Atoi(portStr)
+	srv := NewServer(client.NewComfyClient(host, port, nil))
+	if err := srv.AddWorkflow("latent", testWorkflow); err != nil {
+		t.Fatalf("Failed to add workflow: %v", err)
+	}
+	// no workers are started, so the job stays queued
+	srv.startOnce.Do(func() {})
+	job, err := srv.Submit("latent", nil)
+	if err != nil {
+		t.Fatalf("Failed to submit: %v", err)
+	}
+
+	srv.Close()
+	select {
+	case <-job.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected the queued job to finish when the server closed")
+	}
+	if state := job.State(); state.Status != JobFailed || state.Error == nil || state.Error.Message != ErrServerClosed.Error() {
+		t.Errorf("Expected the queued job to fail, got %+v", state)
+	}
+
+	if _, err := srv.Submit("latent", nil); !errors.Is(err, ErrServerClosed) {
+		t.Errorf("Expected %v, got %v", ErrServerClosed, err)
+	}
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+	resp, err := http.Post(ts.URL+"/workflows/latent", "application/json", strings.NewReader(`{}`))
+	if err != nil {
+		t.Fatalf("Failed to post: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503, got %d", resp.StatusCode)
+	}
+}